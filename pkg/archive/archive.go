@@ -3,7 +3,6 @@ package archive
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"path"
 	"path/filepath"
@@ -11,13 +10,72 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/SeerUK/foldup/pkg/logging"
 )
 
+// FilesSuffix is appended to the base name of a directory to name archives made by Filesf.
+const FilesSuffix = "-files"
+
 // For testing; we can replace these with versions that intercept calls as we need.
 var create = os.Create
 var open = os.Open
 var readDir = ioutil.ReadDir
 var stat = os.Stat
+var timeNow = time.Now
+
+// Result describes an archive that has been produced from a directory.
+type Result struct {
+	// Dirname is the directory that was archived.
+	Dirname string
+	// Filename is the name of the archive file that was produced.
+	Filename string
+	// Files is the number of files added to the archive.
+	Files int
+	// Bytes is the total size of the files added to the archive, before compression.
+	Bytes int64
+	// Size is the size of the archive file itself.
+	Size int64
+	// Duration is how long it took to produce the archive.
+	Duration time.Duration
+}
+
+// byFilename sorts Results by their archive filename.
+type byFilename []Result
+
+func (r byFilename) Len() int           { return len(r) }
+func (r byFilename) Less(i, j int) bool { return r[i].Filename < r[j].Filename }
+func (r byFilename) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// Dir is a directory to archive, along with the name to give its archive.
+type Dir struct {
+	// Path is the path to the directory.
+	Path string
+	// Name replaces the base name of the directory in the archive's name, if it's set.
+	Name string
+	// Excludes are patterns of files to leave out of this directory's archive, as well as those
+	// given for every directory.
+	Excludes []string
+}
+
+// name returns the name to give the directory's archive.
+func (d Dir) name() string {
+	if d.Name != "" {
+		return d.Name
+	}
+
+	return path.Base(d.Path)
+}
+
+// excludes returns the patterns of files to leave out of the directory's archive, given those to
+// leave out of every archive.
+func (d Dir) excludes(excludes []string) []string {
+	if len(d.Excludes) == 0 {
+		return excludes
+	}
+
+	return append(append([]string{}, excludes...), d.Excludes...)
+}
 
 // Dirsf takes an array of directory paths as strings, a formatting string for the file names, and a
 // FormatName to identify the type of archive to produce; and produces archives for each of the
@@ -30,14 +88,34 @@ var stat = os.Stat
 // The `namefmt` needs to have a single `%s` and a single `%d` in it, for both the base dirname and
 // the current unix timestamp, e.g. `"backup-%s-%d"`.
 //
-// Upon success, an array of the archive filenames will be returned.
-func Dirsf(dirnames []string, nameFmt string, formatName FormatName) ([]string, error) {
+// Any files or directories matching one of the `excludes` patterns are left out of the archives,
+// see Excluded. Progress is written to the given logger.
+//
+// Upon success, an array of Results describing each archive will be returned, sorted by filename.
+func Dirsf(logger logging.Logger, dirnames []string, nameFmt string, formatName FormatName, excludes ...string) ([]Result, error) {
+	dirs := []Dir{}
+	for _, dirname := range dirnames {
+		dirs = append(dirs, Dir{Path: dirname})
+	}
+
+	return NamedDirsf(logger, dirs, nameFmt, formatName, excludes...)
+}
+
+// NamedDirsf works like Dirsf, but each archive is named using the Name of its Dir, rather than
+// the base name of the directory, e.g. so that directories with the same base name can be told
+// apart.
+func NamedDirsf(logger logging.Logger, dirs []Dir, nameFmt string, formatName FormatName, excludes ...string) ([]Result, error) {
+	// With nothing to archive, there would be nothing to wait for below.
+	if len(dirs) == 0 {
+		return []Result{}, nil
+	}
+
 	// Cores is the number of logical CPU cores the Go runtime has available to it.
 	cores := runtime.GOMAXPROCS(0)
 
 	limChan := make(chan bool, cores)
-	errChan := make(chan error, len(dirnames))
-	resChan := make(chan string, len(dirnames))
+	errChan := make(chan error, len(dirs))
+	resChan := make(chan Result, len(dirs))
 
 	// Prepare the limiter. We fill the channel with as many values as we want archives to be
 	// created concurrently; for now, this is the number of logical CPU cores available.
@@ -45,44 +123,51 @@ func Dirsf(dirnames []string, nameFmt string, formatName FormatName) ([]string,
 		limChan <- true
 	}
 
-	for i, dirname := range dirnames {
+	for i, dir := range dirs {
 		<-limChan
 
-		go func(i int, dirname string) {
-			log.Printf("Started archiving directory '%s'...", dirname)
+		go func(i int, dir Dir) {
+			folderLogger := logger.With(logging.Folder(dir.name()))
+			folderLogger.Info("Started archiving directory")
 
-			res, err := Dirf(dirname, nameFmt, formatName)
+			res, err := dirf(dir.Path, dir.name(), nameFmt, formatName, false, dir.excludes(excludes))
 			if err != nil {
+				folderLogger.Error("Failed archiving directory", logging.Err(err))
 				errChan <- err
 			} else {
+				folderLogger.Info(
+					"Finished archiving directory",
+					logging.Archive(res.Filename),
+					logging.F("files", res.Files),
+					logging.Bytes(res.Size),
+					logging.Duration(res.Duration),
+				)
 				resChan <- res
 			}
 
-			log.Printf("Finished archiving directory '%s'...", dirname)
-
 			// Release use of limiter
 			limChan <- true
-		}(i, dirname)
+		}(i, dir)
 	}
 
-	filenames := []string{}
+	results := []Result{}
 
 	for {
 		select {
 		case err := <-errChan:
-			return []string{}, err
+			return []Result{}, err
 		case res := <-resChan:
-			filenames = append(filenames, res)
+			results = append(results, res)
 		}
 
-		if len(dirnames) == len(filenames) {
+		if len(dirs) == len(results) {
 			break
 		}
 	}
 
-	sort.Strings(filenames)
+	sort.Sort(byFilename(results))
 
-	return filenames, nil
+	return results, nil
 }
 
 // Dirf archives a given source directory, and creates an archive with a name in the given format,
@@ -95,47 +180,142 @@ func Dirsf(dirnames []string, nameFmt string, formatName FormatName) ([]string,
 // The `namefmt` needs to have a single `%s` and a single `%c` in it, for both the base dirname and
 // the current unix timestamp, e.g. `"backup-%s-%c"`.
 //
-// Upon success, the archive filename will be returned.
-func Dirf(dirname string, nameFmt string, formatName FormatName) (string, error) {
+// Any files or directories matching one of the `excludes` patterns are left out of the archive, see
+// Excluded.
+//
+// Upon success, a Result describing the archive will be returned.
+func Dirf(dirname string, nameFmt string, formatName FormatName, excludes ...string) (Result, error) {
+	return dirf(dirname, path.Base(dirname), nameFmt, formatName, false, excludes)
+}
+
+// Filesf archives only the files directly in the given directory, leaving out its subdirectories,
+// e.g. so that files at the top of a directory whose folders are archived separately are still
+// backed up. The archive is named like NamedDirsf would name it, but with FilesSuffix appended to
+// the name, and is created next to the directory, like Dirf.
+func Filesf(dir Dir, nameFmt string, formatName FormatName, excludes ...string) (Result, error) {
+	return dirf(dir.Path, dir.name()+FilesSuffix, nameFmt, formatName, true, dir.excludes(excludes))
+}
+
+// dirf archives the given directory into an archive named after the given base name. If filesOnly
+// is true, subdirectories are left out.
+func dirf(dirname string, base string, nameFmt string, formatName FormatName, filesOnly bool, excludes []string) (Result, error) {
 	parentPath := path.Dir(dirname)
+	started := timeNow()
 
 	// Create the destination filename based on the name format, and base path.
-	fileName := fmt.Sprintf(nameFmt, path.Base(dirname), time.Now().Unix())
-	fileName = strings.Replace(fileName, " ", "_", -1)
+	fileName := archiveName(base, nameFmt)
 
 	format, err := findFormatByName(formatName)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 
 	// Produce the archive file, with the given name, in the given directory.
 	artifact, err := format.producer(parentPath, fileName)
 	if err != nil {
-		return "", err
+		return Result{}, err
 	}
 
-	defer artifact.Close()
+	result := Result{
+		Dirname:  dirname,
+		Filename: artifact.Name(),
+	}
 
-	return artifact.Name(), walk(dirname, artifact)
+	err = walk(dirname, excludes, filesOnly, artifact, &result)
+	cerr := artifact.Close()
+
+	if err != nil {
+		return result, err
+	}
+
+	if cerr != nil {
+		return result, cerr
+	}
+
+	info, err := stat(result.Filename)
+	if err != nil {
+		return result, err
+	}
+
+	result.Size = info.Size()
+	result.Duration = timeNow().Sub(started)
+
+	return result, nil
 }
 
-func walk(root string, artifact Artifact) error {
+// Planf works out what Dirf would produce for the given directory, without producing an archive.
+// The directory is walked in exactly the same way, so the Files and Bytes of the returned Result are
+// accurate, but as nothing is compressed, its Size and Duration are left empty.
+//
+// The Filename of the Result is the name the archive would be given, if it were produced now, named
+// like NamedDirsf would name it.
+func Planf(dir Dir, nameFmt string, formatName FormatName, excludes ...string) (Result, error) {
+	return planf(dir.Path, dir.name(), nameFmt, formatName, false, dir.excludes(excludes))
+}
+
+// PlanFilesf works out what Filesf would produce for the given directory, like Planf does for Dirf.
+func PlanFilesf(dir Dir, nameFmt string, formatName FormatName, excludes ...string) (Result, error) {
+	return planf(dir.Path, dir.name()+FilesSuffix, nameFmt, formatName, true, dir.excludes(excludes))
+}
+
+// planf works out what dirf would produce, given the same arguments.
+func planf(dirname string, base string, nameFmt string, formatName FormatName, filesOnly bool, excludes []string) (Result, error) {
+	_, err := findFormatByName(formatName)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{
+		Dirname:  dirname,
+		Filename: path.Join(path.Dir(dirname), archiveName(base, nameFmt)+extensions[formatName]),
+	}
+
+	err = walk(dirname, excludes, filesOnly, discardArtifact{}, &result)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// archiveName creates the name of an archive with the given base name, without an extension, from
+// the given name format.
+func archiveName(base string, nameFmt string) string {
+	name := fmt.Sprintf(nameFmt, base, time.Now().Unix())
+
+	return strings.Replace(name, " ", "_", -1)
+}
+
+func walk(root string, excludes []string, filesOnly bool, artifact Artifact, result *Result) error {
 	info, err := stat(root)
 	if err != nil {
 		return err
 	}
 
-	return doWalk(root, info, artifact)
+	return doWalk(root, root, info, excludes, filesOnly, artifact, result)
 }
 
 // walk traverses a directory tree, starting at the given path. This is a simplified version of the
 // walk function provided in the standard library designed to make testing a little easier.
-func doWalk(path string, info os.FileInfo, artifact Artifact) error {
+func doWalk(root string, path string, info os.FileInfo, excludes []string, filesOnly bool, artifact Artifact, result *Result) error {
+	if path != root && Excluded(root, path, excludes) {
+		return nil
+	}
+
+	if path != root && filesOnly && info.IsDir() {
+		return nil
+	}
+
 	err := artifact.AddFile(path, info)
 	if err != nil {
 		return err
 	}
 
+	if info.Mode().IsRegular() {
+		result.Files++
+		result.Bytes += info.Size()
+	}
+
 	// Bail if we're not looking at a directory, we have nothing left to do.
 	if !info.IsDir() {
 		return nil
@@ -151,7 +331,7 @@ func doWalk(path string, info os.FileInfo, artifact Artifact) error {
 		// Create the full path to file.
 		filename := filepath.Join(path, file.Name())
 
-		err = doWalk(filename, file, artifact)
+		err = doWalk(root, filename, file, excludes, filesOnly, artifact, result)
 		if err != nil {
 			return err
 		}
@@ -159,3 +339,40 @@ func doWalk(path string, info os.FileInfo, artifact Artifact) error {
 
 	return nil
 }
+
+// Excluded returns true if the file at the given path, within the directory `root`, matches any of
+// the given patterns. Patterns use the syntax of filepath.Match, and are matched against both the
+// path relative to `root`, and the file's base name; so `*.tmp` excludes temporary files anywhere,
+// and `cache/*` excludes the contents of a top-level cache directory.
+func Excluded(root string, path string, patterns []string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+
+	rel = filepath.ToSlash(rel)
+	base := filepath.Base(path)
+
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateExcludes returns an error if any of the given exclude patterns are malformed.
+func ValidateExcludes(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("archive: invalid exclude pattern '%s': %v", pattern, err)
+		}
+	}
+
+	return nil
+}
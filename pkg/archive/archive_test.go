@@ -4,12 +4,14 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"path"
 	"regexp"
 	"sort"
 	"strings"
 	"testing"
 
 	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/logging"
 )
 
 const (
@@ -27,7 +29,8 @@ const (
 
 func TestDirf(t *testing.T) {
 	t.Run("should return an archive filename", func(t *testing.T) {
-		filename, err := Dirf(testDir1, testFmtValid, TarGz)
+		result, err := Dirf(testDir1, testFmtValid, TarGz)
+		filename := result.Filename
 		assert.OK(t, err)
 
 		defer os.Remove(filename)
@@ -41,7 +44,8 @@ func TestDirf(t *testing.T) {
 
 	t.Run("should not error when given an invalid name format", func(t *testing.T) {
 		// This might seem counter-intuitive, but it's the same behaviour as the fmt package.
-		filename, err := Dirf(testDir2, testFmtInvalid, TarGz)
+		result, err := Dirf(testDir2, testFmtInvalid, TarGz)
+		filename := result.Filename
 		assert.OK(t, err)
 
 		err = os.Remove(filename)
@@ -49,7 +53,8 @@ func TestDirf(t *testing.T) {
 	})
 
 	t.Run("should create an archive file with the returned filename", func(t *testing.T) {
-		filename, err := Dirf(testDir1, testFmtValid, TarGz)
+		result, err := Dirf(testDir1, testFmtValid, TarGz)
+		filename := result.Filename
 		assert.OK(t, err)
 
 		defer os.Remove(filename)
@@ -63,7 +68,8 @@ func TestDirf(t *testing.T) {
 	})
 
 	t.Run("should error if a non-existent directory is given", func(t *testing.T) {
-		filename, err := Dirf(testDir3, testFmtValid, TarGz)
+		result, err := Dirf(testDir3, testFmtValid, TarGz)
+		filename := result.Filename
 		assert.NotOK(t, err)
 
 		err = os.Remove(filename)
@@ -75,7 +81,8 @@ func TestDirf(t *testing.T) {
 			return nil, errors.New("create error")
 		}
 
-		filename, err := Dirf(testDir1, testFmtInvalid, TarGz)
+		result, err := Dirf(testDir1, testFmtInvalid, TarGz)
+		filename := result.Filename
 
 		defer revertStubs()
 		defer func() {
@@ -134,9 +141,104 @@ func TestDirf(t *testing.T) {
 	})
 }
 
+func TestDirf_Result(t *testing.T) {
+	t.Run("should describe the archive that was produced", func(t *testing.T) {
+		result, err := Dirf(testDir2, testFmtValid, TarGz)
+		assert.OK(t, err)
+
+		defer os.Remove(result.Filename)
+
+		info, err := os.Stat(result.Filename)
+		assert.OK(t, err)
+
+		assert.Equal(t, testDir2, result.Dirname)
+		assert.Equal(t, 2, result.Files)
+		assert.Equal(t, int64(12), result.Bytes)
+		assert.Equal(t, info.Size(), result.Size)
+	})
+}
+
+func TestDirf_Excludes(t *testing.T) {
+	t.Run("should leave out files matching an exclude pattern", func(t *testing.T) {
+		result, err := Dirf(testDir2, testFmtValid, TarGz, "*_2.txt")
+		assert.OK(t, err)
+
+		defer os.Remove(result.Filename)
+
+		assert.Equal(t, 1, result.Files)
+		assert.Equal(t, int64(6), result.Bytes)
+	})
+}
+
+func TestFilesf(t *testing.T) {
+	t.Run("should only archive the files directly in the directory", func(t *testing.T) {
+		dirname := createFilesTestDir(t)
+		defer os.RemoveAll(dirname)
+
+		result, err := Filesf(Dir{Path: dirname}, testFmtValid, TarGz)
+		assert.OK(t, err)
+
+		defer os.Remove(result.Filename)
+
+		_, err = os.Stat(result.Filename)
+		assert.OK(t, err)
+
+		base := path.Base(dirname) + FilesSuffix
+		assert.True(t, strings.Contains(result.Filename, "test-"+base+"-"), "Unexpected filename: "+result.Filename)
+		assert.Equal(t, 1, result.Files)
+		assert.Equal(t, int64(3), result.Bytes)
+	})
+}
+
+func TestPlanFilesf(t *testing.T) {
+	t.Run("should describe the archive that Filesf would produce", func(t *testing.T) {
+		dirname := createFilesTestDir(t)
+		defer os.RemoveAll(dirname)
+
+		result, err := PlanFilesf(Dir{Path: dirname}, testFmtValid, TarGz)
+		assert.OK(t, err)
+
+		_, err = os.Stat(result.Filename)
+		assert.True(t, os.IsNotExist(err), "Expected no archive to be created")
+
+		assert.True(t, strings.Contains(result.Filename, FilesSuffix+"-"), "Unexpected filename: "+result.Filename)
+		assert.Equal(t, 1, result.Files)
+		assert.Equal(t, int64(3), result.Bytes)
+	})
+}
+
+// createFilesTestDir creates a directory with a file in it, and a subdirectory with another file.
+func createFilesTestDir(t *testing.T) string {
+	dirname, err := ioutil.TempDir("", "foldup-files")
+	assert.OK(t, err)
+
+	assert.OK(t, ioutil.WriteFile(path.Join(dirname, "top.txt"), []byte("top"), 0644))
+	assert.OK(t, os.Mkdir(path.Join(dirname, "sub"), 0755))
+	assert.OK(t, ioutil.WriteFile(path.Join(dirname, "sub", "inner.txt"), []byte("inner"), 0644))
+
+	return dirname
+}
+
+func TestExcluded(t *testing.T) {
+	t.Run("should match patterns against relative paths and base names", func(t *testing.T) {
+		assert.True(t, Excluded("/srv", "/srv/a/b.tmp", []string{"*.tmp"}), "Expected base name match")
+		assert.True(t, Excluded("/srv", "/srv/cache/x", []string{"cache/*"}), "Expected relative path match")
+		assert.False(t, Excluded("/srv", "/srv/a/cache/x", []string{"cache/*"}), "Expected nested path not to match")
+		assert.False(t, Excluded("/srv", "/srv/a/b.txt", []string{"*.tmp"}), "Expected no match")
+	})
+}
+
+func TestValidateExcludes(t *testing.T) {
+	t.Run("should error if a pattern is malformed", func(t *testing.T) {
+		assert.OK(t, ValidateExcludes([]string{"*.tmp", "cache/*"}))
+		assert.NotOK(t, ValidateExcludes([]string{"[oops"}))
+	})
+}
+
 func TestDirsf(t *testing.T) {
 	t.Run("should return a sorted list of archive names", func(t *testing.T) {
-		filenames, err := Dirsf([]string{testDir1, testDir2}, testFmtValid, TarGz)
+		results, err := Dirsf(logging.NewNopLogger(), []string{testDir1, testDir2}, testFmtValid, TarGz)
+		filenames := resultFilenames(results)
 
 		defer func() {
 			for _, filename := range filenames {
@@ -159,7 +261,8 @@ func TestDirsf(t *testing.T) {
 	})
 
 	t.Run("should create archive files with the returned filenames", func(t *testing.T) {
-		filenames, err := Dirsf([]string{testDir1, testDir2}, testFmtValid, TarGz)
+		results, err := Dirsf(logging.NewNopLogger(), []string{testDir1, testDir2}, testFmtValid, TarGz)
+		filenames := resultFilenames(results)
 
 		defer func() {
 			for _, filename := range filenames {
@@ -180,8 +283,17 @@ func TestDirsf(t *testing.T) {
 		assert.True(t, exists, "Expected all files to exist")
 	})
 
+	t.Run("should return no archive names if given no directories", func(t *testing.T) {
+		results, err := Dirsf(logging.NewNopLogger(), []string{}, testFmtValid, TarGz)
+		filenames := resultFilenames(results)
+
+		assert.OK(t, err)
+		assert.Equal(t, 0, len(filenames))
+	})
+
 	t.Run("should error if there is an error archiving a directory", func(t *testing.T) {
-		filenames, err := Dirsf([]string{testDir1, testDir2}, testFmtValid, "memento")
+		results, err := Dirsf(logging.NewNopLogger(), []string{testDir1, testDir2}, testFmtValid, "memento")
+		filenames := resultFilenames(results)
 
 		defer func() {
 			for _, filename := range filenames {
@@ -192,3 +304,78 @@ func TestDirsf(t *testing.T) {
 		assert.NotOK(t, err)
 	})
 }
+
+func TestNamedDirsf(t *testing.T) {
+	t.Run("should name archives using the given names", func(t *testing.T) {
+		dirs := []Dir{
+			{Path: testDir1, Name: "first"},
+			{Path: testDir2},
+		}
+
+		results, err := NamedDirsf(logging.NewNopLogger(), dirs, testFmtValid, TarGz)
+		filenames := resultFilenames(results)
+
+		defer func() {
+			for _, filename := range filenames {
+				os.Remove(filename)
+			}
+		}()
+
+		assert.OK(t, err)
+		assert.Equal(t, 2, len(results))
+		assert.True(t, strings.HasPrefix(path.Base(results[0].Filename), "test-first-"), "Expected the given name to be used")
+		assert.True(t, strings.HasPrefix(path.Base(results[1].Filename), "test-"+path.Base(testDir2)+"-"), "Expected the base name to be used")
+		assert.Equal(t, testDir1, results[0].Dirname)
+	})
+}
+
+func resultFilenames(results []Result) []string {
+	filenames := []string{}
+	for _, result := range results {
+		filenames = append(filenames, result.Filename)
+	}
+
+	return filenames
+}
+
+func TestPlanf(t *testing.T) {
+	t.Run("should describe the archive that would be produced", func(t *testing.T) {
+		result, err := Planf(Dir{Path: testDir2}, testFmtValid, TarGz)
+		assert.OK(t, err)
+
+		_, err = os.Stat(result.Filename)
+		assert.True(t, os.IsNotExist(err), "Expected no archive to be created")
+
+		assert.Equal(t, testDir2, result.Dirname)
+		assert.True(t, strings.HasSuffix(result.Filename, ".tar.gz"), "Expected a .tar.gz filename")
+		assert.Equal(t, 2, result.Files)
+		assert.Equal(t, int64(12), result.Bytes)
+		assert.Equal(t, int64(0), result.Size)
+	})
+
+	t.Run("should leave out files matching an exclude pattern", func(t *testing.T) {
+		result, err := Planf(Dir{Path: testDir2}, testFmtValid, TarGz, "*_2.txt")
+		assert.OK(t, err)
+
+		assert.Equal(t, 1, result.Files)
+		assert.Equal(t, int64(6), result.Bytes)
+	})
+
+	t.Run("should leave out files matching the directory's own exclude patterns", func(t *testing.T) {
+		result, err := Planf(Dir{Path: testDir2, Excludes: []string{"*_2.txt"}}, testFmtValid, TarGz)
+		assert.OK(t, err)
+
+		assert.Equal(t, 1, result.Files)
+		assert.Equal(t, int64(6), result.Bytes)
+	})
+
+	t.Run("should error if a non-existent directory is given", func(t *testing.T) {
+		_, err := Planf(Dir{Path: "rumpelstilzchen"}, testFmtValid, TarGz)
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if an invalid archive format is given", func(t *testing.T) {
+		_, err := Planf(Dir{Path: testDir2}, testFmtValid, "nope")
+		assert.NotOK(t, err)
+	})
+}
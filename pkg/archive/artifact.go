@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 // Artifact represents an archive to be interacted with.
@@ -42,6 +43,29 @@ type format struct {
 // The formats slice contains all registered archive artifact formats.
 var formats []format
 
+// The extensions map contains the file extensions of archives produced in each format, where known.
+var extensions = make(map[FormatName]string)
+
+// Extension returns the file extension of archives produced in the given format, including the
+// leading dot, e.g. ".tar.gz". If it isn't known, an empty string is returned.
+func Extension(name FormatName) string {
+	return extensions[name]
+}
+
+// ExtensionFormat returns the format that produces archives with the given file extension, with or
+// without its leading dot, e.g. "tar.gz". If no registered format does, false is returned.
+func ExtensionFormat(ext string) (FormatName, bool) {
+	ext = "." + strings.TrimPrefix(ext, ".")
+
+	for name, e := range extensions {
+		if e == ext {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
 // RegisterFormat registers an archive artifact format for use by functions that accept a
 // FormatName.
 //
@@ -52,6 +76,22 @@ func RegisterFormat(name FormatName, producer producerFunc) {
 	formats = append(formats, format{name, producer})
 }
 
+// ParseFormatName returns the FormatName of the registered format with the given name, ignoring
+// case. If there is no such format, an error listing the registered formats is returned.
+func ParseFormatName(name string) (FormatName, error) {
+	names := []string{}
+
+	for _, format := range formats {
+		if strings.EqualFold(string(format.name), name) {
+			return format.name, nil
+		}
+
+		names = append(names, string(format.name))
+	}
+
+	return "", fmt.Errorf("archive: unknown format '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
 // The findFormatByName function attempts to find a archive artifact format that has been registered
 // with the given FormatName. If one cannot be found, an error will be returned.
 func findFormatByName(name FormatName) (format, error) {
@@ -63,3 +103,11 @@ func findFormatByName(name FormatName) (format, error) {
 
 	return format{}, fmt.Errorf("archive: unable to find format '%v'", name)
 }
+
+// discardArtifact is an Artifact that throws away everything added to it. It's used to walk a
+// directory as if it were being archived, without producing anything.
+type discardArtifact struct{}
+
+func (discardArtifact) Close() error                                { return nil }
+func (discardArtifact) AddFile(path string, info os.FileInfo) error { return nil }
+func (discardArtifact) Name() string                                { return "" }
@@ -20,3 +20,45 @@ func TestRegisterFormat(t *testing.T) {
 		assert.OK(t, err)
 	})
 }
+
+func TestParseFormatName(t *testing.T) {
+	t.Run("should find registered formats, ignoring case", func(t *testing.T) {
+		name, err := ParseFormatName("targz")
+
+		assert.OK(t, err)
+		assert.Equal(t, TarGz, name)
+	})
+
+	t.Run("should error if the format isn't registered", func(t *testing.T) {
+		_, err := ParseFormatName("zip")
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestExtension(t *testing.T) {
+	t.Run("should return the extension of archives in the given format", func(t *testing.T) {
+		assert.Equal(t, ".tar.gz", Extension(TarGz))
+	})
+
+	t.Run("should return an empty string if the extension isn't known", func(t *testing.T) {
+		assert.Equal(t, "", Extension("test"))
+	})
+}
+
+func TestExtensionFormat(t *testing.T) {
+	t.Run("should find the format with the given extension", func(t *testing.T) {
+		name, ok := ExtensionFormat("tar.gz")
+		assert.True(t, ok, "Expected a format to be found")
+		assert.Equal(t, TarGz, name)
+
+		name, ok = ExtensionFormat(".tar.gz")
+		assert.True(t, ok, "Expected a format to be found")
+		assert.Equal(t, TarGz, name)
+	})
+
+	t.Run("should return false if no format has the extension", func(t *testing.T) {
+		_, ok := ExtensionFormat("zip")
+		assert.False(t, ok, "Expected no format to be found")
+	})
+}
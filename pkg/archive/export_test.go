@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"io/ioutil"
 	"os"
+	"time"
 )
 
 type stubArchiveWriter struct {
@@ -88,6 +89,7 @@ func revertStubs() {
 	open = os.Open
 	readDir = ioutil.ReadDir
 	stat = os.Stat
+	timeNow = time.Now
 
 	stubArtifactRef = &stubArtifact{}
 }
@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mode decides which directories under a source directory are archived, each into its own archive.
+type Mode struct {
+	// Depth is how many levels below the source directory the archived directories are. At 0, the
+	// source directory itself is archived, and at 1, each of its children are. Anything above that
+	// depth, other than the directories leading down to it, isn't archived.
+	Depth int
+}
+
+// The usual modes.
+var (
+	// ModeSelf archives the source directory itself.
+	ModeSelf = Mode{Depth: 0}
+	// ModeChildren archives each of the source directory's children.
+	ModeChildren = Mode{Depth: 1}
+)
+
+// ParseMode parses a mode; "self", "children", or "depth=N", where N is at least 1. An empty string
+// gives ModeChildren.
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "", "children":
+		return ModeChildren, nil
+	case "self":
+		return ModeSelf, nil
+	}
+
+	if strings.HasPrefix(s, "depth=") {
+		depth, err := strconv.Atoi(strings.TrimPrefix(s, "depth="))
+		if err == nil && depth >= 1 {
+			return Mode{Depth: depth}, nil
+		}
+	}
+
+	return Mode{}, fmt.Errorf("archive: unknown mode '%s', expected one of: children, self, depth=N", s)
+}
+
+// String returns the mode as it would be parsed by ParseMode.
+func (m Mode) String() string {
+	switch m {
+	case ModeSelf:
+		return "self"
+	case ModeChildren:
+		return "children"
+	}
+
+	return fmt.Sprintf("depth=%d", m.Depth)
+}
@@ -0,0 +1,42 @@
+package archive
+
+import (
+	"testing"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestParseMode(t *testing.T) {
+	t.Run("should parse each mode", func(t *testing.T) {
+		modes := map[string]Mode{
+			"":         ModeChildren,
+			"children": ModeChildren,
+			"self":     ModeSelf,
+			"depth=1":  ModeChildren,
+			"depth=3":  {Depth: 3},
+		}
+
+		for s, expected := range modes {
+			mode, err := ParseMode(s)
+			assert.OK(t, err)
+			assert.Equal(t, expected, mode)
+		}
+	})
+
+	t.Run("should error if the mode is unknown", func(t *testing.T) {
+		for _, s := range []string{"everything", "depth=0", "depth=-1", "depth=two"} {
+			_, err := ParseMode(s)
+			assert.NotOK(t, err)
+		}
+	})
+}
+
+func TestMode_String(t *testing.T) {
+	t.Run("should format modes as they're parsed", func(t *testing.T) {
+		for _, s := range []string{"children", "self", "depth=2"} {
+			mode, err := ParseMode(s)
+			assert.OK(t, err)
+			assert.Equal(t, s, mode.String())
+		}
+	})
+}
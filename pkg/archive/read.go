@@ -0,0 +1,89 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Entry describes a file read from an archive.
+type Entry struct {
+	// Name is the path of the file in the archive.
+	Name string
+	// Size is the size of the file, in bytes.
+	Size int64
+	// Mode is the file's mode and permission bits.
+	Mode os.FileMode
+	// ModTime is when the file was last modified, before it was archived.
+	ModTime time.Time
+}
+
+// An EntryFunc is called with each file read from an archive, along with a reader of its contents.
+// The contents can only be read until the function returns.
+type EntryFunc func(entry Entry, contents io.Reader) error
+
+// A readerFunc reads an archive in a specific format, calling the given EntryFunc for each file.
+type readerFunc func(in io.Reader, fn EntryFunc) error
+
+// The readers map contains the functions used to read archives in each format, where known.
+var readers = make(map[FormatName]readerFunc)
+
+// Read streams the archive in the given format from the given reader, calling fn for each file in
+// it, in the order they were archived. Nothing is written to disk, so reading an archive only takes
+// as long as it takes to get to the end of it. If fn returns an error, reading stops, and the error
+// is returned.
+func Read(in io.Reader, formatName FormatName, fn EntryFunc) error {
+	reader, ok := readers[formatName]
+	if !ok {
+		return fmt.Errorf("archive: unable to read archives in format '%v'", formatName)
+	}
+
+	return reader(in, fn)
+}
+
+// FilenameFormat returns the format of the archive with the given file name, judging by its file
+// extension. If no registered format produces archives with that extension, false is returned.
+func FilenameFormat(filename string) (FormatName, bool) {
+	for name, ext := range extensions {
+		if strings.HasSuffix(filename, ext) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// MatchPath checks if the given pattern matches the path of a file in an archive. Files are stored
+// under the path of the directory that was archived, which depends on where it was archived from,
+// so the pattern only has to match the end of the path, e.g. `etc/app.yml` matches
+// `/srv/app/etc/app.yml`. Patterns use the syntax of path.Match.
+//
+// If the pattern matches, the part of the path it matched is returned, e.g. `etc/app.yml`.
+func MatchPath(pattern string, name string) (string, bool) {
+	name = strings.TrimLeft(path.Clean("/"+name), "/")
+
+	// Try each trailing part of the path, from the file's base name up.
+	for i := len(name) - 1; i >= 0; i-- {
+		if i > 0 && name[i-1] != '/' {
+			continue
+		}
+
+		if ok, _ := path.Match(pattern, name[i:]); ok {
+			return name[i:], true
+		}
+	}
+
+	return "", false
+}
+
+// ValidatePattern returns an error if the given pattern, as used by MatchPath, is malformed.
+func ValidatePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("archive: invalid path pattern '%s': %v", pattern, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestRead(t *testing.T) {
+	t.Run("should read each file in an archive", func(t *testing.T) {
+		result, err := Dirf(testDir2, testFmtValid, TarGz)
+		assert.OK(t, err)
+
+		defer os.Remove(result.Filename)
+
+		file, err := os.Open(result.Filename)
+		assert.OK(t, err)
+
+		defer file.Close()
+
+		contents := make(map[string]string)
+
+		err = Read(file, TarGz, func(entry Entry, in io.Reader) error {
+			data, err := ioutil.ReadAll(in)
+			if err != nil {
+				return err
+			}
+
+			assert.Equal(t, int64(len(data)), entry.Size)
+			assert.False(t, entry.ModTime.IsZero(), "Expected a modification time")
+
+			contents[entry.Name] = string(data)
+
+			return nil
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, map[string]string{
+			"testdata/test2/test2_1.txt": "seeruk",
+			"testdata/test2/test2_2.txt": "foldup",
+		}, contents)
+	})
+
+	t.Run("should stop reading if the function returns an error", func(t *testing.T) {
+		result, err := Dirf(testDir2, testFmtValid, TarGz)
+		assert.OK(t, err)
+
+		defer os.Remove(result.Filename)
+
+		file, err := os.Open(result.Filename)
+		assert.OK(t, err)
+
+		defer file.Close()
+
+		calls := 0
+
+		err = Read(file, TarGz, func(entry Entry, in io.Reader) error {
+			calls++
+			return errors.New("oops")
+		})
+
+		assert.NotOK(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should error if the archive is corrupt", func(t *testing.T) {
+		err := Read(bytes.NewBufferString("nope"), TarGz, func(entry Entry, in io.Reader) error {
+			return nil
+		})
+
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if the format can't be read", func(t *testing.T) {
+		err := Read(bytes.NewBufferString(""), "stub", func(entry Entry, in io.Reader) error {
+			return nil
+		})
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestFilenameFormat(t *testing.T) {
+	t.Run("should find the format of archives by their extension", func(t *testing.T) {
+		name, ok := FilenameFormat("backup/backup-photos-1500000000.tar.gz")
+		assert.True(t, ok, "Expected a format")
+		assert.Equal(t, TarGz, name)
+	})
+
+	t.Run("should not find a format for other files", func(t *testing.T) {
+		_, ok := FilenameFormat("notes.txt")
+		assert.False(t, ok, "Expected no format")
+	})
+}
+
+func TestMatchPath(t *testing.T) {
+	t.Run("should match the end of paths", func(t *testing.T) {
+		rel, ok := MatchPath("etc/app.yml", "/srv/app/etc/app.yml")
+		assert.True(t, ok, "Expected path to match")
+		assert.Equal(t, "etc/app.yml", rel)
+	})
+
+	t.Run("should match glob patterns", func(t *testing.T) {
+		rel, ok := MatchPath("etc/*.yml", "backups/app/etc/db.yml")
+		assert.True(t, ok, "Expected path to match")
+		assert.Equal(t, "etc/db.yml", rel)
+	})
+
+	t.Run("should only match whole path elements", func(t *testing.T) {
+		_, ok := MatchPath("app.yml", "/srv/app/etc/myapp.yml")
+		assert.False(t, ok, "Expected path not to match")
+	})
+
+	t.Run("should not match paths outside the archive", func(t *testing.T) {
+		rel, ok := MatchPath("*/passwd", "../../etc/passwd")
+		assert.True(t, ok, "Expected path to match")
+		assert.Equal(t, "etc/passwd", rel)
+
+		_, ok = MatchPath("*", "/")
+		assert.False(t, ok, "Expected path not to match")
+	})
+}
+
+func TestValidatePattern(t *testing.T) {
+	assert.OK(t, ValidatePattern("etc/*.yml"))
+	assert.NotOK(t, ValidatePattern("etc/[.yml"))
+}
@@ -12,11 +12,17 @@ import (
 func init() {
 	// Register the built-in TarGz format.
 	RegisterFormat(TarGz, tarGzProducer)
+
+	extensions[TarGz] = tarGzExtension
+	readers[TarGz] = readTarGz
 }
 
 // TarGz is a format for creating gzipped tarballs.
 const TarGz FormatName = "TarGz"
 
+// tarGzExtension is the file extension of gzipped tarballs.
+const tarGzExtension = ".tar.gz"
+
 // tarWriteCloser is an interface that provides functionality for writing data, writing tar headers,
 // and closing a tar.
 //
@@ -30,7 +36,7 @@ type tarWriteCloser interface {
 
 // tarGzProducer creates a tarGzArtifact, creating the archive file in the process.
 func tarGzProducer(pathname, filename string) (Artifact, error) {
-	filename = fmt.Sprintf("%s.tar.gz", filename)
+	filename = fmt.Sprintf("%s%s", filename, tarGzExtension)
 
 	// To create the file, we need to create the path to the file.
 	file, err := create(path.Join(pathname, filename))
@@ -110,3 +116,44 @@ func (a *tarGzArtifact) AddFile(path string, info os.FileInfo) error {
 func (a *tarGzArtifact) Name() string {
 	return a.fw.Name()
 }
+
+// readTarGz reads a gzipped tarball, calling fn for each regular file in it.
+func readTarGz(in io.Reader, fn EntryFunc) error {
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		info := header.FileInfo()
+
+		// Only regular files are archived, but archives made elsewhere may hold anything.
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		entry := Entry{
+			Name:    header.Name,
+			Size:    header.Size,
+			Mode:    info.Mode(),
+			ModTime: header.ModTime,
+		}
+
+		if err := fn(entry, tr); err != nil {
+			return err
+		}
+	}
+}
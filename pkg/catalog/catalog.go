@@ -0,0 +1,192 @@
+// Package catalog keeps a record of every backup run in the bucket the archives are stored in, so
+// that archives can be listed, restored and pruned without relying on their names alone.
+package catalog
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultObject is the name of the object the catalog is stored as, in the bucket it describes.
+const DefaultObject = "foldup-catalog.json"
+
+// EncryptionNone is recorded for archives that aren't encrypted.
+const EncryptionNone = "none"
+
+// Status is the outcome of a run, or of backing up a single folder.
+type Status string
+
+// Available statuses.
+const (
+	StatusSuccess Status = "success"
+	StatusFailure Status = "failure"
+)
+
+// Catalog records backup runs, and the archives they stored.
+type Catalog struct {
+	// Runs are the recorded runs, oldest first.
+	Runs []Run `json:"runs"`
+
+	// generation is the generation of the object the catalog was loaded from, if generational is
+	// set, so that it's only saved over that object if nobody else has replaced it since. It's 0 if
+	// there was no object to load.
+	generation   int64
+	generational bool
+}
+
+// Run describes a single backup run.
+type Run struct {
+	// ID is the ID of the run.
+	ID string `json:"id"`
+	// Job is the name of the job that ran, if it has one.
+	Job string `json:"job,omitempty"`
+	// Host is the hostname of the machine the run happened on.
+	Host string `json:"host,omitempty"`
+	// Started is when the run started.
+	Started time.Time `json:"started"`
+	// Finished is when the run finished, if it's known.
+	Finished time.Time `json:"finished,omitempty"`
+	// Status is the outcome of the run.
+	Status Status `json:"status"`
+	// Error is why the run failed, if it did.
+	Error string `json:"error,omitempty"`
+	// Format is the format of the run's archives.
+	Format string `json:"format,omitempty"`
+	// Encryption is how the run's archives are encrypted, or EncryptionNone.
+	Encryption string `json:"encryption"`
+	// Snapshots are the archives of each folder backed up by the run.
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// Snapshot describes the archive of a single folder, made by a run.
+type Snapshot struct {
+	// Folder is the name of the folder.
+	Folder string `json:"folder"`
+	// Path is the local path of the folder, if it's known.
+	Path string `json:"path,omitempty"`
+	// Object is the name the archive is stored under.
+	Object string `json:"object"`
+	// Size is the size of the archive, in bytes.
+	Size int64 `json:"size"`
+	// Files is the number of files in the archive, if it's known.
+	Files int `json:"files,omitempty"`
+	// SHA256 is the hex encoded SHA-256 hash of the archive, if it's known.
+	SHA256 string `json:"sha256,omitempty"`
+	// Manifest is the name the manifest of the archive is stored under, if it has one.
+	Manifest string `json:"manifest,omitempty"`
+	// Status is the outcome of backing up the folder. Folders that failed to be backed up are
+	// recorded too, but only successful snapshots have an archive stored under Object.
+	Status Status `json:"status"`
+	// Error is why the folder wasn't backed up, if it wasn't.
+	Error string `json:"error,omitempty"`
+}
+
+// Entry is a stored snapshot, along with the run that made it.
+type Entry struct {
+	Snapshot
+	// RunID is the ID of the run that made the snapshot.
+	RunID string
+	// Job is the name of the job that made the snapshot.
+	Job string
+	// Host is the hostname of the machine the snapshot was made on.
+	Host string
+	// Time is when the run that made the snapshot started.
+	Time time.Time
+	// Format is the format of the snapshot's archive, if it's known.
+	Format string
+}
+
+// Filter narrows down the entries found in a catalog. Empty fields match anything.
+type Filter struct {
+	Job    string
+	Host   string
+	Folder string
+}
+
+// matches checks if the given entry matches the filter.
+func (f Filter) matches(e Entry) bool {
+	return (f.Job == "" || f.Job == e.Job) &&
+		(f.Host == "" || f.Host == e.Host) &&
+		(f.Folder == "" || f.Folder == e.Folder)
+}
+
+// Add records the given run, replacing any run with the same ID.
+func (c *Catalog) Add(run Run) {
+	for i, r := range c.Runs {
+		if r.ID == run.ID {
+			c.Runs[i] = run
+			return
+		}
+	}
+
+	c.Runs = append(c.Runs, run)
+
+	sort.SliceStable(c.Runs, func(i, j int) bool {
+		return c.Runs[i].Started.Before(c.Runs[j].Started)
+	})
+}
+
+// Find returns the stored snapshots that match the given filter, newest first.
+func (c *Catalog) Find(filter Filter) []Entry {
+	entries := []Entry{}
+
+	for _, r := range c.Runs {
+		for _, s := range r.Snapshots {
+			if s.Status != StatusSuccess {
+				continue
+			}
+
+			entry := Entry{
+				Snapshot: s,
+				RunID:    r.ID,
+				Job:      r.Job,
+				Host:     r.Host,
+				Time:     r.Started,
+				Format:   r.Format,
+			}
+
+			if filter.matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+
+	return entries
+}
+
+// Remove forgets the snapshots stored under the given object names, e.g. once they've been deleted.
+// Runs that are left with no successful snapshots are forgotten too, as there's nothing left of
+// them to restore.
+func (c *Catalog) Remove(objects ...string) {
+	removed := make(map[string]bool)
+	for _, o := range objects {
+		removed[o] = true
+	}
+
+	runs := []Run{}
+
+	for _, r := range c.Runs {
+		snapshots := []Snapshot{}
+		stored := false
+
+		for _, s := range r.Snapshots {
+			if !removed[s.Object] {
+				snapshots = append(snapshots, s)
+				stored = stored || s.Status == StatusSuccess
+			}
+		}
+
+		if len(snapshots) < len(r.Snapshots) && !stored {
+			continue
+		}
+
+		r.Snapshots = snapshots
+		runs = append(runs, r)
+	}
+
+	c.Runs = runs
+}
@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestCatalog_Add(t *testing.T) {
+	t.Run("should keep runs in the order they started", func(t *testing.T) {
+		now := time.Now()
+
+		catalog := &Catalog{}
+		catalog.Add(Run{ID: "b", Started: now})
+		catalog.Add(Run{ID: "a", Started: now.Add(-time.Hour)})
+
+		assert.Equal(t, 2, len(catalog.Runs))
+		assert.Equal(t, "a", catalog.Runs[0].ID)
+		assert.Equal(t, "b", catalog.Runs[1].ID)
+	})
+
+	t.Run("should replace runs with the same ID", func(t *testing.T) {
+		catalog := &Catalog{}
+		catalog.Add(Run{ID: "a", Status: StatusFailure})
+		catalog.Add(Run{ID: "a", Status: StatusSuccess})
+
+		assert.Equal(t, 1, len(catalog.Runs))
+		assert.Equal(t, StatusSuccess, catalog.Runs[0].Status)
+	})
+}
+
+func TestCatalog_Find(t *testing.T) {
+	now := time.Now()
+
+	catalog := &Catalog{}
+	catalog.Add(Run{ID: "1", Job: "nightly", Host: "nas", Started: now.Add(-time.Hour), Snapshots: []Snapshot{
+		{Folder: "photos", Object: "photos-1", Status: StatusSuccess},
+		{Folder: "music", Object: "music-1", Status: StatusSuccess},
+	}})
+	catalog.Add(Run{ID: "2", Job: "nightly", Host: "nas", Started: now, Format: "TarGz", Snapshots: []Snapshot{
+		{Folder: "photos", Object: "photos-2", Status: StatusSuccess},
+		{Folder: "music", Object: "music-2", Status: StatusFailure},
+	}})
+
+	t.Run("should find stored snapshots, newest first", func(t *testing.T) {
+		entries := catalog.Find(Filter{Folder: "photos"})
+
+		assert.Equal(t, 2, len(entries))
+		assert.Equal(t, "photos-2", entries[0].Object)
+		assert.Equal(t, "2", entries[0].RunID)
+		assert.Equal(t, "nightly", entries[0].Job)
+		assert.Equal(t, now, entries[0].Time)
+		assert.Equal(t, "TarGz", entries[0].Format)
+		assert.Equal(t, "photos-1", entries[1].Object)
+	})
+
+	t.Run("should leave out snapshots that weren't stored", func(t *testing.T) {
+		entries := catalog.Find(Filter{Folder: "music"})
+
+		assert.Equal(t, 1, len(entries))
+		assert.Equal(t, "music-1", entries[0].Object)
+	})
+
+	t.Run("should filter by job and host", func(t *testing.T) {
+		assert.Equal(t, 3, len(catalog.Find(Filter{Job: "nightly", Host: "nas"})))
+		assert.Equal(t, 0, len(catalog.Find(Filter{Job: "weekly"})))
+		assert.Equal(t, 0, len(catalog.Find(Filter{Host: "laptop"})))
+	})
+}
+
+func TestCatalog_Remove(t *testing.T) {
+	t.Run("should forget snapshots, and runs with none left", func(t *testing.T) {
+		catalog := &Catalog{}
+		catalog.Add(Run{ID: "1", Snapshots: []Snapshot{{Object: "photos-1", Status: StatusSuccess}}})
+		catalog.Add(Run{ID: "2", Snapshots: []Snapshot{{Object: "photos-2", Status: StatusSuccess}, {Object: "music-2", Status: StatusSuccess}}})
+
+		catalog.Remove("photos-1", "photos-2")
+
+		assert.Equal(t, 1, len(catalog.Runs))
+		assert.Equal(t, "2", catalog.Runs[0].ID)
+		assert.Equal(t, []Snapshot{{Object: "music-2", Status: StatusSuccess}}, catalog.Runs[0].Snapshots)
+	})
+
+	t.Run("should forget runs left with only failed snapshots", func(t *testing.T) {
+		catalog := &Catalog{}
+		catalog.Add(Run{ID: "1", Snapshots: []Snapshot{{Object: "photos-1", Status: StatusSuccess}, {Object: "music-1", Status: StatusFailure}}})
+		catalog.Add(Run{ID: "2", Status: StatusFailure})
+
+		catalog.Remove("photos-1")
+
+		assert.Equal(t, 1, len(catalog.Runs))
+		assert.Equal(t, "2", catalog.Runs[0].ID)
+	})
+}
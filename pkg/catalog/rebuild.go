@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"fmt"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/manifest"
+	"github.com/SeerUK/foldup/pkg/naming"
+	"github.com/SeerUK/foldup/pkg/storage"
+)
+
+// Rebuild reconstructs a catalog from the given objects, as found by scanning a bucket. Objects
+// whose names weren't made from the given template are left out. Archives made at the same time,
+// by the same job and host, are assumed to have been made by the same run. Anything that can't be
+// recovered from the bucket, like hashes, and the local paths of folders, is left empty. Manifests
+// found in the bucket are recorded against their archives.
+func Rebuild(objects []storage.ObjectInfo, template *naming.Template) *Catalog {
+	catalog := &Catalog{Runs: []Run{}}
+	runs := make(map[string]int)
+
+	manifests := make(map[string]bool)
+	for _, o := range objects {
+		if manifest.IsManifest(o.Name) {
+			manifests[o.Name] = true
+		}
+	}
+
+	for _, o := range objects {
+		if manifest.IsManifest(o.Name) {
+			continue
+		}
+
+		vars, ok := template.Match(o.Name)
+		if !ok {
+			continue
+		}
+
+		started := vars.Time
+		if started.IsZero() {
+			started = o.Created
+		}
+
+		id := vars.RunID
+		if id == "" {
+			id = fmt.Sprintf("%s/%s/%d", vars.Host, vars.Job, started.Unix())
+		}
+
+		folder := vars.Folder
+		if folder == "" {
+			folder = vars.Path
+		}
+
+		i, ok := runs[id]
+		if !ok {
+			format, _ := archive.ExtensionFormat(vars.Ext)
+
+			catalog.Add(Run{
+				ID:         id,
+				Job:        vars.Job,
+				Host:       vars.Host,
+				Started:    started,
+				Status:     StatusSuccess,
+				Format:     string(format),
+				Encryption: EncryptionNone,
+				Snapshots:  []Snapshot{},
+			})
+
+			// Adding a run may reorder the others, so their positions are found again.
+			for j, r := range catalog.Runs {
+				runs[r.ID] = j
+			}
+
+			i = runs[id]
+		}
+
+		snapshot := Snapshot{
+			Folder: folder,
+			Object: o.Name,
+			Size:   o.Size,
+			Status: StatusSuccess,
+		}
+
+		if manifests[manifest.Name(o.Name)] {
+			snapshot.Manifest = manifest.Name(o.Name)
+		}
+
+		catalog.Runs[i].Snapshots = append(catalog.Runs[i].Snapshots, snapshot)
+	}
+
+	return catalog
+}
@@ -0,0 +1,65 @@
+package catalog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/manifest"
+	"github.com/SeerUK/foldup/pkg/naming"
+	"github.com/SeerUK/foldup/pkg/storage"
+)
+
+func TestRebuild(t *testing.T) {
+	t.Run("should group archives made at the same time into runs", func(t *testing.T) {
+		objects := []storage.ObjectInfo{
+			{Name: "/backup/backup-photos-1500000000.tar.gz", Size: 10},
+			{Name: "/backup/backup-music-1500000000.tar.gz", Size: 20},
+			{Name: "/backup/backup-photos-1499913600.tar.gz", Size: 30},
+			{Name: DefaultObject, Size: 40},
+			{Name: manifest.Name("/backup/backup-photos-1499913600.tar.gz"), Size: 50},
+		}
+
+		catalog := Rebuild(objects, naming.Default)
+
+		assert.Equal(t, 2, len(catalog.Runs))
+
+		first := catalog.Runs[0]
+		assert.Equal(t, int64(1499913600), first.Started.Unix())
+		assert.Equal(t, StatusSuccess, first.Status)
+		assert.Equal(t, "TarGz", first.Format)
+		assert.Equal(t, EncryptionNone, first.Encryption)
+		assert.Equal(t, []Snapshot{{
+			Folder:   "photos",
+			Object:   "/backup/backup-photos-1499913600.tar.gz",
+			Size:     30,
+			Manifest: manifest.Name("/backup/backup-photos-1499913600.tar.gz"),
+			Status:   StatusSuccess,
+		}}, first.Snapshots)
+
+		second := catalog.Runs[1]
+		assert.Equal(t, int64(1500000000), second.Started.Unix())
+		assert.Equal(t, 2, len(second.Snapshots))
+		assert.Equal(t, "photos", second.Snapshots[0].Folder)
+		assert.Equal(t, "music", second.Snapshots[1].Folder)
+		assert.Equal(t, "", second.Snapshots[1].Manifest)
+	})
+
+	t.Run("should recover the job, host, and run ID if the template has them", func(t *testing.T) {
+		template := naming.MustParse("{{host}}/{{job}}/{{folder}}/{{date:2006-01-02}}-{{run}}")
+
+		objects := []storage.ObjectInfo{
+			{Name: "nas/nightly/photos/2017-07-14-abc.tar.gz"},
+			{Name: "nas/nightly/music/2017-07-14-abc.tar.gz"},
+		}
+
+		catalog := Rebuild(objects, template)
+
+		assert.Equal(t, 1, len(catalog.Runs))
+		assert.Equal(t, "abc", catalog.Runs[0].ID)
+		assert.Equal(t, "nightly", catalog.Runs[0].Job)
+		assert.Equal(t, "nas", catalog.Runs[0].Host)
+		assert.Equal(t, time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC), catalog.Runs[0].Started)
+		assert.Equal(t, 2, len(catalog.Runs[0].Snapshots))
+	})
+}
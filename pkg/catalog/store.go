@@ -0,0 +1,149 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/SeerUK/foldup/pkg/storage"
+)
+
+// maxUpdateAttempts is how many times Update tries to change a catalog that keeps being replaced by
+// others before it gives up.
+const maxUpdateAttempts = 5
+
+// updates makes sure this process only updates a catalog once at a time, e.g. when many jobs back
+// up to the same bucket.
+var updates sync.Mutex
+
+// Store loads and saves a catalog.
+type Store interface {
+	// Load loads the catalog. If there isn't one yet, an empty catalog is returned.
+	Load(ctx context.Context) (*Catalog, error)
+	// Save saves the given catalog, replacing the existing one.
+	Save(ctx context.Context, catalog *Catalog) error
+}
+
+// ObjectStore is a Store that keeps the catalog as a JSON object, using a storage gateway.
+type ObjectStore struct {
+	gateway storage.Gateway
+	name    string
+}
+
+// NewObjectStore creates a new Store instance, using ObjectStore, that keeps the catalog as the
+// object with the given name. The gateway must be able to fetch objects. If the name is empty,
+// DefaultObject is used.
+func NewObjectStore(gateway storage.Gateway, name string) Store {
+	if name == "" {
+		name = DefaultObject
+	}
+
+	return &ObjectStore{
+		gateway: gateway,
+		name:    name,
+	}
+}
+
+// Load fetches and decodes the catalog object. If the gateway keeps track of generations, the
+// generation of the object is remembered, so that the catalog is only saved over it if it hasn't
+// been replaced in the meantime.
+func (s *ObjectStore) Load(ctx context.Context) (*Catalog, error) {
+	reader, generation, generational, err := s.fetch(ctx)
+	if err == storage.ErrNotFound {
+		return &Catalog{Runs: []Run{}, generational: generational}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	catalog := &Catalog{}
+
+	err = json.NewDecoder(reader).Decode(catalog)
+	if err != nil {
+		return nil, fmt.Errorf("catalog: can't decode '%s': %v", s.name, err)
+	}
+
+	catalog.generation = generation
+	catalog.generational = generational
+
+	return catalog, nil
+}
+
+// fetch opens the catalog object for reading, along with its generation, if the gateway keeps track
+// of them.
+func (s *ObjectStore) fetch(ctx context.Context) (io.ReadCloser, int64, bool, error) {
+	if generational, ok := s.gateway.(storage.Generational); ok {
+		reader, generation, err := generational.FetchGeneration(ctx, s.name)
+		if err != storage.ErrUnsupported {
+			return reader, generation, true, err
+		}
+	}
+
+	fetcher, ok := s.gateway.(storage.Fetcher)
+	if !ok {
+		return nil, 0, false, errors.New("catalog: storage can't fetch the catalog")
+	}
+
+	reader, err := fetcher.Fetch(ctx, s.name)
+
+	return reader, 0, false, err
+}
+
+// Save encodes the catalog, and stores it as the catalog object. If the catalog was loaded along
+// with the generation of the catalog object, it's only stored if that object hasn't been replaced
+// since, otherwise storage.ErrPreconditionFailed is returned.
+func (s *ObjectStore) Save(ctx context.Context, catalog *Catalog) error {
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if generational, ok := s.gateway.(storage.Generational); ok && catalog.generational {
+		return generational.StoreGeneration(ctx, s.name, bytes.NewReader(data), catalog.generation)
+	}
+
+	return s.gateway.Store(ctx, s.name, bytes.NewReader(data))
+}
+
+// Update loads the catalog from the given store, changes it using the given function, and saves
+// it again, unless the function returns an error. This process only updates a catalog once at a
+// time. If the store keeps track of generations, and the catalog is replaced by another process
+// before it's saved, e.g. on another host sharing the bucket, it's loaded and changed again, so the
+// function may be called more than once, each time with the latest catalog.
+func Update(ctx context.Context, store Store, change func(catalog *Catalog) error) error {
+	updates.Lock()
+	defer updates.Unlock()
+
+	var err error
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err = update(ctx, store, change)
+		if err != storage.ErrPreconditionFailed {
+			return err
+		}
+	}
+
+	return fmt.Errorf("catalog: gave up after %d attempts, it kept being changed by others: %v", maxUpdateAttempts, err)
+}
+
+// update makes a single attempt at updating the catalog in the given store, for Update.
+func update(ctx context.Context, store Store, change func(catalog *Catalog) error) error {
+	catalog, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = change(catalog)
+	if err != nil {
+		return err
+	}
+
+	return store.Save(ctx, catalog)
+}
@@ -0,0 +1,237 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/storage"
+)
+
+// testGateway is a storage gateway that keeps objects in memory.
+type testGateway struct {
+	objects  map[string][]byte
+	fetchErr error
+}
+
+func (g *testGateway) Store(ctx context.Context, name string, in io.Reader) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	if g.objects == nil {
+		g.objects = make(map[string][]byte)
+	}
+
+	g.objects[name] = data
+
+	return nil
+}
+
+func (g *testGateway) Fetch(ctx context.Context, name string) (io.ReadCloser, error) {
+	if g.fetchErr != nil {
+		return nil, g.fetchErr
+	}
+
+	data, ok := g.objects[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// testGenerationalGateway is a storage gateway that keeps objects in memory, along with their
+// generations.
+type testGenerationalGateway struct {
+	testGateway
+	generations map[string]int64
+	// conflicts is how many times an object is replaced by someone else just before it's stored.
+	conflicts int
+	// unsupported makes the gateway act like it wraps one that doesn't keep track of generations.
+	unsupported bool
+}
+
+func (g *testGenerationalGateway) FetchGeneration(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	if g.unsupported {
+		return nil, 0, storage.ErrUnsupported
+	}
+
+	reader, err := g.Fetch(ctx, name)
+
+	return reader, g.generations[name], err
+}
+
+func (g *testGenerationalGateway) StoreGeneration(ctx context.Context, name string, in io.Reader, generation int64) error {
+	if g.unsupported {
+		return storage.ErrUnsupported
+	}
+
+	if g.generations == nil {
+		g.generations = make(map[string]int64)
+	}
+
+	if g.conflicts > 0 {
+		g.conflicts--
+		g.generations[name]++
+		g.Store(ctx, name, bytes.NewBufferString(`{"runs": []}`))
+	}
+
+	if g.generations[name] != generation {
+		return storage.ErrPreconditionFailed
+	}
+
+	g.generations[name]++
+
+	return g.Store(ctx, name, in)
+}
+
+// testStoreOnlyGateway is a storage gateway that can only store objects.
+type testStoreOnlyGateway struct{}
+
+func (g *testStoreOnlyGateway) Store(ctx context.Context, name string, in io.Reader) error {
+	return nil
+}
+
+func TestObjectStore(t *testing.T) {
+	t.Run("should load an empty catalog if there isn't one yet", func(t *testing.T) {
+		catalog, err := NewObjectStore(&testGateway{}, "").Load(context.Background())
+		assert.OK(t, err)
+		assert.Equal(t, 0, len(catalog.Runs))
+	})
+
+	t.Run("should save and load catalogs", func(t *testing.T) {
+		gateway := &testGateway{}
+		store := NewObjectStore(gateway, "")
+
+		started := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+		saved := &Catalog{Runs: []Run{{ID: "1", Started: started, Status: StatusSuccess, Snapshots: []Snapshot{
+			{Folder: "photos", Object: "photos-1", Size: 10, SHA256: "abc", Status: StatusSuccess},
+		}}}}
+
+		assert.OK(t, store.Save(context.Background(), saved))
+
+		_, ok := gateway.objects[DefaultObject]
+		assert.True(t, ok, "Expected the catalog to be stored as "+DefaultObject)
+
+		loaded, err := store.Load(context.Background())
+		assert.OK(t, err)
+		assert.Equal(t, saved, loaded)
+	})
+
+	t.Run("should error if the catalog can't be decoded", func(t *testing.T) {
+		gateway := &testGateway{objects: map[string][]byte{"catalog.json": []byte("nope")}}
+
+		_, err := NewObjectStore(gateway, "catalog.json").Load(context.Background())
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if the gateway can't fetch objects", func(t *testing.T) {
+		_, err := NewObjectStore(&testStoreOnlyGateway{}, "").Load(context.Background())
+		assert.NotOK(t, err)
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("should save the changed catalog", func(t *testing.T) {
+		store := NewObjectStore(&testGateway{}, "")
+
+		err := Update(context.Background(), store, func(catalog *Catalog) error {
+			catalog.Add(Run{ID: "1"})
+			return nil
+		})
+
+		assert.OK(t, err)
+
+		catalog, err := store.Load(context.Background())
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(catalog.Runs))
+	})
+
+	t.Run("should only save over the catalog it loaded", func(t *testing.T) {
+		gateway := &testGenerationalGateway{}
+		store := NewObjectStore(gateway, "")
+
+		catalog, err := store.Load(context.Background())
+		assert.OK(t, err)
+		assert.OK(t, store.Save(context.Background(), catalog))
+
+		err = store.Save(context.Background(), catalog)
+		assert.Equal(t, storage.ErrPreconditionFailed, err)
+	})
+
+	t.Run("should change the catalog again if it's replaced before it's saved", func(t *testing.T) {
+		gateway := &testGenerationalGateway{conflicts: 2}
+		store := NewObjectStore(gateway, "")
+
+		changes := 0
+
+		err := Update(context.Background(), store, func(catalog *Catalog) error {
+			changes++
+			catalog.Add(Run{ID: "1"})
+			return nil
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, 3, changes)
+
+		catalog, err := store.Load(context.Background())
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(catalog.Runs))
+	})
+
+	t.Run("should give up if the catalog keeps being replaced", func(t *testing.T) {
+		gateway := &testGenerationalGateway{conflicts: maxUpdateAttempts}
+
+		err := Update(context.Background(), NewObjectStore(gateway, ""), func(catalog *Catalog) error {
+			catalog.Add(Run{ID: "1"})
+			return nil
+		})
+
+		assert.NotOK(t, err)
+		assert.Equal(t, `{"runs": []}`, string(gateway.objects[DefaultObject]))
+	})
+
+	t.Run("should update catalogs unconditionally if generations aren't supported", func(t *testing.T) {
+		gateway := &testGenerationalGateway{unsupported: true}
+		store := NewObjectStore(gateway, "")
+
+		err := Update(context.Background(), store, func(catalog *Catalog) error {
+			catalog.Add(Run{ID: "1"})
+			return nil
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(gateway.objects))
+	})
+
+	t.Run("should not save the catalog if changing it fails", func(t *testing.T) {
+		gateway := &testGateway{}
+
+		err := Update(context.Background(), NewObjectStore(gateway, ""), func(catalog *Catalog) error {
+			return errors.New("oops")
+		})
+
+		assert.NotOK(t, err)
+		assert.Equal(t, 0, len(gateway.objects))
+	})
+
+	t.Run("should not save the catalog if it can't be loaded", func(t *testing.T) {
+		gateway := &testGateway{fetchErr: errors.New("oops")}
+
+		err := Update(context.Background(), NewObjectStore(gateway, ""), func(catalog *Catalog) error {
+			t.Error("Expected the catalog not to be changed")
+			return nil
+		})
+
+		assert.NotOK(t, err)
+		assert.Equal(t, 0, len(gateway.objects))
+	})
+}
@@ -0,0 +1,408 @@
+// Package config loads configuration files describing many backup jobs, for foldup to run from a
+// single process. Configuration can be written in YAML or JSON, and is validated as it's loaded.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/docker"
+	"github.com/SeerUK/foldup/pkg/lock"
+	"github.com/SeerUK/foldup/pkg/naming"
+	"github.com/SeerUK/foldup/pkg/scheduling"
+)
+
+// Config is the top-level configuration of a foldup daemon.
+type Config struct {
+	// Jobs are the backup jobs to run.
+	Jobs []Job `json:"jobs"`
+}
+
+// Job describes a single named backup job.
+type Job struct {
+	// Name identifies the job in logs and notifications. It must be unique.
+	Name string `json:"name"`
+	// Sources are the directories whose folders are backed up. Glob patterns, like "/srv/*/data",
+	// are expanded each time the job runs.
+	Sources []string `json:"sources"`
+	// Bucket is the name of the GCS bucket to store archives in.
+	Bucket string `json:"bucket"`
+	// Schedule is a cron expression describing when the job runs.
+	Schedule string `json:"schedule"`
+	// Misfire decides what happens to scheduled runs missed while a run was still going; one of
+	// "skip", "once", or "queue". Defaults to "skip".
+	Misfire string `json:"misfire"`
+	// Timezone is the IANA time zone the schedule is evaluated in. Defaults to the local time zone.
+	Timezone string `json:"timezone"`
+	// Jitter delays each run by a random amount of time, up to this long.
+	Jitter Duration `json:"jitter"`
+	// Format is the archive format to produce. Defaults to TarGz.
+	Format string `json:"format"`
+	// Excludes are patterns of files and directories to leave out of archives.
+	Excludes []string `json:"excludes"`
+	// Mode decides which directories in each source are archived; "children", "self", or
+	// "depth=N". Defaults to "children".
+	Mode string `json:"mode"`
+	// IncludeFiles also archives the files directly in each source, which are otherwise left out
+	// unless the mode is "self".
+	IncludeFiles bool `json:"include_files"`
+	// IncludeHidden also archives hidden folders, whose names start with a dot, which are otherwise
+	// left out.
+	IncludeHidden bool `json:"include_hidden"`
+	// NameTemplate names archives in the bucket, e.g. "{{host}}/{{folder}}/{{folder}}-{{unix}}".
+	// Defaults to naming them after their local path, like "dir/backup-{{folder}}-{{unix}}".
+	NameTemplate string `json:"name_template"`
+	// Catalog records each run in a catalog in the bucket, which is used to find expired archives.
+	Catalog bool `json:"catalog"`
+	// Retention decides how long archives are kept in the bucket.
+	Retention Retention `json:"retention"`
+	// Retry decides how failed uploads are retried.
+	Retry Retry `json:"retry"`
+	// ChunkSize enables resumable uploads, in chunks of this many MiB.
+	ChunkSize int `json:"chunk_size"`
+	// SessionFile is where resumable uploads are tracked. Defaults to a file in the first source.
+	SessionFile string `json:"session_file"`
+	// StateFile is where the times the job last ran are tracked. Defaults to a file in the first
+	// source, and may be shared by many jobs.
+	StateFile string `json:"state_file"`
+	// CatchUp runs the job as soon as foldup starts, if a run was missed while it was stopped.
+	CatchUp bool `json:"catch_up"`
+	// Lock makes sure only one instance runs the job at once, if it's run by many.
+	Lock Lock `json:"lock"`
+	// Hooks are shell commands run around each run, and each folder.
+	Hooks Hooks `json:"hooks"`
+	// Docker finds Docker volumes to back up, as well as any sources.
+	Docker Docker `json:"docker"`
+	// Notifications describes who to tell about each run.
+	Notifications Notifications `json:"notifications"`
+}
+
+// Retention decides how long archives are kept in the bucket. The most recent archive of each
+// folder is always kept.
+type Retention struct {
+	// KeepLast is the number of most recent archives to keep for each folder.
+	KeepLast int `json:"keep_last"`
+	// MaxAge is how long to keep archives for.
+	MaxAge Duration `json:"max_age"`
+}
+
+// Retry decides how failed uploads are retried.
+type Retry struct {
+	// Attempts is the maximum number of attempts to upload each archive.
+	Attempts int `json:"attempts"`
+	// Timeout is the maximum time to spend retrying an upload of an archive, once it first fails.
+	Timeout Duration `json:"timeout"`
+}
+
+// Lock describes how a job is locked before each run, so that only one instance runs it at once.
+type Lock struct {
+	// Type is the kind of lock to take; "gcs", or "file". Jobs aren't locked if it's empty.
+	Type string `json:"type"`
+	// TTL is how long a gcs lock lasts if its holder stops renewing it. Defaults to 5 minutes.
+	TTL Duration `json:"ttl"`
+	// Dir is where lock files are created for file locks. Defaults to the first source, or the
+	// working directory if there are no sources.
+	Dir string `json:"dir"`
+}
+
+// Hooks are shell commands run around each run of a job, and around each folder in a run.
+type Hooks struct {
+	// Pre is run before each run. If it fails, the run fails without backing anything up.
+	Pre string `json:"pre"`
+	// Post is run after each run, whatever its outcome.
+	Post string `json:"post"`
+	// PreFolder is run before each folder is archived. If it fails, the folder isn't backed up.
+	PreFolder string `json:"pre_folder"`
+	// PostFolder is run as soon as each folder is archived, whatever its outcome.
+	PostFolder string `json:"post_folder"`
+	// Timeout is how long each hook may run for. Defaults to 10 minutes.
+	Timeout Duration `json:"timeout"`
+}
+
+// Docker describes how Docker volumes are found and backed up by a job.
+type Docker struct {
+	// Enabled finds volumes to back up using the Docker engine, on each run.
+	Enabled bool `json:"enabled"`
+	// Socket is the Docker engine's socket. Defaults to /var/run/docker.sock.
+	Socket string `json:"socket"`
+	// Label is the label volumes need to be backed up, as "name" or "name=value". Defaults to
+	// "foldup.enable=true".
+	Label string `json:"label"`
+	// Stop decides what's done with the containers using a volume while it's archived; "none",
+	// "stop", or "pause". Defaults to "none".
+	Stop string `json:"stop"`
+}
+
+// Notifications describes who to tell about each run of a job.
+type Notifications struct {
+	WebhookURL      string            `json:"webhook_url"`
+	WebhookHeaders  map[string]string `json:"webhook_headers"`
+	WebhookTemplate string            `json:"webhook_template"`
+	SlackURL        string            `json:"slack_url"`
+	PingURL         string            `json:"ping_url"`
+	SMTP            SMTP              `json:"smtp"`
+	EmailFrom       string            `json:"email_from"`
+	EmailTo         []string          `json:"email_to"`
+	EmailDigest     bool              `json:"email_digest"`
+}
+
+// SMTP describes how to connect to a mail server.
+type SMTP struct {
+	Addr     string `json:"addr"`
+	StartTLS bool   `json:"starttls"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Duration is a time.Duration that is written in configuration as a string, like "90m". A "d"
+// suffix may also be used for whole days, like "30d".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration from a JSON string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("expected a duration like \"90m\" or \"30d\", found %s", data)
+	}
+
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = parsed
+
+	return nil
+}
+
+// ParseDuration parses a duration like time.ParseDuration, but also accepts a number of days, like
+// "30d".
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err == nil {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+
+	return time.ParseDuration(s)
+}
+
+// Load reads, parses and validates the configuration file at the given path. Files ending in
+// ".json" are parsed as JSON, anything else as YAML.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+
+	config, err := Parse(data, strings.ToLower(filepath.Ext(path)) == ".json")
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// Parse parses and validates configuration, either as JSON, or as YAML.
+func Parse(data []byte, isJSON bool) (*Config, error) {
+	if !isJSON {
+		tree, err := parseYAML(data)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err = json.Marshal(tree)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var config Config
+	if err := decoder.Decode(&config); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// ValidationError lists everything wrong with a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// Validate checks the configuration, filling in defaults. All problems found are returned together
+// in a *ValidationError, so that they can all be fixed at once.
+func (c *Config) Validate() error {
+	problems := []string{}
+
+	if len(c.Jobs) == 0 {
+		problems = append(problems, "no jobs are defined")
+	}
+
+	names := make(map[string]bool)
+
+	for i := range c.Jobs {
+		job := &c.Jobs[i]
+
+		prefix := fmt.Sprintf("jobs[%d]", i)
+		if job.Name != "" {
+			prefix = fmt.Sprintf("job '%s'", job.Name)
+		}
+
+		if job.Name == "" {
+			problems = append(problems, prefix+": name is required")
+		} else if names[job.Name] {
+			problems = append(problems, prefix+": name is used by more than one job")
+		}
+
+		names[job.Name] = true
+
+		for _, problem := range job.validate() {
+			problems = append(problems, prefix+": "+problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// validate checks a single job, filling in defaults, and returns a description of each problem.
+func (j *Job) validate() []string {
+	problems := []string{}
+
+	if len(j.Sources) == 0 && !j.Docker.Enabled {
+		problems = append(problems, "at least one source is required, unless docker is enabled")
+	}
+
+	for _, source := range j.Sources {
+		// Patterns may match different directories on each run, so only their syntax is checked.
+		if strings.ContainsAny(source, "*?[") {
+			if _, err := filepath.Match(source, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("source pattern '%s' is invalid: %v", source, err))
+			}
+
+			continue
+		}
+
+		info, err := os.Stat(source)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("source '%s' can't be read: %v", source, err))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("source '%s' is not a directory", source))
+		}
+	}
+
+	if j.Bucket == "" {
+		problems = append(problems, "bucket is required")
+	}
+
+	if j.Schedule == "" {
+		problems = append(problems, "schedule is required")
+	} else if interval, err := scheduling.Interval(j.Schedule); err != nil {
+		problems = append(problems, fmt.Sprintf("schedule '%s' is invalid: %v", j.Schedule, err))
+	} else if j.Jitter.Duration >= interval {
+		problems = append(problems, fmt.Sprintf("jitter must be shorter than the interval of schedule '%s', %s", j.Schedule, interval))
+	}
+
+	if misfire, err := scheduling.ParseMisfire(j.Misfire); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		j.Misfire = string(misfire)
+	}
+
+	if _, err := time.LoadLocation(j.Timezone); err != nil {
+		problems = append(problems, fmt.Sprintf("timezone '%s' is invalid: %v", j.Timezone, err))
+	}
+
+	if j.Format == "" {
+		j.Format = string(archive.TarGz)
+	}
+
+	if format, err := archive.ParseFormatName(j.Format); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		j.Format = string(format)
+	}
+
+	if err := archive.ValidateExcludes(j.Excludes); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if _, err := naming.Parse(j.NameTemplate); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if mode, err := archive.ParseMode(j.Mode); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		j.Mode = mode.String()
+	}
+
+	if j.Retention.KeepLast < 0 || j.Retention.MaxAge.Duration < 0 {
+		problems = append(problems, "retention can't be negative")
+	}
+
+	if j.Retry.Attempts < 0 || j.Retry.Timeout.Duration < 0 {
+		problems = append(problems, "retry can't be negative")
+	}
+
+	if j.ChunkSize < 0 {
+		problems = append(problems, "chunk_size can't be negative")
+	}
+
+	if j.Jitter.Duration < 0 {
+		problems = append(problems, "jitter can't be negative")
+	}
+
+	if _, err := lock.ParseKind(j.Lock.Type); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if j.Lock.TTL.Duration < 0 {
+		problems = append(problems, "lock ttl can't be negative")
+	}
+
+	if j.Hooks.Timeout.Duration < 0 {
+		problems = append(problems, "hooks timeout can't be negative")
+	}
+
+	if _, err := docker.ParseStopMode(j.Docker.Stop); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	n := j.Notifications
+	if n.SMTP.Addr != "" && (n.EmailFrom == "" || len(n.EmailTo) == 0) {
+		problems = append(problems, "notifications: email_from and email_to are required to send email")
+	}
+
+	if n.SMTP.Addr == "" && (n.EmailFrom != "" || len(n.EmailTo) > 0) {
+		problems = append(problems, "notifications: smtp.addr is required to send email")
+	}
+
+	return problems
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("should load and validate a YAML file", func(t *testing.T) {
+		config, err := Load("testdata/foldup.yaml")
+		assert.OK(t, err)
+
+		assert.Equal(t, 2, len(config.Jobs))
+
+		photos := config.Jobs[0]
+		assert.Equal(t, "photos", photos.Name)
+		assert.Equal(t, []string{"testdata"}, photos.Sources)
+		assert.Equal(t, "0 3 * * *", photos.Schedule)
+		assert.Equal(t, "skip", photos.Misfire)
+		assert.True(t, photos.CatchUp, "Expected catching up to be enabled")
+		assert.Equal(t, "gcs", photos.Lock.Type)
+		assert.Equal(t, "children", photos.Mode)
+		assert.True(t, photos.IncludeFiles, "Expected top-level files to be included")
+		assert.True(t, photos.IncludeHidden, "Expected hidden folders to be included")
+		assert.True(t, photos.Catalog, "Expected the catalog to be enabled")
+		assert.Equal(t, 10*time.Minute, photos.Lock.TTL.Duration)
+		assert.Equal(t, "TarGz", photos.Format)
+		assert.Equal(t, []string{"*.tmp", "cache/*"}, photos.Excludes)
+		assert.Equal(t, 7, photos.Retention.KeepLast)
+		assert.Equal(t, 30*24*time.Hour, photos.Retention.MaxAge.Duration)
+		assert.Equal(t, time.Hour, photos.Retry.Timeout.Duration)
+		assert.Equal(t, "Bearer xyz", photos.Notifications.WebhookHeaders["Authorization"])
+
+		documents := config.Jobs[1]
+		assert.True(t, documents.Docker.Enabled, "Expected Docker volumes to be backed up")
+		assert.Equal(t, "pause", documents.Docker.Stop)
+		assert.Equal(t, "{{host}}/{{folder}}/{{date:2006/01/02}}/{{folder}}-{{unix}}", documents.NameTemplate)
+		assert.Equal(t, "documents", documents.Name)
+		assert.Equal(t, "0 * * * *", documents.Schedule)
+		assert.Equal(t, "once", documents.Misfire)
+		assert.Equal(t, "TarGz", documents.Format)
+		assert.Equal(t, 8, documents.ChunkSize)
+		assert.Equal(t, "children", documents.Mode)
+		assert.Equal(t, `rm -f "$FOLDUP_FOLDER_PATH/dump.sql"`, documents.Hooks.PostFolder)
+		assert.Equal(t, 30*time.Minute, documents.Hooks.Timeout.Duration)
+		assert.True(t, documents.Notifications.SMTP.StartTLS, "Expected STARTTLS to be enabled")
+		assert.Equal(t, []string{"ops@example.com"}, documents.Notifications.EmailTo)
+	})
+
+	t.Run("should error if the file doesn't exist", func(t *testing.T) {
+		_, err := Load("testdata/nope.yaml")
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestParse(t *testing.T) {
+	t.Run("should parse JSON", func(t *testing.T) {
+		doc := `{"jobs": [{"name": "a", "sources": ["testdata"], "bucket": "b", "schedule": "0 * * * *"}]}`
+
+		config, err := Parse([]byte(doc), true)
+
+		assert.OK(t, err)
+		assert.Equal(t, "a", config.Jobs[0].Name)
+	})
+
+	t.Run("should error on unknown fields", func(t *testing.T) {
+		doc := "jobs:\n  - name: a\n    shedule: 0 * * * *\n"
+
+		_, err := Parse([]byte(doc), false)
+
+		assert.NotOK(t, err)
+		assert.True(t, strings.Contains(err.Error(), "shedule"), "Expected the unknown field to be named")
+	})
+
+	t.Run("should error on invalid durations", func(t *testing.T) {
+		doc := "jobs:\n  - name: a\n    retention:\n      max_age: soon\n"
+
+		_, err := Parse([]byte(doc), false)
+
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should list every problem with the configuration", func(t *testing.T) {
+		doc := `
+jobs:
+  - name: a
+    sources: [testdata/foldup.yaml, testdata/nope, "testdata/*", "testdata/[oops"]
+    schedule: whenever
+    misfire: sometimes
+    timezone: Mars/Olympus_Mons
+    format: zip
+    excludes: ["[oops"]
+    name_template: "{{host}}/{{unix}}"
+    mode: everything
+    lock:
+      type: redis
+    hooks:
+      timeout: -1m
+    docker:
+      stop: kill
+    notifications:
+      email_to: [ops@example.com]
+  - name: a
+    bucket: b
+    schedule: 0 * * * *
+    jitter: 1h
+  - sources: [testdata]
+`
+		_, err := Parse([]byte(doc), false)
+		assert.NotOK(t, err)
+
+		verr, ok := err.(*ValidationError)
+		assert.True(t, ok, "Expected a validation error")
+
+		expected := []string{
+			"job 'a': source 'testdata/foldup.yaml' is not a directory",
+			"job 'a': source 'testdata/nope' can't be read",
+			"job 'a': source pattern 'testdata/[oops' is invalid",
+			"job 'a': bucket is required",
+			"job 'a': schedule 'whenever' is invalid",
+			"job 'a': scheduling: unknown misfire policy 'sometimes'",
+			"job 'a': timezone 'Mars/Olympus_Mons' is invalid",
+			"job 'a': archive: unknown format 'zip'",
+			"job 'a': archive: invalid exclude pattern '[oops'",
+			"job 'a': naming: template '{{host}}/{{unix}}' must include {{folder}} or {{path}}",
+			"job 'a': archive: unknown mode 'everything'",
+			"job 'a': lock: unknown lock type 'redis'",
+			"job 'a': hooks timeout can't be negative",
+			"job 'a': docker: unknown stop mode 'kill', expected one of: none, stop, pause",
+			"job 'a': notifications: smtp.addr is required to send email",
+			"job 'a': name is used by more than one job",
+			"job 'a': at least one source is required, unless docker is enabled",
+			"job 'a': jitter must be shorter than the interval of schedule '0 * * * *'",
+			"jobs[2]: name is required",
+			"jobs[2]: bucket is required",
+			"jobs[2]: schedule is required",
+		}
+
+		assert.Equal(t, len(expected), len(verr.Problems))
+
+		for i, problem := range expected {
+			assert.True(t, strings.HasPrefix(verr.Problems[i], problem), "Unexpected problem: "+verr.Problems[i])
+		}
+	})
+
+	t.Run("should error if there are no jobs", func(t *testing.T) {
+		_, err := Parse([]byte("jobs: []\n"), false)
+
+		assert.NotOK(t, err)
+	})
+}
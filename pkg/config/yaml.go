@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// parseYAML parses a YAML document into maps, slices and scalar values, in the same shapes that
+// encoding/json would produce, so that it can be decoded into structs by way of JSON. Keys must be
+// unique within each mapping.
+func parseYAML(data []byte) (interface{}, error) {
+	var value interface{}
+
+	err := yaml.UnmarshalStrict(data, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	return jsonValue(value)
+}
+
+// jsonValue converts the mappings in a value decoded from YAML, which may have keys of any type,
+// into mappings with string keys, as encoding/json expects.
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		mapping := make(map[string]interface{}, len(v))
+
+		for key, item := range v {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("yaml: mapping keys must be strings, found %v", key)
+			}
+
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+
+			mapping[name] = converted
+		}
+
+		return mapping, nil
+	case []interface{}:
+		sequence := make([]interface{}, len(v))
+
+		for i, item := range v {
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+
+			sequence[i] = converted
+		}
+
+		return sequence, nil
+	default:
+		return v, nil
+	}
+}
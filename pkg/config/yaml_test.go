@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestParseYAML(t *testing.T) {
+	t.Run("should parse nested mappings and sequences", func(t *testing.T) {
+		doc := `
+# Comment
+name: test # trailing comment
+count: 3
+ratio: 0.5
+enabled: true
+missing: ~
+url: "http://example.com/#anchor"
+quoted: 'it''s'
+list: [a, "b, c", 1]
+items:
+- one
+-   two
+nested:
+  - key: value
+    other:
+      - deep
+  -
+    key: second
+`
+		value, err := parseYAML([]byte(doc))
+		assert.OK(t, err)
+
+		expected := map[string]interface{}{
+			"name":    "test",
+			"count":   3,
+			"ratio":   0.5,
+			"enabled": true,
+			"missing": nil,
+			"url":     "http://example.com/#anchor",
+			"quoted":  "it's",
+			"list":    []interface{}{"a", "b, c", 1},
+			"items":   []interface{}{"one", "two"},
+			"nested": []interface{}{
+				map[string]interface{}{
+					"key":   "value",
+					"other": []interface{}{"deep"},
+				},
+				map[string]interface{}{
+					"key": "second",
+				},
+			},
+		}
+
+		assert.Equal(t, expected, value)
+	})
+
+	t.Run("should return an empty mapping for an empty document", func(t *testing.T) {
+		value, err := parseYAML([]byte("# Nothing here\n"))
+
+		assert.OK(t, err)
+		assert.Equal(t, map[string]interface{}{}, value)
+	})
+
+	t.Run("should support multi-line strings", func(t *testing.T) {
+		value, err := parseYAML([]byte("script: |\n  echo one\n  echo two\n"))
+
+		assert.OK(t, err)
+		assert.Equal(t, map[string]interface{}{"script": "echo one\necho two\n"}, value)
+	})
+
+	t.Run("should report the line of any error", func(t *testing.T) {
+		tests := map[string]string{
+			"a: 1\n  b: 2\n": "line 2",
+			"a: 1\na: 2\n":   "line 2",
+			"a: \"oops\n":    "line 2",
+			"a:\n\t- b\n":    "line 2",
+			"a: 1\n- b\n":    "line 1",
+		}
+
+		for doc, expected := range tests {
+			_, err := parseYAML([]byte(doc))
+
+			assert.NotOK(t, err)
+			assert.True(t, strings.Contains(err.Error(), expected), "Unexpected error: "+err.Error())
+		}
+	})
+
+	t.Run("should error if mapping keys aren't strings", func(t *testing.T) {
+		_, err := parseYAML([]byte("1: one\n"))
+		assert.NotOK(t, err)
+	})
+}
@@ -0,0 +1,208 @@
+// Package docker is a small client for the parts of the Docker Engine API that foldup needs to find
+// volumes to back up, and to stop or pause the containers using them while they're archived. It
+// talks to the engine over its unix socket, without depending on the Docker client libraries.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultSocket is where the Docker engine listens by default.
+const DefaultSocket = "/var/run/docker.sock"
+
+// Volume is a Docker volume.
+type Volume struct {
+	// Name is the name of the volume.
+	Name string `json:"Name"`
+	// Driver is the volume driver that manages the volume.
+	Driver string `json:"Driver"`
+	// Mountpoint is where the volume's data is, on the host.
+	Mountpoint string `json:"Mountpoint"`
+	// Labels are the labels set on the volume.
+	Labels map[string]string `json:"Labels"`
+}
+
+// Container is a Docker container.
+type Container struct {
+	// ID is the ID of the container.
+	ID string `json:"Id"`
+	// Names are the names of the container.
+	Names []string `json:"Names"`
+	// State is the state of the container, e.g. "running", or "paused".
+	State string `json:"State"`
+}
+
+// Name returns the name of the container, or its ID if it has no name.
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// Client is a client for the Docker Engine API.
+type Client interface {
+	// Volumes lists the volumes with all of the given labels. Labels may be given as a name, to
+	// match any value, or as name=value.
+	Volumes(ctx context.Context, labels ...string) ([]Volume, error)
+	// Containers lists the running containers that use the volume with the given name.
+	Containers(ctx context.Context, volume string) ([]Container, error)
+	// Stop stops the container with the given ID.
+	Stop(ctx context.Context, id string) error
+	// Start starts the container with the given ID.
+	Start(ctx context.Context, id string) error
+	// Pause pauses the container with the given ID. Pausing a container that's already paused isn't
+	// an error.
+	Pause(ctx context.Context, id string) error
+	// Unpause unpauses the container with the given ID.
+	Unpause(ctx context.Context, id string) error
+}
+
+// apiClient is a Client that makes requests to the Docker engine over HTTP.
+type apiClient struct {
+	client *http.Client
+}
+
+// NewClient creates a new Client instance, using apiClient, that talks to the Docker engine on the
+// unix socket at the given path. If the path is empty, DefaultSocket is used.
+func NewClient(socket string) Client {
+	if socket == "" {
+		socket = DefaultSocket
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	return &apiClient{
+		client: &http.Client{Transport: transport},
+	}
+}
+
+func (c *apiClient) Volumes(ctx context.Context, labels ...string) ([]Volume, error) {
+	query := url.Values{}
+	if len(labels) > 0 {
+		query.Set("filters", filters("label", labels...))
+	}
+
+	var res struct {
+		Volumes []Volume `json:"Volumes"`
+	}
+
+	err := c.do(ctx, http.MethodGet, "/volumes", query, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Volumes, nil
+}
+
+func (c *apiClient) Containers(ctx context.Context, volume string) ([]Container, error) {
+	query := url.Values{}
+	query.Set("filters", filters("volume", volume))
+
+	containers := []Container{}
+
+	err := c.do(ctx, http.MethodGet, "/containers/json", query, &containers)
+	if err != nil {
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+func (c *apiClient) Stop(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/stop", nil, nil)
+}
+
+func (c *apiClient) Start(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/start", nil, nil)
+}
+
+func (c *apiClient) Pause(ctx context.Context, id string) error {
+	// Pausing a container that's already paused conflicts, but it's left paused, as asked.
+	return c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/pause", nil, nil, http.StatusConflict)
+}
+
+func (c *apiClient) Unpause(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/unpause", nil, nil)
+}
+
+// do makes a request to the given API path, decoding the JSON response into `out` if it's not nil.
+// A response saying that nothing was modified, e.g. when stopping a container that's already
+// stopped, is not an error, and nor is a response with any of the given statuses.
+func (c *apiClient) do(ctx context.Context, method string, path string, query url.Values, out interface{}, unmodified ...int) error {
+	// The host is ignored, as every request goes to the socket.
+	u := "http://docker" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("docker: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	for _, status := range unmodified {
+		if res.StatusCode == status {
+			return nil
+		}
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return responseError(method, path, res)
+	}
+
+	if out == nil {
+		ioutil.ReadAll(res.Body)
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// responseError creates an error from an unsuccessful response, including the message the engine
+// gave, if there is one.
+func responseError(method string, path string, res *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+
+	data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		return fmt.Errorf("docker: %s %s responded with '%s': %s", method, path, res.Status, body.Message)
+	}
+
+	return fmt.Errorf("docker: %s %s responded with '%s'", method, path, res.Status)
+}
+
+// filters encodes a filter on the given key, matching any of the given values, as the engine
+// expects to find it in a query string.
+func filters(key string, values ...string) string {
+	data, _ := json.Marshal(map[string][]string{key: values})
+
+	return string(data)
+}
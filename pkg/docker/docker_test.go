@@ -0,0 +1,183 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestClient_Volumes(t *testing.T) {
+	t.Run("should list volumes with the given labels", func(t *testing.T) {
+		engine := newTestEngine(t)
+		defer engine.Close()
+
+		engine.volumes = []Volume{
+			{Name: "db", Mountpoint: "/var/lib/docker/volumes/db/_data", Labels: map[string]string{"foldup.enable": "true"}},
+		}
+
+		volumes, err := NewClient(engine.socket).Volumes(context.Background(), "foldup.enable=true")
+		assert.OK(t, err)
+		assert.Equal(t, engine.volumes, volumes)
+		assert.Equal(t, `{"label":["foldup.enable=true"]}`, engine.query.Get("filters"))
+	})
+
+	t.Run("should error with the engine's message if the request fails", func(t *testing.T) {
+		engine := newTestEngine(t)
+		defer engine.Close()
+
+		engine.status = http.StatusInternalServerError
+
+		_, err := NewClient(engine.socket).Volumes(context.Background())
+		assert.NotOK(t, err)
+		assert.Equal(t, "docker: GET /volumes responded with '500 Internal Server Error': oops", err.Error())
+	})
+
+	t.Run("should error if the engine can't be reached", func(t *testing.T) {
+		_, err := NewClient(path.Join(os.TempDir(), "foldup-no-such.sock")).Volumes(context.Background())
+		assert.NotOK(t, err)
+	})
+}
+
+func TestClient_Containers(t *testing.T) {
+	t.Run("should list the containers using the given volume", func(t *testing.T) {
+		engine := newTestEngine(t)
+		defer engine.Close()
+
+		engine.containers = []Container{{ID: "abc", Names: []string{"/db"}, State: "running"}}
+
+		containers, err := NewClient(engine.socket).Containers(context.Background(), "db")
+		assert.OK(t, err)
+		assert.Equal(t, engine.containers, containers)
+		assert.Equal(t, "db", containers[0].Name())
+		assert.Equal(t, `{"volume":["db"]}`, engine.query.Get("filters"))
+	})
+}
+
+func TestClient_Stop(t *testing.T) {
+	t.Run("should stop, start, pause and unpause containers", func(t *testing.T) {
+		engine := newTestEngine(t)
+		defer engine.Close()
+
+		client := NewClient(engine.socket)
+
+		assert.OK(t, client.Stop(context.Background(), "abc"))
+		assert.OK(t, client.Start(context.Background(), "abc"))
+		assert.OK(t, client.Pause(context.Background(), "abc"))
+		assert.OK(t, client.Unpause(context.Background(), "abc"))
+
+		expected := []string{
+			"POST /containers/abc/stop",
+			"POST /containers/abc/start",
+			"POST /containers/abc/pause",
+			"POST /containers/abc/unpause",
+		}
+
+		assert.Equal(t, expected, engine.requests)
+	})
+
+	t.Run("should not error if the container is already stopped", func(t *testing.T) {
+		engine := newTestEngine(t)
+		defer engine.Close()
+
+		engine.status = http.StatusNotModified
+
+		assert.OK(t, NewClient(engine.socket).Stop(context.Background(), "abc"))
+	})
+
+	t.Run("should not error if the container is already paused", func(t *testing.T) {
+		engine := newTestEngine(t)
+		defer engine.Close()
+
+		engine.status = http.StatusConflict
+
+		assert.OK(t, NewClient(engine.socket).Pause(context.Background(), "abc"))
+		assert.NotOK(t, NewClient(engine.socket).Stop(context.Background(), "abc"))
+	})
+}
+
+func TestParseStopMode(t *testing.T) {
+	t.Run("should parse each stop mode", func(t *testing.T) {
+		for s, expected := range map[string]StopMode{"": StopNone, "none": StopNone, "stop": StopStop, "pause": StopPause} {
+			mode, err := ParseStopMode(s)
+			assert.OK(t, err)
+			assert.Equal(t, expected, mode)
+		}
+	})
+
+	t.Run("should error if the stop mode is unknown", func(t *testing.T) {
+		_, err := ParseStopMode("kill")
+		assert.NotOK(t, err)
+	})
+}
+
+// testEngine is a fake Docker engine, listening on a unix socket.
+type testEngine struct {
+	sync.Mutex
+	*httptest.Server
+
+	socket     string
+	dir        string
+	status     int
+	volumes    []Volume
+	containers []Container
+	query      url.Values
+	requests   []string
+}
+
+func newTestEngine(t *testing.T) *testEngine {
+	dir, err := ioutil.TempDir("", "foldup-docker")
+	assert.OK(t, err)
+
+	engine := &testEngine{
+		socket: path.Join(dir, "docker.sock"),
+		dir:    dir,
+	}
+
+	listener, err := net.Listen("unix", engine.socket)
+	assert.OK(t, err)
+
+	engine.Server = httptest.NewUnstartedServer(http.HandlerFunc(engine.handle))
+	engine.Server.Listener.Close()
+	engine.Server.Listener = listener
+	engine.Server.Start()
+
+	return engine
+}
+
+func (e *testEngine) Close() {
+	e.Server.Close()
+	os.RemoveAll(e.dir)
+}
+
+func (e *testEngine) handle(w http.ResponseWriter, r *http.Request) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.query = r.URL.Query()
+	e.requests = append(e.requests, r.Method+" "+r.URL.Path)
+
+	if e.status != 0 {
+		w.WriteHeader(e.status)
+		json.NewEncoder(w).Encode(map[string]string{"message": "oops"})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/volumes":
+		json.NewEncoder(w).Encode(map[string][]Volume{"Volumes": e.volumes})
+	case "/containers/json":
+		json.NewEncoder(w).Encode(e.containers)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
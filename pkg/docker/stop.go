@@ -0,0 +1,30 @@
+package docker
+
+import (
+	"fmt"
+)
+
+// StopMode decides what's done with the containers using a volume while it's archived.
+type StopMode string
+
+// Available stop modes.
+const (
+	// StopNone leaves containers running.
+	StopNone StopMode = "none"
+	// StopStop stops containers, and starts them again afterwards.
+	StopStop StopMode = "stop"
+	// StopPause pauses containers, and unpauses them afterwards.
+	StopPause StopMode = "pause"
+)
+
+// ParseStopMode parses a stop mode; "none", "stop", or "pause". An empty string gives StopNone.
+func ParseStopMode(s string) (StopMode, error) {
+	switch StopMode(s) {
+	case "", StopNone:
+		return StopNone, nil
+	case StopStop, StopPause:
+		return StopMode(s), nil
+	}
+
+	return StopNone, fmt.Errorf("docker: unknown stop mode '%s', expected one of: none, stop, pause", s)
+}
@@ -5,7 +5,9 @@ import (
 
 	"github.com/SeerUK/foldup/pkg/foldup"
 	"github.com/SeerUK/foldup/pkg/foldup/cli/command"
+	"github.com/SeerUK/foldup/pkg/logging"
 	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
 )
 
 // CreateApplication builds the console application instance. Providing it with some basic
@@ -22,7 +24,23 @@ func CreateApplication(writer io.Writer) *console.Application {
 ╚═╝      ╚═════╝ ╚══════╝╚═════╝  ╚═════╝ ╚═╝
 `
 
-	application.AddCommands(buildCommands(foldup.NewCLIFactory()))
+	var logConfig logging.Config
+
+	application.Configure = func(def *console.Definition) {
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&logConfig.Format),
+			Spec:  "--log-format=FORMAT",
+			Desc:  "The format to write logs in, either 'logfmt' or 'json' (default: logfmt)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&logConfig.Level),
+			Spec:  "--log-level=LEVEL",
+			Desc:  "The minimum level of logs to write: debug, info, warn or error (default: info)",
+		})
+	}
+
+	application.AddCommands(buildCommands(foldup.NewCLIFactory(&logConfig)))
 
 	return application
 }
@@ -31,5 +49,12 @@ func CreateApplication(writer io.Writer) *console.Application {
 func buildCommands(factory foldup.Factory) []*console.Command {
 	return []*console.Command{
 		command.BackupCommand(factory),
+		command.CatCommand(factory),
+		command.FindCommand(factory),
+		command.ListCommand(factory),
+		command.RebuildCatalogCommand(factory),
+		command.RestoreCommand(factory),
+		command.RunCommand(factory),
+		command.ScheduleCommand(),
 	}
 }
@@ -2,14 +2,25 @@ package command
 
 import (
 	"context"
+	"errors"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/docker"
 	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/health"
+	"github.com/SeerUK/foldup/pkg/lock"
+	"github.com/SeerUK/foldup/pkg/metrics"
+	"github.com/SeerUK/foldup/pkg/naming"
+	"github.com/SeerUK/foldup/pkg/notify"
 	"github.com/SeerUK/foldup/pkg/scheduling"
 	"github.com/SeerUK/foldup/pkg/storage"
-	"github.com/SeerUK/foldup/pkg/xioutil"
 	"github.com/eidolon/console"
 	"github.com/eidolon/console/parameters"
 )
@@ -17,12 +28,26 @@ import (
 // BackupFmt is the filename format for the created archives.
 const BackupFmt = "backup-%s-%d"
 
+// SessionFile is the default name of the file used to keep track of resumable uploads. It lives in
+// the directory being backed up, alongside the archives it refers to.
+const SessionFile = ".foldup-sessions.json"
+
+// StateFile is the default name of the file used to keep track of when scheduled backups last ran.
+// Like SessionFile, it lives in the directory being backed up.
+const StateFile = ".foldup-state.json"
+
 // For testing
 var (
-	archiveDirsf = archive.Dirsf
-	osOpen       = os.Open
-	osRemove     = os.Remove
-	scheduleFunc = scheduling.ScheduleFunc
+	archiveDirsf  = archive.NamedDirsf
+	archiveFilesf = archive.Filesf
+	osEnviron     = os.Environ
+	osCreate      = os.Create
+	osOpen        = os.Open
+	osRemove      = os.Remove
+	netListen     = net.Listen
+	scheduleFunc  = scheduling.Schedule
+	signalNotify  = signal.Notify
+	signalStop    = signal.Stop
 )
 
 // BackupCommand creates a command to trigger periodic backups.
@@ -30,12 +55,45 @@ func BackupCommand(factory foldup.Factory) *console.Command {
 	var bucket string
 	var dirname string
 	var schedule string
+	var chunkSize int
+	var sessionFile string
+	var metricsAddr string
+	var healthAddr string
+	var runOnStart bool
+	var triggerAddr string
+	var misfire string
+	var timezone string
+	var jitter time.Duration
+	var stateFile string
+	var catchUp bool
+	var dryRun bool
+	var lockType string
+	var lockTTL time.Duration
+	var lockDir string
+	var notifications notifyConfig
+	var hooks backupHooks
+	var mode string
+	var includeFiles bool
+	var includeHidden bool
+	var useDocker bool
+	var dockerSocket string
+	var dockerLabel string
+	var dockerStop string
+	var nameTemplate string
+	var useCatalog bool
+	var definition *console.Definition
+
+	readyFactor := 2
+
+	retryPolicy := storage.DefaultRetryPolicy()
 
 	configure := func(def *console.Definition) {
+		definition = def
+
 		def.AddArgument(console.ArgumentDefinition{
 			Value: parameters.NewStringValue(&dirname),
-			Spec:  "DIRNAME",
-			Desc:  "The directory to archive folders from",
+			Spec:  "[DIRNAME]",
+			Desc:  "The directory to archive folders from; more directories, or glob patterns like /srv/*/data, may follow it",
 		})
 
 		def.AddOption(console.OptionDefinition{
@@ -49,25 +107,420 @@ func BackupCommand(factory foldup.Factory) *console.Command {
 			Spec:  "-s, --schedule=SCHEDULE",
 			Desc:  "A cron-like expression, for scheduling recurring backups",
 		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewIntValue(&retryPolicy.MaxAttempts),
+			Spec:  "--retry-attempts=ATTEMPTS",
+			Desc:  "The maximum number of attempts made to upload each archive (default: 5)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewDurationValue(&retryPolicy.MaxElapsed),
+			Spec:  "--retry-timeout=DURATION",
+			Desc:  "The maximum time spent retrying an upload of an archive once it first fails (default: 15m)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewIntValue(&chunkSize),
+			Spec:  "--chunk-size=MIB",
+			Desc:  "Upload archives using resumable uploads, in chunks of this many MiB",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&sessionFile),
+			Spec:  "--session-file=FILE",
+			Desc:  "Where to keep track of resumable uploads (default: DIRNAME/" + SessionFile + ")",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&metricsAddr),
+			Spec:  "--metrics-addr=ADDR",
+			Desc:  "An address to expose Prometheus metrics on, at /metrics, e.g. ':9100'",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&healthAddr),
+			Spec:  "--health-addr=ADDR",
+			Desc:  "An address to expose /healthz and /readyz on when scheduled, e.g. ':8080'",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewIntValue(&readyFactor),
+			Spec:  "--ready-factor=N",
+			Desc:  "Only ready if a backup succeeded within N times the schedule interval (default: 2)",
+		})
+
+		notifications.configure(def)
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewBoolValue(&runOnStart),
+			Spec:  "--run-on-start",
+			Desc:  "Run a backup straight away when scheduled, rather than waiting for the first run",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&triggerAddr),
+			Spec:  "--trigger-addr=ADDR",
+			Desc:  "An address to accept POST /trigger on, forcing a scheduled backup to run now",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&misfire),
+			Spec:  "--misfire=POLICY",
+			Desc:  "What to do about runs missed while a backup was running: skip, once, or queue (default: skip)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&timezone),
+			Spec:  "--timezone=ZONE",
+			Desc:  "An IANA time zone to evaluate the schedule in, e.g. 'Europe/London' (default: local)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewDurationValue(&jitter),
+			Spec:  "--jitter=DURATION",
+			Desc:  "Delay each scheduled backup by a random amount of time, up to this long, which must be shorter than the interval",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&stateFile),
+			Spec:  "--state-file=FILE",
+			Desc:  "Where to keep track of when scheduled backups last ran (default: DIRNAME/" + StateFile + ")",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewBoolValue(&catchUp),
+			Spec:  "--catch-up",
+			Desc:  "Run a backup straight away when scheduled, if a run was missed while foldup was stopped",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewBoolValue(&dryRun),
+			Spec:  "--dry-run",
+			Desc:  "Show what would be backed up, without archiving or uploading anything",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&lockType),
+			Spec:  "--lock=TYPE",
+			Desc:  "Only back up if no other instance is backing up the same folders: gcs, or file",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewDurationValue(&lockTTL),
+			Spec:  "--lock-ttl=DURATION",
+			Desc:  "How long a gcs lock lasts if its holder stops renewing it, e.g. by crashing (default: 5m)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&lockDir),
+			Spec:  "--lock-dir=DIR",
+			Desc:  "Where to create lock files when using file locks (default: DIRNAME)",
+		})
+
+		hooks.configure(def)
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&mode),
+			Spec:  "--mode=MODE",
+			Desc:  "What to archive: children of DIRNAME, DIRNAME itself (self), or folders N levels deep (depth=N)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewBoolValue(&includeFiles),
+			Spec:  "--include-files",
+			Desc:  "Also archive files directly in DIRNAME, which are otherwise left out unless the mode is self",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewBoolValue(&includeHidden),
+			Spec:  "--include-hidden",
+			Desc:  "Also archive hidden folders, whose names start with a dot, which are otherwise left out",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewBoolValue(&useDocker),
+			Spec:  "--docker",
+			Desc:  "Also archive Docker volumes, found using the Docker engine's socket",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&dockerSocket),
+			Spec:  "--docker-socket=PATH",
+			Desc:  "The Docker engine's socket (default: " + docker.DefaultSocket + ")",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&dockerLabel),
+			Spec:  "--docker-label=LABEL",
+			Desc:  "The label volumes need to be archived, as NAME or NAME=VALUE (default: " + DefaultDockerLabel + ")",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&dockerStop),
+			Spec:  "--docker-stop=MODE",
+			Desc:  "What to do with containers using a volume while it's archived: none, stop, or pause (default: none)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&nameTemplate),
+			Spec:  "--name-template=TEMPLATE",
+			Desc:  "How to name archives in the bucket, e.g. {{host}}/{{folder}}/{{folder}}-{{unix}} (default: " + naming.DefaultTemplate + ")",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewBoolValue(&useCatalog),
+			Spec:  "--catalog",
+			Desc:  "Record each run in a catalog in the bucket, used to list and prune archives",
+		})
 	}
 
 	execute := func(input *console.Input, output *console.Output) error {
-		gateway, err := factory.CreateGCSGateway(bucket)
+		var gateway storage.Gateway
+		var sessions storage.SessionStore
+
+		err := mapEnv(definition, input, osEnviron())
+		if err != nil {
+			return err
+		}
+
+		archiveMode, err := archive.ParseMode(mode)
 		if err != nil {
 			return err
 		}
 
+		template, err := naming.Parse(nameTemplate)
+		if err != nil {
+			return err
+		}
+
+		if dirname == "" && !useDocker {
+			return errors.New("a DIRNAME is required, unless Docker volumes are archived using --docker")
+		}
+
+		// Any arguments after DIRNAME are more sources, which the definition can't describe.
+		dirnames := []string{}
+		if dirname != "" {
+			dirnames = append(dirnames, dirname)
+		}
+
+		if len(input.Arguments) > 1 {
+			for _, arg := range input.Arguments[1:] {
+				dirnames = append(dirnames, arg.Value)
+			}
+		}
+
+		// Foldup's own files are kept in the first source by default, or the working directory.
+		dirname = sourceDir(dirname)
+
+		source := backupSource{
+			dirnames:     dirnames,
+			mode:         archiveMode,
+			includeFiles: includeFiles,
+			hidden:       includeHidden,
+		}
+
+		source.names.template = template
+		source.names.host, _ = os.Hostname()
+
+		// What's backed up identifies the backup, in its lock and state.
+		keys := append([]string{}, dirnames...)
+
+		if useDocker {
+			source.docker, err = newDockerSource(factory, dockerSocket, dockerLabel, dockerStop)
+			if err != nil {
+				return err
+			}
+
+			keys = append(keys, "docker:"+source.docker.label)
+		}
+
+		if dryRun {
+			return planBackup(output, source, bucket)
+		}
+
+		logger, err := factory.CreateLogger()
+		if err != nil {
+			return err
+		}
+
+		if chunkSize > 0 {
+			if sessionFile == "" {
+				sessionFile = path.Join(dirname, SessionFile)
+			}
+
+			sessions = storage.NewFileSessionStore(sessionFile)
+			gateway, err = factory.CreateResumableGCSGateway(bucket, sessions, chunkSize*1024*1024)
+		} else {
+			gateway, err = factory.CreateGCSGateway(bucket)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		job := &backupJob{
+			source: source,
+			bucket: bucket,
+			// Retry uploads that fail because of transient errors, like network issues.
+			gateway:  storage.NewRetryGateway(gateway, retryPolicy, logger),
+			sessions: sessions,
+			hooks:    hooks,
+			logger:   logger,
+		}
+
+		if useCatalog {
+			// Archives in the catalog can be searched using their manifests.
+			job.source.manifests = true
+
+			job.catalog, err = newCatalogStore(factory, job, bucket)
+			if err != nil {
+				return err
+			}
+		}
+
+		if notifications.EmailDigest && schedule == "" {
+			return errors.New("email digests are only available for scheduled backups")
+		}
+
+		job.notifier, err = notifications.notifier()
+		if err != nil {
+			return err
+		}
+
+		if lockDir == "" {
+			lockDir = dirname
+		}
+
+		job.locker, err = newLocker(factory, lockType, bucket, lockDir, lockTTL)
+		if err != nil {
+			return err
+		}
+
+		// Instances backing up folders of the same name to the same bucket would upload the same
+		// archives, so they share a lock.
+		job.lockName = lockName(keys)
+
+		job.hostname = source.names.host
+
+		// Metrics and health checks may share an address, so gather up handlers by address first.
+		muxes := make(map[string]*http.ServeMux)
+		muxFor := func(addr string) *http.ServeMux {
+			if _, ok := muxes[addr]; !ok {
+				muxes[addr] = http.NewServeMux()
+			}
+
+			return muxes[addr]
+		}
+
+		if metricsAddr != "" {
+			registry := metrics.NewRegistry()
+			job.metrics = newBackupMetrics(registry)
+
+			muxFor(metricsAddr).Handle("/metrics", registry)
+		}
+
+		if healthAddr != "" {
+			if schedule == "" {
+				return errors.New("health checks are only available for scheduled backups")
+			}
+
+			job.health, err = newHealthMonitor(factory, bucket, gateway, sessions != nil, schedule, readyFactor)
+			if err != nil {
+				return err
+			}
+
+			handler := job.health.Handler()
+
+			muxFor(healthAddr).Handle("/healthz", handler)
+			muxFor(healthAddr).Handle("/readyz", handler)
+		}
+
+		// Scheduled backups can be forced to run by sending a signal, or a request.
+		runNow := newTrigger()
+
+		if triggerAddr != "" {
+			if schedule == "" {
+				return errors.New("triggers are only available for scheduled backups")
+			}
+
+			muxFor(triggerAddr).Handle("/trigger", runNow)
+		}
+
+		for addr, mux := range muxes {
+			err = serveHTTP(logger, addr, mux)
+			if err != nil {
+				return err
+			}
+		}
+
 		if schedule != "" {
+			misfirePolicy, err := scheduling.ParseMisfire(misfire)
+			if err != nil {
+				return err
+			}
+
+			location, err := loadLocation(timezone)
+			if err != nil {
+				return err
+			}
+
+			if stateFile == "" {
+				stateFile = path.Join(dirname, StateFile)
+			}
+
+			job.state = scheduling.NewFileStateStore(stateFile)
+			job.stateKey = strings.Join(keys, ",")
+
+			if source.docker != nil {
+				source.docker.state = job.state
+				source.docker.stateKey = job.stateKey
+			}
+
+			if catchUp && !runOnStart {
+				runOnStart, err = job.missedRun(schedule, location)
+				if err != nil {
+					return err
+				}
+
+				if runOnStart {
+					logger.Info("Catching up on a backup run missed while foldup was stopped")
+				}
+			}
+
 			done := make(chan int)
 
-			// Schedule a backup that will be recurring.
+			job.health.SchedulerStarted()
+			defer job.health.SchedulerStopped()
+
+			runNow.notifyOn(logger, triggerSignals...)
+
+			if notifications.EmailDigest {
+				// Digests are sent daily, and once more when foldup is stopped, so that the reports
+				// held on to for them aren't lost.
+				stopOnShutdown(logger, func() { close(done) })
+				go flushDigests(done, notify.DigestInterval, job)
+				defer job.flushNotifications()
+			}
+
+			// Schedule a backup that will be recurring. A failed run is logged, counted and reported,
+			// but mustn't stop the schedule, so that later runs can recover.
 			return scheduleFunc(done, schedule, func() error {
-				return doBackup(dirname, gateway)
+				job.run()
+				return nil
+			}, scheduling.Options{
+				OnNext:     job.scheduledNext,
+				OnSkip:     job.skippedRuns,
+				RunOnStart: runOnStart,
+				Trigger:    runNow,
+				Misfire:    misfirePolicy,
+				Location:   location,
+				Jitter:     jitter,
 			})
 		}
 
 		// Run a one-off backup.
-		return doBackup(dirname, gateway)
+		return job.run()
 	}
 
 	return &console.Command{
@@ -78,43 +531,87 @@ func BackupCommand(factory foldup.Factory) *console.Command {
 	}
 }
 
-// doBackup perform performs the actual backup, whether on a schedule or not.
-func doBackup(dirname string, gateway storage.Gateway) error {
-	// Read the directory names in the given directory.
-	dirs, err := xioutil.ReadDirsInDir(dirname, false)
+// loadLocation loads the time zone with the given IANA name, or the local time zone if it's empty.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(name)
+}
+
+// newDockerSource creates a dockerSource finding volumes with the given label, using the Docker
+// engine listening on the given socket. Containers using the volumes are stopped as the given stop
+// mode says.
+func newDockerSource(factory foldup.Factory, socket string, label string, stop string) (*dockerSource, error) {
+	stopMode, err := docker.ParseStopMode(stop)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Create the relative paths to those directories, so other code can find them.
-	relativePaths := []string{}
-	for _, d := range dirs {
-		relativePaths = append(relativePaths, path.Join(dirname, d.Name()))
+	if label == "" {
+		label = DefaultDockerLabel
 	}
 
-	// Begin archiving the directories that were found.
-	archives, err := archiveDirsf(relativePaths, BackupFmt, archive.TarGz)
+	client, err := factory.CreateDockerClient(socket)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Upload each of the created archives to the storage.
-	for _, a := range archives {
-		in, err := osOpen(a)
-		if err != nil {
-			return err
-		}
+	return &dockerSource{
+		client: client,
+		label:  label,
+		stop:   stopMode,
+	}, nil
+}
 
-		err = gateway.Store(context.Background(), a, in)
-		if err != nil {
-			return err
-		}
+// lockName returns the name of the lock taken by a backup of the given sources. It's the base name
+// of the source if there's only one, otherwise it's made from all of them.
+func lockName(sources []string) string {
+	if len(sources) == 1 && !isPattern(sources[0]) {
+		return lock.Name(path.Base(path.Clean(sources[0])))
+	}
+
+	return lock.Name(strings.Join(sources, ","))
+}
+
+// newLocker creates a Locker of the type with the given name, or returns nil if the name is empty.
+// Leases are stored in the given bucket, and lock files are created in the given directory.
+func newLocker(factory foldup.Factory, name string, bucket string, dir string, ttl time.Duration) (lock.Locker, error) {
+	kind, err := lock.ParseKind(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case lock.KindGCS:
+		return factory.CreateLeaseLocker(bucket, ttl)
+	case lock.KindFile:
+		return lock.NewFileLocker(dir), nil
+	}
+
+	return nil, nil
+}
 
-		err = osRemove(a)
+// newHealthMonitor creates a health.Monitor for a backup on the given schedule. Resumable gateways
+// can't check that storage is reachable, so a regular gateway is created for that purpose.
+func newHealthMonitor(factory foldup.Factory, bucket string, gateway storage.Gateway, resumable bool, schedule string, factor int) (*health.Monitor, error) {
+	interval, err := scheduling.Interval(schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	if resumable {
+		gateway, err = factory.CreateGCSGateway(bucket)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	var check func(ctx context.Context) error
+	if checker, ok := gateway.(storage.Checker); ok {
+		check = checker.Check
+	}
+
+	return health.NewMonitor(interval, factor, check), nil
 }
@@ -2,24 +2,42 @@ package command
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/SeerUK/assert"
 	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/docker"
 	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/health"
+	"github.com/SeerUK/foldup/pkg/hook"
+	"github.com/SeerUK/foldup/pkg/lock"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/manifest"
+	"github.com/SeerUK/foldup/pkg/metrics"
+	"github.com/SeerUK/foldup/pkg/scheduling"
+	"github.com/SeerUK/foldup/pkg/storage"
 	"github.com/eidolon/console"
 	"github.com/eidolon/console/parameters"
 )
 
 func TestBackupCommand(t *testing.T) {
-	log.SetOutput(&bytes.Buffer{})
-
 	t.Run("should return the backup command", func(t *testing.T) {
-		factory := foldup.NewCLIFactory()
+		factory := foldup.NewCLIFactory(nil)
 		backupCmd := BackupCommand(factory)
 
 		assert.Equal(t, "backup", backupCmd.Name)
@@ -28,7 +46,7 @@ func TestBackupCommand(t *testing.T) {
 	t.Run("should prepare the input definition", func(t *testing.T) {
 		def := console.NewDefinition()
 
-		factory := foldup.NewCLIFactory()
+		factory := foldup.NewCLIFactory(nil)
 		backupCmd := BackupCommand(factory)
 		backupCmd.Configure(def)
 
@@ -36,11 +54,38 @@ func TestBackupCommand(t *testing.T) {
 		opts := def.Options()
 
 		assert.Equal(t, 1, len(args))
-		assert.Equal(t, 2, len(opts))
+		assert.Equal(t, 46, len(opts))
 
 		assert.Equal(t, "DIRNAME", args[0].Name)
 		assert.Equal(t, []string{"b", "bucket"}, opts[0].Names)
 		assert.Equal(t, []string{"s", "schedule"}, opts[1].Names)
+		assert.Equal(t, []string{"retry-attempts"}, opts[2].Names)
+		assert.Equal(t, []string{"retry-timeout"}, opts[3].Names)
+		assert.Equal(t, []string{"chunk-size"}, opts[4].Names)
+		assert.Equal(t, []string{"session-file"}, opts[5].Names)
+		assert.Equal(t, []string{"metrics-addr"}, opts[6].Names)
+		assert.Equal(t, []string{"health-addr"}, opts[7].Names)
+		assert.Equal(t, []string{"ready-factor"}, opts[8].Names)
+	})
+
+	t.Run("should error if the logger can't be created", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{
+			createLoggerError: errors.New("oops"),
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
 	})
 
 	t.Run("should error if the storage gateway can't be created", func(t *testing.T) {
@@ -83,8 +128,8 @@ func TestBackupCommand(t *testing.T) {
 	t.Run("should error if archiving fails", func(t *testing.T) {
 		defer revertStubs()
 
-		archiveDirsf = func(ds []string, nf string, fn archive.FormatName) ([]string, error) {
-			return []string{}, errors.New("oops")
+		archiveDirsf = func(l logging.Logger, ds []archive.Dir, nf string, fn archive.FormatName, ex ...string) ([]archive.Result, error) {
+			return []archive.Result{}, errors.New("oops")
 		}
 
 		def := console.NewDefinition()
@@ -105,6 +150,7 @@ func TestBackupCommand(t *testing.T) {
 
 	t.Run("should error if opening the archive to upload fails", func(t *testing.T) {
 		defer revertStubs()
+		defer removeTestArchives()
 
 		osOpen = func(name string) (*os.File, error) {
 			return nil, errors.New("oops")
@@ -127,6 +173,8 @@ func TestBackupCommand(t *testing.T) {
 	})
 
 	t.Run("should error if uploading the archive fails", func(t *testing.T) {
+		defer removeTestArchives()
+
 		def := console.NewDefinition()
 
 		gateway := &backupTestStorageGateway{
@@ -152,6 +200,7 @@ func TestBackupCommand(t *testing.T) {
 
 	t.Run("should error if removing the archive fails", func(t *testing.T) {
 		defer revertStubs()
+		defer removeTestArchives()
 
 		osRemove = func(name string) error {
 			return errors.New("oops")
@@ -190,29 +239,1909 @@ func TestBackupCommand(t *testing.T) {
 		assert.OK(t, result)
 	})
 
-	t.Run("should be able to schedule a backup", func(t *testing.T) {
+	t.Run("should use resumable uploads if a chunk size is given", func(t *testing.T) {
 		def := console.NewDefinition()
 
-		scheduleFunc = func(done <-chan int, expr string, fn func() error) error {
-			return fn()
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "chunk-size", "8")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 8*1024*1024, factory.resumableChunkSize)
+		assert.NotEqual(t, nil, factory.resumableSessions)
+	})
+
+	t.Run("should resume interrupted uploads before backing up", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-resume")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		archive := path.Join(dir, "backup-test-1.tar.gz")
+		assert.OK(t, ioutil.WriteFile(archive, []byte("test-data"), 0644))
+		assert.OK(t, os.Mkdir(path.Join(dir, "test"), 0755))
+
+		sessions := storage.NewFileSessionStore(path.Join(dir, SessionFile))
+		sessions.Put(storage.UploadSession{Bucket: "test-bucket", Object: archive, Source: archive})
+		sessions.Put(storage.UploadSession{Bucket: "test-bucket", Object: "gone", Source: "gone"})
+
+		gateway := &backupTestStorageGateway{}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", dir)
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "chunk-size", "8")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 2, len(gateway.stored))
+		assert.Equal(t, archive, gateway.stored[0])
+
+		_, err = os.Stat(archive)
+		assert.True(t, os.IsNotExist(err), "Expected resumed archive to be removed")
+
+		pending, err := sessions.All()
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(pending))
+	})
+
+	t.Run("should expose metrics if a metrics address is given", func(t *testing.T) {
+		defer revertStubs()
+
+		var listener net.Listener
+
+		netListen = func(network, address string) (net.Listener, error) {
+			var err error
+
+			listener, err = net.Listen(network, "127.0.0.1:0")
+
+			return listener, err
 		}
 
+		def := console.NewDefinition()
+
 		factory := &backupTestFactory{}
 		backupCmd := BackupCommand(factory)
 		backupCmd.Configure(def)
 
 		setArgValue(def.Arguments(), "DIRNAME", "testdata")
 		setOptValue(def.Options(), "bucket", "test-bucket")
-		setOptValue(def.Options(), "schedule", "* * * * * * *")
+		setOptValue(def.Options(), "metrics-addr", ":9100")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+		assert.OK(t, result)
+
+		defer listener.Close()
+
+		res, err := http.Get(fmt.Sprintf("http://%s/metrics", listener.Addr()))
+		assert.OK(t, err)
+
+		defer res.Body.Close()
+
+		body, err := ioutil.ReadAll(res.Body)
+		assert.OK(t, err)
+		assert.True(t, strings.Contains(string(body), `foldup_runs_total{status="success"} 1`), "Expected a successful run")
+	})
+
+	t.Run("should error if the metrics address can't be listened on", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "metrics-addr", "not an address")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should expose health checks if a health address is given", func(t *testing.T) {
+		defer revertStubs()
+		defer removeTestState()
+
+		var listeners []net.Listener
+
+		netListen = func(network, address string) (net.Listener, error) {
+			listener, err := net.Listen(network, "127.0.0.1:0")
+			listeners = append(listeners, listener)
+
+			return listener, err
+		}
+
+		var healthz, readyz int
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, opts scheduling.Options) error {
+			opts.OnNext(time.Now().Add(time.Hour))
+
+			err := fn()
+
+			base := fmt.Sprintf("http://%s", listeners[0].Addr())
+
+			res, _ := http.Get(base + "/healthz")
+			healthz = res.StatusCode
+			res.Body.Close()
+
+			res, _ = http.Get(base + "/readyz")
+			readyz = res.StatusCode
+			res.Body.Close()
+
+			return err
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "0 * * * *")
+		setOptValue(def.Options(), "metrics-addr", ":8080")
+		setOptValue(def.Options(), "health-addr", ":8080")
 
 		input, output := createInputAndOutput(&bytes.Buffer{})
 
 		result := backupCmd.Execute(input, output)
 
+		for _, l := range listeners {
+			l.Close()
+		}
+
 		assert.OK(t, result)
+		assert.Equal(t, 1, len(listeners))
+		assert.Equal(t, http.StatusOK, healthz)
+		assert.Equal(t, http.StatusOK, readyz)
+	})
+
+	t.Run("should error if health checks are requested without a schedule", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "health-addr", ":8080")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should still back up the other folders if one can't be archived", func(t *testing.T) {
+		defer revertStubs()
+
+		archiveDirsf = func(l logging.Logger, ds []archive.Dir, nf string, fn archive.FormatName, ex ...string) ([]archive.Result, error) {
+			if ds[0].Name == "test1" {
+				return []archive.Result{}, errors.New("oops")
+			}
+
+			return archive.NamedDirsf(l, ds, nf, fn, ex...)
+		}
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.Equal(t, 1, len(gateway.stored))
+		assert.True(t, strings.Contains(gateway.stored[0], "test2"), "Expected test2 to be backed up")
+	})
+
+	t.Run("should send notifications at the start and end of each run", func(t *testing.T) {
+		defer revertStubs()
+
+		archiveDirsf = func(l logging.Logger, ds []archive.Dir, nf string, fn archive.FormatName, ex ...string) ([]archive.Result, error) {
+			return []archive.Result{}, errors.New("oops")
+		}
+
+		pings := make(chan string, 2)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pings <- r.URL.Path
+		}))
+
+		defer server.Close()
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "ping-url", server.URL+"/check")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.Equal(t, "/check/start", <-pings)
+		assert.Equal(t, "/check/fail", <-pings)
+	})
+
+	t.Run("should error if an email digest is requested without a schedule", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "smtp-addr", "localhost:25")
+		setOptValue(def.Options(), "email-from", "foldup@example.com")
+		setOptValue(def.Options(), "email-to", "a@example.com")
+		setOptValue(def.Options(), "email-digest", "true")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.True(t, strings.Contains(result.Error(), "scheduled"), "Unexpected error: "+result.Error())
+	})
+
+	t.Run("should stop a schedule with an email digest gracefully when asked to shut down", func(t *testing.T) {
+		defer revertStubs()
+		defer removeTestState()
+
+		received := make(chan chan<- os.Signal, 1)
+
+		signalNotify = func(c chan<- os.Signal, sig ...os.Signal) {
+			if reflect.DeepEqual(shutdownSignals, sig) {
+				received <- c
+			}
+		}
+
+		signalStop = func(c chan<- os.Signal) {}
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, o scheduling.Options) error {
+			c := <-received
+			c <- os.Interrupt
+
+			select {
+			case <-done:
+				return nil
+			case <-time.After(time.Second):
+				return errors.New("schedule wasn't stopped")
+			}
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "@daily")
+		setOptValue(def.Options(), "smtp-addr", "127.0.0.1:1")
+		setOptValue(def.Options(), "email-from", "foldup@example.com")
+		setOptValue(def.Options(), "email-to", "a@example.com")
+		setOptValue(def.Options(), "email-digest", "true")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.OK(t, backupCmd.Execute(input, output))
+	})
+
+	t.Run("should error if webhook headers are invalid", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "webhook-url", "http://localhost/hook")
+		setOptValue(def.Options(), "webhook-headers", "Authorization")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should error if email is enabled without recipients", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "smtp-addr", "localhost:25")
+		setOptValue(def.Options(), "email-from", "foldup@example.com")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
 	})
 
-	log.SetOutput(os.Stdout)
+	t.Run("should describe the backup without archiving or uploading on a dry run", func(t *testing.T) {
+		defer revertStubs()
+
+		archiveDirsf = func(l logging.Logger, ds []archive.Dir, nf string, fn archive.FormatName, ex ...string) ([]archive.Result, error) {
+			t.Error("Expected nothing to be archived")
+			return []archive.Result{}, nil
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		factory.createGCSGatewayError = errors.New("Expected storage not to be used")
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "dry-run", "true")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.True(t, strings.Contains(buf.String(), "testdata/backup-test1-"), "Expected the object name of test1")
+		assert.True(t, strings.Contains(buf.String(), "testdata/backup-test2-"), "Expected the object name of test2")
+		assert.True(t, strings.Contains(buf.String(), "2 folder(s), 2 file(s)"), "Expected a summary")
+		assert.True(t, strings.Contains(buf.String(), "gs://test-bucket/"), "Expected the destination")
+	})
+
+	t.Run("should error on a dry run if the archiving target doesn't exist", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "rumpelstilzchen")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "dry-run", "true")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should read options from the environment", func(t *testing.T) {
+		defer revertStubs()
+
+		osEnviron = func() []string {
+			return []string{"FOLDUP_BUCKET=test-bucket", "FOLDUP_CHUNK_SIZE=8", "OTHER=1"}
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 8*1024*1024, factory.resumableChunkSize)
+	})
+
+	t.Run("should prefer options given on the command line over the environment", func(t *testing.T) {
+		defer revertStubs()
+
+		osEnviron = func() []string {
+			return []string{"FOLDUP_CHUNK_SIZE=8"}
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "chunk-size", "4")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+		input.Options = []console.InputOption{{Name: "chunk-size", Value: "4"}}
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 4*1024*1024, factory.resumableChunkSize)
+	})
+
+	t.Run("should read options from files named in the environment", func(t *testing.T) {
+		defer revertStubs()
+
+		file, err := ioutil.TempFile("", "foldup-env")
+		assert.OK(t, err)
+
+		defer os.Remove(file.Name())
+
+		file.WriteString("2\n")
+		file.Close()
+
+		osEnviron = func() []string {
+			return []string{"FOLDUP_BUCKET=test-bucket", "FOLDUP_CHUNK_SIZE_FILE=" + file.Name()}
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 2*1024*1024, factory.resumableChunkSize)
+	})
+
+	t.Run("should error if an option is set in the environment and a file", func(t *testing.T) {
+		defer revertStubs()
+
+		osEnviron = func() []string {
+			return []string{"FOLDUP_SMTP_PASSWORD=secret", "FOLDUP_SMTP_PASSWORD_FILE=/run/secrets/smtp"}
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should error if an option in the environment is invalid", func(t *testing.T) {
+		defer revertStubs()
+
+		osEnviron = func() []string {
+			return []string{"FOLDUP_RETRY_ATTEMPTS=lots"}
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should run on start, and when triggered, if asked to", func(t *testing.T) {
+		defer revertStubs()
+
+		var listeners []net.Listener
+
+		netListen = func(network, address string) (net.Listener, error) {
+			listener, err := net.Listen(network, "127.0.0.1:0")
+			listeners = append(listeners, listener)
+
+			return listener, err
+		}
+
+		var signals []os.Signal
+
+		signalNotify = func(c chan<- os.Signal, sig ...os.Signal) {
+			signals = sig
+		}
+
+		var opts scheduling.Options
+		var statuses []int
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, o scheduling.Options) error {
+			opts = o
+
+			url := fmt.Sprintf("http://%s/trigger", listeners[0].Addr())
+
+			res, _ := http.Get(url)
+			statuses = append(statuses, res.StatusCode)
+			res.Body.Close()
+
+			for i := 0; i < 2; i++ {
+				res, _ := http.Post(url, "text/plain", nil)
+				statuses = append(statuses, res.StatusCode)
+				res.Body.Close()
+			}
+
+			return nil
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "0 3 * * *")
+		setOptValue(def.Options(), "run-on-start", "true")
+		setOptValue(def.Options(), "trigger-addr", ":8080")
+		setOptValue(def.Options(), "misfire", "once")
+		setOptValue(def.Options(), "timezone", "Europe/London")
+		setOptValue(def.Options(), "jitter", "5m")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		for _, l := range listeners {
+			l.Close()
+		}
+
+		assert.OK(t, result)
+		assert.True(t, opts.RunOnStart, "Expected a run on start")
+		assert.Equal(t, scheduling.MisfireOnce, opts.Misfire)
+		assert.Equal(t, "Europe/London", opts.Location.String())
+		assert.Equal(t, 5*time.Minute, opts.Jitter)
+		assert.Equal(t, 1, len(opts.Trigger))
+		assert.Equal(t, triggerSignals, signals)
+		assert.Equal(t, []int{http.StatusMethodNotAllowed, http.StatusAccepted, http.StatusConflict}, statuses)
+	})
+
+	t.Run("should error if a trigger is requested without a schedule", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "trigger-addr", ":8080")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should error if the misfire policy is unknown", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "0 3 * * *")
+		setOptValue(def.Options(), "misfire", "sometimes")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should error if the time zone is unknown", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "0 3 * * *")
+		setOptValue(def.Options(), "timezone", "Mars/Olympus_Mons")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should catch up on a run missed while stopped, and record the run", func(t *testing.T) {
+		defer revertStubs()
+
+		dir, err := ioutil.TempDir("", "foldup-state")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		stateFile := path.Join(dir, "state.json")
+		lastRun := time.Now().Add(-48 * time.Hour)
+
+		err = scheduling.NewFileStateStore(stateFile).Put("testdata", scheduling.JobState{LastRun: lastRun})
+		assert.OK(t, err)
+
+		var opts scheduling.Options
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, o scheduling.Options) error {
+			opts = o
+			return fn()
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "0 3 * * *")
+		setOptValue(def.Options(), "state-file", stateFile)
+		setOptValue(def.Options(), "catch-up", "true")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.True(t, opts.RunOnStart, "Expected a run on start to catch up")
+
+		state, ok, err := scheduling.NewFileStateStore(stateFile).Get("testdata")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the state to be recorded")
+		assert.True(t, state.LastRun.After(lastRun), "Expected the last run to be updated")
+		assert.Equal(t, state.LastRun, state.LastSuccess)
+	})
+
+	t.Run("should not catch up if no run was missed", func(t *testing.T) {
+		defer revertStubs()
+
+		dir, err := ioutil.TempDir("", "foldup-state")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		stateFile := path.Join(dir, "state.json")
+
+		err = scheduling.NewFileStateStore(stateFile).Put("testdata", scheduling.JobState{LastRun: time.Now()})
+		assert.OK(t, err)
+
+		var opts scheduling.Options
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, o scheduling.Options) error {
+			opts = o
+			return nil
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "@every 1h")
+		setOptValue(def.Options(), "state-file", stateFile)
+		setOptValue(def.Options(), "catch-up", "true")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.False(t, opts.RunOnStart, "Expected no run on start")
+	})
+
+	t.Run("should take a gcs lock before backing up, and release it after", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		locker := &backupTestLocker{}
+		gateway := &backupTestStorageGateway{}
+
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+			leaseLocker:             locker,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "lock", "gcs")
+		setOptValue(def.Options(), "lock-ttl", "1m")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, time.Minute, factory.leaseLockerTTL)
+		assert.Equal(t, []string{"testdata"}, locker.names)
+		assert.Equal(t, 1, locker.released)
+		assert.True(t, len(gateway.stored) > 0, "Expected archives to be stored")
+	})
+
+	t.Run("should skip the backup if another instance holds the lock", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+			leaseLocker:             &backupTestLocker{held: true},
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "lock", "gcs")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 0, len(gateway.stored))
+	})
+
+	t.Run("should count runs skipped because of the lock as healthy", func(t *testing.T) {
+		monitor := health.NewMonitor(50*time.Millisecond, 1, nil)
+		monitor.SchedulerStarted()
+
+		registry := metrics.NewRegistry()
+
+		job := &backupJob{
+			source:  backupSource{dirnames: []string{"testdata"}},
+			gateway: &backupTestStorageGateway{},
+			locker:  &backupTestLocker{held: true},
+			health:  monitor,
+			metrics: newBackupMetrics(registry),
+			logger:  logging.NewNopLogger(),
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		assert.NotOK(t, monitor.Ready(context.Background()))
+
+		assert.OK(t, job.run())
+		assert.OK(t, monitor.Ready(context.Background()))
+		assert.Equal(t, float64(1), job.metrics.runs.Value("skipped"))
+	})
+
+	t.Run("should fail the backup, without pruning, if the lock is lost", func(t *testing.T) {
+		lost := make(chan struct{})
+		close(lost)
+
+		gateway := &backupTestStorageGateway{}
+		locker := &backupTestLocker{lost: lost}
+
+		job := &backupJob{
+			source:    backupSource{dirnames: []string{"testdata"}},
+			gateway:   gateway,
+			locker:    locker,
+			retention: storage.RetentionPolicy{KeepLast: 1},
+			logger:    logging.NewNopLogger(),
+		}
+
+		err := job.run()
+
+		assert.Equal(t, lock.ErrLost, err)
+		assert.Equal(t, 0, len(gateway.deleted))
+		assert.Equal(t, 1, locker.released)
+	})
+
+	t.Run("should fail the backup if the lock can't be checked", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+			leaseLocker:             &backupTestLocker{acquireErr: errors.New("oops")},
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "lock", "gcs")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.Equal(t, 0, len(gateway.stored))
+	})
+
+	t.Run("should take a file lock in the lock directory", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-lock")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "lock", "file")
+		setOptValue(def.Options(), "lock-dir", dir)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+
+		_, err = os.Stat(path.Join(dir, ".foldup-testdata.lock"))
+		assert.OK(t, err)
+	})
+
+	t.Run("should leave the lock file out of archives of DIRNAME", func(t *testing.T) {
+		dir := createTestSource(t, "src/top.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "src"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "mode", "self")
+		setOptValue(def.Options(), "lock", "file")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 1, len(gateway.stored))
+
+		format, ok := archive.FilenameFormat(gateway.stored[0])
+		assert.True(t, ok, "Unexpected archive: "+gateway.stored[0])
+
+		names := []string{}
+		err := archive.Read(bytes.NewReader(gateway.contents[gateway.stored[0]]), format, func(entry archive.Entry, contents io.Reader) error {
+			names = append(names, entry.Name)
+			return nil
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, []string{path.Join(dir, "src/top.txt")}, names)
+	})
+
+	t.Run("should error if the lock type is unknown", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "lock", "redis")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should run hooks around the backup, and around each folder", func(t *testing.T) {
+		defer revertStubs()
+
+		gateway := &backupTestStorageGateway{}
+
+		ran := []string{}
+		timeouts := []time.Duration{}
+		uploaded := []int{}
+
+		runHook = func(ctx context.Context, logger logging.Logger, command string, timeout time.Duration, env hook.Env) error {
+			ran = append(ran, strings.Join(strings.Fields(command+" "+env["FOLDUP_FOLDER"]+" "+env["FOLDUP_STATUS"]), " "))
+			timeouts = append(timeouts, timeout)
+
+			if command == "clean" {
+				uploaded = append(uploaded, len(gateway.stored))
+			}
+
+			return nil
+		}
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "pre-hook", "lock")
+		setOptValue(def.Options(), "post-hook", "unlock")
+		setOptValue(def.Options(), "pre-folder-hook", "dump")
+		setOptValue(def.Options(), "post-folder-hook", "clean")
+		setOptValue(def.Options(), "hook-timeout", "30s")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 2, len(gateway.stored))
+		assert.Equal(t, []string{
+			"lock",
+			"dump test1",
+			"clean test1 success",
+			"dump test2",
+			"clean test2 success",
+			"unlock success",
+		}, ran)
+
+		// Each folder's post-folder hook runs as soon as it's archived, before anything is uploaded.
+		assert.Equal(t, []int{0, 0}, uploaded)
+
+		for _, timeout := range timeouts {
+			assert.Equal(t, 30*time.Second, timeout)
+		}
+	})
+
+	t.Run("should not back up anything if the pre-hook fails, but still run the post-hook", func(t *testing.T) {
+		defer revertStubs()
+
+		var post hook.Env
+
+		runHook = func(ctx context.Context, logger logging.Logger, command string, timeout time.Duration, env hook.Env) error {
+			if command == "unlock" {
+				post = env
+			}
+
+			if command == "lock" {
+				return errors.New("database is busy")
+			}
+
+			return nil
+		}
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "pre-hook", "lock")
+		setOptValue(def.Options(), "post-hook", "unlock")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.Equal(t, 0, len(gateway.stored))
+		assert.Equal(t, "post", post["FOLDUP_HOOK"])
+		assert.Equal(t, "failure", post["FOLDUP_STATUS"])
+		assert.Equal(t, "hook", post["FOLDUP_STAGE"])
+		assert.Equal(t, "database is busy", post["FOLDUP_ERROR"])
+	})
+
+	t.Run("should skip folders whose pre-folder hook fails, and back up the rest", func(t *testing.T) {
+		defer revertStubs()
+
+		statuses := make(map[string]string)
+
+		runHook = func(ctx context.Context, logger logging.Logger, command string, timeout time.Duration, env hook.Env) error {
+			if command == "clean" {
+				statuses[env["FOLDUP_FOLDER"]] = env["FOLDUP_STATUS"]
+			}
+
+			if command == "dump" && env["FOLDUP_FOLDER"] == "test1" {
+				return errors.New("dump failed")
+			}
+
+			return nil
+		}
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "pre-folder-hook", "dump")
+		setOptValue(def.Options(), "post-folder-hook", "clean")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.Equal(t, 1, len(gateway.stored))
+		assert.True(t, strings.Contains(gateway.stored[0], "test2"), "Expected test2 to be backed up")
+		assert.Equal(t, map[string]string{"test1": "failure", "test2": "success"}, statuses)
+	})
+
+	t.Run("should archive DIRNAME itself in self mode", func(t *testing.T) {
+		dir := createTestSource(t, "src/top.txt", "src/a/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "src"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "mode", "self")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 1, len(gateway.stored))
+		assert.True(t, strings.HasPrefix(gateway.stored[0], path.Join(dir, "backup-src-")), "Unexpected archive: "+gateway.stored[0])
+	})
+
+	t.Run("should archive folders N levels below DIRNAME in depth mode, named after their path", func(t *testing.T) {
+		dir := createTestSource(t, "src/a/x/file.txt", "src/b/y/file.txt", "src/b/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "src"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "mode", "depth=2")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 2, len(gateway.stored))
+		assert.True(t, strings.HasPrefix(gateway.stored[0], path.Join(dir, "src/a/backup-a_x-")), "Unexpected archive: "+gateway.stored[0])
+		assert.True(t, strings.HasPrefix(gateway.stored[1], path.Join(dir, "src/b/backup-b_y-")), "Unexpected archive: "+gateway.stored[1])
+	})
+
+	t.Run("should name stored archives using the name template", func(t *testing.T) {
+		dir := createTestSource(t, "src/a/x/file.txt", "src/b/y/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "src"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "mode", "depth=2")
+		setOptValue(def.Options(), "name-template", "{{path}}/{{date:2006}}/{{folder}}-{{unix}}.{{ext}}")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		year := time.Now().UTC().Format("2006")
+
+		assert.OK(t, result)
+		assert.Equal(t, 2, len(gateway.stored))
+		assert.True(t, strings.HasPrefix(gateway.stored[0], "a/x/"+year+"/a_x-"), "Unexpected archive: "+gateway.stored[0])
+		assert.True(t, strings.HasSuffix(gateway.stored[0], ".tar.gz"), "Unexpected archive: "+gateway.stored[0])
+		assert.True(t, strings.HasPrefix(gateway.stored[1], "b/y/"+year+"/b_y-"), "Unexpected archive: "+gateway.stored[1])
+	})
+
+	t.Run("should error if the name template is invalid", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		backupCmd := BackupCommand(&backupTestFactory{})
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "name-template", "{{folder}}-{{when}}")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.Equal(t, "naming: unknown placeholder '{{when}}'", result.Error())
+	})
+
+	t.Run("should error without archiving if two folders would be stored under the same name", func(t *testing.T) {
+		defer revertStubs()
+
+		archiveDirsf = func(l logging.Logger, ds []archive.Dir, nf string, fn archive.FormatName, ex ...string) ([]archive.Result, error) {
+			t.Error("Expected nothing to be archived")
+			return []archive.Result{}, nil
+		}
+
+		dir := createTestSource(t, "one/data/file.txt", "two/data/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "one"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "name-template", "{{path}}-{{unix}}")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+		input.Arguments = []console.InputArgument{
+			{Value: path.Join(dir, "one")},
+			{Value: path.Join(dir, "two")},
+		}
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.True(t, strings.Contains(result.Error(), "would both be stored as 'data-"), "Unexpected error: "+result.Error())
+		assert.Equal(t, 0, len(gateway.stored))
+	})
+
+	t.Run("should error if an archive is already stored under the same name", func(t *testing.T) {
+		defer revertStubs()
+
+		archiveDirsf = func(l logging.Logger, ds []archive.Dir, nf string, fn archive.FormatName, ex ...string) ([]archive.Result, error) {
+			t.Error("Expected nothing to be archived")
+			return []archive.Result{}, nil
+		}
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{
+			objects: []storage.ObjectInfo{
+				{Name: "test1-" + time.Now().UTC().Format("2006") + ".tar.gz"},
+			},
+		}
+
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "name-template", "{{folder}}-{{date:2006}}")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.True(t, strings.HasPrefix(result.Error(), "naming: an archive is already stored as 'test1-"), "Unexpected error: "+result.Error())
+		assert.Equal(t, 0, len(gateway.stored))
+	})
+
+	t.Run("should record each run in the catalog if asked to, with a manifest of each archive", func(t *testing.T) {
+		dir := createTestSource(t, "src/a/file.txt", "src/b/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "src"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "catalog", "true")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.OK(t, backupCmd.Execute(input, output))
+
+		recorded, err := catalog.NewObjectStore(gateway, "").Load(context.Background())
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(recorded.Runs))
+
+		run := recorded.Runs[0]
+		assert.Equal(t, catalog.StatusSuccess, run.Status)
+		assert.Equal(t, "TarGz", run.Format)
+		assert.Equal(t, catalog.EncryptionNone, run.Encryption)
+		assert.Equal(t, 2, len(run.Snapshots))
+
+		for _, snapshot := range run.Snapshots {
+			assert.Equal(t, int64(len(gateway.contents[snapshot.Object])), snapshot.Size)
+			assert.Equal(t, 64, len(snapshot.SHA256))
+			assert.Equal(t, manifest.Name(snapshot.Object), snapshot.Manifest)
+
+			files := []string{}
+
+			err := manifest.Read(bytes.NewReader(gateway.contents[snapshot.Manifest]), func(entry manifest.Entry) error {
+				files = append(files, path.Base(entry.Path))
+				return nil
+			})
+
+			assert.OK(t, err)
+			assert.Equal(t, []string{"file.txt"}, files)
+		}
+
+		// Nothing is left behind locally, once it's all stored.
+		entries, err := ioutil.ReadDir(path.Join(dir, "src"))
+		assert.OK(t, err)
+		assert.Equal(t, 2, len(entries))
+	})
+
+	t.Run("should archive files directly in DIRNAME if asked to, leaving out foldup's own", func(t *testing.T) {
+		dir := createTestSource(t, "src/top.txt", "src/a/file.txt", "src/"+StateFile, "src/backup-a-123.tar.gz")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "src"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "include-files", "true")
+		setOptValue(def.Options(), "dry-run", "true")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+
+		rows := make(map[string]string)
+		for _, line := range strings.Split(buf.String(), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 4 {
+				rows[fields[0]] = fields[1]
+			}
+		}
+
+		assert.Equal(t, "1", rows["a"])
+		assert.Equal(t, "1", rows["src-files"])
+	})
+
+	t.Run("should report hidden folders and files as skipped, unless asked to include them", func(t *testing.T) {
+		dir := createTestSource(t, "src/.config/file.txt", "src/a/file.txt", "src/top.txt")
+		defer os.RemoveAll(dir)
+
+		for _, include := range []bool{false, true} {
+			def := console.NewDefinition()
+
+			factory := &backupTestFactory{}
+			backupCmd := BackupCommand(factory)
+			backupCmd.Configure(def)
+
+			setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "src"))
+			setOptValue(def.Options(), "bucket", "test-bucket")
+			setOptValue(def.Options(), "dry-run", "true")
+
+			if include {
+				setOptValue(def.Options(), "include-hidden", "true")
+			}
+
+			buf := &bytes.Buffer{}
+			input, output := createInputAndOutput(buf)
+
+			result := backupCmd.Execute(input, output)
+
+			assert.OK(t, result)
+			assert.True(t, strings.Contains(buf.String(), path.Join(dir, "src/top.txt")+" (not a directory)"), "Expected the file to be skipped")
+			assert.Equal(t, !include, strings.Contains(buf.String(), path.Join(dir, "src/.config")+" (hidden)"))
+			assert.Equal(t, include, strings.Contains(buf.String(), "\n.config "))
+		}
+	})
+
+	t.Run("should skip folders matching an exclude pattern", func(t *testing.T) {
+		dir := createTestSource(t, "src/a/file.txt", "src/cache/file.txt")
+		defer os.RemoveAll(dir)
+
+		source := backupSource{
+			dirnames: []string{path.Join(dir, "src")},
+			excludes: []string{"cache"},
+			mode:     archive.ModeChildren,
+		}
+
+		folders, skipped, err := sourceFolders(context.Background(), source)
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(folders))
+		assert.Equal(t, "a", folders[0].name())
+		assert.Equal(t, []skippedEntry{{path: path.Join(dir, "src/cache"), reason: skippedExcluded}}, skipped)
+	})
+
+	t.Run("should skip entries at every level above the depth being archived", func(t *testing.T) {
+		dir := createTestSource(t,
+			"src/a/x/file.txt",
+			"src/a/top.txt",
+			"src/a/.hidden/file.txt",
+			"src/a/cache/file.txt",
+			"src/b/file.txt",
+		)
+
+		defer os.RemoveAll(dir)
+
+		source := backupSource{
+			dirnames:     []string{path.Join(dir, "src")},
+			excludes:     []string{"cache"},
+			mode:         archive.Mode{Depth: 2},
+			includeFiles: true,
+		}
+
+		folders, skipped, err := sourceFolders(context.Background(), source)
+		assert.OK(t, err)
+		assert.Equal(t, 2, len(folders))
+		assert.True(t, folders[0].filesOnly, "Expected files at the top of the source to be archived")
+		assert.Equal(t, "a_x", folders[1].name())
+		assert.Equal(t, []skippedEntry{
+			{path: path.Join(dir, "src/a/.hidden"), reason: skippedHidden},
+			{path: path.Join(dir, "src/a/cache"), reason: skippedExcluded},
+			{path: path.Join(dir, "src/a/top.txt"), reason: skippedNotDir},
+			{path: path.Join(dir, "src/b/file.txt"), reason: skippedNotDir},
+			{path: path.Join(dir, "src/b"), reason: skippedShallow},
+		}, skipped)
+	})
+
+	t.Run("should error if the mode is unknown", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "mode", "everything")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should archive folders from every source, named after their source", func(t *testing.T) {
+		dir := createTestSource(t, "one/data/file.txt", "two/data/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "one"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+		input.Arguments = []console.InputArgument{
+			{Value: path.Join(dir, "one")},
+			{Value: path.Join(dir, "two")},
+		}
+
+		result := backupCmd.Execute(input, output)
+
+		one := path.Join(dir, "one", "backup-"+sourceLabel(path.Join(dir, "one"))+"_data-")
+		two := path.Join(dir, "two", "backup-"+sourceLabel(path.Join(dir, "two"))+"_data-")
+
+		assert.OK(t, result)
+		assert.Equal(t, 2, len(gateway.stored))
+		assert.True(t, strings.HasPrefix(gateway.stored[0], one), "Unexpected archive: "+gateway.stored[0])
+		assert.True(t, strings.HasPrefix(gateway.stored[1], two), "Unexpected archive: "+gateway.stored[1])
+	})
+
+	t.Run("should expand patterns, and leave out duplicate and nested sources", func(t *testing.T) {
+		dir := createTestSource(t, "srv/a/data/file.txt", "srv/a/data/nested/file.txt", "srv/b/data/file.txt", "srv/c/other/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "srv/*/data"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "mode", "self")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+		input.Arguments = []console.InputArgument{
+			{Value: path.Join(dir, "srv/*/data")},
+			{Value: path.Join(dir, "srv/a/data")},
+			{Value: path.Join(dir, "srv/a/data/nested")},
+		}
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 2, len(gateway.stored))
+
+		a := path.Join(dir, "srv/a/backup-"+sourceLabel(path.Join(dir, "srv/a/data"))+"-")
+		b := path.Join(dir, "srv/b/backup-"+sourceLabel(path.Join(dir, "srv/b/data"))+"-")
+
+		assert.True(t, strings.HasPrefix(gateway.stored[0], a), "Unexpected archive: "+gateway.stored[0])
+		assert.True(t, strings.HasPrefix(gateway.stored[1], b), "Unexpected archive: "+gateway.stored[1])
+	})
+
+	t.Run("should error if a pattern matches no directories", func(t *testing.T) {
+		dir := createTestSource(t, "srv/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", path.Join(dir, "srv/*"))
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.Equal(t, 0, len(gateway.stored))
+	})
+
+	t.Run("should archive labelled Docker volumes, stopping their containers while they're archived", func(t *testing.T) {
+		defer revertStubs()
+
+		dir := createTestSource(t, "volumes/db/_data/file.txt", "volumes/web/_data/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		engine := &backupTestDocker{
+			volumes: []docker.Volume{
+				{Name: "web", Mountpoint: path.Join(dir, "volumes/web/_data")},
+				{Name: "db", Mountpoint: path.Join(dir, "volumes/db/_data"), Labels: map[string]string{labelPreHook: "dump"}},
+			},
+			containers: map[string][]docker.Container{
+				"db": {{ID: "c1", Names: []string{"/db"}}},
+			},
+		}
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+			dockerClient:            engine,
+		}
+
+		archiveDirsf = func(l logging.Logger, ds []archive.Dir, nf string, fn archive.FormatName, ex ...string) ([]archive.Result, error) {
+			engine.calls = append(engine.calls, "archive")
+			return archive.NamedDirsf(l, ds, nf, fn, ex...)
+		}
+
+		ran := []string{}
+		runHook = func(ctx context.Context, logger logging.Logger, command string, timeout time.Duration, env hook.Env) error {
+			ran = append(ran, command+" "+env["FOLDUP_FOLDER"])
+			return nil
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "docker", "true")
+		setOptValue(def.Options(), "docker-socket", "/tmp/docker.sock")
+		setOptValue(def.Options(), "docker-stop", "stop")
+		setOptValue(def.Options(), "pre-folder-hook", "check")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, "/tmp/docker.sock", factory.dockerSocket)
+		assert.Equal(t, []string{DefaultDockerLabel}, engine.labels)
+		assert.Equal(t, []string{"stop c1", "archive", "start c1", "archive"}, engine.calls)
+		assert.Equal(t, []string{"dump db", "check web"}, ran)
+		assert.Equal(t, 2, len(gateway.stored))
+		assert.True(t, strings.HasPrefix(gateway.stored[0], path.Join(dir, "volumes/db/backup-db-")), "Unexpected archive: "+gateway.stored[0])
+		assert.True(t, strings.HasPrefix(gateway.stored[1], path.Join(dir, "volumes/web/backup-web-")), "Unexpected archive: "+gateway.stored[1])
+	})
+
+	t.Run("should pause the containers using each volume only while that volume is archived", func(t *testing.T) {
+		defer revertStubs()
+
+		dir := createTestSource(t, "volumes/db/_data/file.txt", "volumes/web/_data/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		engine := &backupTestDocker{
+			volumes: []docker.Volume{
+				{Name: "db", Mountpoint: path.Join(dir, "volumes/db/_data")},
+				{Name: "web", Mountpoint: path.Join(dir, "volumes/web/_data")},
+			},
+			containers: map[string][]docker.Container{
+				"db":  {{ID: "app"}, {ID: "idle", State: "paused"}},
+				"web": {{ID: "app"}},
+			},
+		}
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+			dockerClient:            engine,
+		}
+
+		archiveDirsf = func(l logging.Logger, ds []archive.Dir, nf string, fn archive.FormatName, ex ...string) ([]archive.Result, error) {
+			engine.calls = append(engine.calls, "archive "+ds[0].Name)
+			return archive.NamedDirsf(l, ds, nf, fn, ex...)
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "docker", "true")
+		setOptValue(def.Options(), "docker-stop", "pause")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, []string{
+			"pause app", "archive db", "unpause app",
+			"pause app", "archive web", "unpause app",
+		}, engine.calls)
+		assert.Equal(t, 2, len(gateway.stored))
+	})
+
+	t.Run("should not archive a volume if its containers can't be stopped", func(t *testing.T) {
+		dir := createTestSource(t, "volumes/db/_data/file.txt", "volumes/web/_data/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		engine := &backupTestDocker{
+			volumes: []docker.Volume{
+				{Name: "db", Mountpoint: path.Join(dir, "volumes/db/_data")},
+				{Name: "web", Mountpoint: path.Join(dir, "volumes/web/_data"), Labels: map[string]string{labelStop: "none"}},
+			},
+			containers: map[string][]docker.Container{
+				"db":  {{ID: "c1"}},
+				"web": {{ID: "c2"}},
+			},
+			stopErr: errors.New("oops"),
+		}
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+			dockerClient:            engine,
+		}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "docker", "true")
+		setOptValue(def.Options(), "docker-stop", "pause")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+		assert.Equal(t, []string{"pause c1"}, engine.calls)
+		assert.Equal(t, 1, len(gateway.stored))
+		assert.True(t, strings.Contains(gateway.stored[0], "backup-web-"), "Expected the other volume to be backed up")
+	})
+
+	t.Run("should report volumes that are skipped, and apply their excludes", func(t *testing.T) {
+		dir := createTestSource(t, "volumes/a/_data/keep.txt", "volumes/a/_data/skip.tmp", "volumes/b/_data/file.txt")
+		defer os.RemoveAll(dir)
+
+		def := console.NewDefinition()
+
+		engine := &backupTestDocker{
+			volumes: []docker.Volume{
+				{Name: "a", Mountpoint: path.Join(dir, "volumes/a/_data"), Labels: map[string]string{labelExcludes: "*.tmp, cache/*"}},
+				{Name: "b", Mountpoint: path.Join(dir, "volumes/b/_data"), Labels: map[string]string{labelSchedule: "whenever"}},
+				{Name: "c", Driver: "nfs"},
+			},
+		}
+
+		factory := &backupTestFactory{dockerClient: engine}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "docker", "true")
+		setOptValue(def.Options(), "docker-label", "backup")
+		setOptValue(def.Options(), "dry-run", "true")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, []string{"backup"}, engine.labels)
+		assert.True(t, strings.Contains(buf.String(), "docker volume b (invalid labels: foldup.schedule: "), "Expected b to be skipped")
+		assert.True(t, strings.Contains(buf.String(), "docker volume c (no mountpoint)"), "Expected c to be skipped")
+		assert.True(t, strings.Contains(buf.String(), "1 folder(s), 1 file(s)"), "Expected only a's kept file to be backed up")
+	})
+
+	t.Run("should only back up volumes with their own schedule when they're due", func(t *testing.T) {
+		dir := createTestSource(t, "volumes/a/_data/file.txt")
+		defer os.RemoveAll(dir)
+
+		started := time.Date(2026, 1, 1, 3, 0, 0, 0, time.Local)
+
+		source := &dockerSource{
+			client: &backupTestDocker{
+				volumes: []docker.Volume{
+					{Name: "a", Mountpoint: path.Join(dir, "volumes/a/_data"), Labels: map[string]string{labelSchedule: "0 3 * * *"}},
+				},
+			},
+			state:    scheduling.NewFileStateStore(path.Join(dir, StateFile)),
+			stateKey: "job",
+		}
+
+		folders, _, err := source.volumes(context.Background(), started)
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(folders))
+		assert.OK(t, source.recordRun(folders[0].volume, started))
+
+		folders, skipped, err := source.volumes(context.Background(), started.Add(time.Hour))
+		assert.OK(t, err)
+		assert.Equal(t, 0, len(folders))
+		assert.Equal(t, []skippedEntry{{path: "docker volume a", reason: "not due"}}, skipped)
+
+		folders, _, err = source.volumes(context.Background(), started.Add(24*time.Hour))
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(folders))
+	})
+
+	t.Run("should error if there's no DIRNAME, and Docker volumes aren't archived", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.NotOK(t, result)
+	})
+
+	t.Run("should be able to schedule a backup", func(t *testing.T) {
+		defer removeTestState()
+
+		def := console.NewDefinition()
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, opts scheduling.Options) error {
+			return fn()
+		}
+
+		factory := &backupTestFactory{}
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "* * * * * * *")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+	})
+
+	t.Run("should keep a schedule running after a failed run", func(t *testing.T) {
+		defer removeTestArchives()
+		defer removeTestState()
+
+		def := console.NewDefinition()
+
+		runs := 0
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, opts scheduling.Options) error {
+			for i := 0; i < 2; i++ {
+				if err := fn(); err != nil {
+					return err
+				}
+
+				runs++
+			}
+
+			return nil
+		}
+
+		gateway := &backupTestStorageGateway{storeError: errors.New("oops")}
+		factory := &backupTestFactory{createGCSGatewayGateway: gateway}
+
+		backupCmd := BackupCommand(factory)
+		backupCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "DIRNAME", "testdata")
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "schedule", "* * * * * * *")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		result := backupCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.Equal(t, 2, runs)
+		assert.Equal(t, 2, len(gateway.stored))
+	})
+}
+
+// createTestSource creates a temporary directory containing the given files, which may be in
+// subdirectories. The caller should remove it when they're done with it.
+func createTestSource(t *testing.T, files ...string) string {
+	dir, err := ioutil.TempDir("", "foldup-source")
+	assert.OK(t, err)
+
+	for _, file := range files {
+		assert.OK(t, os.MkdirAll(path.Dir(path.Join(dir, file)), 0755))
+		assert.OK(t, ioutil.WriteFile(path.Join(dir, file), []byte("data"), 0644))
+	}
+
+	return dir
+}
+
+// removeTestArchives removes any archives left in testdata by backups that failed to upload them.
+func removeTestArchives() {
+	archives, _ := filepath.Glob("testdata/backup-*.tar.gz")
+
+	for _, a := range archives {
+		os.Remove(a)
+	}
+}
+
+// removeTestState removes the state files written to testdata by scheduled backups.
+func removeTestState() {
+	states, _ := filepath.Glob("testdata/*" + StateFile)
+	nested, _ := filepath.Glob("testdata/*/" + StateFile)
+
+	for _, s := range append(states, nested...) {
+		os.Remove(s)
+	}
 }
 
 func createInputAndOutput(writer io.Writer) (*console.Input, *console.Output) {
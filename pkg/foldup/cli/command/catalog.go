@@ -0,0 +1,108 @@
+package command
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/naming"
+	"github.com/SeerUK/foldup/pkg/storage"
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// RebuildCatalogCommand creates a command to reconstruct the catalog of a bucket, by scanning the
+// archives in it, e.g. if it's lost, or archives were stored before it was enabled.
+func RebuildCatalogCommand(factory foldup.Factory) *console.Command {
+	var bucket string
+	var nameTemplate string
+	var definition *console.Definition
+
+	configure := func(def *console.Definition) {
+		definition = def
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&bucket),
+			Spec:  "-b, --bucket=BUCKET",
+			Desc:  "The bucket to rebuild the catalog of",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&nameTemplate),
+			Spec:  "--name-template=TEMPLATE",
+			Desc:  "The template the archives were named with (default: " + naming.DefaultTemplate + ")",
+		})
+	}
+
+	execute := func(input *console.Input, output *console.Output) error {
+		err := mapEnv(definition, input, osEnviron())
+		if err != nil {
+			return err
+		}
+
+		if bucket == "" {
+			return errors.New("a bucket must be given with --bucket")
+		}
+
+		template, err := naming.Parse(nameTemplate)
+		if err != nil {
+			return err
+		}
+
+		gateway, err := factory.CreateGCSGateway(bucket)
+		if err != nil {
+			return err
+		}
+
+		lister, ok := gateway.(storage.Lister)
+		if !ok {
+			return errors.New("storage can't list archives")
+		}
+
+		objects, err := lister.List(context.Background(), "")
+		if err != nil {
+			return err
+		}
+
+		rebuilt := catalog.Rebuild(objects, template)
+
+		err = catalog.NewObjectStore(gateway, "").Save(context.Background(), rebuilt)
+		if err != nil {
+			return err
+		}
+
+		output.Printf("Rebuilt the catalog of gs://%s/ from %d archive(s), in %d run(s).\n", bucket, len(rebuilt.Find(catalog.Filter{})), len(rebuilt.Runs))
+
+		return nil
+	}
+
+	return &console.Command{
+		Name:        "rebuild-catalog",
+		Description: "Rebuild the catalog of a bucket, by scanning the archives in it.",
+		Configure:   configure,
+		Execute:     execute,
+	}
+}
+
+// newCatalogStore creates the store for the catalog in the given bucket, for the given job.
+// Resumable gateways can't fetch objects, so a regular gateway is used for the catalog instead, and
+// for removing expired archives.
+func newCatalogStore(factory foldup.Factory, job *backupJob, bucket string) (catalog.Store, error) {
+	gateway := job.gateway
+
+	if job.sessions != nil {
+		if job.objects == nil {
+			objects, err := factory.CreateGCSGateway(bucket)
+			if err != nil {
+				return nil, err
+			}
+
+			job.objects = objects
+		}
+
+		gateway = job.objects
+	}
+
+	return catalog.NewObjectStore(gateway, ""), nil
+}
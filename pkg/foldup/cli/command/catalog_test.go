@@ -0,0 +1,75 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/storage"
+	"github.com/eidolon/console"
+)
+
+func TestRebuildCatalogCommand(t *testing.T) {
+	t.Run("should rebuild the catalog from the archives in the bucket", func(t *testing.T) {
+		gateway := &backupTestStorageGateway{
+			objects: []storage.ObjectInfo{
+				{Name: "nas/photos/photos-1500000000.tar.gz", Size: 10},
+				{Name: "nas/music/music-1500000000.tar.gz", Size: 20},
+				{Name: "nas/photos/photos-1499913600.tar.gz", Size: 30},
+				{Name: "notes.txt", Size: 40},
+			},
+		}
+
+		def := console.NewDefinition()
+
+		rebuildCmd := RebuildCatalogCommand(&backupTestFactory{createGCSGatewayGateway: gateway})
+		rebuildCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "name-template", "{{host}}/{{folder}}/{{folder}}-{{unix}}")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		assert.OK(t, rebuildCmd.Execute(input, output))
+		assert.True(t, strings.Contains(buf.String(), "from 3 archive(s), in 2 run(s)"), "Unexpected output: "+buf.String())
+
+		rebuilt, err := catalog.NewObjectStore(gateway, "").Load(context.Background())
+		assert.OK(t, err)
+
+		entries := rebuilt.Find(catalog.Filter{Folder: "photos"})
+		assert.Equal(t, 2, len(entries))
+		assert.Equal(t, "nas", entries[0].Host)
+		assert.Equal(t, "nas/photos/photos-1500000000.tar.gz", entries[0].Object)
+	})
+
+	t.Run("should error if the name template is invalid", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		rebuildCmd := RebuildCatalogCommand(&backupTestFactory{})
+		rebuildCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "name-template", "{{host}}")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, rebuildCmd.Execute(input, output))
+	})
+
+	t.Run("should error if storage can't list archives", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		rebuildCmd := RebuildCatalogCommand(&backupTestFactory{createGCSGatewayGateway: &testStoreOnlyGateway{}})
+		rebuildCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, rebuildCmd.Execute(input, output))
+	})
+}
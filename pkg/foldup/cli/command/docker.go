@@ -0,0 +1,236 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/docker"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/scheduling"
+)
+
+// DefaultDockerLabel is the label volumes need to be backed up, when discovered from Docker.
+const DefaultDockerLabel = "foldup.enable=true"
+
+// Labels that may be set on Docker volumes to change how they're backed up.
+const (
+	// labelSchedule is a schedule to back the volume up on, instead of every run.
+	labelSchedule = "foldup.schedule"
+	// labelExcludes are comma-separated patterns of files to leave out of the volume's archive.
+	labelExcludes = "foldup.excludes"
+	// labelPreHook is run before the volume is archived, instead of the pre-folder hook.
+	labelPreHook = "foldup.pre_hook"
+	// labelPostHook is run once the volume is archived, instead of the post-folder hook.
+	labelPostHook = "foldup.post_hook"
+	// labelStop decides what's done with the containers using the volume while it's archived.
+	labelStop = "foldup.stop"
+)
+
+// dockerSource discovers Docker volumes to back up, on each run.
+type dockerSource struct {
+	client docker.Client
+	// label selects the volumes to back up.
+	label string
+	// stop decides what's done with the containers using a volume while it's archived, unless the
+	// volume's labels say otherwise.
+	stop docker.StopMode
+	// state records when each volume with its own schedule was last backed up, under keys made from
+	// stateKey. Without it, those volumes are backed up on every run.
+	state    scheduling.StateStore
+	stateKey string
+}
+
+// dockerVolume is a Docker volume to back up, along with the settings read from its labels.
+type dockerVolume struct {
+	name     string
+	schedule string
+	preHook  string
+	postHook string
+	stop     docker.StopMode
+}
+
+// volumes finds the volumes to back up, returning a folder for each of them, along with the volumes
+// that are left out, e.g. because their schedule says they're not due yet, or their labels are
+// invalid. Each volume's data is archived as a whole, named after the volume.
+func (d *dockerSource) volumes(ctx context.Context, now time.Time) ([]sourceFolder, []skippedEntry, error) {
+	volumes, err := d.client.Volumes(ctx, d.label)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+
+	folders := []sourceFolder{}
+	skipped := []skippedEntry{}
+
+	for _, v := range volumes {
+		entry := "docker volume " + v.Name
+
+		if v.Mountpoint == "" {
+			skipped = append(skipped, skippedEntry{path: entry, reason: "no mountpoint"})
+			continue
+		}
+
+		volume, excludes, err := d.readLabels(v)
+		if err != nil {
+			skipped = append(skipped, skippedEntry{path: entry, reason: fmt.Sprintf("invalid labels: %v", err)})
+			continue
+		}
+
+		if volume.schedule != "" {
+			due, err := d.due(volume, now)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !due {
+				skipped = append(skipped, skippedEntry{path: entry, reason: "not due"})
+				continue
+			}
+		}
+
+		folders = append(folders, sourceFolder{
+			dir:    archive.Dir{Path: v.Mountpoint, Name: v.Name, Excludes: excludes},
+			volume: volume,
+		})
+	}
+
+	return folders, skipped, nil
+}
+
+// readLabels reads the settings for the given volume from its labels, along with the patterns of
+// files to leave out of its archive.
+func (d *dockerSource) readLabels(v docker.Volume) (*dockerVolume, []string, error) {
+	volume := &dockerVolume{
+		name:     v.Name,
+		schedule: v.Labels[labelSchedule],
+		preHook:  v.Labels[labelPreHook],
+		postHook: v.Labels[labelPostHook],
+		stop:     d.stop,
+	}
+
+	if volume.schedule != "" {
+		if _, err := scheduling.Interval(volume.schedule); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", labelSchedule, err)
+		}
+	}
+
+	if stop, ok := v.Labels[labelStop]; ok {
+		mode, err := docker.ParseStopMode(stop)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		volume.stop = mode
+	}
+
+	excludes := []string{}
+	for _, pattern := range strings.Split(v.Labels[labelExcludes], ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			excludes = append(excludes, pattern)
+		}
+	}
+
+	if err := archive.ValidateExcludes(excludes); err != nil {
+		return nil, nil, err
+	}
+
+	return volume, excludes, nil
+}
+
+// due checks if the given volume, which has its own schedule, should be backed up now. It is if
+// it's never been backed up, or a run on its schedule has come due since it last was.
+func (d *dockerSource) due(volume *dockerVolume, now time.Time) (bool, error) {
+	if d.state == nil {
+		return true, nil
+	}
+
+	state, ok, err := d.state.Get(d.volumeKey(volume))
+	if err != nil || !ok {
+		return err == nil, err
+	}
+
+	return scheduling.Missed(volume.schedule, state.LastRun, now)
+}
+
+// recordRun records that the given volume, which has its own schedule, was backed up by the run
+// that started at the given time.
+func (d *dockerSource) recordRun(volume *dockerVolume, started time.Time) error {
+	if d.state == nil {
+		return nil
+	}
+
+	return d.state.Put(d.volumeKey(volume), scheduling.JobState{
+		LastRun:     started,
+		LastSuccess: started,
+	})
+}
+
+// volumeKey returns the key that the state of the given volume is stored under.
+func (d *dockerSource) volumeKey(volume *dockerVolume) string {
+	return d.stateKey + "#docker:" + volume.name
+}
+
+// quiesce stops or pauses the running containers using the given volume, as its stop mode says,
+// and returns a function that starts or unpauses them again. If any container can't be stopped,
+// the ones that were are started again, and an error is returned.
+func (d *dockerSource) quiesce(ctx context.Context, logger logging.Logger, volume *dockerVolume) (func(), error) {
+	stopped := []docker.Container{}
+
+	resume := func() {
+		for _, c := range stopped {
+			var err error
+			if volume.stop == docker.StopPause {
+				err = d.client.Unpause(context.Background(), c.ID)
+			} else {
+				err = d.client.Start(context.Background(), c.ID)
+			}
+
+			if err != nil {
+				logger.Error("Failed to resume container", logging.F("container", c.Name()), logging.Err(err))
+			} else {
+				logger.Info("Resumed container", logging.F("container", c.Name()))
+			}
+		}
+	}
+
+	if volume.stop == docker.StopNone {
+		return resume, nil
+	}
+
+	containers, err := d.client.Containers(ctx, volume.name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range containers {
+		// Containers that are already paused aren't writing to the volume, and are left as they are,
+		// rather than being resumed afterwards.
+		if c.State == "paused" {
+			continue
+		}
+
+		if volume.stop == docker.StopPause {
+			err = d.client.Pause(ctx, c.ID)
+		} else {
+			err = d.client.Stop(ctx, c.ID)
+		}
+
+		if err != nil {
+			resume()
+			return nil, err
+		}
+
+		logger.Info("Stopped container while its volume is archived", logging.F("container", c.Name()), logging.F("mode", string(volume.stop)))
+
+		stopped = append(stopped, c)
+	}
+
+	return resume, nil
+}
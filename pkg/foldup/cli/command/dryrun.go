@@ -0,0 +1,84 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/eidolon/console"
+)
+
+// planBackup works out what a backup of the given source would do, and describes it to the given
+// output, including any entries that would be skipped. Directories are read and walked just like a
+// real backup, but nothing is archived, and storage isn't touched.
+func planBackup(output *console.Output, source backupSource, bucket string) error {
+	folders, skipped, err := sourceFolders(context.Background(), source)
+	if err != nil {
+		return err
+	}
+
+	format := source.format
+	if format == "" {
+		format = archive.TarGz
+	}
+
+	// The archives would be named as if the run started now.
+	objects, err := objectNames(source, folders, foldup.NewReport(""))
+	if err != nil {
+		return err
+	}
+
+	plans := []archive.Result{}
+	names := []string{}
+
+	for _, folder := range folders {
+		plan := archive.Planf
+		if folder.filesOnly {
+			plan = archive.PlanFilesf
+		}
+
+		result, err := plan(folder.dir, BackupFmt, format, sourceExcludes(source, folder)...)
+		if err != nil {
+			return err
+		}
+
+		plans = append(plans, result)
+		names = append(names, folder.name())
+	}
+
+	buf := &bytes.Buffer{}
+	files := 0
+	total := int64(0)
+
+	fmt.Fprintf(buf, "Dry run, nothing will be archived or uploaded.\n\n")
+
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FOLDER\tFILES\tBYTES\tOBJECT")
+
+	for i, p := range plans {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", names[i], p.Files, p.Bytes, objects[i])
+
+		files += p.Files
+		total += p.Bytes
+	}
+
+	w.Flush()
+
+	if len(skipped) > 0 {
+		fmt.Fprintf(buf, "\nSkipped:\n")
+
+		for _, entry := range skipped {
+			fmt.Fprintf(buf, "  %s (%s)\n", entry.path, entry.reason)
+		}
+	}
+
+	fmt.Fprintf(buf, "\n%d folder(s), %d file(s), %d bytes before compression.\n", len(plans), files, total)
+	fmt.Fprintf(buf, "Destination: gs://%s/\n", bucket)
+
+	output.Print(buf.String())
+
+	return nil
+}
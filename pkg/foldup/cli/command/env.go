@@ -0,0 +1,115 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// EnvPrefix is the prefix of the environment variables options can be set with.
+const EnvPrefix = "FOLDUP_"
+
+// EnvFileSuffix is appended to an option's environment variable name to read its value from a
+// file instead, which is how secrets are usually handed to containers.
+const EnvFileSuffix = "_FILE"
+
+// EnvVarName returns the name of the environment variable for the option with the given name, e.g.
+// "FOLDUP_SMTP_PASSWORD" for "smtp-password".
+func EnvVarName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// mapEnv sets any options in the given definition that weren't given on the command line from
+// their environment variables. Options given on the command line take precedence, so this has to
+// be done here rather than by the console, which would let the environment win.
+func mapEnv(def *console.Definition, input *console.Input, env []string) error {
+	vars := make(map[string]string)
+
+	for _, ev := range env {
+		pair := strings.SplitN(ev, "=", 2)
+		if len(pair) == 2 {
+			vars[pair[0]] = pair[1]
+		}
+	}
+
+	given := make(map[string]bool)
+
+	for _, opt := range input.Options {
+		given[opt.Name] = true
+	}
+
+	for _, opt := range def.Options() {
+		name := optionName(opt)
+		if name == "help" || optionGiven(opt, given) {
+			continue
+		}
+
+		key := EnvVarName(name)
+
+		value, ok, err := lookupEnv(vars, key)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := opt.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid value '%s' for option '%s' from environment: %v", value, name, err)
+		}
+	}
+
+	return nil
+}
+
+// lookupEnv finds the value of the given environment variable, or reads it from the file named by
+// the same variable with EnvFileSuffix appended. It's an error for both to be set.
+func lookupEnv(vars map[string]string, key string) (string, bool, error) {
+	value, ok := vars[key]
+	filename, fileOK := vars[key+EnvFileSuffix]
+
+	if ok && fileOK {
+		return "", false, fmt.Errorf("only one of %s and %s%s may be set", key, key, EnvFileSuffix)
+	}
+
+	if !fileOK {
+		return value, ok, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s%s: %v", key, EnvFileSuffix, err)
+	}
+
+	// Files written by hand, or by most secret managers, end with a newline that isn't part of the
+	// secret itself.
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// optionName returns the longest name of the given option, which is its long name if it has one.
+func optionName(opt parameters.Option) string {
+	name := ""
+
+	for _, n := range opt.Names {
+		if len(n) > len(name) {
+			name = n
+		}
+	}
+
+	return name
+}
+
+// optionGiven checks if the given option was given on the command line under any of its names.
+func optionGiven(opt parameters.Option, given map[string]bool) bool {
+	for _, n := range opt.Names {
+		if given[n] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,11 +1,24 @@
 package command
 
 import (
+	"bytes"
 	"context"
 	"io"
+	"io/ioutil"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/config"
+	"github.com/SeerUK/foldup/pkg/docker"
+	"github.com/SeerUK/foldup/pkg/hook"
+	"github.com/SeerUK/foldup/pkg/lock"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/notify"
 	"github.com/SeerUK/foldup/pkg/scheduling"
 	"github.com/SeerUK/foldup/pkg/storage"
 )
@@ -14,16 +27,105 @@ import (
 // testing.
 type backupTestStorageGateway struct {
 	storeError error
+	stored     []string
+	contents   map[string][]byte
+	objects    []storage.ObjectInfo
+	deleted    []string
+}
+
+func (f *backupTestStorageGateway) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	objects := []storage.ObjectInfo{}
+	for _, o := range f.objects {
+		if strings.HasPrefix(o.Name, prefix) {
+			objects = append(objects, o)
+		}
+	}
+
+	return objects, nil
+}
+
+func (f *backupTestStorageGateway) Delete(ctx context.Context, name string) error {
+	f.deleted = append(f.deleted, name)
+
+	return nil
+}
+
+func (f *backupTestStorageGateway) Fetch(ctx context.Context, name string) (io.ReadCloser, error) {
+	data, ok := f.contents[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
 }
 
 func (f *backupTestStorageGateway) Store(ctx context.Context, filename string, in io.Reader) error {
+	f.stored = append(f.stored, filename)
+
+	if f.contents == nil {
+		f.contents = make(map[string][]byte)
+	}
+
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	f.contents[filename] = data
+
 	return f.storeError
 }
 
+// backupTestLocker is used as a locker for backup jobs during testing. Locks can be acquired unless
+// held is set, which simulates another instance holding them. Locks are lost once lost is closed.
+type backupTestLocker struct {
+	held       bool
+	acquireErr error
+	lost       chan struct{}
+	names      []string
+	released   int
+}
+
+func (l *backupTestLocker) Acquire(ctx context.Context, name string) (lock.Lock, bool, error) {
+	l.names = append(l.names, name)
+
+	if l.acquireErr != nil || l.held {
+		return nil, false, l.acquireErr
+	}
+
+	return l, true, nil
+}
+
+func (l *backupTestLocker) Release(ctx context.Context) error {
+	l.released++
+
+	return nil
+}
+
+func (l *backupTestLocker) Lost() <-chan struct{} {
+	return l.lost
+}
+
 // backupTestFactory is used to create dependencies for the backup command during testing.
 type backupTestFactory struct {
+	createLoggerError error
+
 	createGCSGatewayGateway storage.Gateway
 	createGCSGatewayError   error
+
+	resumableSessions  storage.SessionStore
+	resumableChunkSize int
+
+	leaseLocker      lock.Locker
+	leaseLockerError error
+	leaseLockerTTL   time.Duration
+
+	dockerClient docker.Client
+	dockerSocket string
+}
+
+func (f *backupTestFactory) CreateLogger() (logging.Logger, error) {
+	return logging.NewNopLogger(), f.createLoggerError
 }
 
 func (f *backupTestFactory) CreateGCSGateway(bucket string) (storage.Gateway, error) {
@@ -34,9 +136,106 @@ func (f *backupTestFactory) CreateGCSGateway(bucket string) (storage.Gateway, er
 	return f.createGCSGatewayGateway, f.createGCSGatewayError
 }
 
+func (f *backupTestFactory) CreateResumableGCSGateway(bucket string, sessions storage.SessionStore, chunkSize int) (storage.Gateway, error) {
+	f.resumableSessions = sessions
+	f.resumableChunkSize = chunkSize
+
+	return f.CreateGCSGateway(bucket)
+}
+
+func (f *backupTestFactory) CreateLeaseLocker(bucket string, ttl time.Duration) (lock.Locker, error) {
+	f.leaseLockerTTL = ttl
+
+	return f.leaseLocker, f.leaseLockerError
+}
+
+func (f *backupTestFactory) CreateDockerClient(socket string) (docker.Client, error) {
+	f.dockerSocket = socket
+
+	return f.dockerClient, nil
+}
+
+// backupTestDocker is a fake Docker engine, recording what's done to its containers.
+type backupTestDocker struct {
+	volumes    []docker.Volume
+	containers map[string][]docker.Container
+	labels     []string
+	calls      []string
+	stopErr    error
+}
+
+func (d *backupTestDocker) Volumes(ctx context.Context, labels ...string) ([]docker.Volume, error) {
+	d.labels = labels
+
+	return d.volumes, nil
+}
+
+func (d *backupTestDocker) Containers(ctx context.Context, volume string) ([]docker.Container, error) {
+	return d.containers[volume], nil
+}
+
+func (d *backupTestDocker) Stop(ctx context.Context, id string) error {
+	d.calls = append(d.calls, "stop "+id)
+
+	return d.stopErr
+}
+
+func (d *backupTestDocker) Start(ctx context.Context, id string) error {
+	d.calls = append(d.calls, "start "+id)
+
+	return nil
+}
+
+func (d *backupTestDocker) Pause(ctx context.Context, id string) error {
+	d.calls = append(d.calls, "pause "+id)
+
+	return d.stopErr
+}
+
+func (d *backupTestDocker) Unpause(ctx context.Context, id string) error {
+	d.calls = append(d.calls, "unpause "+id)
+
+	return nil
+}
+
+// backupTestNotifier is a notify.Notifier that counts the times it's flushed.
+type backupTestNotifier struct {
+	sync.Mutex
+
+	flushed int
+}
+
+func (n *backupTestNotifier) Notify(ctx context.Context, notification notify.Notification) error {
+	return nil
+}
+
+func (n *backupTestNotifier) Flush(ctx context.Context) error {
+	n.Lock()
+	defer n.Unlock()
+
+	n.flushed++
+
+	return nil
+}
+
+func (n *backupTestNotifier) flushes() int {
+	n.Lock()
+	defer n.Unlock()
+
+	return n.flushed
+}
+
 func revertStubs() {
-	archiveDirsf = archive.Dirsf
+	archiveDirsf = archive.NamedDirsf
+	archiveFilesf = archive.Filesf
+	osEnviron = os.Environ
+	runHook = hook.Run
+	osCreate = os.Create
 	osOpen = os.Open
 	osRemove = os.Remove
-	scheduleFunc = scheduling.ScheduleFunc
+	netListen = net.Listen
+	scheduleFunc = scheduling.Schedule
+	signalNotify = signal.Notify
+	signalStop = signal.Stop
+	loadConfig = config.Load
 }
@@ -0,0 +1,171 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/manifest"
+	"github.com/SeerUK/foldup/pkg/storage"
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// FindCommand creates a command to search for files in every archive recorded in the catalog of a
+// bucket. Only the manifest stored alongside each archive is read, so no archives are downloaded.
+func FindCommand(factory foldup.Factory) *console.Command {
+	var pattern string
+	var bucket string
+	var filter catalog.Filter
+	var definition *console.Definition
+
+	configure := func(def *console.Definition) {
+		definition = def
+
+		def.AddArgument(console.ArgumentDefinition{
+			Value: parameters.NewStringValue(&pattern),
+			Spec:  "PATTERN",
+			Desc:  "The path of the files to find, e.g. etc/app.yml; may be a glob pattern like etc/*.yml",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&bucket),
+			Spec:  "-b, --bucket=BUCKET",
+			Desc:  "The bucket to search the archives in",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&filter.Job),
+			Spec:  "--job=NAME",
+			Desc:  "Only search archives made by the job with this name",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&filter.Host),
+			Spec:  "--host=HOST",
+			Desc:  "Only search archives made on this host",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&filter.Folder),
+			Spec:  "--folder=NAME",
+			Desc:  "Only search archives of the folder with this name",
+		})
+	}
+
+	execute := func(input *console.Input, output *console.Output) error {
+		err := mapEnv(definition, input, osEnviron())
+		if err != nil {
+			return err
+		}
+
+		if bucket == "" {
+			return errors.New("a bucket must be given with --bucket")
+		}
+
+		err = archive.ValidatePattern(pattern)
+		if err != nil {
+			return err
+		}
+
+		gateway, err := factory.CreateGCSGateway(bucket)
+		if err != nil {
+			return err
+		}
+
+		fetcher, ok := gateway.(storage.Fetcher)
+		if !ok {
+			return errors.New("storage can't fetch manifests")
+		}
+
+		ctx := context.Background()
+
+		c, err := catalog.NewObjectStore(gateway, "").Load(ctx)
+		if err != nil {
+			return err
+		}
+
+		buf := &bytes.Buffer{}
+
+		w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tFOLDER\tPATH\tBYTES\tMODIFIED\tOBJECT")
+
+		found := 0
+		unsearched := 0
+
+		// Archives are searched newest first, so the first match is the latest copy of a file.
+		for _, e := range c.Find(filter) {
+			if e.Manifest == "" {
+				unsearched++
+				continue
+			}
+
+			err := readManifest(ctx, fetcher, e.Manifest, func(entry manifest.Entry) error {
+				if _, ok := archive.MatchPath(pattern, entry.Path); !ok {
+					return nil
+				}
+
+				found++
+
+				_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+					e.Time.UTC().Format(time.RFC3339),
+					e.Folder,
+					entry.Path,
+					entry.Size,
+					entry.ModTime.UTC().Format(time.RFC3339),
+					e.Object,
+				)
+
+				return err
+			})
+
+			if err == storage.ErrNotFound {
+				unsearched++
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if found == 0 {
+			output.Printf("No files matching '%s' found in the catalog of gs://%s/.\n", pattern, bucket)
+		} else {
+			w.Flush()
+			output.Print(buf.String())
+		}
+
+		if unsearched > 0 {
+			output.Printf("%d archive(s) have no manifest, and weren't searched.\n", unsearched)
+		}
+
+		return nil
+	}
+
+	return &console.Command{
+		Name:        "find",
+		Description: "Find files matching a path in every archive recorded in the catalog of a bucket.",
+		Configure:   configure,
+		Execute:     execute,
+	}
+}
+
+// readManifest fetches the manifest with the given name, and reads it, calling fn for each file in
+// it. If the manifest isn't stored, storage.ErrNotFound is returned.
+func readManifest(ctx context.Context, fetcher storage.Fetcher, name string, fn func(entry manifest.Entry) error) error {
+	in, err := fetcher.Fetch(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	return manifest.Read(in, fn)
+}
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/manifest"
+	"github.com/eidolon/console"
+)
+
+// createTestManifest creates the manifest of an archive holding the given files.
+func createTestManifest(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+
+	_, err := manifest.Build(buf, bytes.NewReader(createTestArchive(t, files)), archive.TarGz)
+	assert.OK(t, err)
+
+	return buf.Bytes()
+}
+
+// createFindTestGateway creates a gateway holding a catalog of three archives of an app folder,
+// made a day apart. Only the two newest have manifests, and only the oldest has the file app.yml.
+func createFindTestGateway(t *testing.T) *backupTestStorageGateway {
+	started := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+	gateway := &backupTestStorageGateway{contents: map[string][]byte{
+		manifest.Name("backup-app-2.tar.gz"): createTestManifest(t, map[string]string{
+			"/srv/app/etc/app.yml": "old: true",
+		}),
+		manifest.Name("backup-app-3.tar.gz"): createTestManifest(t, map[string]string{
+			"/srv/app/etc/db.yml": "db: true",
+		}),
+	}}
+
+	saved := &catalog.Catalog{Runs: []catalog.Run{
+		{ID: "1", Started: started.Add(-48 * time.Hour), Snapshots: []catalog.Snapshot{
+			{Folder: "app", Object: "backup-app-1.tar.gz", Status: catalog.StatusSuccess},
+		}},
+		{ID: "2", Started: started.Add(-24 * time.Hour), Snapshots: []catalog.Snapshot{
+			{Folder: "app", Object: "backup-app-2.tar.gz", Manifest: manifest.Name("backup-app-2.tar.gz"), Status: catalog.StatusSuccess},
+		}},
+		{ID: "3", Started: started, Snapshots: []catalog.Snapshot{
+			{Folder: "app", Object: "backup-app-3.tar.gz", Manifest: manifest.Name("backup-app-3.tar.gz"), Status: catalog.StatusSuccess},
+		}},
+	}}
+
+	assert.OK(t, catalog.NewObjectStore(gateway, "").Save(context.Background(), saved))
+
+	return gateway
+}
+
+func TestFindCommand(t *testing.T) {
+	// run configures and executes the find command, looking for the given pattern.
+	run := func(t *testing.T, gateway *backupTestStorageGateway, pattern string) (string, error) {
+		def := console.NewDefinition()
+
+		findCmd := FindCommand(&backupTestFactory{createGCSGatewayGateway: gateway})
+		findCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "PATTERN", pattern)
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		err := findCmd.Execute(input, output)
+
+		return buf.String(), err
+	}
+
+	t.Run("should find files in the manifests of archives, newest first", func(t *testing.T) {
+		out, err := run(t, createFindTestGateway(t), "etc/*.yml")
+		assert.OK(t, err)
+
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+
+		assert.Equal(t, 4, len(lines))
+		assert.True(t, strings.HasPrefix(lines[0], "TIME"), "Expected a header")
+		assert.True(t, strings.HasPrefix(lines[1], "2017-07-14T02:40:00Z"), "Unexpected line: "+lines[1])
+		assert.True(t, strings.Contains(lines[1], "/srv/app/etc/db.yml"), "Unexpected line: "+lines[1])
+		assert.True(t, strings.HasSuffix(lines[1], "backup-app-3.tar.gz"), "Unexpected line: "+lines[1])
+		assert.Equal(t, []string{
+			"2017-07-13T02:40:00Z", "app", "/srv/app/etc/app.yml", "9", "2017-07-11T09:30:00Z", "backup-app-2.tar.gz",
+		}, strings.Fields(lines[2]))
+		assert.Equal(t, "1 archive(s) have no manifest, and weren't searched.", lines[3])
+	})
+
+	t.Run("should say if no files match", func(t *testing.T) {
+		out, err := run(t, createFindTestGateway(t), "nope.yml")
+		assert.OK(t, err)
+		assert.True(t, strings.Contains(out, "No files matching 'nope.yml' found"), "Unexpected output: "+out)
+	})
+
+	t.Run("should not search archives whose manifest is missing", func(t *testing.T) {
+		gateway := createFindTestGateway(t)
+		delete(gateway.contents, manifest.Name("backup-app-2.tar.gz"))
+
+		out, err := run(t, gateway, "app.yml")
+		assert.OK(t, err)
+		assert.True(t, strings.Contains(out, "No files matching"), "Unexpected output: "+out)
+		assert.True(t, strings.Contains(out, "2 archive(s) have no manifest"), "Unexpected output: "+out)
+	})
+
+	t.Run("should error if a manifest is corrupt", func(t *testing.T) {
+		gateway := createFindTestGateway(t)
+		gateway.contents[manifest.Name("backup-app-3.tar.gz")] = []byte("nope")
+
+		_, err := run(t, gateway, "app.yml")
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if the pattern is invalid", func(t *testing.T) {
+		_, err := run(t, createFindTestGateway(t), "etc/[.yml")
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if no bucket is given", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		findCmd := FindCommand(&backupTestFactory{})
+		findCmd.Configure(def)
+
+		setArgValue(def.Arguments(), "PATTERN", "app.yml")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, findCmd.Execute(input, output))
+	})
+}
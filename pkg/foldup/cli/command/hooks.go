@@ -0,0 +1,122 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/hook"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// For testing
+var runHook = hook.Run
+
+// backupHooks are shell commands run around each backup run, and around each folder in a run.
+type backupHooks struct {
+	// Pre is run before each run. If it fails, the run fails without backing anything up.
+	Pre string
+	// Post is run after each run, whatever its outcome.
+	Post string
+	// PreFolder is run before each folder is archived. If it fails, the folder isn't backed up.
+	PreFolder string
+	// PostFolder is run as soon as each folder is archived, whatever its outcome.
+	PostFolder string
+	// Timeout is how long each hook may run for.
+	Timeout time.Duration
+}
+
+// configure adds options for each hook to the given definition.
+func (h *backupHooks) configure(def *console.Definition) {
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&h.Pre),
+		Spec:  "--pre-hook=COMMAND",
+		Desc:  "A shell command to run before each backup; if it fails, nothing is backed up",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&h.Post),
+		Spec:  "--post-hook=COMMAND",
+		Desc:  "A shell command to run after each backup, whether it succeeded or not",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&h.PreFolder),
+		Spec:  "--pre-folder-hook=COMMAND",
+		Desc:  "A shell command to run before each folder is archived; if it fails, the folder is skipped",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&h.PostFolder),
+		Spec:  "--post-folder-hook=COMMAND",
+		Desc:  "A shell command to run as soon as each folder is archived, whether it succeeded or not",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewDurationValue(&h.Timeout),
+		Spec:  "--hook-timeout=DURATION",
+		Desc:  "How long each hook may run for before it's killed (default: 10m)",
+	})
+}
+
+// run runs the given hook command, if there is one, describing the given run to it.
+func (h backupHooks) run(ctx context.Context, logger logging.Logger, command string, env hook.Env) error {
+	if command == "" {
+		return nil
+	}
+
+	return runHook(ctx, logger, command, h.Timeout, env)
+}
+
+// runEnv returns the environment variables describing the given run to the hook with the given
+// name. Hooks run after the run also get its outcome.
+func runEnv(name string, report *foldup.Report, after bool) hook.Env {
+	env := hook.Env{
+		"FOLDUP_HOOK":    name,
+		"FOLDUP_RUN_ID":  report.RunID,
+		"FOLDUP_JOB":     report.Job,
+		"FOLDUP_DIRNAME": report.Dirname,
+	}
+
+	if after {
+		outcomeEnv(env, report.Err)
+
+		if report.Err != nil {
+			env["FOLDUP_STAGE"] = string(report.Stage)
+		}
+	}
+
+	return env
+}
+
+// folderEnv returns the environment variables describing the given folder, in the given run, to
+// the hook with the given name. Hooks run after the folder is backed up also get its outcome.
+func folderEnv(name string, report *foldup.Report, folder foldup.FolderReport, after bool) hook.Env {
+	env := runEnv(name, report, false)
+	env["FOLDUP_FOLDER"] = folder.Name
+	env["FOLDUP_FOLDER_PATH"] = folder.Path
+
+	if after {
+		outcomeEnv(env, folder.Err)
+
+		env["FOLDUP_ARCHIVE"] = folder.Archive
+		env["FOLDUP_OBJECT"] = folder.Object
+		env["FOLDUP_BYTES"] = fmt.Sprintf("%d", folder.BytesArchived)
+	}
+
+	return env
+}
+
+// outcomeEnv adds the outcome described by the given error to the given environment variables.
+func outcomeEnv(env hook.Env, err error) {
+	env["FOLDUP_STATUS"] = "success"
+	env["FOLDUP_ERROR"] = ""
+
+	if err != nil {
+		env["FOLDUP_STATUS"] = "failure"
+		env["FOLDUP_ERROR"] = err.Error()
+	}
+}
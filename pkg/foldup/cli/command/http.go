@@ -0,0 +1,29 @@
+package command
+
+import (
+	"net/http"
+
+	"github.com/SeerUK/foldup/pkg/logging"
+)
+
+// serveHTTP starts serving the given handler on the given address in the background. Errors
+// listening on the address are returned straight away, so that a bad address is reported before
+// any backups start.
+func serveHTTP(logger logging.Logger, addr string, handler http.Handler) error {
+	listener, err := netListen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	logger = logger.With(logging.F("addr", listener.Addr().String()))
+	logger.Info("Listening for HTTP requests")
+
+	go func() {
+		err := http.Serve(listener, handler)
+		if err != nil {
+			logger.Error("Stopped listening for HTTP requests", logging.Err(err))
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,1251 @@
+package command
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/health"
+	"github.com/SeerUK/foldup/pkg/lock"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/manifest"
+	"github.com/SeerUK/foldup/pkg/naming"
+	"github.com/SeerUK/foldup/pkg/notify"
+	"github.com/SeerUK/foldup/pkg/scheduling"
+	"github.com/SeerUK/foldup/pkg/storage"
+)
+
+// backupSource describes what a backup job archives.
+type backupSource struct {
+	// dirnames are the directories whose folders are archived.
+	dirnames []string
+	// format is the archive format to produce.
+	format archive.FormatName
+	// excludes are patterns of files to leave out of archives.
+	excludes []string
+	// mode decides which directories in each of dirnames are archived.
+	mode archive.Mode
+	// includeFiles also archives the files directly in each of dirnames, which mode would otherwise
+	// leave out.
+	includeFiles bool
+	// hidden includes hidden directories, whose names start with a dot, which are otherwise left out.
+	hidden bool
+	// docker discovers Docker volumes to archive, as well as any dirnames, if it's set.
+	docker *dockerSource
+	// names names the archives in storage.
+	names archiveNames
+	// manifests stores a manifest of the files in each archive alongside it, so they can be searched.
+	manifests bool
+}
+
+// archiveNames names the archives of a backup source's folders in storage.
+type archiveNames struct {
+	// template names each archive. If it's nil, naming.Default is used.
+	template *naming.Template
+	// host is the hostname of the machine making the archives.
+	host string
+}
+
+// templateOrDefault returns the template used to name archives.
+func (n archiveNames) templateOrDefault() *naming.Template {
+	if n.template == nil {
+		return naming.Default
+	}
+
+	return n.template
+}
+
+// sourceFolder is a folder found in a backup source, to be archived.
+type sourceFolder struct {
+	// dir is the folder, and the name its archives are given.
+	dir archive.Dir
+	// rel is the path of the folder relative to the source directory it was found in, if it's deeper
+	// than the source directory.
+	rel string
+	// filesOnly means only the files directly in the folder are archived, not its subdirectories.
+	filesOnly bool
+	// volume is the Docker volume the folder holds the data of, if it was discovered from Docker.
+	volume *dockerVolume
+}
+
+// name returns the name of the folder, as used to name its archives.
+func (f sourceFolder) name() string {
+	if f.filesOnly {
+		return f.dir.Name + archive.FilesSuffix
+	}
+
+	return f.dir.Name
+}
+
+// relPath returns the path of the folder relative to its source, as used to name its archives.
+// Folders that are a whole source directory, or volume, are named after the folder instead.
+func (f sourceFolder) relPath() string {
+	if f.rel == "" || f.filesOnly {
+		return f.name()
+	}
+
+	return f.rel
+}
+
+// preHook returns the command to run before the folder is archived. Docker volumes may have their
+// own, instead of the given hooks' pre-folder hook.
+func (f sourceFolder) preHook(hooks backupHooks) string {
+	if f.volume != nil && f.volume.preHook != "" {
+		return f.volume.preHook
+	}
+
+	return hooks.PreFolder
+}
+
+// postHook returns the command to run once the folder is archived, like preHook.
+func (f sourceFolder) postHook(hooks backupHooks) string {
+	if f.volume != nil && f.volume.postHook != "" {
+		return f.volume.postHook
+	}
+
+	return hooks.PostFolder
+}
+
+// skippedEntry is an entry in a backup source that isn't backed up, and why.
+type skippedEntry struct {
+	path   string
+	reason string
+}
+
+// Reasons entries in a backup source are skipped.
+const (
+	skippedHidden   = "hidden"
+	skippedNotDir   = "not a directory"
+	skippedExcluded = "excluded"
+	skippedShallow  = "no folders at the archived depth"
+)
+
+// backupJob holds everything needed to back up a directory, so that it can be run repeatedly.
+type backupJob struct {
+	name      string
+	source    backupSource
+	bucket    string
+	gateway   storage.Gateway
+	retention storage.RetentionPolicy
+	// objects is used to list and delete stored archives, if gateway can't.
+	objects  storage.Gateway
+	sessions storage.SessionStore
+	metrics  *backupMetrics
+	health   *health.Monitor
+	notifier notify.Notifier
+	hostname string
+	logger   logging.Logger
+	// state records when the job last ran, under stateKey, so missed runs can be caught up on.
+	state    scheduling.StateStore
+	stateKey string
+	// locker is used to take the lock named lockName before each run, so that only one instance
+	// backs up the same thing at once.
+	locker   lock.Locker
+	lockName string
+	// hooks are run around each run, and each folder.
+	hooks backupHooks
+	// catalog records each run, and is used to find expired archives, if it's set.
+	catalog catalog.Store
+}
+
+// run performs a single backup run, recording the outcome. If the job has a locker, and another
+// instance holds its lock, the run is skipped.
+func (j *backupJob) run() error {
+	report := foldup.NewReport(strings.Join(j.source.dirnames, ", "))
+	report.Job = j.name
+
+	// Everything logged during the run, including by storage gateways, is tagged with the run ID.
+	ctx := logging.WithFields(context.Background(), logging.RunID(report.RunID))
+	if j.name != "" {
+		ctx = logging.WithFields(ctx, logging.F("job", j.name))
+	}
+
+	logger := logging.FromContext(ctx, j.logger)
+
+	// Work done under the lock stops if the lock is lost. Post-hooks and recording the outcome still
+	// use the run's own context, so that the failure is seen through.
+	work := ctx
+
+	var lost <-chan struct{}
+
+	if j.locker != nil {
+		held, ok, err := j.locker.Acquire(ctx, j.lockName)
+		if err != nil {
+			report.Fail(foldup.StageLock, err)
+		} else if !ok {
+			// Another instance is doing the same backup, so there's nothing to do, or to notify
+			// anyone about. It's still a healthy outcome, so that standby instances stay ready.
+			logger.Info("Skipped backup run, another instance holds the lock", logging.F("lock", j.lockName))
+
+			j.health.RunStarted()
+			j.health.RunFinished(true)
+			j.metrics.recordSkipped()
+
+			return nil
+		} else {
+			defer j.release(logger, held)
+
+			var cancel context.CancelFunc
+
+			work, cancel = whileHeld(ctx, held)
+			lost = held.Lost()
+
+			defer cancel()
+		}
+	}
+
+	logger.Info("Started backup run", logging.F("dirname", report.Dirname))
+
+	j.health.RunStarted()
+	j.notify(logger, report)
+
+	// Post-hooks are run for every run that gets as far as its pre-hook, whatever the outcome.
+	hooked := report.OK()
+
+	if hooked {
+		err := j.hooks.run(work, logger, j.hooks.Pre, runEnv("pre", report, false))
+		if err != nil {
+			report.Fail(foldup.StageHook, err)
+		}
+	}
+
+	// Finish off any uploads that were interrupted in a previous run, or by a restart.
+	if j.sessions != nil && report.OK() {
+		err := resumeUploads(work, j.bucket, j.sessions, j.gateway)
+		if err != nil {
+			report.Fail(foldup.StageUpload, err)
+		}
+	}
+
+	if report.OK() {
+		doBackup(work, logger, j.source, j.gateway, report, j.hooks)
+	}
+
+	// Whatever else went wrong, if the lock was lost then another instance may have been running
+	// alongside this one, so nothing it did can be trusted, and nothing should be pruned.
+	select {
+	case <-lost:
+		report.Fail(foldup.StageLock, lock.ErrLost)
+	default:
+	}
+
+	// Only remove old archives once there are new ones to replace them.
+	if report.OK() && j.retention.Enabled() {
+		err := j.prune(work, report)
+		if err != nil {
+			logger.Warn("Failed to remove expired archives", logging.Err(err))
+		}
+	}
+
+	if hooked {
+		err := j.hooks.run(ctx, logger, j.hooks.Post, runEnv("post", report, true))
+		if err != nil && report.OK() {
+			report.Fail(foldup.StageHook, err)
+		}
+	}
+
+	report.Finish()
+
+	fields := []logging.Field{
+		logging.F("folders", len(report.Folders)),
+		logging.Bytes(report.BytesUploaded()),
+		logging.Duration(report.Duration()),
+	}
+
+	if report.OK() {
+		logger.Info("Finished backup run", fields...)
+	} else {
+		fields = append(fields, logging.F("stage", string(report.Stage)), logging.Err(report.Err))
+		logger.Error("Backup run failed", fields...)
+	}
+
+	j.recordState(logger, report)
+	j.recordCatalog(ctx, logger, report)
+	j.metrics.record(report)
+	j.health.RunFinished(report.OK())
+	j.notify(logger, report)
+
+	return report.Err
+}
+
+// notify sends a notification about the given report, if notifications are enabled. Failing to send
+// a notification doesn't fail the run, so errors are only logged.
+func (j *backupJob) notify(logger logging.Logger, report *foldup.Report) {
+	if j.notifier == nil {
+		return
+	}
+
+	err := j.notifier.Notify(context.Background(), notify.NewNotification(j.hostname, report))
+	if err != nil {
+		logger.Warn("Failed to send notification", logging.Err(err))
+	}
+}
+
+// flushNotifications sends any notifications held on to by the job's notifier, like the reports
+// collected for a digest email. As with notify, errors are only logged.
+func (j *backupJob) flushNotifications() {
+	flusher, ok := j.notifier.(notify.Flusher)
+	if !ok {
+		return
+	}
+
+	err := flusher.Flush(context.Background())
+	if err != nil {
+		j.logger.Warn("Failed to send held notifications", logging.Err(err))
+	}
+}
+
+// prune removes the archives that have expired under the job's retention policy, now that the run
+// described by the given report has stored new ones. If the job has a catalog, it's used to find
+// the expired archives, rather than listing objects.
+func (j *backupJob) prune(ctx context.Context, report *foldup.Report) error {
+	objects := j.objects
+	if objects == nil {
+		objects = j.gateway
+	}
+
+	template := j.source.names.templateOrDefault()
+
+	if j.catalog == nil {
+		return pruneArchives(ctx, objects, j.retention, template, report.Folders)
+	}
+
+	return catalog.Update(ctx, j.catalog, func(c *catalog.Catalog) error {
+		return pruneCatalog(ctx, objects, j.retention, template, c, report)
+	})
+}
+
+// recordCatalog records the run described by the given report in the job's catalog, if it has one.
+// Failing to do so doesn't fail the run, so errors are only logged.
+func (j *backupJob) recordCatalog(ctx context.Context, logger logging.Logger, report *foldup.Report) {
+	if j.catalog == nil {
+		return
+	}
+
+	err := catalog.Update(ctx, j.catalog, func(c *catalog.Catalog) error {
+		c.Add(catalogRun(j.source, j.hostname, report))
+		return nil
+	})
+
+	if err != nil {
+		logger.Warn("Failed to record the backup run in the catalog", logging.Err(err))
+	}
+}
+
+// release releases the given lock, taken for a run. Failing to do so doesn't fail the run, so
+// errors are only logged.
+func (j *backupJob) release(logger logging.Logger, held lock.Lock) {
+	err := held.Release(context.Background())
+	if err != nil {
+		logger.Warn("Failed to release lock", logging.F("lock", j.lockName), logging.Err(err))
+	}
+}
+
+// whileHeld returns a context that's cancelled if the given lock is lost, so that work done under
+// it stops, rather than carrying on alongside another instance that's taken the lock.
+func whileHeld(ctx context.Context, held lock.Lock) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		select {
+		case <-held.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// recordState records when the run described by the given report started, and if it succeeded, in
+// the job's state store. Failing to do so doesn't fail the run, so errors are only logged.
+func (j *backupJob) recordState(logger logging.Logger, report *foldup.Report) {
+	if j.state == nil {
+		return
+	}
+
+	state, _, err := j.state.Get(j.stateKey)
+	if err == nil {
+		state.LastRun = report.Started
+
+		if report.OK() {
+			state.LastSuccess = report.Started
+		}
+
+		err = j.state.Put(j.stateKey, state)
+	}
+
+	if err != nil {
+		logger.Warn("Failed to record the state of the backup run", logging.Err(err))
+	}
+}
+
+// missedRun checks if a run on the given schedule, in the given time zone, was missed since the job
+// last ran, according to its state store.
+func (j *backupJob) missedRun(schedule string, location *time.Location) (bool, error) {
+	if j.state == nil {
+		return false, nil
+	}
+
+	state, ok, err := j.state.Get(j.stateKey)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return scheduling.Missed(schedule, state.LastRun, time.Now().In(location))
+}
+
+// scheduledNext is called by the scheduler each time the next run is scheduled.
+func (j *backupJob) scheduledNext(next time.Time) {
+	j.metrics.recordNextRun(next)
+	j.health.ScheduledNext(next)
+}
+
+// skippedRuns is called by the scheduler when runs were missed, and skipped, because a backup was
+// still running when they came due.
+func (j *backupJob) skippedRuns(missed int) {
+	logger := j.logger
+	if j.name != "" {
+		logger = logger.With(logging.F("job", j.name))
+	}
+
+	logger.Warn("Skipped scheduled backup runs missed while a backup was running", logging.F("missed", missed))
+}
+
+// doBackup perform performs the actual backup, whether on a schedule or not. The outcome is
+// recorded in the given report, and any error is also returned. Each folder's hooks are run around
+// it; a folder whose pre-folder hook fails isn't backed up, but the rest still are.
+func doBackup(ctx context.Context, logger logging.Logger, source backupSource, gateway storage.Gateway, report *foldup.Report, hooks backupHooks) error {
+	folders, skipped, err := sourceFolders(ctx, source)
+	if err != nil {
+		return report.Fail(foldup.StageRead, err)
+	}
+
+	// Entries that are left out are logged, so it's clear what isn't being backed up, and why.
+	for _, entry := range skipped {
+		logger.Info("Skipped entry in backup source", logging.F("path", entry.path), logging.F("reason", entry.reason))
+	}
+
+	names, err := objectNames(source, folders, report)
+	if err != nil {
+		return report.Fail(foldup.StageArchive, err)
+	}
+
+	for i, folder := range folders {
+		report.Folders = append(report.Folders, foldup.FolderReport{
+			Name:   folder.name(),
+			Path:   folder.dir.Path,
+			Object: names[i],
+		})
+	}
+
+	// Storing an archive under a name that's taken would overwrite an archive made before.
+	err = checkStored(ctx, gateway, names)
+	if err != nil {
+		return report.Fail(foldup.StageArchive, err)
+	}
+
+	err = backupFolders(ctx, logger, source, folders, gateway, report, hooks)
+
+	// Any folder not uploaded by now failed along with the run.
+	for i := range report.Folders {
+		folder := &report.Folders[i]
+		if !folder.Uploaded && folder.Err == nil {
+			folder.Err = err
+		}
+	}
+
+	// Volumes with their own schedule aren't due again until their next scheduled run.
+	for i, folder := range folders {
+		if folder.volume == nil || folder.volume.schedule == "" || !report.Folders[i].Uploaded {
+			continue
+		}
+
+		stateErr := source.docker.recordRun(folder.volume, report.Started)
+		if stateErr != nil {
+			logger.Warn("Failed to record when the volume was backed up", logging.Folder(folder.name()), logging.Err(stateErr))
+		}
+	}
+
+	return err
+}
+
+// backupFolders archives and uploads the given folders. The report must have a FolderReport for
+// each of them, in the same order. Folders are archived one at a time, each between its pre- and
+// post-folder hooks, and with the containers using it stopped or paused, if it's a Docker volume
+// whose stop mode says so. Post-folder hooks are run as soon as their folder has been archived, so
+// that whatever was done for it, e.g. locking a database, doesn't have to wait for every upload.
+func backupFolders(ctx context.Context, logger logging.Logger, source backupSource, folders []sourceFolder, gateway storage.Gateway, report *foldup.Report, hooks backupHooks) error {
+	format := source.format
+	if format == "" {
+		format = archive.TarGz
+	}
+
+	var hookErr error
+	var archiveErr error
+	var postErr error
+
+	archives := []archive.Result{}
+	archived := []*foldup.FolderReport{}
+
+	for i, folder := range folders {
+		folderReport := &report.Folders[i]
+
+		a, stage, err := archiveFolder(ctx, logger, source, folder, report, folderReport, hooks, format)
+		if err == nil {
+			archives = append(archives, a)
+			archived = append(archived, folderReport)
+		} else {
+			// A folder that isn't archived is skipped, but the rest are still backed up.
+			folderReport.Err = err
+
+			if stage == foldup.StageHook && hookErr == nil {
+				hookErr = err
+			} else if stage == foldup.StageArchive && archiveErr == nil {
+				archiveErr = err
+			}
+		}
+
+		// Post-folder hooks are run for every folder, whatever happened to it.
+		env := folderEnv("post-folder", report, *folderReport, true)
+
+		err = hooks.run(ctx, logger.With(logging.Folder(folderReport.Name)), folder.postHook(hooks), env)
+		if err != nil && postErr == nil {
+			postErr = err
+		}
+	}
+
+	// Upload each of the created archives to the storage.
+	for i, a := range archives {
+		folder := archived[i]
+		started := time.Now()
+
+		in, err := osOpen(a.Filename)
+		if err != nil {
+			return report.Fail(foldup.StageUpload, err)
+		}
+
+		reader := &countingReader{file: in}
+
+		err = gateway.Store(logging.WithFields(ctx, logging.Folder(folder.Name)), folder.Object, reader)
+		in.Close()
+
+		folder.BytesUploaded = reader.read
+		folder.Duration += time.Since(started)
+
+		if err != nil {
+			return report.Fail(foldup.StageUpload, err)
+		}
+
+		folder.Uploaded = true
+
+		if source.manifests {
+			storeManifest(ctx, logger, gateway, a.Filename, format, folder)
+		}
+
+		err = osRemove(a.Filename)
+		if err != nil {
+			return report.Fail(foldup.StageUpload, err)
+		}
+	}
+
+	// The other folders were backed up, but the run still failed if any folder was skipped.
+	if hookErr != nil {
+		return report.Fail(foldup.StageHook, hookErr)
+	}
+
+	if archiveErr != nil {
+		return report.Fail(foldup.StageArchive, archiveErr)
+	}
+
+	if postErr != nil {
+		return report.Fail(foldup.StageHook, postErr)
+	}
+
+	return nil
+}
+
+// archiveFolder runs the pre-folder hook of the given folder, and then archives it, recording the
+// archive in the folder's report. If the folder is a Docker volume, the containers using it are
+// stopped or paused while it's archived, if its stop mode says so, and resumed straight after. If
+// the folder isn't archived, the stage that stopped it is returned along with the error.
+func archiveFolder(ctx context.Context, logger logging.Logger, source backupSource, folder sourceFolder, report *foldup.Report, folderReport *foldup.FolderReport, hooks backupHooks, format archive.FormatName) (archive.Result, foldup.Stage, error) {
+	folderLogger := logger.With(logging.Folder(folderReport.Name))
+	env := folderEnv("pre-folder", report, *folderReport, false)
+
+	err := hooks.run(ctx, folderLogger, folder.preHook(hooks), env)
+	if err != nil {
+		return archive.Result{}, foldup.StageHook, err
+	}
+
+	resume := func() {}
+
+	if folder.volume != nil {
+		resume, err = source.docker.quiesce(ctx, folderLogger, folder.volume)
+		if err != nil {
+			return archive.Result{}, foldup.StageArchive, err
+		}
+	}
+
+	a, err := archiveSourceFolder(logger, source, folder, format)
+	resume()
+
+	if err != nil {
+		return a, foldup.StageArchive, err
+	}
+
+	folderReport.SHA256, err = hashFile(a.Filename)
+	if err != nil {
+		return a, foldup.StageArchive, err
+	}
+
+	folderReport.Archive = a.Filename
+	folderReport.Files = a.Files
+	folderReport.BytesRead = a.Bytes
+	folderReport.BytesArchived = a.Size
+	folderReport.Duration = a.Duration
+
+	return a, "", nil
+}
+
+// archiveSourceFolder archives the given folder. Folders of files directly in a source directory
+// are archived without the directory's subdirectories.
+func archiveSourceFolder(logger logging.Logger, source backupSource, folder sourceFolder, format archive.FormatName) (archive.Result, error) {
+	if folder.filesOnly {
+		return archiveFilesf(folder.dir, BackupFmt, format, sourceExcludes(source, folder)...)
+	}
+
+	archives, err := archiveDirsf(logger, []archive.Dir{folder.dir}, BackupFmt, format, sourceExcludes(source, folder)...)
+	if err != nil {
+		return archive.Result{}, err
+	}
+
+	if len(archives) != 1 {
+		return archive.Result{}, fmt.Errorf("archive: expected an archive of '%s'", folder.dir.Path)
+	}
+
+	return archives[0], nil
+}
+
+// storeManifest builds a manifest of the files in the archive with the given filename, of the given
+// folder, and stores it alongside the folder's archive. An archive without a manifest can still be
+// restored, it just can't be searched, so failing to store one doesn't fail the run, and errors are
+// only logged.
+func storeManifest(ctx context.Context, logger logging.Logger, gateway storage.Gateway, filename string, format archive.FormatName, folder *foldup.FolderReport) {
+	logger = logger.With(logging.Folder(folder.Name))
+
+	// Manifests are built next to the archive, so they can be uploaded like it is.
+	manifestFilename := filename + manifest.Suffix
+
+	err := buildManifest(manifestFilename, filename, format)
+	if err == nil {
+		var in *os.File
+
+		in, err = osOpen(manifestFilename)
+		if err == nil {
+			err = gateway.Store(ctx, manifest.Name(folder.Object), in)
+			in.Close()
+		}
+	}
+
+	osRemove(manifestFilename)
+
+	if err != nil {
+		logger.Warn("Failed to store the manifest of the archive", logging.Err(err))
+		return
+	}
+
+	folder.Manifest = manifest.Name(folder.Object)
+}
+
+// buildManifest writes a manifest of the files in the archive with the given filename, in the given
+// format, to a file with the given name.
+func buildManifest(manifestFilename string, filename string, format archive.FormatName) error {
+	in, err := osOpen(filename)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := osCreate(manifestFilename)
+	if err != nil {
+		return err
+	}
+
+	_, err = manifest.Build(out, in, format)
+	cerr := out.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return cerr
+}
+
+// objectNames returns the name the archive of each of the given folders is stored under, in the run
+// described by the given report. If the archives of two folders would be stored under the same
+// name, an error is returned, as one would overwrite the other.
+func objectNames(source backupSource, folders []sourceFolder, report *foldup.Report) ([]string, error) {
+	format := source.format
+	if format == "" {
+		format = archive.TarGz
+	}
+
+	template := source.names.templateOrDefault()
+
+	names := []string{}
+	seen := make(map[string]sourceFolder)
+
+	for _, folder := range folders {
+		name := template.Execute(naming.Vars{
+			Dir:    path.Dir(folder.dir.Path),
+			Host:   source.names.host,
+			Job:    report.Job,
+			Folder: folder.name(),
+			Path:   folder.relPath(),
+			Time:   report.Started,
+			Ext:    strings.TrimPrefix(archive.Extension(format), "."),
+			RunID:  report.RunID,
+		})
+
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("naming: folders '%s' and '%s' would both be stored as '%s'", other.dir.Path, folder.dir.Path, name)
+		}
+
+		seen[name] = folder
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// checkStored returns an error if an archive is already stored under any of the given names. If
+// the gateway can't list objects, there's no way to tell, so nothing is checked.
+func checkStored(ctx context.Context, gateway storage.Gateway, names []string) error {
+	lister, ok := gateway.(storage.Lister)
+	if !ok {
+		return nil
+	}
+
+	for _, name := range names {
+		objects, err := lister.List(ctx, name)
+		if err != nil {
+			return nil
+		}
+
+		for _, o := range objects {
+			if o.Name == name {
+				return fmt.Errorf("naming: an archive is already stored as '%s'", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sourceFolders reads the folders to archive from each of the source's directories, along with the
+// entries that are left out. Each folder is named after its path relative to its source directory,
+// and if there's more than one source directory, or they're found using a pattern, after the source
+// directory too, so that folders from different sources never share a name.
+func sourceFolders(ctx context.Context, source backupSource) ([]sourceFolder, []skippedEntry, error) {
+	dirnames, err := expandSources(source.dirnames)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	labelled := len(source.dirnames) > 1 || (len(source.dirnames) == 1 && isPattern(source.dirnames[0]))
+
+	folders := []sourceFolder{}
+	skipped := []skippedEntry{}
+
+	for _, dirname := range dirnames {
+		// Find the directories at the depth the mode asks for, relative to the given directory.
+		dirs, dirSkipped, err := readSource(source, dirname)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		skipped = append(skipped, dirSkipped...)
+
+		label := path.Base(dirname)
+		if labelled {
+			label = sourceLabel(dirname)
+		}
+
+		if source.includeFiles && source.mode != archive.ModeSelf {
+			folders = append(folders, sourceFolder{dir: archive.Dir{Path: dirname, Name: label}, filesOnly: true})
+		}
+
+		for _, d := range dirs {
+			folders = append(folders, sourceFolder{
+				dir: archive.Dir{Path: d, Name: folderName(dirname, d, label, labelled)},
+				rel: relPath(dirname, d),
+			})
+		}
+	}
+
+	if source.docker != nil {
+		volumes, volumesSkipped, err := source.docker.volumes(ctx, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+
+		folders = append(folders, volumes...)
+		skipped = append(skipped, volumesSkipped...)
+	}
+
+	return folders, skipped, nil
+}
+
+// readSource finds the directories to archive in the given source directory, at the depth the
+// source's mode asks for, along with every entry on the way down that's left out, and why.
+func readSource(source backupSource, dirname string) ([]string, []skippedEntry, error) {
+	if source.mode.Depth <= 0 {
+		return []string{dirname}, nil, nil
+	}
+
+	return readSourceDir(source, dirname, dirname, source.mode.Depth)
+}
+
+// readSourceDir finds the directories the given number of levels below dir, in the given source
+// directory. Hidden and excluded entries are left out at every level, as are files, except for those
+// at the top of the source directory that are archived on their own. Directories with nothing at
+// the depth being archived are left out too, along with everything in them.
+func readSourceDir(source backupSource, dirname string, dir string, depth int) ([]string, []skippedEntry, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dirs := []string{}
+	skipped := []skippedEntry{}
+
+	for _, entry := range entries {
+		entryPath := path.Join(dir, entry.Name())
+
+		switch {
+		case !entry.IsDir():
+			if !source.includeFiles || dir != dirname {
+				skipped = append(skipped, skippedEntry{path: entryPath, reason: skippedNotDir})
+			}
+		case !source.hidden && strings.HasPrefix(entry.Name(), "."):
+			skipped = append(skipped, skippedEntry{path: entryPath, reason: skippedHidden})
+		case archive.Excluded(dirname, entryPath, source.excludes):
+			skipped = append(skipped, skippedEntry{path: entryPath, reason: skippedExcluded})
+		case depth == 1:
+			dirs = append(dirs, entryPath)
+		default:
+			found, foundSkipped, err := readSourceDir(source, dirname, entryPath, depth-1)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			dirs = append(dirs, found...)
+			skipped = append(skipped, foundSkipped...)
+
+			if len(found) == 0 {
+				skipped = append(skipped, skippedEntry{path: entryPath, reason: skippedShallow})
+			}
+		}
+	}
+
+	return dirs, skipped, nil
+}
+
+// folderName returns the name of the given folder, found in the given source directory, which has
+// the given label. Folders deeper than the source are named after their path relative to it, and
+// only prefixed with the label if the given flag is set.
+func folderName(dirname string, folder string, label string, labelled bool) string {
+	rel, err := filepath.Rel(dirname, folder)
+	if err != nil || rel == "." {
+		return label
+	}
+
+	name := strings.Replace(filepath.ToSlash(rel), "/", "_", -1)
+	if labelled {
+		return label + "_" + name
+	}
+
+	return name
+}
+
+// relPath returns the path of the given folder relative to the given source directory, with forward
+// slashes, or an empty string if the folder is the source directory.
+func relPath(dirname string, folder string) string {
+	rel, err := filepath.Rel(dirname, folder)
+	if err != nil || rel == "." {
+		return ""
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// sourceLabel returns a label for the given source directory, made from its path, so that sources
+// with the same base name can be told apart, e.g. "/srv/app/data" becomes "srv_app_data".
+func sourceLabel(dirname string) string {
+	label := strings.TrimLeft(path.Clean(filepath.ToSlash(dirname)), "./")
+	if label == "" {
+		return path.Base(dirname)
+	}
+
+	return strings.Replace(label, "/", "_", -1)
+}
+
+// isPattern checks if the given source is a glob pattern, rather than a path.
+func isPattern(source string) bool {
+	return strings.ContainsAny(source, "*?[")
+}
+
+// sourceDir returns the directory foldup keeps its own files in by default for the given source.
+// That's the source itself, or for patterns, the directory the pattern starts from, e.g. "/srv" for
+// "/srv/*/data".
+func sourceDir(source string) string {
+	dir := source
+	for isPattern(dir) {
+		dir = path.Dir(dir)
+	}
+
+	return dir
+}
+
+// expandSources expands any glob patterns in the given sources into the directories they match, and
+// deduplicates the result. A pattern that matches no directories is an error, as it's most likely a
+// mistake. Sources that are inside of another source are dropped, as they're already backed up as
+// part of it. The directories are returned sorted, so that runs always see them in the same order.
+func expandSources(sources []string) ([]string, error) {
+	dirnames := []string{}
+
+	for _, source := range sources {
+		if !isPattern(source) {
+			dirnames = append(dirnames, path.Clean(source))
+			continue
+		}
+
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source pattern '%s': %v", source, err)
+		}
+
+		found := 0
+
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				dirnames = append(dirnames, path.Clean(filepath.ToSlash(match)))
+				found++
+			}
+		}
+
+		if found == 0 {
+			return nil, fmt.Errorf("no directories match source pattern '%s'", source)
+		}
+	}
+
+	abs := make(map[string]string)
+
+	for _, dirname := range dirnames {
+		a, err := filepath.Abs(dirname)
+		if err != nil {
+			return nil, err
+		}
+
+		abs[dirname] = a
+	}
+
+	// Sorting by absolute path means each directory comes after any directory it's inside of.
+	sort.SliceStable(dirnames, func(i, j int) bool {
+		return abs[dirnames[i]] < abs[dirnames[j]]
+	})
+
+	kept := []string{}
+	keptAbs := []string{}
+
+	for _, dirname := range dirnames {
+		if !insideAny(abs[dirname], keptAbs) {
+			kept = append(kept, dirname)
+			keptAbs = append(keptAbs, abs[dirname])
+		}
+	}
+
+	return kept, nil
+}
+
+// insideAny checks if the given path is one of, or inside of one of, the given directories.
+func insideAny(dirname string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dirname == dir || strings.HasPrefix(dirname, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sourceExcludes returns the exclude patterns for archiving the given folder. Archives that include
+// files directly in a source directory also leave out foldup's own files, which are kept there.
+func sourceExcludes(source backupSource, folder sourceFolder) []string {
+	if !folder.filesOnly && source.mode != archive.ModeSelf {
+		return source.excludes
+	}
+
+	own := strings.NewReplacer("%s", "*", "%d", "[0-9]*").Replace(BackupFmt) + "*"
+
+	return append([]string{own, ".foldup-*"}, source.excludes...)
+}
+
+// resumeUploads finds any resumable uploads to the given bucket that were interrupted, and attempts
+// to finish them, removing the archives once they're uploaded. Sessions for archives that no longer
+// exist locally are discarded.
+func resumeUploads(ctx context.Context, bucket string, sessions storage.SessionStore, gateway storage.Gateway) error {
+	pending, err := sessions.All()
+	if err != nil {
+		return err
+	}
+
+	for _, session := range pending {
+		if session.Bucket != bucket || session.Source == "" {
+			continue
+		}
+
+		in, err := osOpen(session.Source)
+		if os.IsNotExist(err) {
+			err = sessions.Delete(session.Bucket, session.Object)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = gateway.Store(ctx, session.Object, in)
+		in.Close()
+
+		if err != nil {
+			return err
+		}
+
+		err = osRemove(session.Source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneArchives removes archives of the given folders from storage that have expired under the
+// given retention policy. Older archives of each folder are found by the name they'd be stored
+// under, using the template the folder's archive was named with. The gateway must be able to list
+// and delete objects.
+func pruneArchives(ctx context.Context, gateway storage.Gateway, policy storage.RetentionPolicy, template *naming.Template, folders []foldup.FolderReport) error {
+	lister, canList := gateway.(storage.Lister)
+	deleter, canDelete := gateway.(storage.Deleter)
+
+	if !canList || !canDelete {
+		return errors.New("storage can't list or delete archives")
+	}
+
+	for _, folder := range folders {
+		// Folders that weren't uploaded have no stored archive to find older archives with.
+		if !folder.Uploaded {
+			continue
+		}
+
+		vars, ok := template.Match(folder.Object)
+		if !ok {
+			continue
+		}
+
+		objects, err := lister.List(ctx, template.Prefix(vars))
+		if err != nil {
+			return err
+		}
+
+		// Archives of other folders may share the prefix, e.g. "photos" and "photos-old".
+		archives := []storage.ObjectInfo{}
+		for _, o := range objects {
+			if template.Of(o.Name, vars) {
+				archives = append(archives, o)
+			}
+		}
+
+		for _, o := range policy.Expired(archives, time.Now()) {
+			err = deleter.Delete(ctx, o.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// pruneCatalog removes archives of the folders backed up by the run described by the given report,
+// that have expired under the given retention policy, finding older archives of each folder in the
+// given catalog. Deleted archives are removed from the catalog. The gateway must be able to delete
+// objects.
+func pruneCatalog(ctx context.Context, gateway storage.Gateway, policy storage.RetentionPolicy, template *naming.Template, c *catalog.Catalog, report *foldup.Report) error {
+	deleter, canDelete := gateway.(storage.Deleter)
+	if !canDelete {
+		return errors.New("storage can't delete archives")
+	}
+
+	entries := c.Find(catalog.Filter{})
+
+	// Manifests are deleted along with their archives.
+	manifests := make(map[string]string)
+	for _, e := range entries {
+		manifests[e.Object] = e.Manifest
+	}
+
+	for _, folder := range report.Folders {
+		if !folder.Uploaded {
+			continue
+		}
+
+		manifests[folder.Object] = folder.Manifest
+
+		vars, ok := template.Match(folder.Object)
+		if !ok {
+			continue
+		}
+
+		// The run isn't in the catalog yet, but its archive counts towards those kept.
+		archives := []storage.ObjectInfo{{Name: folder.Object, Size: folder.BytesArchived, Created: report.Started}}
+
+		for _, e := range entries {
+			if e.Object != folder.Object && template.Of(e.Object, vars) {
+				archives = append(archives, storage.ObjectInfo{Name: e.Object, Size: e.Size, Created: e.Time})
+			}
+		}
+
+		for _, o := range policy.Expired(archives, time.Now()) {
+			// The catalog may be changed again if it was replaced while being pruned, so archives may
+			// already have been deleted by an earlier attempt.
+			err := deleter.Delete(ctx, o.Name)
+			if err != nil && err != storage.ErrNotFound {
+				return err
+			}
+
+			if manifests[o.Name] != "" {
+				err = deleter.Delete(ctx, manifests[o.Name])
+				if err != nil && err != storage.ErrNotFound {
+					return err
+				}
+			}
+
+			c.Remove(o.Name)
+		}
+	}
+
+	return nil
+}
+
+// catalogRun describes the run of a backup of the given source, on the given host, described by the
+// given report, as it's recorded in a catalog.
+func catalogRun(source backupSource, host string, report *foldup.Report) catalog.Run {
+	format := source.format
+	if format == "" {
+		format = archive.TarGz
+	}
+
+	run := catalog.Run{
+		ID:         report.RunID,
+		Job:        report.Job,
+		Host:       host,
+		Started:    report.Started,
+		Finished:   report.Finished,
+		Status:     catalog.StatusSuccess,
+		Format:     string(format),
+		Encryption: catalog.EncryptionNone,
+		Snapshots:  []catalog.Snapshot{},
+	}
+
+	if !report.OK() {
+		run.Status = catalog.StatusFailure
+		run.Error = report.Err.Error()
+	}
+
+	for _, folder := range report.Folders {
+		snapshot := catalog.Snapshot{
+			Folder:   folder.Name,
+			Path:     folder.Path,
+			Object:   folder.Object,
+			Size:     folder.BytesArchived,
+			Files:    folder.Files,
+			SHA256:   folder.SHA256,
+			Manifest: folder.Manifest,
+			Status:   catalog.StatusSuccess,
+		}
+
+		if !folder.Uploaded {
+			snapshot.Status = catalog.StatusFailure
+
+			if folder.Err != nil {
+				snapshot.Error = folder.Err.Error()
+			}
+		}
+
+		run.Snapshots = append(run.Snapshots, snapshot)
+	}
+
+	return run
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the file with the given name.
+func hashFile(filename string) (string, error) {
+	in, err := osOpen(filename)
+	if err != nil {
+		return "", err
+	}
+
+	defer in.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, in)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// countingReader wraps a file being uploaded, counting how many bytes are read from it. It only
+// exposes the methods of *os.File that storage gateways make use of.
+type countingReader struct {
+	file *os.File
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.read += int64(n)
+
+	return n, err
+}
+
+func (r *countingReader) Seek(offset int64, whence int) (int64, error) {
+	return r.file.Seek(offset, whence)
+}
+
+func (r *countingReader) Name() string {
+	return r.file.Name()
+}
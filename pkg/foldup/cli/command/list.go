@@ -0,0 +1,99 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// ListCommand creates a command to list the archives recorded in the catalog of a bucket.
+func ListCommand(factory foldup.Factory) *console.Command {
+	var bucket string
+	var filter catalog.Filter
+	var definition *console.Definition
+
+	configure := func(def *console.Definition) {
+		definition = def
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&bucket),
+			Spec:  "-b, --bucket=BUCKET",
+			Desc:  "The bucket to list the archives in",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&filter.Job),
+			Spec:  "--job=NAME",
+			Desc:  "Only list archives made by the job with this name",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&filter.Host),
+			Spec:  "--host=HOST",
+			Desc:  "Only list archives made on this host",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&filter.Folder),
+			Spec:  "--folder=NAME",
+			Desc:  "Only list archives of the folder with this name",
+		})
+	}
+
+	execute := func(input *console.Input, output *console.Output) error {
+		err := mapEnv(definition, input, osEnviron())
+		if err != nil {
+			return err
+		}
+
+		if bucket == "" {
+			return errors.New("a bucket must be given with --bucket")
+		}
+
+		gateway, err := factory.CreateGCSGateway(bucket)
+		if err != nil {
+			return err
+		}
+
+		c, err := catalog.NewObjectStore(gateway, "").Load(context.Background())
+		if err != nil {
+			return err
+		}
+
+		entries := c.Find(filter)
+		if len(entries) == 0 {
+			output.Printf("No archives found in the catalog of gs://%s/.\n", bucket)
+			return nil
+		}
+
+		buf := &bytes.Buffer{}
+
+		w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tJOB\tHOST\tFOLDER\tBYTES\tOBJECT")
+
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", e.Time.UTC().Format(time.RFC3339), e.Job, e.Host, e.Folder, e.Size, e.Object)
+		}
+
+		w.Flush()
+
+		output.Print(buf.String())
+
+		return nil
+	}
+
+	return &console.Command{
+		Name:        "list",
+		Description: "List the archives recorded in the catalog of a bucket, newest first.",
+		Configure:   configure,
+		Execute:     execute,
+	}
+}
@@ -0,0 +1,112 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/eidolon/console"
+)
+
+func TestListCommand(t *testing.T) {
+	t.Run("should list the archives in the catalog, newest first", func(t *testing.T) {
+		gateway := &backupTestStorageGateway{}
+		started := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+		saved := &catalog.Catalog{Runs: []catalog.Run{
+			{ID: "1", Job: "nightly", Host: "nas", Started: started.Add(-24 * time.Hour), Snapshots: []catalog.Snapshot{
+				{Folder: "photos", Object: "photos-1", Size: 10, Status: catalog.StatusSuccess},
+			}},
+			{ID: "2", Job: "nightly", Host: "nas", Started: started, Snapshots: []catalog.Snapshot{
+				{Folder: "photos", Object: "photos-2", Size: 20, Status: catalog.StatusSuccess},
+				{Folder: "music", Object: "music-2", Status: catalog.StatusFailure},
+			}},
+		}}
+
+		assert.OK(t, catalog.NewObjectStore(gateway, "").Save(context.Background(), saved))
+
+		def := console.NewDefinition()
+
+		listCmd := ListCommand(&backupTestFactory{createGCSGatewayGateway: gateway})
+		listCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "folder", "photos")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		assert.OK(t, listCmd.Execute(input, output))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+		assert.Equal(t, 3, len(lines))
+		assert.True(t, strings.HasPrefix(lines[0], "TIME"), "Expected a header")
+		assert.True(t, strings.HasPrefix(lines[1], "2017-07-14T02:40:00Z"), "Unexpected line: "+lines[1])
+		assert.True(t, strings.HasSuffix(lines[1], "photos-2"), "Unexpected line: "+lines[1])
+		assert.True(t, strings.HasSuffix(lines[2], "photos-1"), "Unexpected line: "+lines[2])
+	})
+
+	t.Run("should say if there are no archives", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		listCmd := ListCommand(&backupTestFactory{})
+		listCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		assert.OK(t, listCmd.Execute(input, output))
+		assert.True(t, strings.Contains(buf.String(), "No archives found"), "Unexpected output: "+buf.String())
+	})
+
+	t.Run("should read options from the environment", func(t *testing.T) {
+		defer revertStubs()
+
+		osEnviron = func() []string {
+			return []string{"FOLDUP_BUCKET=test-bucket"}
+		}
+
+		def := console.NewDefinition()
+
+		listCmd := ListCommand(&backupTestFactory{})
+		listCmd.Configure(def)
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		assert.OK(t, listCmd.Execute(input, output))
+		assert.True(t, strings.Contains(buf.String(), "No archives found"), "Unexpected output: "+buf.String())
+	})
+
+	t.Run("should error if no bucket is given", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		listCmd := ListCommand(&backupTestFactory{})
+		listCmd.Configure(def)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, listCmd.Execute(input, output))
+	})
+
+	t.Run("should error if storage can't be reached", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		listCmd := ListCommand(&backupTestFactory{createGCSGatewayError: errors.New("oops")})
+		listCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, listCmd.Execute(input, output))
+	})
+}
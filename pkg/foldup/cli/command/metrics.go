@@ -0,0 +1,116 @@
+package command
+
+import (
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/metrics"
+)
+
+// backupMetrics holds the metrics recorded about backup runs. A nil *backupMetrics is valid, and
+// simply records nothing, so callers don't need to check whether metrics are enabled.
+type backupMetrics struct {
+	lastSuccess      *metrics.Metric
+	runDuration      *metrics.Metric
+	runs             *metrics.Metric
+	bytesRead        *metrics.Metric
+	bytesArchived    *metrics.Metric
+	bytesUploaded    *metrics.Metric
+	compressionRatio *metrics.Metric
+	failures         *metrics.Metric
+	nextRun          *metrics.Metric
+}
+
+// newBackupMetrics registers the backup metrics with the given registry.
+func newBackupMetrics(registry *metrics.Registry) *backupMetrics {
+	return &backupMetrics{
+		lastSuccess: registry.NewGauge(
+			"foldup_last_success_timestamp_seconds",
+			"Unix time of the last successful backup of each folder.",
+			"folder",
+		),
+		runDuration: registry.NewGauge(
+			"foldup_last_run_duration_seconds",
+			"How long the last backup run took.",
+		),
+		runs: registry.NewCounter(
+			"foldup_runs_total",
+			"Number of backup runs, by status.",
+			"status",
+		),
+		bytesRead: registry.NewCounter(
+			"foldup_read_bytes_total",
+			"Bytes read from the files in each folder.",
+			"folder",
+		),
+		bytesArchived: registry.NewCounter(
+			"foldup_archived_bytes_total",
+			"Bytes written to the archives of each folder.",
+			"folder",
+		),
+		bytesUploaded: registry.NewCounter(
+			"foldup_uploaded_bytes_total",
+			"Bytes uploaded to storage for each folder, including retries.",
+			"folder",
+		),
+		compressionRatio: registry.NewGauge(
+			"foldup_compression_ratio",
+			"Size of the last archive of each folder, relative to the size of its files.",
+			"folder",
+		),
+		failures: registry.NewCounter(
+			"foldup_failures_total",
+			"Number of failed backup runs, by the stage they failed at.",
+			"stage",
+		),
+		nextRun: registry.NewGauge(
+			"foldup_next_run_timestamp_seconds",
+			"Unix time of the next scheduled backup run.",
+		),
+	}
+}
+
+// record updates the metrics using the outcome of a backup run.
+func (m *backupMetrics) record(report *foldup.Report) {
+	if m == nil {
+		return
+	}
+
+	status := "success"
+	if !report.OK() {
+		status = "failure"
+		m.failures.Inc(string(report.Stage))
+	}
+
+	m.runs.Inc(status)
+	m.runDuration.Set(report.Duration().Seconds())
+
+	for _, f := range report.Folders {
+		m.bytesRead.Add(float64(f.BytesRead), f.Name)
+		m.bytesArchived.Add(float64(f.BytesArchived), f.Name)
+		m.bytesUploaded.Add(float64(f.BytesUploaded), f.Name)
+		m.compressionRatio.Set(f.CompressionRatio(), f.Name)
+
+		if f.Uploaded {
+			m.lastSuccess.Set(float64(report.Finished.Unix()), f.Name)
+		}
+	}
+}
+
+// recordSkipped records a run that was skipped, because another instance was doing the same backup.
+func (m *backupMetrics) recordSkipped() {
+	if m == nil {
+		return
+	}
+
+	m.runs.Inc("skipped")
+}
+
+// recordNextRun updates the time of the next scheduled run.
+func (m *backupMetrics) recordNextRun(next time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.nextRun.Set(float64(next.Unix()))
+}
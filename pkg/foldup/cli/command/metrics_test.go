@@ -0,0 +1,73 @@
+package command
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/metrics"
+)
+
+func TestBackupMetrics_Record(t *testing.T) {
+	t.Run("should record successful runs", func(t *testing.T) {
+		m := newBackupMetrics(metrics.NewRegistry())
+
+		report := foldup.NewReport("testdata")
+		report.Folders = []foldup.FolderReport{
+			{Name: "test1", BytesRead: 100, BytesArchived: 40, BytesUploaded: 40, Uploaded: true},
+		}
+		report.Finish()
+
+		m.record(report)
+
+		assert.Equal(t, float64(1), m.runs.Value("success"))
+		assert.Equal(t, float64(100), m.bytesRead.Value("test1"))
+		assert.Equal(t, float64(40), m.bytesArchived.Value("test1"))
+		assert.Equal(t, float64(40), m.bytesUploaded.Value("test1"))
+		assert.Equal(t, 0.4, m.compressionRatio.Value("test1"))
+		assert.Equal(t, float64(report.Finished.Unix()), m.lastSuccess.Value("test1"))
+	})
+
+	t.Run("should record failures by stage", func(t *testing.T) {
+		m := newBackupMetrics(metrics.NewRegistry())
+
+		report := foldup.NewReport("testdata")
+		report.Folders = []foldup.FolderReport{{Name: "test1"}}
+		report.Fail(foldup.StageUpload, errors.New("oops"))
+		report.Finish()
+
+		m.record(report)
+
+		assert.Equal(t, float64(1), m.runs.Value("failure"))
+		assert.Equal(t, float64(1), m.failures.Value("upload"))
+		assert.Equal(t, float64(0), m.lastSuccess.Value("test1"))
+	})
+
+	t.Run("should record skipped runs", func(t *testing.T) {
+		m := newBackupMetrics(metrics.NewRegistry())
+
+		m.recordSkipped()
+
+		assert.Equal(t, float64(1), m.runs.Value("skipped"))
+		assert.Equal(t, float64(0), m.runs.Value("success"))
+	})
+
+	t.Run("should record the next run time", func(t *testing.T) {
+		m := newBackupMetrics(metrics.NewRegistry())
+		next := time.Now().Add(time.Hour)
+
+		m.recordNextRun(next)
+
+		assert.Equal(t, float64(next.Unix()), m.nextRun.Value())
+	})
+
+	t.Run("should do nothing if metrics are disabled", func(t *testing.T) {
+		var m *backupMetrics
+
+		m.record(foldup.NewReport("testdata"))
+		m.recordNextRun(time.Now())
+		m.recordSkipped()
+	})
+}
@@ -0,0 +1,231 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/notify"
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// shutdownSignals are the signals that stop scheduled backups, once any running backups finish.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// notifyConfig holds the options used to configure notifications about backup runs.
+type notifyConfig struct {
+	WebhookURL      string
+	WebhookHeaders  string
+	WebhookHeader   http.Header
+	WebhookTemplate string
+	SlackURL        string
+	PingURL         string
+	SMTP            notify.SMTPConfig
+	EmailFrom       string
+	EmailTo         string
+	EmailDigest     bool
+}
+
+// configure adds the options for configuring notifications to the given definition.
+func (c *notifyConfig) configure(def *console.Definition) {
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.WebhookURL),
+		Spec:  "--webhook-url=URL",
+		Desc:  "A URL to POST a JSON report to after each backup run",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.WebhookHeaders),
+		Spec:  "--webhook-headers=HEADERS",
+		Desc:  "Comma separated headers to send to the webhook, e.g. 'Authorization: Bearer xyz'",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.WebhookTemplate),
+		Spec:  "--webhook-template=FILE",
+		Desc:  "A Go template file used to render the webhook body, instead of the default JSON",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.SlackURL),
+		Spec:  "--slack-url=URL",
+		Desc:  "A Slack-compatible incoming webhook URL to post a message to after each backup run",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.PingURL),
+		Spec:  "--ping-url=URL",
+		Desc:  "A healthchecks.io-style URL to ping when runs start (/start), succeed, and fail (/fail)",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.SMTP.Addr),
+		Spec:  "--smtp-addr=ADDR",
+		Desc:  "An SMTP server to send email reports through, e.g. 'smtp.example.com:587'",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewBoolValue(&c.SMTP.StartTLS),
+		Spec:  "--smtp-starttls",
+		Desc:  "Require the SMTP connection to be upgraded using STARTTLS",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.SMTP.Username),
+		Spec:  "--smtp-username=USERNAME",
+		Desc:  "A username to authenticate with the SMTP server",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.SMTP.Password),
+		Spec:  "--smtp-password=PASSWORD",
+		Desc:  "A password to authenticate with the SMTP server",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.EmailFrom),
+		Spec:  "--email-from=ADDRESS",
+		Desc:  "The address email reports are sent from",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&c.EmailTo),
+		Spec:  "--email-to=ADDRESSES",
+		Desc:  "Comma separated addresses to send email reports to",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewBoolValue(&c.EmailDigest),
+		Spec:  "--email-digest",
+		Desc:  "Send a single daily digest email, instead of an email after each scheduled backup run",
+	})
+}
+
+// notifier creates a notify.Notifier that sends notifications to each of the configured services.
+// If none are configured, nil is returned.
+func (c *notifyConfig) notifier() (notify.Notifier, error) {
+	var notifiers notify.Notifiers
+
+	if c.WebhookURL != "" {
+		header, err := parseHeaders(c.WebhookHeaders)
+		if err != nil {
+			return nil, err
+		}
+
+		// Headers from a configuration file are already parsed, so values may contain commas.
+		for name, values := range c.WebhookHeader {
+			for _, value := range values {
+				header.Add(name, value)
+			}
+		}
+
+		var body string
+		if c.WebhookTemplate != "" {
+			bs, err := ioutil.ReadFile(c.WebhookTemplate)
+			if err != nil {
+				return nil, err
+			}
+
+			body = string(bs)
+		}
+
+		notifier, err := notify.NewWebhookNotifier(http.DefaultClient, c.WebhookURL, header, body)
+		if err != nil {
+			return nil, err
+		}
+
+		notifiers = append(notifiers, notifier)
+	}
+
+	if c.SlackURL != "" {
+		notifiers = append(notifiers, notify.NewSlackNotifier(http.DefaultClient, c.SlackURL))
+	}
+
+	if c.PingURL != "" {
+		notifiers = append(notifiers, notify.NewPingNotifier(http.DefaultClient, c.PingURL))
+	}
+
+	if c.SMTP.Addr != "" {
+		notifier, err := notify.NewEmailNotifier(c.SMTP, c.EmailFrom, splitList(c.EmailTo), c.EmailDigest)
+		if err != nil {
+			return nil, err
+		}
+
+		notifiers = append(notifiers, notifier)
+	}
+
+	if len(notifiers) == 0 {
+		return nil, nil
+	}
+
+	return notifiers, nil
+}
+
+// flushDigests flushes the notifications held on to by the given jobs every interval, until done is
+// closed, so that digests are sent on time whether or not any more runs finish.
+func flushDigests(done <-chan int, interval time.Duration, jobs ...*backupJob) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, job := range jobs {
+				job.flushNotifications()
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// stopOnShutdown calls stop when one of the shutdown signals is received, so that schedules stop
+// once any running backups finish, and held notifications can be sent before foldup exits. Only the
+// first signal is caught, so another stops foldup straight away.
+func stopOnShutdown(logger logging.Logger, stop func()) {
+	received := make(chan os.Signal, 1)
+	signalNotify(received, shutdownSignals...)
+
+	go func() {
+		sig := <-received
+		signalStop(received)
+
+		logger.Info("Stopping once running backups finish", logging.F("signal", sig.String()))
+		stop()
+	}()
+}
+
+// parseHeaders parses a comma separated list of HTTP headers, in the form 'Name: value'.
+func parseHeaders(headers string) (http.Header, error) {
+	header := http.Header{}
+
+	for _, h := range splitList(headers) {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid header '%s', expected 'Name: value'", h)
+		}
+
+		header.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return header, nil
+}
+
+// splitList splits a comma separated list, ignoring any empty items.
+func splitList(list string) []string {
+	items := []string{}
+
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
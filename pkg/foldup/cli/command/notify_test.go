@@ -0,0 +1,48 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/logging"
+)
+
+func TestFlushDigests(t *testing.T) {
+	t.Run("should flush each job's notifications every interval until done", func(t *testing.T) {
+		first := &backupTestNotifier{}
+		second := &backupTestNotifier{}
+
+		jobs := []*backupJob{
+			{notifier: first, logger: logging.NewNopLogger()},
+			{notifier: second, logger: logging.NewNopLogger()},
+		}
+
+		done := make(chan int)
+		stopped := make(chan struct{})
+
+		go func() {
+			flushDigests(done, time.Millisecond, jobs...)
+			close(stopped)
+		}()
+
+		for first.flushes() < 2 || second.flushes() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		close(done)
+		<-stopped
+
+		flushed := first.flushes()
+		time.Sleep(5 * time.Millisecond)
+
+		assert.Equal(t, flushed, first.flushes())
+	})
+
+	t.Run("should not flush jobs whose notifiers don't hold on to notifications", func(t *testing.T) {
+		job := &backupJob{logger: logging.NewNopLogger()}
+
+		// A job without a notifier mustn't panic.
+		job.flushNotifications()
+	})
+}
@@ -0,0 +1,367 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/storage"
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// restoreSource holds the options used to choose an archive in a bucket, and the files in it to
+// read, for the restore and cat commands.
+type restoreSource struct {
+	bucket  string
+	filter  catalog.Filter
+	at      string
+	object  string
+	pattern string
+}
+
+// configure adds the options used to choose an archive, and files in it, to the given definition.
+func (s *restoreSource) configure(def *console.Definition) {
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&s.bucket),
+		Spec:  "-b, --bucket=BUCKET",
+		Desc:  "The bucket the archive is stored in",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&s.pattern),
+		Spec:  "-p, --path=PATTERN",
+		Desc:  "The path of the files to read, e.g. etc/app.yml; may be a glob pattern like etc/*.yml",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&s.filter.Folder),
+		Spec:  "--folder=NAME",
+		Desc:  "Read an archive of the folder with this name, from the catalog",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&s.filter.Job),
+		Spec:  "--job=NAME",
+		Desc:  "Only read archives made by the job with this name",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&s.filter.Host),
+		Spec:  "--host=HOST",
+		Desc:  "Only read archives made on this host",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&s.at),
+		Spec:  "--at=TIME",
+		Desc:  "Read the newest archive made at or before this time, like 2017-07-14T02:40:00Z, or by the end of a day, like 2017-07-14 (default: now)",
+	})
+
+	def.AddOption(console.OptionDefinition{
+		Value: parameters.NewStringValue(&s.object),
+		Spec:  "--object=OBJECT",
+		Desc:  "Read the archive stored as this object, rather than finding one in the catalog",
+	})
+}
+
+// read streams the chosen archive from storage, calling fn for each file in it that matches the
+// pattern, along with the part of the file's path that matched. The name of the archive's object,
+// and how many files matched, are returned.
+func (s *restoreSource) read(factory foldup.Factory, fn func(rel string, entry archive.Entry, contents io.Reader) error) (string, int, error) {
+	if s.bucket == "" {
+		return "", 0, errors.New("a bucket must be given with --bucket")
+	}
+
+	if s.pattern == "" {
+		return "", 0, errors.New("the files to read must be given with --path")
+	}
+
+	err := archive.ValidatePattern(s.pattern)
+	if err != nil {
+		return "", 0, err
+	}
+
+	gateway, err := factory.CreateGCSGateway(s.bucket)
+	if err != nil {
+		return "", 0, err
+	}
+
+	fetcher, ok := gateway.(storage.Fetcher)
+	if !ok {
+		return "", 0, errors.New("storage can't fetch archives")
+	}
+
+	ctx := context.Background()
+
+	object, format, err := s.find(ctx, gateway)
+	if err != nil {
+		return "", 0, err
+	}
+
+	in, err := fetcher.Fetch(ctx, object)
+	if err == storage.ErrNotFound {
+		return object, 0, fmt.Errorf("the archive '%s' isn't stored in gs://%s/", object, s.bucket)
+	}
+
+	if err != nil {
+		return object, 0, err
+	}
+
+	defer in.Close()
+
+	matched := 0
+
+	err = archive.Read(in, format, func(entry archive.Entry, contents io.Reader) error {
+		rel, ok := archive.MatchPath(s.pattern, entry.Name)
+		if !ok {
+			return nil
+		}
+
+		matched++
+
+		return fn(rel, entry, contents)
+	})
+
+	if err != nil {
+		return object, matched, err
+	}
+
+	if matched == 0 {
+		return object, 0, fmt.Errorf("no files in '%s' match '%s'", object, s.pattern)
+	}
+
+	return object, matched, nil
+}
+
+// find returns the name and format of the archive to read. Unless an object is given, it's the
+// newest archive in the catalog that matches the filter, and was made by the given time.
+func (s *restoreSource) find(ctx context.Context, gateway storage.Gateway) (string, archive.FormatName, error) {
+	if s.object != "" {
+		format, ok := archive.FilenameFormat(s.object)
+		if !ok {
+			return "", "", fmt.Errorf("can't tell the format of '%s' from its name", s.object)
+		}
+
+		return s.object, format, nil
+	}
+
+	at, err := parseRestoreTime(s.at)
+	if err != nil {
+		return "", "", err
+	}
+
+	c, err := catalog.NewObjectStore(gateway, "").Load(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	var found *catalog.Entry
+
+	entries := c.Find(s.filter)
+
+	for i, e := range entries {
+		if !at.IsZero() && e.Time.After(at) {
+			continue
+		}
+
+		if found == nil {
+			found = &entries[i]
+			continue
+		}
+
+		if e.Folder != found.Folder {
+			return "", "", fmt.Errorf("archives of more than one folder match, e.g. '%s' and '%s'; choose one with --folder", found.Folder, e.Folder)
+		}
+	}
+
+	if found == nil {
+		return "", "", fmt.Errorf("no archives in the catalog of gs://%s/ match", s.bucket)
+	}
+
+	format := archive.FormatName(found.Format)
+	if format == "" {
+		var ok bool
+
+		format, ok = archive.FilenameFormat(found.Object)
+		if !ok {
+			return "", "", fmt.Errorf("can't tell the format of '%s' from its name", found.Object)
+		}
+	}
+
+	return found.Object, format, nil
+}
+
+// parseRestoreTime parses the time to restore files as they were at. A date alone means the end of
+// that day, in UTC. An empty string gives the zero time, so that archives made at any time match.
+func parseRestoreTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	day, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time '%s', expected one like 2017-07-14T02:40:00Z, or 2017-07-14", s)
+	}
+
+	return day.Add(24*time.Hour - time.Nanosecond), nil
+}
+
+// RestoreCommand creates a command to restore individual files from an archive. The archive is
+// streamed from storage, and only the files that match are written, so nothing else from the folder
+// is downloaded to disk.
+func RestoreCommand(factory foldup.Factory) *console.Command {
+	var source restoreSource
+	var target string
+	var overwrite bool
+	var definition *console.Definition
+
+	configure := func(def *console.Definition) {
+		definition = def
+
+		source.configure(def)
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&target),
+			Spec:  "-t, --target=DIR",
+			Desc:  "The directory to restore files into, keeping the part of their path that matched (default: the working directory)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewBoolValue(&overwrite),
+			Spec:  "--overwrite",
+			Desc:  "Replace files that already exist in the target directory",
+		})
+	}
+
+	execute := func(input *console.Input, output *console.Output) error {
+		err := mapEnv(definition, input, osEnviron())
+		if err != nil {
+			return err
+		}
+
+		if target == "" {
+			target = "."
+		}
+
+		// Files in different directories may match the same part of a pattern, e.g. `*.yml` matches
+		// both etc/app.yml and config/app.yml, so they'd be restored as the same file.
+		restoredFrom := make(map[string]string)
+
+		object, restored, err := source.read(factory, func(rel string, entry archive.Entry, contents io.Reader) error {
+			filename := filepath.Join(target, filepath.FromSlash(rel))
+
+			if name, ok := restoredFrom[filename]; ok {
+				return fmt.Errorf("'%s' and '%s' would both be restored as '%s'; use a --path that matches more of their paths", name, entry.Name, filename)
+			}
+
+			err := restoreFile(filename, entry, contents, overwrite)
+			if err != nil {
+				return err
+			}
+
+			restoredFrom[filename] = entry.Name
+
+			output.Printf("Restored %s\n", filename)
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		output.Printf("Restored %d file(s) from gs://%s/%s.\n", restored, source.bucket, object)
+
+		return nil
+	}
+
+	return &console.Command{
+		Name:        "restore",
+		Description: "Restore files matching a path from an archive, without downloading the whole archive.",
+		Configure:   configure,
+		Execute:     execute,
+	}
+}
+
+// CatCommand creates a command to write the contents of files in an archive to standard output,
+// e.g. to pipe them into another command. The archive is streamed from storage, like it is by the
+// restore command.
+func CatCommand(factory foldup.Factory) *console.Command {
+	var source restoreSource
+	var definition *console.Definition
+
+	configure := func(def *console.Definition) {
+		definition = def
+
+		source.configure(def)
+	}
+
+	execute := func(input *console.Input, output *console.Output) error {
+		err := mapEnv(definition, input, osEnviron())
+		if err != nil {
+			return err
+		}
+
+		_, _, err = source.read(factory, func(rel string, entry archive.Entry, contents io.Reader) error {
+			_, err := io.Copy(output.Writer, contents)
+			return err
+		})
+
+		return err
+	}
+
+	return &console.Command{
+		Name:        "cat",
+		Description: "Write the contents of files matching a path in an archive to standard output.",
+		Configure:   configure,
+		Execute:     execute,
+	}
+}
+
+// restoreFile writes a file read from an archive to the given filename, creating the directories
+// it's in. Unless overwrite is true, existing files are left alone, and an error is returned.
+func restoreFile(filename string, entry archive.Entry, contents io.Reader, overwrite bool) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+
+	file, err := os.OpenFile(filename, flags, entry.Mode.Perm())
+	if os.IsExist(err) {
+		return fmt.Errorf("'%s' already exists; use --overwrite to replace it", filename)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, contents)
+	cerr := file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if cerr != nil {
+		return cerr
+	}
+
+	return os.Chtimes(filename, entry.ModTime, entry.ModTime)
+}
@@ -0,0 +1,366 @@
+package command
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/eidolon/console"
+)
+
+// createTestArchive creates a gzipped tarball holding files with the given names and contents.
+func createTestArchive(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+
+	for name, contents := range files {
+		assert.OK(t, tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0640,
+			Size:    int64(len(contents)),
+			ModTime: time.Date(2017, 7, 11, 9, 30, 0, 0, time.UTC),
+		}))
+
+		_, err := tw.Write([]byte(contents))
+		assert.OK(t, err)
+	}
+
+	assert.OK(t, tw.Close())
+	assert.OK(t, gw.Close())
+
+	return buf.Bytes()
+}
+
+// createRestoreTestGateway creates a gateway holding two archives of an app folder, made a day
+// apart, and a catalog that records them, and one archive of a photos folder.
+func createRestoreTestGateway(t *testing.T) *backupTestStorageGateway {
+	started := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+
+	gateway := &backupTestStorageGateway{contents: map[string][]byte{
+		"backup-app-1.tar.gz": createTestArchive(t, map[string]string{
+			"/srv/app/etc/app.yml": "old: true",
+		}),
+		"backup-app-2.tar.gz": createTestArchive(t, map[string]string{
+			"/srv/app/etc/app.yml": "new: true",
+			"/srv/app/etc/db.yml":  "db: true",
+			"/srv/app/data/db.bin": "0101",
+		}),
+		"backup-photos-2.tar.gz": createTestArchive(t, map[string]string{
+			"/srv/photos/cat.jpg": "meow",
+		}),
+	}}
+
+	saved := &catalog.Catalog{Runs: []catalog.Run{
+		{ID: "1", Started: started.Add(-24 * time.Hour), Format: "TarGz", Snapshots: []catalog.Snapshot{
+			{Folder: "app", Object: "backup-app-1.tar.gz", Status: catalog.StatusSuccess},
+		}},
+		{ID: "2", Started: started, Format: "TarGz", Snapshots: []catalog.Snapshot{
+			{Folder: "app", Object: "backup-app-2.tar.gz", Status: catalog.StatusSuccess},
+			{Folder: "photos", Object: "backup-photos-2.tar.gz", Status: catalog.StatusSuccess},
+		}},
+	}}
+
+	assert.OK(t, catalog.NewObjectStore(gateway, "").Save(context.Background(), saved))
+
+	return gateway
+}
+
+func TestRestoreCommand(t *testing.T) {
+	// run configures and executes the restore command, with the given options.
+	run := func(t *testing.T, gateway *backupTestStorageGateway, opts map[string]string) (string, error) {
+		def := console.NewDefinition()
+
+		restoreCmd := RestoreCommand(&backupTestFactory{createGCSGatewayGateway: gateway})
+		restoreCmd.Configure(def)
+
+		for name, value := range opts {
+			setOptValue(def.Options(), name, value)
+		}
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		err := restoreCmd.Execute(input, output)
+
+		return buf.String(), err
+	}
+
+	t.Run("should restore matching files from the newest archive of a folder", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-restore")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		out, err := run(t, createRestoreTestGateway(t), map[string]string{
+			"bucket": "test-bucket",
+			"folder": "app",
+			"path":   "etc/app.yml",
+			"target": dir,
+		})
+
+		assert.OK(t, err)
+		assert.True(t, strings.Contains(out, "Restored 1 file(s) from gs://test-bucket/backup-app-2.tar.gz"), "Unexpected output: "+out)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "etc", "app.yml"))
+		assert.OK(t, err)
+		assert.Equal(t, "new: true", string(data))
+
+		info, err := os.Stat(filepath.Join(dir, "etc", "app.yml"))
+		assert.OK(t, err)
+		assert.Equal(t, time.Date(2017, 7, 11, 9, 30, 0, 0, time.UTC), info.ModTime().UTC())
+
+		_, err = os.Stat(filepath.Join(dir, "etc", "db.yml"))
+		assert.True(t, os.IsNotExist(err), "Expected only matching files to be restored")
+	})
+
+	t.Run("should restore files matching a glob pattern", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-restore")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		_, err = run(t, createRestoreTestGateway(t), map[string]string{
+			"bucket": "test-bucket",
+			"folder": "app",
+			"path":   "etc/*.yml",
+			"target": dir,
+		})
+
+		assert.OK(t, err)
+
+		files, err := ioutil.ReadDir(filepath.Join(dir, "etc"))
+		assert.OK(t, err)
+		assert.Equal(t, 2, len(files))
+	})
+
+	t.Run("should restore files from the newest archive made by the given time", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-restore")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		_, err = run(t, createRestoreTestGateway(t), map[string]string{
+			"bucket": "test-bucket",
+			"folder": "app",
+			"path":   "etc/app.yml",
+			"target": dir,
+			"at":     "2017-07-13",
+		})
+
+		assert.OK(t, err)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "etc", "app.yml"))
+		assert.OK(t, err)
+		assert.Equal(t, "old: true", string(data))
+	})
+
+	t.Run("should restore files from the given object", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-restore")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		gateway := createRestoreTestGateway(t)
+		delete(gateway.contents, catalog.DefaultObject)
+
+		_, err = run(t, gateway, map[string]string{
+			"bucket": "test-bucket",
+			"object": "backup-photos-2.tar.gz",
+			"path":   "*.jpg",
+			"target": dir,
+		})
+
+		assert.OK(t, err)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "cat.jpg"))
+		assert.OK(t, err)
+		assert.Equal(t, "meow", string(data))
+	})
+
+	t.Run("should error if more than one file would be restored as the same file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-restore")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		gateway := &backupTestStorageGateway{contents: map[string][]byte{
+			"backup-app-3.tar.gz": createTestArchive(t, map[string]string{
+				"/srv/app/etc/app.yml":    "etc: true",
+				"/srv/app/config/app.yml": "config: true",
+			}),
+		}}
+
+		_, err = run(t, gateway, map[string]string{
+			"bucket":    "test-bucket",
+			"object":    "backup-app-3.tar.gz",
+			"path":      "*.yml",
+			"target":    dir,
+			"overwrite": "true",
+		})
+
+		assert.NotOK(t, err)
+		assert.True(t, strings.Contains(err.Error(), "would both be restored as"), "Unexpected error: "+err.Error())
+	})
+
+	t.Run("should not replace existing files, unless asked to", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-restore")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		assert.OK(t, os.MkdirAll(filepath.Join(dir, "etc"), 0755))
+		assert.OK(t, ioutil.WriteFile(filepath.Join(dir, "etc", "app.yml"), []byte("mine"), 0644))
+
+		opts := map[string]string{
+			"bucket": "test-bucket",
+			"folder": "app",
+			"path":   "etc/app.yml",
+			"target": dir,
+		}
+
+		_, err = run(t, createRestoreTestGateway(t), opts)
+		assert.NotOK(t, err)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "etc", "app.yml"))
+		assert.OK(t, err)
+		assert.Equal(t, "mine", string(data))
+
+		opts["overwrite"] = "true"
+
+		_, err = run(t, createRestoreTestGateway(t), opts)
+		assert.OK(t, err)
+
+		data, err = ioutil.ReadFile(filepath.Join(dir, "etc", "app.yml"))
+		assert.OK(t, err)
+		assert.Equal(t, "new: true", string(data))
+	})
+
+	t.Run("should read options from the environment", func(t *testing.T) {
+		defer revertStubs()
+
+		dir, err := ioutil.TempDir("", "foldup-restore")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		osEnviron = func() []string {
+			return []string{"FOLDUP_BUCKET=test-bucket", "FOLDUP_FOLDER=app", "FOLDUP_TARGET=" + dir}
+		}
+
+		_, err = run(t, createRestoreTestGateway(t), map[string]string{"path": "etc/app.yml"})
+		assert.OK(t, err)
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "etc", "app.yml"))
+		assert.OK(t, err)
+		assert.Equal(t, "new: true", string(data))
+	})
+
+	t.Run("should error if no files match", func(t *testing.T) {
+		_, err := run(t, createRestoreTestGateway(t), map[string]string{
+			"bucket": "test-bucket",
+			"folder": "app",
+			"path":   "etc/nope.yml",
+		})
+
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if archives of more than one folder match", func(t *testing.T) {
+		_, err := run(t, createRestoreTestGateway(t), map[string]string{
+			"bucket": "test-bucket",
+			"path":   "etc/app.yml",
+		})
+
+		assert.NotOK(t, err)
+		assert.True(t, strings.Contains(err.Error(), "--folder"), "Unexpected error: "+err.Error())
+	})
+
+	t.Run("should error if no archives were made by the given time", func(t *testing.T) {
+		_, err := run(t, createRestoreTestGateway(t), map[string]string{
+			"bucket": "test-bucket",
+			"folder": "app",
+			"path":   "etc/app.yml",
+			"at":     "2017-07-01T00:00:00Z",
+		})
+
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if the time is invalid", func(t *testing.T) {
+		_, err := run(t, createRestoreTestGateway(t), map[string]string{
+			"bucket": "test-bucket",
+			"folder": "app",
+			"path":   "etc/app.yml",
+			"at":     "last tuesday",
+		})
+
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if no bucket or path is given", func(t *testing.T) {
+		_, err := run(t, createRestoreTestGateway(t), map[string]string{"path": "etc/app.yml"})
+		assert.NotOK(t, err)
+
+		_, err = run(t, createRestoreTestGateway(t), map[string]string{"bucket": "test-bucket"})
+		assert.NotOK(t, err)
+	})
+}
+
+func TestCatCommand(t *testing.T) {
+	t.Run("should write the contents of matching files", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		catCmd := CatCommand(&backupTestFactory{createGCSGatewayGateway: createRestoreTestGateway(t)})
+		catCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "folder", "app")
+		setOptValue(def.Options(), "path", "etc/app.yml")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		assert.OK(t, catCmd.Execute(input, output))
+		assert.Equal(t, "new: true", buf.String())
+	})
+
+	t.Run("should error if the archive isn't stored", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		catCmd := CatCommand(&backupTestFactory{createGCSGatewayGateway: &backupTestStorageGateway{}})
+		catCmd.Configure(def)
+
+		setOptValue(def.Options(), "bucket", "test-bucket")
+		setOptValue(def.Options(), "object", "backup-app-3.tar.gz")
+		setOptValue(def.Options(), "path", "etc/app.yml")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, catCmd.Execute(input, output))
+	})
+}
+
+func TestParseRestoreTime(t *testing.T) {
+	t.Run("should take dates to mean the end of the day", func(t *testing.T) {
+		at, err := parseRestoreTime("2017-07-14")
+		assert.OK(t, err)
+		assert.Equal(t, time.Date(2017, 7, 14, 23, 59, 59, 999999999, time.UTC), at)
+	})
+
+	t.Run("should parse times", func(t *testing.T) {
+		at, err := parseRestoreTime("2017-07-14T02:40:00Z")
+		assert.OK(t, err)
+		assert.Equal(t, time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC), at)
+	})
+}
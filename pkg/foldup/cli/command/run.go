@@ -0,0 +1,339 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+	"github.com/SeerUK/foldup/pkg/config"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/lock"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/naming"
+	"github.com/SeerUK/foldup/pkg/notify"
+	"github.com/SeerUK/foldup/pkg/scheduling"
+	"github.com/SeerUK/foldup/pkg/storage"
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// For testing
+var loadConfig = config.Load
+
+// RunCommand creates a command to run many scheduled backup jobs, described in a configuration file.
+func RunCommand(factory foldup.Factory) *console.Command {
+	var configPath string
+	var definition *console.Definition
+
+	configure := func(def *console.Definition) {
+		definition = def
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&configPath),
+			Spec:  "-c, --config=FILE",
+			Desc:  "A YAML or JSON file describing the backup jobs to run",
+		})
+	}
+
+	execute := func(input *console.Input, output *console.Output) error {
+		err := mapEnv(definition, input, osEnviron())
+		if err != nil {
+			return err
+		}
+
+		if configPath == "" {
+			return errors.New("a configuration file must be given with --config or " + EnvVarName("config"))
+		}
+
+		logger, err := factory.CreateLogger()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(configPath)
+		if err != nil {
+			return err
+		}
+
+		jobs := []*backupJob{}
+		options := []scheduling.Options{}
+
+		// Jobs may share a state or session file, in which case they must also share a store, so that
+		// they don't overwrite each other's state, or sessions.
+		states := make(map[string]scheduling.StateStore)
+		sessions := make(map[string]storage.SessionStore)
+
+		for _, jc := range cfg.Jobs {
+			job, err := newConfiguredJob(factory, logger, jc, sessions)
+			if err != nil {
+				return fmt.Errorf("job '%s': %v", jc.Name, err)
+			}
+
+			stateFile := jc.StateFile
+			if stateFile == "" {
+				stateFile = path.Join(jobDir(jc), StateFile)
+			}
+
+			if _, ok := states[stateFile]; !ok {
+				states[stateFile] = scheduling.NewFileStateStore(stateFile)
+			}
+
+			job.state = states[stateFile]
+			job.stateKey = jc.Name
+
+			if job.source.docker != nil {
+				job.source.docker.state = job.state
+				job.source.docker.stateKey = job.stateKey
+			}
+
+			location, err := loadLocation(jc.Timezone)
+			if err != nil {
+				return fmt.Errorf("job '%s': %v", jc.Name, err)
+			}
+
+			missed := false
+			if jc.CatchUp {
+				missed, err = job.missedRun(jc.Schedule, location)
+				if err != nil {
+					return fmt.Errorf("job '%s': %v", jc.Name, err)
+				}
+
+				if missed {
+					logger.Info("Catching up on a backup run missed while foldup was stopped", logging.F("job", jc.Name))
+				}
+			}
+
+			jobs = append(jobs, job)
+			options = append(options, scheduling.Options{
+				OnNext:     job.scheduledNext,
+				OnSkip:     job.skippedRuns,
+				RunOnStart: missed,
+				Misfire:    scheduling.Misfire(jc.Misfire),
+				Location:   location,
+				Jitter:     jc.Jitter.Duration,
+			})
+		}
+
+		done := make(chan int)
+		errs := make(chan error, len(jobs))
+
+		var once sync.Once
+		stop := func() {
+			once.Do(func() { close(done) })
+		}
+
+		digests := []*backupJob{}
+		for i, job := range jobs {
+			if cfg.Jobs[i].Notifications.EmailDigest {
+				digests = append(digests, job)
+			}
+		}
+
+		if len(digests) > 0 {
+			// Digests are sent daily, and once more when foldup is stopped, so that the reports held
+			// on to for them aren't lost.
+			stopOnShutdown(logger, stop)
+			go flushDigests(done, notify.DigestInterval, digests...)
+
+			defer func() {
+				for _, job := range digests {
+					job.flushNotifications()
+				}
+			}()
+		}
+
+		for i, job := range jobs {
+			go func(schedule string, job *backupJob, opts scheduling.Options) {
+				// A failed run is reported, but mustn't stop this or any other job's schedule.
+				errs <- scheduleFunc(done, schedule, func() error {
+					job.run()
+					return nil
+				}, opts)
+			}(cfg.Jobs[i].Schedule, job, options[i])
+		}
+
+		logger.Info("Scheduled backup jobs", logging.F("jobs", len(jobs)))
+
+		// Schedules only stop if something has gone wrong, at which point stop them all.
+		for range jobs {
+			if err := <-errs; err != nil {
+				stop()
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return &console.Command{
+		Name:        "run",
+		Description: "Run the scheduled backup jobs described in a configuration file.",
+		Configure:   configure,
+		Execute:     execute,
+	}
+}
+
+// newConfiguredJob creates a backupJob from a job's configuration. Session stores are shared with
+// other jobs using the same session file, through the given map of stores by path.
+func newConfiguredJob(factory foldup.Factory, logger logging.Logger, jc config.Job, stores map[string]storage.SessionStore) (*backupJob, error) {
+	var gateway storage.Gateway
+	var sessions storage.SessionStore
+	var err error
+
+	if jc.ChunkSize > 0 {
+		sessionFile := jc.SessionFile
+		if sessionFile == "" {
+			sessionFile = path.Join(jobDir(jc), SessionFile)
+		}
+
+		if _, ok := stores[sessionFile]; !ok {
+			stores[sessionFile] = storage.NewFileSessionStore(sessionFile)
+		}
+
+		// Each job only sees its own sessions, so it can't resume or discard another job's uploads.
+		sessions = storage.NewJobSessionStore(stores[sessionFile], jc.Name)
+		gateway, err = factory.CreateResumableGCSGateway(jc.Bucket, sessions, jc.ChunkSize*1024*1024)
+	} else {
+		gateway, err = factory.CreateGCSGateway(jc.Bucket)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	retryPolicy := storage.DefaultRetryPolicy()
+	if jc.Retry.Attempts > 0 {
+		retryPolicy.MaxAttempts = jc.Retry.Attempts
+	}
+
+	if jc.Retry.Timeout.Duration > 0 {
+		retryPolicy.MaxElapsed = jc.Retry.Timeout.Duration
+	}
+
+	mode, err := archive.ParseMode(jc.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := naming.Parse(jc.NameTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &backupJob{
+		name: jc.Name,
+		source: backupSource{
+			dirnames:     jc.Sources,
+			format:       archive.FormatName(jc.Format),
+			excludes:     jc.Excludes,
+			mode:         mode,
+			includeFiles: jc.IncludeFiles,
+			hidden:       jc.IncludeHidden,
+			names:        archiveNames{template: template},
+		},
+		bucket:   jc.Bucket,
+		gateway:  storage.NewRetryGateway(gateway, retryPolicy, logger),
+		sessions: sessions,
+		retention: storage.RetentionPolicy{
+			KeepLast: jc.Retention.KeepLast,
+			MaxAge:   jc.Retention.MaxAge.Duration,
+		},
+		hooks: backupHooks{
+			Pre:        jc.Hooks.Pre,
+			Post:       jc.Hooks.Post,
+			PreFolder:  jc.Hooks.PreFolder,
+			PostFolder: jc.Hooks.PostFolder,
+			Timeout:    jc.Hooks.Timeout.Duration,
+		},
+		logger: logger,
+	}
+
+	if jc.Docker.Enabled {
+		job.source.docker, err = newDockerSource(factory, jc.Docker.Socket, jc.Docker.Label, jc.Docker.Stop)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Resumable gateways can't list or delete archives, so a regular gateway is used for that.
+	if sessions != nil && job.retention.Enabled() {
+		job.objects, err = factory.CreateGCSGateway(jc.Bucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if jc.Catalog {
+		// Archives in the catalog can be searched using their manifests.
+		job.source.manifests = true
+
+		job.catalog, err = newCatalogStore(factory, job, jc.Bucket)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	job.notifier, err = newNotifyConfig(jc.Notifications).notifier()
+	if err != nil {
+		return nil, err
+	}
+
+	lockDir := jc.Lock.Dir
+	if lockDir == "" {
+		lockDir = jobDir(jc)
+	}
+
+	job.locker, err = newLocker(factory, jc.Lock.Type, jc.Bucket, lockDir, jc.Lock.TTL.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	// Job names are unique, and are the same for every instance running the same configuration.
+	job.lockName = lock.Name(jc.Name)
+
+	job.hostname, _ = os.Hostname()
+	job.source.names.host = job.hostname
+
+	return job, nil
+}
+
+// newNotifyConfig converts the notifications section of a job's configuration into the same form
+// as the backup command's options.
+func newNotifyConfig(n config.Notifications) *notifyConfig {
+	header := http.Header{}
+	for name, value := range n.WebhookHeaders {
+		header.Add(name, value)
+	}
+
+	return &notifyConfig{
+		WebhookURL:      n.WebhookURL,
+		WebhookHeader:   header,
+		WebhookTemplate: n.WebhookTemplate,
+		SlackURL:        n.SlackURL,
+		PingURL:         n.PingURL,
+		SMTP: notify.SMTPConfig{
+			Addr:     n.SMTP.Addr,
+			StartTLS: n.SMTP.StartTLS,
+			Username: n.SMTP.Username,
+			Password: n.SMTP.Password,
+		},
+		EmailFrom:   n.EmailFrom,
+		EmailTo:     strings.Join(n.EmailTo, ","),
+		EmailDigest: n.EmailDigest,
+	}
+}
+
+// jobDir returns the directory the given job keeps foldup's own files in by default; its first
+// source, or the working directory, if it only backs up Docker volumes.
+func jobDir(jc config.Job) string {
+	if len(jc.Sources) == 0 {
+		return ""
+	}
+
+	return sourceDir(jc.Sources[0])
+}
@@ -0,0 +1,487 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/catalog"
+	"github.com/SeerUK/foldup/pkg/config"
+	"github.com/SeerUK/foldup/pkg/docker"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/naming"
+	"github.com/SeerUK/foldup/pkg/scheduling"
+	"github.com/SeerUK/foldup/pkg/storage"
+	"github.com/eidolon/console"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "foldup-config")
+	assert.OK(t, err)
+
+	_, err = file.WriteString(content)
+	assert.OK(t, err)
+	assert.OK(t, file.Close())
+
+	return file.Name()
+}
+
+func TestRunCommand(t *testing.T) {
+	t.Run("should error if no configuration file is given", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		runCmd := RunCommand(&backupTestFactory{})
+		runCmd.Configure(def)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, runCmd.Execute(input, output))
+	})
+
+	t.Run("should error if the configuration is invalid", func(t *testing.T) {
+		configPath := writeTestConfig(t, "jobs:\n  - name: a\n")
+		defer os.Remove(configPath)
+		defer removeTestState()
+
+		def := console.NewDefinition()
+
+		runCmd := RunCommand(&backupTestFactory{})
+		runCmd.Configure(def)
+
+		setOptValue(def.Options(), "config", configPath)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		err := runCmd.Execute(input, output)
+
+		assert.NotOK(t, err)
+		assert.True(t, strings.Contains(err.Error(), "bucket is required"), "Expected validation errors")
+	})
+
+	t.Run("should run each job on its own schedule", func(t *testing.T) {
+		defer revertStubs()
+
+		configPath := writeTestConfig(t, `
+jobs:
+  - name: first
+    sources: [testdata]
+    bucket: first-bucket
+    schedule: "0 * * * *"
+  - name: second
+    sources: [testdata/test1, testdata/test2]
+    bucket: second-bucket
+    schedule: "30 * * * *"
+    misfire: queue
+    timezone: Europe/London
+    jitter: 5m
+    excludes: [".gitkeep"]
+`)
+		defer os.Remove(configPath)
+		defer removeTestState()
+
+		var mu sync.Mutex
+		schedules := []string{}
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, opts scheduling.Options) error {
+			mu.Lock()
+			schedules = append(schedules, fmt.Sprintf("%s %s %s %s", expr, opts.Misfire, opts.Location, opts.Jitter))
+			mu.Unlock()
+
+			return fn()
+		}
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+		}
+
+		def := console.NewDefinition()
+
+		runCmd := RunCommand(factory)
+		runCmd.Configure(def)
+
+		setOptValue(def.Options(), "config", configPath)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.OK(t, runCmd.Execute(input, output))
+
+		sort.Strings(schedules)
+		assert.Equal(t, []string{"0 * * * * skip Local 0s", "30 * * * * queue Europe/London 5m0s"}, schedules)
+
+		// The first job backs up both folders in testdata, and the second job has no folders in its
+		// sources, so stores nothing.
+		assert.Equal(t, 2, len(gateway.stored))
+	})
+
+	t.Run("should keep scheduling a job if a run fails", func(t *testing.T) {
+		defer revertStubs()
+
+		configPath := writeTestConfig(t, `
+jobs:
+  - name: failing
+    sources: [testdata]
+    bucket: test-bucket
+    schedule: "0 * * * *"
+`)
+		defer os.Remove(configPath)
+		defer removeTestState()
+		defer removeTestArchives()
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, opts scheduling.Options) error {
+			return fn()
+		}
+
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: &backupTestStorageGateway{storeError: os.ErrPermission},
+		}
+
+		def := console.NewDefinition()
+
+		runCmd := RunCommand(factory)
+		runCmd.Configure(def)
+
+		setOptValue(def.Options(), "config", configPath)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.OK(t, runCmd.Execute(input, output))
+	})
+
+	t.Run("should skip runs of jobs locked by another instance", func(t *testing.T) {
+		defer revertStubs()
+
+		configPath := writeTestConfig(t, `
+jobs:
+  - name: photos
+    sources: [testdata]
+    bucket: test-bucket
+    schedule: "0 * * * *"
+    lock:
+      type: gcs
+      ttl: 2m
+`)
+		defer os.Remove(configPath)
+		defer removeTestState()
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, opts scheduling.Options) error {
+			return fn()
+		}
+
+		gateway := &backupTestStorageGateway{}
+		locker := &backupTestLocker{held: true}
+
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+			leaseLocker:             locker,
+		}
+
+		def := console.NewDefinition()
+
+		runCmd := RunCommand(factory)
+		runCmd.Configure(def)
+
+		setOptValue(def.Options(), "config", configPath)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.OK(t, runCmd.Execute(input, output))
+		assert.Equal(t, 2*time.Minute, factory.leaseLockerTTL)
+		assert.Equal(t, []string{"photos"}, locker.names)
+		assert.Equal(t, 0, len(gateway.stored))
+	})
+
+	t.Run("should back up Docker volumes, recording when those with their own schedule ran", func(t *testing.T) {
+		defer revertStubs()
+
+		dir := createTestSource(t, "volumes/db/_data/file.txt")
+		defer os.RemoveAll(dir)
+
+		stateFile := path.Join(dir, StateFile)
+
+		configPath := writeTestConfig(t, `
+jobs:
+  - name: volumes
+    bucket: test-bucket
+    schedule: "0 * * * *"
+    state_file: `+stateFile+`
+    docker:
+      enabled: true
+      socket: /tmp/docker.sock
+`)
+		defer os.Remove(configPath)
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, opts scheduling.Options) error {
+			return fn()
+		}
+
+		engine := &backupTestDocker{
+			volumes: []docker.Volume{
+				{Name: "db", Mountpoint: path.Join(dir, "volumes/db/_data"), Labels: map[string]string{labelSchedule: "0 3 * * *"}},
+			},
+		}
+
+		gateway := &backupTestStorageGateway{}
+		factory := &backupTestFactory{
+			createGCSGatewayGateway: gateway,
+			dockerClient:            engine,
+		}
+
+		def := console.NewDefinition()
+
+		runCmd := RunCommand(factory)
+		runCmd.Configure(def)
+
+		setOptValue(def.Options(), "config", configPath)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.OK(t, runCmd.Execute(input, output))
+		assert.Equal(t, "/tmp/docker.sock", factory.dockerSocket)
+		assert.Equal(t, 1, len(gateway.stored))
+
+		_, ok, err := scheduling.NewFileStateStore(stateFile).Get("volumes#docker:db")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the volume's state to be recorded")
+	})
+
+	t.Run("should catch up on jobs that missed a run while stopped", func(t *testing.T) {
+		defer revertStubs()
+
+		dir, err := ioutil.TempDir("", "foldup-state")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		stateFile := path.Join(dir, "state.json")
+		states := scheduling.NewFileStateStore(stateFile)
+
+		assert.OK(t, states.Put("missed", scheduling.JobState{LastRun: time.Now().Add(-48 * time.Hour)}))
+		assert.OK(t, states.Put("recent", scheduling.JobState{LastRun: time.Now()}))
+
+		configPath := writeTestConfig(t, fmt.Sprintf(`
+jobs:
+  - name: missed
+    sources: [testdata/test1]
+    bucket: test-bucket
+    schedule: "0 3 * * *"
+    state_file: %[1]s
+    catch_up: true
+  - name: recent
+    sources: [testdata/test1]
+    bucket: test-bucket
+    schedule: "0 3 * * *"
+    state_file: %[1]s
+    catch_up: true
+`, stateFile))
+		defer os.Remove(configPath)
+
+		var mu sync.Mutex
+		catchUps := 0
+
+		scheduleFunc = func(done <-chan int, expr string, fn func() error, opts scheduling.Options) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if opts.RunOnStart {
+				catchUps++
+			}
+
+			return fn()
+		}
+
+		def := console.NewDefinition()
+
+		runCmd := RunCommand(&backupTestFactory{})
+		runCmd.Configure(def)
+
+		setOptValue(def.Options(), "config", configPath)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.OK(t, runCmd.Execute(input, output))
+		assert.Equal(t, 1, catchUps)
+
+		// Both jobs ran, and recorded it in the same file, without overwriting each other.
+		for _, job := range []string{"missed", "recent"} {
+			state, ok, err := scheduling.NewFileStateStore(stateFile).Get(job)
+			assert.OK(t, err)
+			assert.True(t, ok, "Expected state for job "+job)
+			assert.False(t, state.LastSuccess.IsZero(), "Expected a successful run of job "+job)
+		}
+	})
+}
+
+func TestNewConfiguredJob(t *testing.T) {
+	t.Run("should share session stores between jobs, only letting each see its own sessions", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-sessions")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		sessionFile := path.Join(dir, "sessions.json")
+		stores := make(map[string]storage.SessionStore)
+
+		first, err := newConfiguredJob(&backupTestFactory{}, logging.NewNopLogger(), config.Job{
+			Name:        "first",
+			Sources:     []string{"testdata"},
+			Bucket:      "test-bucket",
+			ChunkSize:   8,
+			SessionFile: sessionFile,
+		}, stores)
+
+		assert.OK(t, err)
+
+		second, err := newConfiguredJob(&backupTestFactory{}, logging.NewNopLogger(), config.Job{
+			Name:        "second",
+			Sources:     []string{"testdata"},
+			Bucket:      "test-bucket",
+			ChunkSize:   8,
+			SessionFile: sessionFile,
+		}, stores)
+
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(stores))
+
+		assert.OK(t, first.sessions.Put(storage.UploadSession{Bucket: "test-bucket", Object: "first-object"}))
+		assert.OK(t, second.sessions.Put(storage.UploadSession{Bucket: "test-bucket", Object: "second-object"}))
+
+		sessions, err := first.sessions.All()
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(sessions))
+		assert.Equal(t, "first-object", sessions[0].Object)
+
+		all, err := stores[sessionFile].All()
+		assert.OK(t, err)
+		assert.Equal(t, 2, len(all))
+	})
+}
+
+func TestNewNotifyConfig(t *testing.T) {
+	t.Run("should keep webhook header values containing commas intact", func(t *testing.T) {
+		c := newNotifyConfig(config.Notifications{
+			WebhookURL: "http://localhost/hook",
+			WebhookHeaders: map[string]string{
+				"Accept":        "application/json, text/plain",
+				"Authorization": "Bearer xyz",
+			},
+		})
+
+		assert.Equal(t, "application/json, text/plain", c.WebhookHeader.Get("Accept"))
+		assert.Equal(t, "Bearer xyz", c.WebhookHeader.Get("Authorization"))
+
+		_, err := c.notifier()
+		assert.OK(t, err)
+	})
+}
+
+func TestPruneArchives(t *testing.T) {
+	t.Run("should delete expired archives of each folder", func(t *testing.T) {
+		now := time.Now()
+
+		gateway := &backupTestStorageGateway{
+			objects: []storage.ObjectInfo{
+				{Name: "data/backup-photos-3.tar.gz", Created: now},
+				{Name: "data/backup-photos-2.tar.gz", Created: now.Add(-time.Hour)},
+				{Name: "data/backup-photos-1.tar.gz", Created: now.Add(-2 * time.Hour)},
+				{Name: "data/backup-photos-old-1.tar.gz", Created: now.Add(-3 * time.Hour)},
+			},
+		}
+
+		folders := []foldup.FolderReport{
+			{Name: "photos", Object: "data/backup-photos-3.tar.gz", Uploaded: true},
+		}
+
+		err := pruneArchives(context.Background(), gateway, storage.RetentionPolicy{KeepLast: 2}, naming.Default, folders)
+
+		assert.OK(t, err)
+		assert.Equal(t, []string{"data/backup-photos-1.tar.gz"}, gateway.deleted)
+	})
+
+	t.Run("should find archives named using a template", func(t *testing.T) {
+		now := time.Now()
+
+		gateway := &backupTestStorageGateway{
+			objects: []storage.ObjectInfo{
+				{Name: "nas/photos/2017/07/14/photos-1500000000.tar.gz", Created: now},
+				{Name: "nas/photos/2017/07/13/photos-1499913600.tar.gz", Created: now.Add(-time.Hour)},
+				{Name: "nas/photos/2017/07/12/photos-1499827200.tar.gz", Created: now.Add(-2 * time.Hour)},
+				{Name: "nas/photos/2017/07/11/music-1499740800.tar.gz", Created: now.Add(-3 * time.Hour)},
+				{Name: "nas/photos/notes.txt", Created: now.Add(-3 * time.Hour)},
+			},
+		}
+
+		folders := []foldup.FolderReport{
+			{Name: "photos", Object: "nas/photos/2017/07/14/photos-1500000000.tar.gz", Uploaded: true},
+		}
+
+		template := naming.MustParse("{{host}}/{{folder}}/{{date:2006/01/02}}/{{folder}}-{{unix}}")
+
+		err := pruneArchives(context.Background(), gateway, storage.RetentionPolicy{KeepLast: 2}, template, folders)
+
+		assert.OK(t, err)
+		assert.Equal(t, []string{"nas/photos/2017/07/12/photos-1499827200.tar.gz"}, gateway.deleted)
+	})
+
+	t.Run("should error if the gateway can't list archives", func(t *testing.T) {
+		err := pruneArchives(context.Background(), &testStoreOnlyGateway{}, storage.RetentionPolicy{KeepLast: 2}, naming.Default, nil)
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestPruneCatalog(t *testing.T) {
+	t.Run("should delete expired archives found in the catalog, and their manifests, and forget them", func(t *testing.T) {
+		now := time.Now()
+
+		c := &catalog.Catalog{}
+		c.Add(catalog.Run{ID: "1", Started: now.Add(-2 * time.Hour), Snapshots: []catalog.Snapshot{
+			{Folder: "photos", Object: "data/backup-photos-1.tar.gz", Manifest: "foldup-manifests/data/backup-photos-1.tar.gz.json.gz", Status: catalog.StatusSuccess},
+			{Folder: "photos-old", Object: "data/backup-photos-old-1.tar.gz", Status: catalog.StatusSuccess},
+		}})
+		c.Add(catalog.Run{ID: "2", Started: now.Add(-time.Hour), Snapshots: []catalog.Snapshot{
+			{Folder: "photos", Object: "data/backup-photos-2.tar.gz", Status: catalog.StatusSuccess},
+		}})
+
+		report := foldup.NewReport("data")
+		report.Folders = []foldup.FolderReport{
+			{Name: "photos", Object: "data/backup-photos-3.tar.gz", Uploaded: true},
+		}
+
+		gateway := &backupTestStorageGateway{}
+
+		err := pruneCatalog(context.Background(), gateway, storage.RetentionPolicy{KeepLast: 2}, naming.Default, c, report)
+
+		assert.OK(t, err)
+		assert.Equal(t, []string{"data/backup-photos-1.tar.gz", "foldup-manifests/data/backup-photos-1.tar.gz.json.gz"}, gateway.deleted)
+
+		remaining := c.Find(catalog.Filter{})
+		assert.Equal(t, 2, len(remaining))
+		assert.Equal(t, "data/backup-photos-2.tar.gz", remaining[0].Object)
+		assert.Equal(t, "data/backup-photos-old-1.tar.gz", remaining[1].Object)
+	})
+
+	t.Run("should error if the gateway can't delete archives", func(t *testing.T) {
+		err := pruneCatalog(context.Background(), &testStoreOnlyGateway{}, storage.RetentionPolicy{KeepLast: 2}, naming.Default, &catalog.Catalog{}, foldup.NewReport(""))
+
+		assert.NotOK(t, err)
+	})
+}
+
+// testStoreOnlyGateway is a Gateway that can only store files.
+type testStoreOnlyGateway struct{}
+
+func (g *testStoreOnlyGateway) Store(ctx context.Context, filename string, in io.Reader) error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package command
+
+import (
+	"errors"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/scheduling"
+	"github.com/eidolon/console"
+	"github.com/eidolon/console/parameters"
+)
+
+// ScheduleCommand creates a command to check schedule expressions, by showing when they'd run.
+func ScheduleCommand() *console.Command {
+	var explain string
+	var timezone string
+
+	count := 5
+
+	configure := func(def *console.Definition) {
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&explain),
+			Spec:  "--explain=EXPR",
+			Desc:  "A schedule expression to show the next runs of, e.g. '0 3 * * *' or '@every 6h'",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewIntValue(&count),
+			Spec:  "-n, --count=N",
+			Desc:  "How many runs to show (default: 5)",
+		})
+
+		def.AddOption(console.OptionDefinition{
+			Value: parameters.NewStringValue(&timezone),
+			Spec:  "--timezone=ZONE",
+			Desc:  "An IANA time zone to evaluate the schedule in, e.g. 'Europe/London' (default: local)",
+		})
+	}
+
+	execute := func(input *console.Input, output *console.Output) error {
+		if explain == "" {
+			return errors.New("a schedule expression must be given with --explain")
+		}
+
+		if count < 1 {
+			return errors.New("at least one run must be shown")
+		}
+
+		location, err := loadLocation(timezone)
+		if err != nil {
+			return err
+		}
+
+		runs, err := scheduling.NextRuns(explain, time.Now().In(location), count)
+		if err != nil {
+			return err
+		}
+
+		output.Printf("Expression: %s\n", explain)
+		output.Printf("Time zone:  %s\n", location)
+
+		if len(runs) > 1 {
+			output.Printf("Interval:   %s (between the next two runs)\n", runs[1].Sub(runs[0]))
+		}
+
+		if len(runs) == 0 {
+			output.Println("\nThis schedule will never run.")
+			return nil
+		}
+
+		output.Printf("\nNext %d run(s):\n", len(runs))
+
+		for _, run := range runs {
+			output.Printf("  %s\n", run.Format("Mon, 02 Jan 2006 15:04:05 MST"))
+		}
+
+		return nil
+	}
+
+	return &console.Command{
+		Name:        "schedule",
+		Description: "Check a schedule expression, by showing when it would run.",
+		Configure:   configure,
+		Execute:     execute,
+	}
+}
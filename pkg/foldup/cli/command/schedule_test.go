@@ -0,0 +1,77 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SeerUK/assert"
+	"github.com/eidolon/console"
+)
+
+func TestScheduleCommand(t *testing.T) {
+	t.Run("should return the schedule command", func(t *testing.T) {
+		scheduleCmd := ScheduleCommand()
+
+		assert.Equal(t, "schedule", scheduleCmd.Name)
+	})
+
+	t.Run("should show the next runs of an expression", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		scheduleCmd := ScheduleCommand()
+		scheduleCmd.Configure(def)
+
+		setOptValue(def.Options(), "explain", "@every 6h offset 30m")
+		setOptValue(def.Options(), "count", "3")
+		setOptValue(def.Options(), "timezone", "Europe/London")
+
+		buf := &bytes.Buffer{}
+		input, output := createInputAndOutput(buf)
+
+		result := scheduleCmd.Execute(input, output)
+
+		assert.OK(t, result)
+		assert.True(t, strings.Contains(buf.String(), "Time zone:  Europe/London"), "Expected the time zone")
+		assert.True(t, strings.Contains(buf.String(), "Interval:   6h0m0s"), "Expected the interval")
+		assert.Equal(t, 3, strings.Count(buf.String(), ":30:00 "))
+	})
+
+	t.Run("should error if no expression is given", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		scheduleCmd := ScheduleCommand()
+		scheduleCmd.Configure(def)
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, scheduleCmd.Execute(input, output))
+	})
+
+	t.Run("should error if the expression is invalid", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		scheduleCmd := ScheduleCommand()
+		scheduleCmd.Configure(def)
+
+		setOptValue(def.Options(), "explain", "@every fortnight")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, scheduleCmd.Execute(input, output))
+	})
+
+	t.Run("should error if the time zone is unknown", func(t *testing.T) {
+		def := console.NewDefinition()
+
+		scheduleCmd := ScheduleCommand()
+		scheduleCmd.Configure(def)
+
+		setOptValue(def.Options(), "explain", "@daily")
+		setOptValue(def.Options(), "timezone", "Mars/Olympus_Mons")
+
+		input, output := createInputAndOutput(&bytes.Buffer{})
+
+		assert.NotOK(t, scheduleCmd.Execute(input, output))
+	})
+}
@@ -0,0 +1,60 @@
+package command
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/SeerUK/foldup/pkg/logging"
+)
+
+// trigger is used to force a scheduled backup to run out of schedule. At most one triggered run is
+// kept pending at a time; triggering again before it starts does nothing.
+type trigger chan struct{}
+
+// newTrigger creates a new trigger.
+func newTrigger() trigger {
+	return make(trigger, 1)
+}
+
+// fire triggers a run, returning false if a triggered run was already pending.
+func (t trigger) fire() bool {
+	select {
+	case t <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// notifyOn fires the trigger whenever one of the given signals is received.
+func (t trigger) notifyOn(logger logging.Logger, signals ...os.Signal) {
+	if len(signals) == 0 {
+		return
+	}
+
+	received := make(chan os.Signal, 1)
+	signalNotify(received, signals...)
+
+	go func() {
+		for sig := range received {
+			logger.Info("Triggering a backup run", logging.F("signal", sig.String()))
+			t.fire()
+		}
+	}()
+}
+
+// ServeHTTP fires the trigger in response to POST requests.
+func (t trigger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !t.fire() {
+		http.Error(w, "a triggered backup run is already pending", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
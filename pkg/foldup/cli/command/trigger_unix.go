@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package command
+
+import (
+	"os"
+	"syscall"
+)
+
+// triggerSignals are the signals that trigger a scheduled backup to run out of schedule.
+var triggerSignals = []os.Signal{syscall.SIGUSR1}
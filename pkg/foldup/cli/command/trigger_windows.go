@@ -0,0 +1,7 @@
+package command
+
+import "os"
+
+// triggerSignals are the signals that trigger a scheduled backup to run out of schedule. Windows
+// has no SIGUSR1, so only the HTTP trigger is available there.
+var triggerSignals = []os.Signal{}
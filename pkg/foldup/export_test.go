@@ -1,7 +1,14 @@
 package foldup
 
-import gstorage "cloud.google.com/go/storage"
+import (
+	"os"
+
+	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/transport"
+)
 
 func revertStubs() {
 	newGCSClient = gstorage.NewClient
+	newHTTPClient = transport.NewHTTPClient
+	logWriter = os.Stderr
 }
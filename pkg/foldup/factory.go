@@ -2,10 +2,19 @@ package foldup
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
 
 	gstorage "cloud.google.com/go/storage"
+	"github.com/SeerUK/foldup/pkg/docker"
+	"github.com/SeerUK/foldup/pkg/lock"
+	"github.com/SeerUK/foldup/pkg/logging"
 	"github.com/SeerUK/foldup/pkg/storage"
 	"github.com/SeerUK/foldup/pkg/storage/gcs"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
 )
 
 // Factory is used to create dependencies used elsewhere in the application. It's primary reason for
@@ -13,30 +22,113 @@ import (
 // of a factory) to create it's dependencies "dynamically" in a test. The factory should produce
 // interfaces, meaning the actual implementations of anything it creates could be fake.
 type Factory interface {
+	// CreateLogger is used to create the logger that everything else logs to. It should return the
+	// same logger each time it's called.
+	CreateLogger() (logging.Logger, error)
 	// CreateGCSGateway is used to create a storage gateway. In normal use it should be a GCS
 	// gateway, that uses the given bucket to store files.
 	CreateGCSGateway(bucket string) (storage.Gateway, error)
+	// CreateResumableGCSGateway is used to create a storage gateway that uploads files to the given
+	// bucket in chunks, using resumable upload sessions that are persisted in the given store.
+	CreateResumableGCSGateway(bucket string, sessions storage.SessionStore, chunkSize int) (storage.Gateway, error)
+	// CreateLeaseLocker is used to create a locker that stores leases in the given bucket, lasting
+	// for the given TTL unless they're renewed.
+	CreateLeaseLocker(bucket string, ttl time.Duration) (lock.Locker, error)
+	// CreateDockerClient is used to create a client for the Docker engine listening on the unix
+	// socket at the given path.
+	CreateDockerClient(socket string) (docker.Client, error)
 }
 
 // For testing
 var newGCSClient = gstorage.NewClient
+var newHTTPClient = transport.NewHTTPClient
+var logWriter io.Writer = os.Stderr
 
 // cliFactory is the default factory for CLI use, creating real implementations of dependencies.
-type cliFactory struct{}
+type cliFactory struct {
+	logConfig *logging.Config
+	logger    logging.Logger
+}
 
-// NewCLIFactory produces a new instance of cliFactory.
-func NewCLIFactory() Factory {
-	return &cliFactory{}
+// NewCLIFactory produces a new instance of cliFactory. The given logging config is only read when
+// the logger is first created, so it may be filled in by command-line options in the meantime.
+func NewCLIFactory(logConfig *logging.Config) Factory {
+	return &cliFactory{
+		logConfig: logConfig,
+	}
+}
+
+func (f *cliFactory) CreateLogger() (logging.Logger, error) {
+	if f.logger != nil {
+		return f.logger, nil
+	}
+
+	config := logging.Config{}
+	if f.logConfig != nil {
+		config = *f.logConfig
+	}
+
+	logger, err := logging.NewLoggerFromConfig(logWriter, config)
+	if err != nil {
+		return nil, err
+	}
+
+	f.logger = logger
+
+	return logger, nil
 }
 
 func (f *cliFactory) CreateGCSGateway(bucket string) (storage.Gateway, error) {
+	logger, err := f.CreateLogger()
+	if err != nil {
+		return nil, err
+	}
+
 	storageClient, err := newGCSClient(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
 	client := gcs.NewGoogleClient(storageClient)
-	gateway := storage.NewGCSGateway(client, bucket)
+	gateway := storage.NewGCSGateway(client, bucket, logger)
 
 	return gateway, nil
 }
+
+func (f *cliFactory) CreateResumableGCSGateway(bucket string, sessions storage.SessionStore, chunkSize int) (storage.Gateway, error) {
+	logger, err := f.CreateLogger()
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, _, err := newHTTPClient(context.Background(), option.WithScopes(gstorage.ScopeReadWrite))
+	if err != nil {
+		return nil, err
+	}
+
+	client := gcs.NewHTTPResumableClient(httpClient, gcs.ResumableEndpoint)
+
+	return storage.NewResumableGateway(client, bucket, sessions, chunkSize, logger)
+}
+
+func (f *cliFactory) CreateLeaseLocker(bucket string, ttl time.Duration) (lock.Locker, error) {
+	logger, err := f.CreateLogger()
+	if err != nil {
+		return nil, err
+	}
+
+	storageClient, err := newGCSClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	// Leases are held by this process, on this host, which is enough to tell replicas apart.
+	hostname, _ := os.Hostname()
+	holder := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	return lock.NewLeaseLocker(gcs.NewGoogleClient(storageClient), bucket, holder, ttl, logger), nil
+}
+
+func (f *cliFactory) CreateDockerClient(socket string) (docker.Client, error) {
+	return docker.NewClient(socket), nil
+}
@@ -1,23 +1,70 @@
 package foldup
 
 import (
+	"bytes"
 	"errors"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	gstorage "cloud.google.com/go/storage"
 	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/storage"
 	"golang.org/x/net/context"
 	"google.golang.org/api/option"
 )
 
 func TestNewCLIFactory(t *testing.T) {
 	t.Run("should not return nil", func(t *testing.T) {
-		factory := NewCLIFactory()
+		factory := NewCLIFactory(nil)
 
 		assert.NotEqual(t, nil, factory)
 	})
 }
 
+func TestCliFactory_CreateLogger(t *testing.T) {
+	t.Run("should create a logger using the given config", func(t *testing.T) {
+		defer revertStubs()
+
+		buf := &bytes.Buffer{}
+		logWriter = buf
+
+		factory := NewCLIFactory(&logging.Config{Format: "json", Level: "warn"})
+
+		logger, err := factory.CreateLogger()
+		assert.OK(t, err)
+
+		logger.Info("hidden")
+		logger.Warn("shown")
+
+		assert.True(t, strings.HasPrefix(buf.String(), "{"), "Expected JSON log entries")
+		assert.True(t, strings.Contains(buf.String(), `"msg":"shown"`), "Expected warn entry")
+		assert.False(t, strings.Contains(buf.String(), "hidden"), "Expected info entry to be hidden")
+	})
+
+	t.Run("should return the same logger each time", func(t *testing.T) {
+		factory := NewCLIFactory(nil)
+
+		first, err := factory.CreateLogger()
+		assert.OK(t, err)
+
+		second, err := factory.CreateLogger()
+		assert.OK(t, err)
+
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("should error if the config is invalid", func(t *testing.T) {
+		factory := NewCLIFactory(&logging.Config{Level: "loud"})
+
+		_, err := factory.CreateLogger()
+
+		assert.NotOK(t, err)
+	})
+}
+
 func TestCliFactory_CreateGCSGateway(t *testing.T) {
 	t.Run("should not error under normal circumstances", func(t *testing.T) {
 		defer revertStubs()
@@ -26,7 +73,7 @@ func TestCliFactory_CreateGCSGateway(t *testing.T) {
 			return &gstorage.Client{}, nil
 		}
 
-		factory := NewCLIFactory()
+		factory := NewCLIFactory(nil)
 
 		_, err := factory.CreateGCSGateway("test-bucket")
 
@@ -40,10 +87,84 @@ func TestCliFactory_CreateGCSGateway(t *testing.T) {
 			return nil, errors.New("uh oh")
 		}
 
-		factory := NewCLIFactory()
+		factory := NewCLIFactory(nil)
 
 		_, err := factory.CreateGCSGateway("test-bucket")
 
 		assert.NotOK(t, err)
 	})
 }
+
+func TestCliFactory_CreateResumableGCSGateway(t *testing.T) {
+	t.Run("should not error under normal circumstances", func(t *testing.T) {
+		defer revertStubs()
+
+		newHTTPClient = func(ctx context.Context, opts ...option.ClientOption) (*http.Client, string, error) {
+			return &http.Client{}, "", nil
+		}
+
+		factory := NewCLIFactory(nil)
+		sessions := storage.NewFileSessionStore("sessions.json")
+
+		_, err := factory.CreateResumableGCSGateway("test-bucket", sessions, storage.ResumableChunkSizeMultiple)
+
+		assert.OK(t, err)
+	})
+
+	t.Run("should propagate errors creating the HTTP client", func(t *testing.T) {
+		defer revertStubs()
+
+		newHTTPClient = func(ctx context.Context, opts ...option.ClientOption) (*http.Client, string, error) {
+			return nil, "", errors.New("uh oh")
+		}
+
+		factory := NewCLIFactory(nil)
+		sessions := storage.NewFileSessionStore("sessions.json")
+
+		_, err := factory.CreateResumableGCSGateway("test-bucket", sessions, storage.ResumableChunkSizeMultiple)
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestCliFactory_CreateLeaseLocker(t *testing.T) {
+	t.Run("should not error under normal circumstances", func(t *testing.T) {
+		defer revertStubs()
+
+		newGCSClient = func(ctx context.Context, opts ...option.ClientOption) (*gstorage.Client, error) {
+			return &gstorage.Client{}, nil
+		}
+
+		factory := NewCLIFactory(nil)
+
+		locker, err := factory.CreateLeaseLocker("test-bucket", time.Minute)
+
+		assert.OK(t, err)
+		assert.NotEqual(t, nil, locker)
+	})
+
+	t.Run("should propagate errors creating the GCS client", func(t *testing.T) {
+		defer revertStubs()
+
+		newGCSClient = func(ctx context.Context, opts ...option.ClientOption) (*gstorage.Client, error) {
+			return nil, errors.New("uh oh")
+		}
+
+		factory := NewCLIFactory(nil)
+
+		_, err := factory.CreateLeaseLocker("test-bucket", time.Minute)
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestCliFactory_CreateDockerClient(t *testing.T) {
+	t.Run("should not error under normal circumstances", func(t *testing.T) {
+		factory := NewCLIFactory(nil)
+
+		client, err := factory.CreateDockerClient("/var/run/docker.sock")
+
+		assert.OK(t, err)
+		assert.NotEqual(t, nil, client)
+	})
+}
@@ -0,0 +1,151 @@
+package foldup
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Stage identifies a part of the backup process.
+type Stage string
+
+// The stages of a backup run, in the order they happen.
+const (
+	StageLock    Stage = "lock"
+	StageHook    Stage = "hook"
+	StageRead    Stage = "read"
+	StageArchive Stage = "archive"
+	StageUpload  Stage = "upload"
+)
+
+// Report describes the outcome of a single backup run.
+type Report struct {
+	// RunID uniquely identifies the run.
+	RunID string
+	// Job is the name of the job the run was for, if it has one.
+	Job string
+	// Dirname is the directory that was backed up.
+	Dirname string
+	// Started is the time the run started.
+	Started time.Time
+	// Finished is the time the run finished.
+	Finished time.Time
+	// Folders contains a FolderReport for each folder that was found to back up.
+	Folders []FolderReport
+	// Stage is the stage the run failed at, if it failed.
+	Stage Stage
+	// Err is the error that caused the run to fail, if it failed.
+	Err error
+}
+
+// NewReport creates a new Report for a run starting now, with a new run ID.
+func NewReport(dirname string) *Report {
+	return &Report{
+		RunID:   NewRunID(),
+		Dirname: dirname,
+		Started: time.Now(),
+	}
+}
+
+// Fail marks the run as having failed at the given stage, with the given error. It returns the
+// error, for convenience.
+func (r *Report) Fail(stage Stage, err error) error {
+	r.Stage = stage
+	r.Err = err
+
+	return err
+}
+
+// Finish marks the run as finished.
+func (r *Report) Finish() {
+	r.Finished = time.Now()
+}
+
+// OK returns true if the run didn't fail.
+func (r *Report) OK() bool {
+	return r.Err == nil
+}
+
+// Duration returns how long the run took.
+func (r *Report) Duration() time.Duration {
+	return r.Finished.Sub(r.Started)
+}
+
+// BytesRead returns the total size of the files read from all folders.
+func (r *Report) BytesRead() int64 {
+	var total int64
+	for _, f := range r.Folders {
+		total += f.BytesRead
+	}
+
+	return total
+}
+
+// BytesArchived returns the total size of the archives created for all folders.
+func (r *Report) BytesArchived() int64 {
+	var total int64
+	for _, f := range r.Folders {
+		total += f.BytesArchived
+	}
+
+	return total
+}
+
+// BytesUploaded returns the total number of bytes uploaded for all folders.
+func (r *Report) BytesUploaded() int64 {
+	var total int64
+	for _, f := range r.Folders {
+		total += f.BytesUploaded
+	}
+
+	return total
+}
+
+// FolderReport describes the outcome of backing up a single folder.
+type FolderReport struct {
+	// Name is the base name of the folder.
+	Name string
+	// Path is the path to the folder.
+	Path string
+	// Archive is the name of the archive that was created for the folder.
+	Archive string
+	// Object is the name the archive is stored under.
+	Object string
+	// Files is the number of files in the archive.
+	Files int
+	// SHA256 is the hex encoded SHA-256 hash of the archive.
+	SHA256 string
+	// Manifest is the name the manifest of the archive is stored under, if one was stored.
+	Manifest string
+	// BytesRead is the total size of the files in the folder.
+	BytesRead int64
+	// BytesArchived is the size of the archive.
+	BytesArchived int64
+	// BytesUploaded is the number of bytes uploaded to storage, which may be more than the size of
+	// the archive if uploads had to be retried.
+	BytesUploaded int64
+	// Duration is how long it took to archive and upload the folder.
+	Duration time.Duration
+	// Uploaded is true once the archive has been uploaded.
+	Uploaded bool
+	// Err is the error that stopped the folder being backed up, if it wasn't.
+	Err error
+}
+
+// CompressionRatio returns the size of the archive relative to the size of the files in it. If no
+// files were read, 0 is returned.
+func (f FolderReport) CompressionRatio() float64 {
+	if f.BytesRead == 0 {
+		return 0
+	}
+
+	return float64(f.BytesArchived) / float64(f.BytesRead)
+}
+
+// NewRunID generates a new random identifier for a backup run.
+func NewRunID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,45 @@
+package foldup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestReport(t *testing.T) {
+	t.Run("should record failures", func(t *testing.T) {
+		report := NewReport("testdata")
+		assert.True(t, report.OK(), "Expected new report to be OK")
+
+		err := report.Fail(StageUpload, errors.New("oops"))
+
+		assert.Equal(t, report.Err, err)
+		assert.Equal(t, StageUpload, report.Stage)
+		assert.False(t, report.OK(), "Expected failed report not to be OK")
+	})
+
+	t.Run("should total up the bytes of each folder", func(t *testing.T) {
+		report := NewReport("testdata")
+		report.Folders = []FolderReport{
+			{BytesRead: 10, BytesArchived: 5, BytesUploaded: 5},
+			{BytesRead: 20, BytesArchived: 10, BytesUploaded: 20},
+		}
+
+		assert.Equal(t, int64(30), report.BytesRead())
+		assert.Equal(t, int64(15), report.BytesArchived())
+		assert.Equal(t, int64(25), report.BytesUploaded())
+	})
+
+	t.Run("should have a unique run ID", func(t *testing.T) {
+		assert.NotEqual(t, NewReport("a").RunID, NewReport("b").RunID)
+		assert.Equal(t, 16, len(NewRunID()))
+	})
+}
+
+func TestFolderReport_CompressionRatio(t *testing.T) {
+	t.Run("should return the ratio of archived bytes to read bytes", func(t *testing.T) {
+		assert.Equal(t, 0.25, FolderReport{BytesRead: 100, BytesArchived: 25}.CompressionRatio())
+		assert.Equal(t, float64(0), FolderReport{}.CompressionRatio())
+	})
+}
@@ -0,0 +1,195 @@
+// Package health keeps track of the state of a running foldup process, so that orchestrators like
+// Kubernetes or Docker can probe whether it is alive, and whether it is doing its job.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MissedRunGrace is how long after a run was due to start the scheduler can go without starting it
+// before it's considered to be stuck.
+const MissedRunGrace = 1 * time.Minute
+
+// CheckTimeout is how long a readiness probe will wait for storage to respond.
+const CheckTimeout = 10 * time.Second
+
+// For testing
+var timeNow = time.Now
+
+// Monitor tracks the scheduler loop and backup runs of a foldup process. A nil *Monitor is valid,
+// and simply tracks nothing, so callers don't need to check whether health checks are enabled.
+type Monitor struct {
+	sync.Mutex
+
+	started     time.Time
+	interval    time.Duration
+	factor      int
+	check       func(ctx context.Context) error
+	scheduling  bool
+	next        time.Time
+	running     bool
+	lastSuccess time.Time
+}
+
+// NewMonitor creates a new Monitor. The `interval` is the expected time between backup runs, and
+// the process will only be considered ready if a backup succeeded within `factor` times that
+// interval. The `check` function should return an error if storage can't be reached.
+func NewMonitor(interval time.Duration, factor int, check func(ctx context.Context) error) *Monitor {
+	return &Monitor{
+		started:  timeNow(),
+		interval: interval,
+		factor:   factor,
+		check:    check,
+	}
+}
+
+// SchedulerStarted records that the scheduler loop has started.
+func (m *Monitor) SchedulerStarted() {
+	if m == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.scheduling = true
+}
+
+// SchedulerStopped records that the scheduler loop has stopped.
+func (m *Monitor) SchedulerStopped() {
+	if m == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.scheduling = false
+}
+
+// ScheduledNext records the time the scheduler will next start a run.
+func (m *Monitor) ScheduledNext(next time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.next = next
+}
+
+// RunStarted records that a backup run has started.
+func (m *Monitor) RunStarted() {
+	if m == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.running = true
+}
+
+// RunFinished records that a backup run has finished, and whether it succeeded.
+func (m *Monitor) RunFinished(ok bool) {
+	if m == nil {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.running = false
+
+	if ok {
+		m.lastSuccess = timeNow()
+	}
+}
+
+// Live returns an error if the process appears to be stuck; either the scheduler loop has stopped,
+// or it has failed to start a run that was due.
+func (m *Monitor) Live() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.scheduling {
+		return fmt.Errorf("health: scheduler is not running")
+	}
+
+	if !m.running && !m.next.IsZero() && timeNow().After(m.next.Add(MissedRunGrace)) {
+		return fmt.Errorf("health: scheduler missed the run due at %s", m.next.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Ready returns an error if storage can't be reached, or if there hasn't been a successful backup
+// recently enough. Until the process has been running for long enough that a backup should have
+// succeeded, it's given the benefit of the doubt.
+func (m *Monitor) Ready(ctx context.Context) error {
+	if m.check != nil {
+		ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+		defer cancel()
+
+		if err := m.check(ctx); err != nil {
+			return fmt.Errorf("health: storage is not reachable: %v", err)
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.interval <= 0 || m.factor <= 0 {
+		return nil
+	}
+
+	window := time.Duration(m.factor) * m.interval
+
+	since := m.lastSuccess
+	if since.IsZero() {
+		since = m.started
+	}
+
+	if timeNow().Sub(since) > window {
+		if m.lastSuccess.IsZero() {
+			return fmt.Errorf("health: no successful backup since starting %s ago", timeNow().Sub(m.started))
+		}
+
+		return fmt.Errorf("health: last successful backup was at %s", m.lastSuccess.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Handler returns an http.Handler serving `/healthz` and `/readyz` endpoints, which respond with
+// 200 if everything is fine, and 503 along with the reason if not.
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, m.Live())
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, m.Ready(r.Context()))
+	})
+
+	return mux
+}
+
+func respond(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
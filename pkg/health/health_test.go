@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+)
+
+func revertStubs() {
+	timeNow = time.Now
+}
+
+func stubTimeNow(now time.Time) {
+	timeNow = func() time.Time {
+		return now
+	}
+}
+
+func TestMonitor_Live(t *testing.T) {
+	t.Run("should not be live if the scheduler isn't running", func(t *testing.T) {
+		monitor := NewMonitor(time.Hour, 2, nil)
+
+		assert.NotOK(t, monitor.Live())
+
+		monitor.SchedulerStarted()
+		assert.OK(t, monitor.Live())
+
+		monitor.SchedulerStopped()
+		assert.NotOK(t, monitor.Live())
+	})
+
+	t.Run("should not be live if a run is overdue", func(t *testing.T) {
+		defer revertStubs()
+
+		now := time.Now()
+		stubTimeNow(now)
+
+		monitor := NewMonitor(time.Hour, 2, nil)
+		monitor.SchedulerStarted()
+		monitor.ScheduledNext(now.Add(-2 * MissedRunGrace))
+
+		assert.NotOK(t, monitor.Live())
+
+		// It's fine if the run is just taking a while though.
+		monitor.RunStarted()
+		assert.OK(t, monitor.Live())
+	})
+}
+
+func TestMonitor_Ready(t *testing.T) {
+	t.Run("should not be ready if storage is unreachable", func(t *testing.T) {
+		monitor := NewMonitor(time.Hour, 2, func(ctx context.Context) error {
+			return errors.New("oops")
+		})
+
+		assert.NotOK(t, monitor.Ready(context.Background()))
+	})
+
+	t.Run("should be ready until a backup is overdue", func(t *testing.T) {
+		defer revertStubs()
+
+		now := time.Now()
+		stubTimeNow(now)
+
+		monitor := NewMonitor(time.Hour, 2, func(ctx context.Context) error {
+			return nil
+		})
+
+		assert.OK(t, monitor.Ready(context.Background()))
+
+		stubTimeNow(now.Add(3 * time.Hour))
+		assert.NotOK(t, monitor.Ready(context.Background()))
+
+		monitor.RunStarted()
+		monitor.RunFinished(true)
+		assert.OK(t, monitor.Ready(context.Background()))
+
+		stubTimeNow(now.Add(6 * time.Hour))
+		monitor.RunStarted()
+		monitor.RunFinished(false)
+		assert.NotOK(t, monitor.Ready(context.Background()))
+	})
+}
+
+func TestMonitor_Handler(t *testing.T) {
+	t.Run("should respond with the status of each probe", func(t *testing.T) {
+		monitor := NewMonitor(time.Hour, 2, nil)
+		handler := monitor.Handler()
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+		monitor.SchedulerStarted()
+
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "ok\n", rec.Body.String())
+
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestMonitor_Nil(t *testing.T) {
+	t.Run("should do nothing if health checks are disabled", func(t *testing.T) {
+		var monitor *Monitor
+
+		monitor.SchedulerStarted()
+		monitor.ScheduledNext(time.Now())
+		monitor.RunStarted()
+		monitor.RunFinished(true)
+		monitor.SchedulerStopped()
+	})
+}
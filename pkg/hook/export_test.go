@@ -0,0 +1,7 @@
+package hook
+
+import "os"
+
+func revertStubs() {
+	osEnviron = os.Environ
+}
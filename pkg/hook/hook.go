@@ -0,0 +1,130 @@
+// Package hook runs user-supplied shell commands around backups, e.g. to dump a database before
+// it's archived, or to unlock it afterwards.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/logging"
+)
+
+// DefaultTimeout is how long a hook may run for, unless a timeout is given.
+const DefaultTimeout = 10 * time.Minute
+
+// maxOutput is the most output from a failed hook that's included in its error.
+const maxOutput = 512
+
+// For testing
+var osEnviron = os.Environ
+
+// envPrefix is the prefix of the environment variables that foldup reads its options from, and
+// that it describes runs to hooks with.
+const envPrefix = "FOLDUP_"
+
+// Env holds the environment variables passed to a hook, on top of foldup's own.
+type Env map[string]string
+
+// environ returns the environment for a hook's process, sorted by name so that it's predictable.
+// foldup's own options, e.g. credentials given as FOLDUP_ variables, aren't passed on, and nor can
+// they be mistaken for variables describing the run.
+func (e Env) environ() []string {
+	names := []string{}
+	for name := range e {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	environ := []string{}
+	for _, variable := range osEnviron() {
+		if !strings.HasPrefix(variable, envPrefix) {
+			environ = append(environ, variable)
+		}
+	}
+
+	for _, name := range names {
+		environ = append(environ, name+"="+e[name])
+	}
+
+	return environ
+}
+
+// Run runs the given command with the shell, passing it the given environment variables. If it
+// takes longer than the given timeout, or DefaultTimeout if the timeout isn't positive, it's killed,
+// along with anything it started. Its output is logged, and included in the error if it fails.
+func Run(ctx context.Context, logger logging.Logger, command string, timeout time.Duration, env Env) error {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	started := time.Now()
+	output := &bytes.Buffer{}
+
+	cmd := shellCommand(command)
+	cmd.Env = env.environ()
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Start()
+	if err != nil {
+		return fmt.Errorf("hook: '%s' couldn't be started: %v", command, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-done:
+	case <-timer.C:
+		kill(cmd)
+		<-done
+
+		err = fmt.Errorf("timed out after %s", timeout)
+	case <-ctx.Done():
+		kill(cmd)
+		<-done
+
+		err = ctx.Err()
+	}
+
+	fields := []logging.Field{logging.F("hook", command), logging.Duration(time.Since(started))}
+	if output.Len() > 0 {
+		fields = append(fields, logging.F("output", strings.TrimSpace(output.String())))
+	}
+
+	if err != nil {
+		logger.Error("Hook failed", append(fields, logging.Err(err))...)
+
+		return fmt.Errorf("hook: '%s' failed: %v%s", command, err, describeOutput(output.String()))
+	}
+
+	logger.Info("Ran hook", fields...)
+
+	return nil
+}
+
+// describeOutput formats the end of a failed hook's output for including in its error, which is
+// where the reason it failed is most likely to be.
+func describeOutput(output string) string {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return ""
+	}
+
+	if len(output) > maxOutput {
+		output = "..." + output[len(output)-maxOutput:]
+	}
+
+	return ": " + output
+}
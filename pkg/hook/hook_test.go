@@ -0,0 +1,104 @@
+//go:build !windows
+// +build !windows
+
+package hook
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/logging"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("should run the command with the given environment", func(t *testing.T) {
+		defer revertStubs()
+
+		osEnviron = func() []string {
+			return []string{"INHERITED=yes"}
+		}
+
+		dir, err := ioutil.TempDir("", "foldup-hook")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		out := filepath.Join(dir, "out")
+		env := Env{"FOLDUP_FOLDER": "photos"}
+
+		err = Run(context.Background(), logging.NewNopLogger(), `echo "$INHERITED $FOLDUP_FOLDER" > `+out, time.Minute, env)
+		assert.OK(t, err)
+
+		data, err := ioutil.ReadFile(out)
+		assert.OK(t, err)
+		assert.Equal(t, "yes photos\n", string(data))
+	})
+
+	t.Run("should not pass on foldup's own options from the environment", func(t *testing.T) {
+		defer revertStubs()
+
+		osEnviron = func() []string {
+			return []string{"FOLDUP_SMTP_PASSWORD=secret", "FOLDUP_FOLDER=other"}
+		}
+
+		dir, err := ioutil.TempDir("", "foldup-hook")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		out := filepath.Join(dir, "out")
+		env := Env{"FOLDUP_FOLDER": "photos"}
+
+		err = Run(context.Background(), logging.NewNopLogger(), `echo "$FOLDUP_SMTP_PASSWORD $FOLDUP_FOLDER" > `+out, time.Minute, env)
+		assert.OK(t, err)
+
+		data, err := ioutil.ReadFile(out)
+		assert.OK(t, err)
+		assert.Equal(t, " photos\n", string(data))
+	})
+
+	t.Run("should return an error including the output if the command fails", func(t *testing.T) {
+		err := Run(context.Background(), logging.NewNopLogger(), "echo 'no database' >&2; exit 3", time.Minute, nil)
+		assert.NotOK(t, err)
+		assert.True(t, strings.Contains(err.Error(), "exit status 3"), "Expected the exit status: "+err.Error())
+		assert.True(t, strings.HasSuffix(err.Error(), ": no database"), "Expected the output: "+err.Error())
+	})
+
+	t.Run("should kill the command, and anything it started, if it times out", func(t *testing.T) {
+		started := time.Now()
+
+		err := Run(context.Background(), logging.NewNopLogger(), "sleep 10 | cat", 50*time.Millisecond, nil)
+		assert.NotOK(t, err)
+		assert.True(t, strings.Contains(err.Error(), "timed out after 50ms"), "Expected a timeout: "+err.Error())
+		assert.True(t, time.Since(started) < 5*time.Second, "Expected the hook to be killed")
+	})
+
+	t.Run("should kill the command if the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := Run(ctx, logging.NewNopLogger(), "sleep 10", time.Minute, nil)
+		assert.NotOK(t, err)
+	})
+}
+
+func TestDescribeOutput(t *testing.T) {
+	t.Run("should return nothing if there's no output", func(t *testing.T) {
+		assert.Equal(t, "", describeOutput(" \n"))
+	})
+
+	t.Run("should keep only the end of long output", func(t *testing.T) {
+		output := strings.Repeat("a", maxOutput) + "the end"
+		described := describeOutput(output)
+
+		assert.True(t, strings.HasPrefix(described, ": ..."), "Expected the output to be truncated")
+		assert.True(t, strings.HasSuffix(described, "the end"), "Expected the end of the output")
+		assert.Equal(t, maxOutput+len(": ..."), len(described))
+	})
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package hook
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand creates a command that runs the given script with sh. It's started in its own
+// process group, so that anything it starts can be killed with it.
+func shellCommand(script string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	return cmd
+}
+
+// kill kills the given command's process group.
+func kill(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package hook
+
+import "os/exec"
+
+// shellCommand creates a command that runs the given script with cmd.
+func shellCommand(script string) *exec.Cmd {
+	return exec.Command("cmd", "/C", script)
+}
+
+// kill kills the given command. Processes it started are left running, because Windows has no
+// process groups to kill them with.
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
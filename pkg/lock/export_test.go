@@ -0,0 +1,7 @@
+package lock
+
+import "time"
+
+func revertStubs() {
+	timeNow = time.Now
+}
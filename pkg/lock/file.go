@@ -0,0 +1,57 @@
+package lock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// FileLocker is a Locker that uses advisory locks on files in a local directory. It only protects
+// against other instances on the same host, or sharing the same directory, e.g. containers that
+// mount the same volume.
+type FileLocker struct {
+	dir string
+}
+
+// NewFileLocker creates a new Locker instance, using FileLocker. Lock files are created in the
+// given directory, which must already exist.
+func NewFileLocker(dir string) Locker {
+	return &FileLocker{
+		dir: dir,
+	}
+}
+
+// Acquire attempts to lock the lock file with the given name. The lock is released by the operating
+// system if the process exits, so it can never be left behind by a crash. Lock files are hidden, and
+// named like foldup's other files, so they're left out of any archive of the directory they're in.
+func (l *FileLocker) Acquire(ctx context.Context, name string) (Lock, bool, error) {
+	file, err := os.OpenFile(filepath.Join(l.dir, ".foldup-"+name+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ok, err := flock(file)
+	if err != nil || !ok {
+		file.Close()
+		return nil, false, err
+	}
+
+	return &fileLock{file: file, lost: make(chan struct{})}, true, nil
+}
+
+// fileLock is a Lock held on an open lock file.
+type fileLock struct {
+	file *os.File
+	lost chan struct{}
+}
+
+// Lost returns a channel that's never closed, because a lock file stays locked until it's closed.
+func (l *fileLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release unlocks the lock file by closing it. The file itself is left in place, because removing
+// it could let two instances lock different files with the same name.
+func (l *fileLock) Release(ctx context.Context) error {
+	return l.file.Close()
+}
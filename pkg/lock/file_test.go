@@ -0,0 +1,73 @@
+//go:build !windows
+// +build !windows
+
+package lock
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestFileLocker_Acquire(t *testing.T) {
+	t.Run("should create and lock a lock file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-lock")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		lock, ok, err := NewFileLocker(dir).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the lock to be acquired")
+
+		defer lock.Release(context.Background())
+
+		_, err = os.Stat(filepath.Join(dir, ".foldup-photos.lock"))
+		assert.OK(t, err)
+	})
+
+	t.Run("should not lock a file that's already locked", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-lock")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		first, ok, err := NewFileLocker(dir).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the first lock to be acquired")
+
+		defer first.Release(context.Background())
+
+		_, ok, err = NewFileLocker(dir).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.False(t, ok, "Expected the second lock not to be acquired")
+	})
+
+	t.Run("should lock a file again once it's released", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-lock")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		locker := NewFileLocker(dir)
+
+		lock, _, err := locker.Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.OK(t, lock.Release(context.Background()))
+
+		lock, ok, err := locker.Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the lock to be acquired again")
+		assert.OK(t, lock.Release(context.Background()))
+	})
+
+	t.Run("should return an error if the directory doesn't exist", func(t *testing.T) {
+		_, ok, err := NewFileLocker("/does/not/exist").Acquire(context.Background(), "photos")
+		assert.NotOK(t, err)
+		assert.False(t, ok, "Expected the lock not to be acquired")
+	})
+}
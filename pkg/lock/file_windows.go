@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package lock
+
+import "os"
+
+// flock isn't implemented on Windows, where the GCS lease locker should be used instead.
+func flock(file *os.File) (bool, error) {
+	return false, ErrNotSupported
+}
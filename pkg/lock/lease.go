@@ -0,0 +1,253 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/storage/gcs"
+	"google.golang.org/api/googleapi"
+)
+
+// LeasePrefix is the prefix of the names of lease objects in a bucket.
+const LeasePrefix = "foldup-locks/"
+
+// For testing
+var timeNow = time.Now
+
+// lease is the content of a lease object.
+type lease struct {
+	// Holder identifies the instance holding the lease.
+	Holder string `json:"holder"`
+	// Expires is when the lease may be taken by another instance, if it isn't renewed.
+	Expires time.Time `json:"expires"`
+}
+
+// LeaseLocker is a Locker that stores leases as objects in a GCS bucket, so it works across hosts.
+// Leases are taken and renewed using generation preconditions, so two instances can never both
+// believe they hold the same lock. A lease that isn't renewed, e.g. because its holder crashed,
+// expires after its TTL, and may then be taken by another instance.
+type LeaseLocker struct {
+	client gcs.Client
+	bucket string
+	holder string
+	ttl    time.Duration
+	logger logging.Logger
+}
+
+// NewLeaseLocker creates a new Locker instance, using LeaseLocker. Leases are held by the given
+// holder, which should be unique to this instance, and last for the given TTL unless renewed. If
+// the TTL isn't positive, DefaultTTL is used.
+func NewLeaseLocker(client gcs.Client, bucket string, holder string, ttl time.Duration, logger logging.Logger) Locker {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	return &LeaseLocker{
+		client: client,
+		bucket: bucket,
+		holder: holder,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// Acquire attempts to take the lease with the given name. Held leases are renewed in the background
+// until they're released.
+func (l *LeaseLocker) Acquire(ctx context.Context, name string) (Lock, bool, error) {
+	object := l.client.Bucket(l.bucket).Object(LeasePrefix + name + ".lock")
+
+	conds, ok, err := l.takeable(ctx, object)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	written := timeNow()
+
+	generation, err := l.write(ctx, object, conds)
+	if isPreconditionFailed(err) {
+		// Someone else took the lease between us reading it, and writing it.
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	lock := &leaseLock{
+		locker:     l,
+		object:     object,
+		name:       name,
+		generation: generation,
+		expires:    written.Add(l.ttl),
+		stop:       make(chan struct{}),
+		lost:       make(chan struct{}),
+	}
+
+	lock.wg.Add(1)
+	go lock.renew()
+
+	return lock, true, nil
+}
+
+// takeable checks if the given lease object may be taken, returning the conditions that must still
+// hold when it's written for it to be taken safely.
+func (l *LeaseLocker) takeable(ctx context.Context, object gcs.Object) (storage.Conditions, bool, error) {
+	attrs, err := object.Attrs(ctx)
+	if err == storage.ErrObjectNotExist {
+		return storage.Conditions{DoesNotExist: true}, true, nil
+	}
+
+	if err != nil {
+		return storage.Conditions{}, false, err
+	}
+
+	conds := storage.Conditions{GenerationMatch: attrs.Generation}
+
+	reader, err := object.If(conds).NewReader(ctx)
+	if err == storage.ErrObjectNotExist || isPreconditionFailed(err) {
+		// The lease changed since we looked at it, so it's probably just been taken.
+		return storage.Conditions{}, false, nil
+	}
+
+	if err != nil {
+		return storage.Conditions{}, false, err
+	}
+
+	defer reader.Close()
+
+	var current lease
+
+	// A lease that can't be read is treated as expired, otherwise it would block everyone forever.
+	if json.NewDecoder(reader).Decode(&current) == nil {
+		if current.Holder != l.holder && current.Expires.After(timeNow()) {
+			return storage.Conditions{}, false, nil
+		}
+	}
+
+	return conds, true, nil
+}
+
+// write writes a new lease, expiring one TTL from now, to the given object if the given conditions
+// hold. The generation of the new lease object is returned.
+func (l *LeaseLocker) write(ctx context.Context, object gcs.Object, conds storage.Conditions) (int64, error) {
+	data, err := json.Marshal(lease{
+		Holder:  l.holder,
+		Expires: timeNow().Add(l.ttl),
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	writer := object.If(conds).NewWriteCloser(ctx)
+
+	_, err = writer.Write(data)
+	if err != nil {
+		writer.Close()
+		return 0, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	// Nobody else may replace the lease until it expires, so it's safe to read its generation back.
+	attrs, err := object.Attrs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return attrs.Generation, nil
+}
+
+// leaseLock is a Lock held as a lease in a GCS bucket.
+type leaseLock struct {
+	locker     *LeaseLocker
+	object     gcs.Object
+	name       string
+	generation int64
+	expires    time.Time
+	stop       chan struct{}
+	lost       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Lost returns a channel that's closed if the lease is taken by another instance, or expires before
+// it can be renewed.
+func (l *leaseLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// renew renews the lease every third of its TTL, until the lock is released. If renewing fails,
+// it's retried on the next tick, which leaves time for a couple of attempts before the lease
+// expires. If the lease is lost, renewing stops.
+func (l *leaseLock) renew() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.locker.ttl / 3)
+	defer ticker.Stop()
+
+	logger := l.locker.logger.With(logging.F("lock", l.name))
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		written := timeNow()
+
+		generation, err := l.locker.write(context.Background(), l.object, storage.Conditions{
+			GenerationMatch: l.generation,
+		})
+
+		if isPreconditionFailed(err) {
+			logger.Error("Lost lock, it was taken by another instance")
+			close(l.lost)
+			return
+		}
+
+		if err != nil && !timeNow().Before(l.expires) {
+			logger.Error("Lost lock, it expired before it could be renewed", logging.Err(err))
+			close(l.lost)
+			return
+		}
+
+		if err != nil {
+			logger.Warn("Failed to renew lock", logging.Err(err))
+			continue
+		}
+
+		l.generation = generation
+		l.expires = written.Add(l.locker.ttl)
+	}
+}
+
+// Release stops renewing the lease, and deletes it, as long as it hasn't been taken by another
+// instance in the meantime.
+func (l *leaseLock) Release(ctx context.Context) error {
+	close(l.stop)
+	l.wg.Wait()
+
+	err := l.object.If(storage.Conditions{GenerationMatch: l.generation}).Delete(ctx)
+	if isPreconditionFailed(err) {
+		return errors.New("lock: lease was taken by another instance before it was released")
+	}
+
+	return err
+}
+
+// isPreconditionFailed checks if the given error means that an object's preconditions weren't met.
+func isPreconditionFailed(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+
+	return ok && apiErr.Code == http.StatusPreconditionFailed
+}
@@ -0,0 +1,366 @@
+package lock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/storage/gcs"
+	"google.golang.org/api/googleapi"
+)
+
+func TestLeaseLocker_Acquire(t *testing.T) {
+	t.Run("should take a lease that doesn't exist", func(t *testing.T) {
+		bucket := newTestBucket()
+		locker := newTestLeaseLocker(bucket, "a", time.Minute)
+
+		lock, ok, err := locker.Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the lock to be acquired")
+
+		defer lock.Release(context.Background())
+
+		held := bucket.lease(t, LeasePrefix+"photos.lock")
+		assert.Equal(t, "a", held.Holder)
+	})
+
+	t.Run("should not take a lease held by someone else", func(t *testing.T) {
+		bucket := newTestBucket()
+
+		first, ok, err := newTestLeaseLocker(bucket, "a", time.Minute).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the first lock to be acquired")
+
+		defer first.Release(context.Background())
+
+		_, ok, err = newTestLeaseLocker(bucket, "b", time.Minute).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.False(t, ok, "Expected the second lock not to be acquired")
+	})
+
+	t.Run("should take a lease that has expired", func(t *testing.T) {
+		defer revertStubs()
+
+		bucket := newTestBucket()
+
+		_, ok, err := newTestLeaseLocker(bucket, "a", time.Hour).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the first lock to be acquired")
+
+		// The first holder has "crashed", without releasing its lease.
+		timeNow = func() time.Time {
+			return time.Now().Add(2 * time.Hour)
+		}
+
+		lock, ok, err := newTestLeaseLocker(bucket, "b", time.Hour).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the expired lease to be taken")
+
+		defer lock.Release(context.Background())
+
+		held := bucket.lease(t, LeasePrefix+"photos.lock")
+		assert.Equal(t, "b", held.Holder)
+	})
+
+	t.Run("should not take a lease if it changes before it's written", func(t *testing.T) {
+		bucket := newTestBucket()
+		bucket.beforeWrite = func() {
+			// Another instance sneaks in, and takes the lease first.
+			bucket.put(LeasePrefix+"photos.lock", []byte(`{"holder":"b"}`))
+		}
+
+		_, ok, err := newTestLeaseLocker(bucket, "a", time.Minute).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.False(t, ok, "Expected the lock not to be acquired")
+	})
+
+	t.Run("should return an error if the lease can't be read", func(t *testing.T) {
+		bucket := newTestBucket()
+		bucket.attrsErr = errors.New("oops")
+
+		_, ok, err := newTestLeaseLocker(bucket, "a", time.Minute).Acquire(context.Background(), "photos")
+		assert.NotOK(t, err)
+		assert.False(t, ok, "Expected the lock not to be acquired")
+	})
+
+	t.Run("should renew the lease while it's held", func(t *testing.T) {
+		bucket := newTestBucket()
+
+		lock, ok, err := newTestLeaseLocker(bucket, "a", 30*time.Millisecond).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the lock to be acquired")
+
+		time.Sleep(50 * time.Millisecond)
+
+		err = lock.Release(context.Background())
+		assert.OK(t, err)
+
+		assert.True(t, bucket.renewed > 0, "Expected the lease to be renewed")
+
+		select {
+		case <-lock.Lost():
+			t.Error("Expected the lock not to be lost")
+		default:
+		}
+	})
+
+	t.Run("should report the lock as lost if the lease is taken by someone else", func(t *testing.T) {
+		bucket := newTestBucket()
+
+		lock, _, err := newTestLeaseLocker(bucket, "a", 30*time.Millisecond).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+
+		bucket.put(LeasePrefix+"photos.lock", []byte(`{"holder":"b"}`))
+
+		select {
+		case <-lock.Lost():
+		case <-time.After(time.Second):
+			t.Fatal("Expected the lock to be lost")
+		}
+
+		assert.NotOK(t, lock.Release(context.Background()))
+	})
+
+	t.Run("should report the lock as lost if the lease expires before it can be renewed", func(t *testing.T) {
+		bucket := newTestBucket()
+
+		lock, _, err := newTestLeaseLocker(bucket, "a", 30*time.Millisecond).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+
+		bucket.Lock()
+		bucket.attrsErr = errors.New("oops")
+		bucket.Unlock()
+
+		select {
+		case <-lock.Lost():
+		case <-time.After(time.Second):
+			t.Fatal("Expected the lock to be lost")
+		}
+	})
+}
+
+func TestLeaseLock_Release(t *testing.T) {
+	t.Run("should delete the lease", func(t *testing.T) {
+		bucket := newTestBucket()
+
+		lock, _, err := newTestLeaseLocker(bucket, "a", time.Minute).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+
+		err = lock.Release(context.Background())
+		assert.OK(t, err)
+
+		assert.Equal(t, int64(0), bucket.generation(LeasePrefix+"photos.lock"))
+	})
+
+	t.Run("should let the lock be taken again once released", func(t *testing.T) {
+		bucket := newTestBucket()
+
+		lock, _, err := newTestLeaseLocker(bucket, "a", time.Minute).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.OK(t, lock.Release(context.Background()))
+
+		lock, ok, err := newTestLeaseLocker(bucket, "b", time.Minute).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected the lock to be acquired again")
+		assert.OK(t, lock.Release(context.Background()))
+	})
+
+	t.Run("should return an error if the lease was taken by someone else", func(t *testing.T) {
+		bucket := newTestBucket()
+
+		lock, _, err := newTestLeaseLocker(bucket, "a", time.Minute).Acquire(context.Background(), "photos")
+		assert.OK(t, err)
+
+		bucket.put(LeasePrefix+"photos.lock", []byte(`{"holder":"b"}`))
+
+		err = lock.Release(context.Background())
+		assert.NotOK(t, err)
+		assert.Equal(t, "b", bucket.lease(t, LeasePrefix+"photos.lock").Holder)
+	})
+}
+
+func newTestLeaseLocker(bucket *testBucket, holder string, ttl time.Duration) Locker {
+	return NewLeaseLocker(&testClient{bucket: bucket}, "bucket", holder, ttl, logging.NewNopLogger())
+}
+
+type testClient struct {
+	bucket *testBucket
+}
+
+func (c *testClient) Bucket(name string) gcs.Bucket {
+	return c.bucket
+}
+
+type testStoredObject struct {
+	data       []byte
+	generation int64
+}
+
+// testBucket is an in-memory bucket that enforces object preconditions like GCS does.
+type testBucket struct {
+	sync.Mutex
+
+	objects     map[string]testStoredObject
+	generations int64
+	renewed     int
+	attrsErr    error
+	beforeWrite func()
+}
+
+func newTestBucket() *testBucket {
+	return &testBucket{
+		objects: make(map[string]testStoredObject),
+	}
+}
+
+func (b *testBucket) Attrs(ctx context.Context) (*storage.BucketAttrs, error) {
+	return &storage.BucketAttrs{}, nil
+}
+
+func (b *testBucket) Object(name string) gcs.Object {
+	return &testObject{bucket: b, name: name}
+}
+
+func (b *testBucket) Objects(ctx context.Context, prefix string) ([]*storage.ObjectAttrs, error) {
+	return nil, nil
+}
+
+func (b *testBucket) put(name string, data []byte) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.generations++
+	b.objects[name] = testStoredObject{data: data, generation: b.generations}
+}
+
+func (b *testBucket) generation(name string) int64 {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.objects[name].generation
+}
+
+func (b *testBucket) lease(t *testing.T, name string) lease {
+	b.Lock()
+	defer b.Unlock()
+
+	var l lease
+	assert.OK(t, json.Unmarshal(b.objects[name].data, &l))
+
+	return l
+}
+
+// check verifies the given conditions against the named object. The bucket must be locked.
+func (b *testBucket) check(name string, conds storage.Conditions) error {
+	current, exists := b.objects[name]
+
+	if conds.DoesNotExist && exists {
+		return &googleapi.Error{Code: http.StatusPreconditionFailed}
+	}
+
+	if conds.GenerationMatch != 0 && conds.GenerationMatch != current.generation {
+		return &googleapi.Error{Code: http.StatusPreconditionFailed}
+	}
+
+	return nil
+}
+
+type testObject struct {
+	bucket *testBucket
+	name   string
+	conds  storage.Conditions
+}
+
+func (o *testObject) NewWriteCloser(ctx context.Context) io.WriteCloser {
+	return &testWriter{object: o}
+}
+
+func (o *testObject) NewReader(ctx context.Context) (io.ReadCloser, error) {
+	o.bucket.Lock()
+	defer o.bucket.Unlock()
+
+	current, exists := o.bucket.objects[o.name]
+	if !exists {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	if err := o.bucket.check(o.name, o.conds); err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(current.data)), nil
+}
+
+func (o *testObject) Attrs(ctx context.Context) (*storage.ObjectAttrs, error) {
+	o.bucket.Lock()
+	defer o.bucket.Unlock()
+
+	if o.bucket.attrsErr != nil {
+		return nil, o.bucket.attrsErr
+	}
+
+	current, exists := o.bucket.objects[o.name]
+	if !exists {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	return &storage.ObjectAttrs{Name: o.name, Generation: current.generation}, nil
+}
+
+func (o *testObject) Delete(ctx context.Context) error {
+	o.bucket.Lock()
+	defer o.bucket.Unlock()
+
+	if err := o.bucket.check(o.name, o.conds); err != nil {
+		return err
+	}
+
+	delete(o.bucket.objects, o.name)
+
+	return nil
+}
+
+func (o *testObject) If(conds storage.Conditions) gcs.Object {
+	return &testObject{bucket: o.bucket, name: o.name, conds: conds}
+}
+
+type testWriter struct {
+	bytes.Buffer
+
+	object *testObject
+}
+
+func (w *testWriter) Close() error {
+	bucket := w.object.bucket
+
+	if bucket.beforeWrite != nil {
+		bucket.beforeWrite()
+		bucket.beforeWrite = nil
+	}
+
+	bucket.Lock()
+	defer bucket.Unlock()
+
+	if err := bucket.check(w.object.name, w.object.conds); err != nil {
+		return err
+	}
+
+	if w.object.conds.GenerationMatch != 0 {
+		bucket.renewed++
+	}
+
+	bucket.generations++
+	bucket.objects[w.object.name] = testStoredObject{data: w.Bytes(), generation: bucket.generations}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultTTL is how long leases last for if they aren't renewed, unless a TTL is given.
+const DefaultTTL = 5 * time.Minute
+
+// Kind identifies a type of Locker.
+type Kind string
+
+// The kinds of Locker available.
+const (
+	// KindGCS stores leases in a GCS bucket, so only one instance on any host holds a lock.
+	KindGCS Kind = "gcs"
+	// KindFile locks files in a local directory, so only one instance on the same host holds a lock.
+	KindFile Kind = "file"
+)
+
+// ParseKind returns the kind of Locker with the given name. An empty name gives an empty Kind, which
+// means that no locking should be done.
+func ParseKind(name string) (Kind, error) {
+	switch Kind(name) {
+	case "", KindGCS, KindFile:
+		return Kind(name), nil
+	}
+
+	return "", fmt.Errorf("lock: unknown lock type '%s', expected one of: gcs, file", name)
+}
+
+// ErrNotSupported is returned by lockers that can't work on the current platform.
+var ErrNotSupported = errors.New("lock: locking isn't supported on this platform")
+
+// Locker hands out named locks, so that only one instance of foldup does something at a time, even
+// when several are running.
+type Locker interface {
+	// Acquire attempts to take the lock with the given name, without waiting for it. If another
+	// holder already has the lock, ok is false, and no error is returned.
+	Acquire(ctx context.Context, name string) (lock Lock, ok bool, err error)
+}
+
+// ErrLost is the error given when a lock is lost while it's still needed.
+var ErrLost = errors.New("lock: lock was lost before the run finished, another instance may have taken it")
+
+// Lock is a lock that's currently held.
+type Lock interface {
+	// Lost returns a channel that's closed if the lock is lost before it's released, e.g. because
+	// another instance took it. Anything done while holding the lock should stop once it's lost.
+	Lost() <-chan struct{}
+	// Release gives up the lock, so that others may take it.
+	Release(ctx context.Context) error
+}
+
+// Name turns the given string, e.g. a job name, into a lock name that's safe to use in file and
+// object names.
+func Name(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+
+		return '_'
+	}, s)
+
+	return strings.Trim(name, ".")
+}
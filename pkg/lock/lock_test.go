@@ -0,0 +1,36 @@
+package lock
+
+import (
+	"testing"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestName(t *testing.T) {
+	t.Run("should leave safe names alone", func(t *testing.T) {
+		assert.Equal(t, "photos-2017.v1", Name("photos-2017.v1"))
+	})
+
+	t.Run("should replace unsafe characters", func(t *testing.T) {
+		assert.Equal(t, "my_bucket_photos", Name("my bucket/photos"))
+	})
+
+	t.Run("should not allow relative path names", func(t *testing.T) {
+		assert.Equal(t, "_photos", Name("../photos"))
+	})
+}
+
+func TestParseKind(t *testing.T) {
+	t.Run("should parse known kinds", func(t *testing.T) {
+		for _, kind := range []Kind{"", KindGCS, KindFile} {
+			parsed, err := ParseKind(string(kind))
+			assert.OK(t, err)
+			assert.Equal(t, kind, parsed)
+		}
+	})
+
+	t.Run("should return an error for unknown kinds", func(t *testing.T) {
+		_, err := ParseKind("redis")
+		assert.NotOK(t, err)
+	})
+}
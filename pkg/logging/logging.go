@@ -0,0 +1,350 @@
+// Package logging provides a structured, levelled logger, so that backup events can be indexed and
+// alerted on by log pipelines. Log entries are written as either JSON or logfmt.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// For testing
+var timeNow = time.Now
+
+// Level is the severity of a log entry.
+type Level int
+
+// The levels log entries can be written at, in order of increasing severity.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+
+	return levelNames[l]
+}
+
+// ParseLevel returns the Level with the given name.
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return Level(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("logging: unknown level '%s', expected one of: %s", name, strings.Join(levelNames, ", "))
+}
+
+// Format is the encoding used to write log entries.
+type Format string
+
+// The formats log entries can be written in.
+const (
+	FormatLogfmt Format = "logfmt"
+	FormatJSON   Format = "json"
+)
+
+// ParseFormat returns the Format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case FormatLogfmt:
+		return FormatLogfmt, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+
+	return "", fmt.Errorf("logging: unknown format '%s', expected one of: logfmt, json", name)
+}
+
+// Config describes how to create a Logger.
+type Config struct {
+	// Format is the name of the format to write log entries in.
+	Format string
+	// Level is the name of the minimum level of log entries to write.
+	Level string
+}
+
+// Field is a key and value attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// The keys of fields that are used consistently across foldup's log entries.
+const (
+	KeyRunID    = "run_id"
+	KeyFolder   = "folder"
+	KeyArchive  = "archive"
+	KeyBytes    = "bytes"
+	KeyDuration = "duration"
+	KeyError    = "error"
+)
+
+// F creates a Field with the given key and value.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// RunID creates a Field identifying a backup run.
+func RunID(id string) Field {
+	return F(KeyRunID, id)
+}
+
+// Folder creates a Field identifying a folder being backed up.
+func Folder(name string) Field {
+	return F(KeyFolder, name)
+}
+
+// Archive creates a Field identifying an archive.
+func Archive(name string) Field {
+	return F(KeyArchive, name)
+}
+
+// Bytes creates a Field holding a number of bytes.
+func Bytes(n int64) Field {
+	return F(KeyBytes, n)
+}
+
+// Duration creates a Field holding how long something took.
+func Duration(d time.Duration) Field {
+	return F(KeyDuration, d)
+}
+
+// Err creates a Field holding an error.
+func Err(err error) Field {
+	return F(KeyError, err)
+}
+
+// Logger writes structured log entries.
+type Logger interface {
+	// Debug writes an entry at the debug level.
+	Debug(msg string, fields ...Field)
+	// Info writes an entry at the info level.
+	Info(msg string, fields ...Field)
+	// Warn writes an entry at the warn level.
+	Warn(msg string, fields ...Field)
+	// Error writes an entry at the error level.
+	Error(msg string, fields ...Field)
+	// With returns a Logger that adds the given fields to every entry.
+	With(fields ...Field) Logger
+}
+
+// writer is shared between a logger and those derived from it using With, so that entries written
+// concurrently aren't interleaved.
+type writer struct {
+	sync.Mutex
+	io.Writer
+}
+
+// logger is the default implementation of Logger.
+type logger struct {
+	out    *writer
+	format Format
+	level  Level
+	fields []Field
+}
+
+// NewLogger creates a new Logger, writing entries at or above the given level to `w`.
+func NewLogger(w io.Writer, format Format, level Level) Logger {
+	return &logger{
+		out:    &writer{Writer: w},
+		format: format,
+		level:  level,
+	}
+}
+
+// NewLoggerFromConfig creates a new Logger writing to `w`, as described by the given config. Empty
+// config values default to the logfmt format, and info level.
+func NewLoggerFromConfig(w io.Writer, config Config) (Logger, error) {
+	format, level := FormatLogfmt, LevelInfo
+
+	var err error
+	if config.Format != "" {
+		format, err = ParseFormat(config.Format)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Level != "" {
+		level, err = ParseLevel(config.Level)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewLogger(w, format, level), nil
+}
+
+// NewNopLogger creates a Logger that discards everything.
+func NewNopLogger() Logger {
+	return NewLogger(ioutil.Discard, FormatLogfmt, LevelError+1)
+}
+
+func (l *logger) Debug(msg string, fields ...Field) {
+	l.log(LevelDebug, msg, fields)
+}
+
+func (l *logger) Info(msg string, fields ...Field) {
+	l.log(LevelInfo, msg, fields)
+}
+
+func (l *logger) Warn(msg string, fields ...Field) {
+	l.log(LevelWarn, msg, fields)
+}
+
+func (l *logger) Error(msg string, fields ...Field) {
+	l.log(LevelError, msg, fields)
+}
+
+func (l *logger) With(fields ...Field) Logger {
+	derived := *l
+	derived.fields = append(append([]Field{}, l.fields...), fields...)
+
+	return &derived
+}
+
+func (l *logger) log(level Level, msg string, fields []Field) {
+	if level < l.level {
+		return
+	}
+
+	all := []Field{
+		F("time", timeNow().UTC().Format(time.RFC3339Nano)),
+		F("level", level.String()),
+		F("msg", msg),
+	}
+
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+
+	var entry []byte
+	if l.format == FormatJSON {
+		entry = encodeJSON(all)
+	} else {
+		entry = encodeLogfmt(all)
+	}
+
+	l.out.Lock()
+	defer l.out.Unlock()
+
+	l.out.Write(entry)
+}
+
+// encodeJSON encodes fields as a JSON object on a single line, keeping the order of the fields.
+func encodeJSON(fields []Field) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(f.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		value, err := json.Marshal(jsonValue(f.Value))
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f.Value))
+		}
+
+		buf.Write(value)
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+// jsonValue converts values that don't encode usefully as JSON.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.Seconds()
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	return value
+}
+
+// encodeLogfmt encodes fields as space separated key=value pairs on a single line.
+func encodeLogfmt(fields []Field) []byte {
+	buf := &bytes.Buffer{}
+
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(f.Value))
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+// logfmtValue formats a value for logfmt, quoting it if necessary.
+func logfmtValue(value interface{}) string {
+	var s string
+
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+type contextKey struct{}
+
+// WithFields returns a copy of the context carrying the given fields, in addition to any it already
+// carries. Loggers retrieved with FromContext add these fields to every entry.
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	existing, _ := ctx.Value(contextKey{}).([]Field)
+
+	return context.WithValue(ctx, contextKey{}, append(append([]Field{}, existing...), fields...))
+}
+
+// FromContext returns the given Logger, adding any fields carried by the context.
+func FromContext(ctx context.Context, logger Logger) Logger {
+	fields, _ := ctx.Value(contextKey{}).([]Field)
+	if len(fields) == 0 {
+		return logger
+	}
+
+	return logger.With(fields...)
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+)
+
+func revertStubs() {
+	timeNow = time.Now
+}
+
+func stubTimeNow() {
+	timeNow = func() time.Time {
+		return time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Run("should parse level names", func(t *testing.T) {
+		level, err := ParseLevel("WARN")
+
+		assert.OK(t, err)
+		assert.Equal(t, LevelWarn, level)
+	})
+
+	t.Run("should error if given an unknown level", func(t *testing.T) {
+		_, err := ParseLevel("loud")
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestNewLoggerFromConfig(t *testing.T) {
+	t.Run("should default to logfmt at the info level", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+
+		logger, err := NewLoggerFromConfig(buf, Config{})
+		assert.OK(t, err)
+
+		logger.Debug("hidden")
+		logger.Info("shown")
+
+		assert.True(t, bytes.Contains(buf.Bytes(), []byte("msg=shown")), "Expected info entry in logfmt")
+		assert.False(t, bytes.Contains(buf.Bytes(), []byte("hidden")), "Expected debug entry to be hidden")
+	})
+
+	t.Run("should error if given an unknown format", func(t *testing.T) {
+		_, err := NewLoggerFromConfig(&bytes.Buffer{}, Config{Format: "xml"})
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("should write logfmt entries with fields", func(t *testing.T) {
+		defer revertStubs()
+		stubTimeNow()
+
+		buf := &bytes.Buffer{}
+		logger := NewLogger(buf, FormatLogfmt, LevelDebug).With(RunID("abc"))
+
+		logger.Error("Upload failed", Archive("backup-photos-1.tar.gz"), Bytes(10), Err(errors.New("bad thing")))
+
+		expected := `time=2018-01-02T03:04:05Z level=error msg="Upload failed" run_id=abc ` +
+			`archive=backup-photos-1.tar.gz bytes=10 error="bad thing"` + "\n"
+
+		assert.Equal(t, expected, buf.String())
+	})
+
+	t.Run("should write JSON entries with fields", func(t *testing.T) {
+		defer revertStubs()
+		stubTimeNow()
+
+		buf := &bytes.Buffer{}
+		logger := NewLogger(buf, FormatJSON, LevelInfo)
+
+		logger.Info("Archived folder", Folder("photos"), Duration(1500*time.Millisecond))
+
+		expected := `{"time":"2018-01-02T03:04:05Z","level":"info","msg":"Archived folder",` +
+			`"folder":"photos","duration":1.5}` + "\n"
+
+		assert.Equal(t, expected, buf.String())
+
+		var entry map[string]interface{}
+		assert.OK(t, json.Unmarshal(buf.Bytes(), &entry))
+	})
+
+	t.Run("should not modify the parent logger when adding fields", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		parent := NewLogger(buf, FormatLogfmt, LevelInfo)
+
+		parent.With(Folder("photos"))
+		parent.Info("hello")
+
+		assert.False(t, bytes.Contains(buf.Bytes(), []byte("folder")), "Expected parent to have no fields")
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	t.Run("should add fields carried by the context", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := NewLogger(buf, FormatLogfmt, LevelInfo)
+
+		ctx := WithFields(context.Background(), RunID("abc"))
+		ctx = WithFields(ctx, Folder("photos"))
+
+		FromContext(ctx, logger).Info("hello")
+
+		assert.True(t, bytes.Contains(buf.Bytes(), []byte("run_id=abc folder=photos")), "Expected context fields")
+	})
+}
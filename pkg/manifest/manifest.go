@@ -0,0 +1,96 @@
+// Package manifest describes the files in each archive, in a small index stored alongside it, so
+// that the files in every archive in a bucket can be searched without downloading the archives.
+package manifest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/archive"
+)
+
+// Prefix is the prefix of the names of stored manifests, keeping them apart from archives.
+const Prefix = "foldup-manifests/"
+
+// Suffix is appended to the name of an archive to name its manifest.
+const Suffix = ".json.gz"
+
+// Entry describes a single file in an archive.
+type Entry struct {
+	// Path is the path of the file in the archive.
+	Path string `json:"path"`
+	// Size is the size of the file, in bytes.
+	Size int64 `json:"size"`
+	// ModTime is when the file was last modified, before it was archived.
+	ModTime time.Time `json:"mtime"`
+}
+
+// Name returns the name the manifest of the archive stored under the given name is stored under.
+func Name(object string) string {
+	return Prefix + strings.TrimPrefix(object, "/") + Suffix
+}
+
+// IsManifest checks if the object with the given name is a manifest.
+func IsManifest(name string) bool {
+	return strings.HasPrefix(name, Prefix)
+}
+
+// Build reads the archive in the given format from in, and writes a manifest of the files in it to
+// out. Manifests are gzipped, with a JSON encoded Entry on each line, so they can be read a file at
+// a time. The number of files in the manifest is returned.
+func Build(out io.Writer, in io.Reader, format archive.FormatName) (int, error) {
+	gw := gzip.NewWriter(out)
+	enc := json.NewEncoder(gw)
+
+	files := 0
+
+	err := archive.Read(in, format, func(entry archive.Entry, contents io.Reader) error {
+		files++
+
+		return enc.Encode(Entry{
+			Path:    entry.Name,
+			Size:    entry.Size,
+			ModTime: entry.ModTime.UTC(),
+		})
+	})
+
+	if err != nil {
+		return files, err
+	}
+
+	return files, gw.Close()
+}
+
+// Read reads the manifest from in, calling fn for each file in it. If fn returns an error, reading
+// stops, and the error is returned.
+func Read(in io.Reader, fn func(entry Entry) error) error {
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("manifest: can't read manifest: %v", err)
+	}
+
+	defer gr.Close()
+
+	scanner := bufio.NewScanner(gr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var entry Entry
+
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return fmt.Errorf("manifest: can't decode entry: %v", err)
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,106 @@
+package manifest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/archive"
+)
+
+// createTestArchive creates a gzipped tarball holding files with the given names and contents.
+func createTestArchive(t *testing.T, files ...string) []byte {
+	buf := &bytes.Buffer{}
+
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+
+	for _, name := range files {
+		assert.OK(t, tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(name)),
+			ModTime: time.Date(2017, 7, 11, 9, 30, 0, 0, time.UTC),
+		}))
+
+		_, err := tw.Write([]byte(name))
+		assert.OK(t, err)
+	}
+
+	assert.OK(t, tw.Close())
+	assert.OK(t, gw.Close())
+
+	return buf.Bytes()
+}
+
+func TestName(t *testing.T) {
+	t.Run("should name manifests after their archive", func(t *testing.T) {
+		assert.Equal(t, "foldup-manifests/backup/backup-photos-1500000000.tar.gz.json.gz", Name("/backup/backup-photos-1500000000.tar.gz"))
+		assert.Equal(t, "foldup-manifests/backup-photos-1500000000.tar.gz.json.gz", Name("backup-photos-1500000000.tar.gz"))
+	})
+
+	t.Run("should tell manifests apart from archives", func(t *testing.T) {
+		assert.True(t, IsManifest(Name("backup-photos-1500000000.tar.gz")), "Expected a manifest")
+		assert.False(t, IsManifest("backup-photos-1500000000.tar.gz"), "Expected an archive")
+	})
+}
+
+func TestBuild(t *testing.T) {
+	t.Run("should describe each file in the archive", func(t *testing.T) {
+		in := bytes.NewReader(createTestArchive(t, "/srv/app/etc/app.yml", "/srv/app/data/db.bin"))
+		out := &bytes.Buffer{}
+
+		files, err := Build(out, in, archive.TarGz)
+		assert.OK(t, err)
+		assert.Equal(t, 2, files)
+
+		entries := []Entry{}
+
+		err = Read(out, func(entry Entry) error {
+			entries = append(entries, entry)
+			return nil
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, []Entry{
+			{Path: "/srv/app/etc/app.yml", Size: 20, ModTime: time.Date(2017, 7, 11, 9, 30, 0, 0, time.UTC)},
+			{Path: "/srv/app/data/db.bin", Size: 20, ModTime: time.Date(2017, 7, 11, 9, 30, 0, 0, time.UTC)},
+		}, entries)
+	})
+
+	t.Run("should error if the archive can't be read", func(t *testing.T) {
+		_, err := Build(&bytes.Buffer{}, bytes.NewBufferString("nope"), archive.TarGz)
+		assert.NotOK(t, err)
+	})
+}
+
+func TestRead(t *testing.T) {
+	t.Run("should stop reading if the function returns an error", func(t *testing.T) {
+		out := &bytes.Buffer{}
+
+		_, err := Build(out, bytes.NewReader(createTestArchive(t, "a", "b")), archive.TarGz)
+		assert.OK(t, err)
+
+		calls := 0
+
+		err = Read(out, func(entry Entry) error {
+			calls++
+			return errors.New("oops")
+		})
+
+		assert.NotOK(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should error if the manifest is corrupt", func(t *testing.T) {
+		err := Read(bytes.NewBufferString("nope"), func(entry Entry) error {
+			return nil
+		})
+
+		assert.NotOK(t, err)
+	})
+}
@@ -0,0 +1,228 @@
+// Package metrics provides a small registry of counters and gauges that can be exposed over HTTP in
+// the Prometheus text exposition format. It intentionally supports only what foldup needs, rather
+// than pulling in the whole Prometheus client library.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types, as they appear in the exposition format.
+const (
+	TypeCounter = "counter"
+	TypeGauge   = "gauge"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds a set of metrics, and can write them out in the Prometheus text format.
+type Registry struct {
+	sync.Mutex
+
+	metrics []*Metric
+}
+
+// NewRegistry creates a new, empty, Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounter registers a new counter, a value that only ever goes up, with the given name, help
+// text, and label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Metric {
+	return r.register(name, help, TypeCounter, labels)
+}
+
+// NewGauge registers a new gauge, a value that can go up and down, with the given name, help text,
+// and label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Metric {
+	return r.register(name, help, TypeGauge, labels)
+}
+
+func (r *Registry) register(name, help, kind string, labels []string) *Metric {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, m := range r.metrics {
+		if m.name == name {
+			panic(fmt.Errorf("metrics: cannot register metric '%s' more than once", name))
+		}
+	}
+
+	metric := &Metric{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: make(map[string]*sample),
+	}
+
+	r.metrics = append(r.metrics, metric)
+
+	return metric
+}
+
+// WriteTo writes all registered metrics to the given writer, in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.Lock()
+	metrics := append([]*Metric{}, r.metrics...)
+	r.Unlock()
+
+	sort.Sort(byName(metrics))
+
+	buf := &bytes.Buffer{}
+	for _, m := range metrics {
+		m.writeTo(buf)
+	}
+
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP exposes the registered metrics over HTTP.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteTo(w)
+}
+
+// Metric is a named counter or gauge, which may have many values, one for each combination of
+// label values.
+type Metric struct {
+	sync.Mutex
+
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]*sample
+}
+
+// sample is a single value of a metric, for a particular set of label values.
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// Add adds the given value to the metric with the given label values. Counters may only be
+// increased, so adding a negative value to a counter will panic.
+func (m *Metric) Add(value float64, labelValues ...string) {
+	if m.kind == TypeCounter && value < 0 {
+		panic(fmt.Errorf("metrics: counter '%s' cannot decrease", m.name))
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.sample(labelValues).value += value
+}
+
+// Inc increments the metric with the given label values by one.
+func (m *Metric) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+// Set sets the value of the metric with the given label values. It should only be used on gauges.
+func (m *Metric) Set(value float64, labelValues ...string) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.sample(labelValues).value = value
+}
+
+// Value returns the current value of the metric with the given label values.
+func (m *Metric) Value(labelValues ...string) float64 {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.sample(labelValues).value
+}
+
+// sample finds, or creates, the sample for the given label values. The lock must be held.
+func (m *Metric) sample(labelValues []string) *sample {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Errorf("metrics: metric '%s' expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := m.values[key]
+	if !ok {
+		s = &sample{labelValues: labelValues}
+		m.values[key] = s
+	}
+
+	return s
+}
+
+func (m *Metric) writeTo(buf *bytes.Buffer) {
+	m.Lock()
+	defer m.Unlock()
+
+	fmt.Fprintf(buf, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.kind)
+
+	keys := []string{}
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.values[key]
+
+		buf.WriteString(m.name)
+
+		if len(m.labels) > 0 {
+			pairs := []string{}
+			for i, label := range m.labels {
+				pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label, escapeLabelValue(s.labelValues[i])))
+			}
+
+			fmt.Fprintf(buf, "{%s}", strings.Join(pairs, ","))
+		}
+
+		fmt.Fprintf(buf, " %s\n", formatValue(s.value))
+	}
+}
+
+// byName sorts metrics by their name.
+type byName []*Metric
+
+func (m byName) Len() int           { return len(m) }
+func (m byName) Less(i, j int) bool { return m[i].name < m[j].name }
+func (m byName) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,91 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/metrics"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	t.Run("should write metrics in the text exposition format, sorted by name", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+
+		gauge := registry.NewGauge("test_gauge", "A test gauge.", "folder")
+		counter := registry.NewCounter("test_counter", "A test counter.")
+
+		gauge.Set(1.5, "b")
+		gauge.Set(2, "a\"quoted\"")
+		counter.Inc()
+		counter.Add(2)
+
+		buf := &bytes.Buffer{}
+		_, err := registry.WriteTo(buf)
+		assert.OK(t, err)
+
+		expected := `# HELP test_counter A test counter.
+# TYPE test_counter counter
+test_counter 3
+# HELP test_gauge A test gauge.
+# TYPE test_gauge gauge
+test_gauge{folder="a\"quoted\""} 2
+test_gauge{folder="b"} 1.5
+`
+
+		assert.Equal(t, expected, buf.String())
+	})
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	t.Run("should serve metrics with the right content type", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		registry.NewGauge("test_gauge", "A test gauge.").Set(42)
+
+		rec := httptest.NewRecorder()
+		registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+		assert.Equal(t, metrics.ContentType, rec.Header().Get("Content-Type"))
+		assert.True(t, bytes.Contains(rec.Body.Bytes(), []byte("test_gauge 42\n")), "Expected gauge value")
+	})
+}
+
+func TestMetric(t *testing.T) {
+	t.Run("should return the current value", func(t *testing.T) {
+		registry := metrics.NewRegistry()
+		counter := registry.NewCounter("test_counter", "A test counter.", "stage")
+
+		counter.Inc("upload")
+		counter.Inc("upload")
+
+		assert.Equal(t, float64(2), counter.Value("upload"))
+		assert.Equal(t, float64(0), counter.Value("archive"))
+	})
+
+	t.Run("should panic if a counter is decreased", func(t *testing.T) {
+		defer func() {
+			assert.True(t, recover() != nil, "Expected a panic")
+		}()
+
+		metrics.NewRegistry().NewCounter("test_counter", "A test counter.").Add(-1)
+	})
+
+	t.Run("should panic if the wrong number of label values are given", func(t *testing.T) {
+		defer func() {
+			assert.True(t, recover() != nil, "Expected a panic")
+		}()
+
+		metrics.NewRegistry().NewGauge("test_gauge", "A test gauge.", "folder").Set(1)
+	})
+
+	t.Run("should panic if a metric is registered twice", func(t *testing.T) {
+		defer func() {
+			assert.True(t, recover() != nil, "Expected a panic")
+		}()
+
+		registry := metrics.NewRegistry()
+		registry.NewGauge("test_gauge", "A test gauge.")
+		registry.NewGauge("test_gauge", "A test gauge.")
+	})
+}
@@ -0,0 +1,408 @@
+// Package naming names stored archives using templates, and recovers what an archive is of, and when
+// it was made, from its name; so that archives can be found, listed, and pruned however they're
+// named.
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTemplate names archives the way foldup always has; after the local path of the archive,
+// e.g. "/backup/backup-photos-1500000000.tar.gz".
+const DefaultTemplate = "{{dir}}/backup-{{folder}}-{{unix}}"
+
+// Default is the parsed DefaultTemplate.
+var Default = MustParse(DefaultTemplate)
+
+// Vars are the values of the placeholders in a Template.
+type Vars struct {
+	// Dir is the local directory the archive is created in, for {{dir}}.
+	Dir string
+	// Host is the hostname of the machine making the archive, for {{host}}.
+	Host string
+	// Job is the name of the job making the archive, for {{job}}.
+	Job string
+	// Folder is the name of the folder archived, for {{folder}}.
+	Folder string
+	// Path is the path of the folder archived, relative to its source, for {{path}}.
+	Path string
+	// Time is when the archive was made, for {{unix}}, and {{date:LAYOUT}}.
+	Time time.Time
+	// Ext is the extension of the archive's format, without a leading dot, for {{ext}}.
+	Ext string
+	// RunID is the ID of the run making the archive, for {{run}}.
+	RunID string
+}
+
+// part is a piece of a Template; either literal text, or a placeholder.
+type part struct {
+	literal string
+	name    string
+	layout  string
+}
+
+// Template names archives. Placeholders are written like {{name}}, and are:
+//
+//	{{dir}}           the local directory the archive is created in
+//	{{host}}          the hostname of the machine making the archive
+//	{{job}}           the name of the job making the archive
+//	{{folder}}        the name of the folder archived
+//	{{path}}          the path of the folder archived, relative to its source
+//	{{date:LAYOUT}}   when the archive was made, in UTC, formatted with a Go time layout
+//	{{unix}}          when the archive was made, as a Unix timestamp
+//	{{ext}}           the extension of the archive's format, e.g. tar.gz
+//	{{run}}           the ID of the run making the archive
+//
+// A template must include {{folder}} or {{path}}, and {{unix}} or {{date:LAYOUT}}, so that what an
+// archive is of, and when it was made, can be recovered from its name. If it doesn't include
+// {{ext}}, the extension is added to the end.
+type Template struct {
+	text  string
+	parts []part
+	re    *regexp.Regexp
+	// groups maps each capture group of re to the index of the part it captures.
+	groups []int
+	hasExt bool
+}
+
+// Parse parses the given template. An empty template gives the default template.
+func Parse(text string) (*Template, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+
+	t := &Template{text: text}
+
+	rest := text
+	for rest != "" {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+
+		if start > 0 {
+			t.parts = append(t.parts, part{literal: rest[:start]})
+		}
+
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("naming: unclosed placeholder in template '%s'", text)
+		}
+
+		p, err := parsePlaceholder(rest[start+2 : start+end])
+		if err != nil {
+			return nil, err
+		}
+
+		t.parts = append(t.parts, p)
+		rest = rest[start+end+2:]
+	}
+
+	if !t.has("folder") && !t.has("path") {
+		return nil, fmt.Errorf("naming: template '%s' must include {{folder}} or {{path}}", text)
+	}
+
+	if !t.has("unix") && !t.has("date") {
+		return nil, fmt.Errorf("naming: template '%s' must include {{unix}} or {{date:LAYOUT}}", text)
+	}
+
+	t.hasExt = t.has("ext")
+	t.compile()
+
+	return t, nil
+}
+
+// MustParse is like Parse, but panics if the template can't be parsed.
+func MustParse(text string) *Template {
+	t, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// parsePlaceholder parses the inside of a placeholder, e.g. "folder", or "date:2006".
+func parsePlaceholder(s string) (part, error) {
+	name := strings.TrimSpace(s)
+
+	if strings.HasPrefix(name, "date:") {
+		layout := strings.TrimPrefix(name, "date:")
+		if layout == "" {
+			return part{}, fmt.Errorf("naming: {{date:LAYOUT}} needs a layout")
+		}
+
+		return part{name: "date", layout: layout}, nil
+	}
+
+	switch name {
+	case "dir", "host", "job", "folder", "path", "unix", "ext", "run":
+		return part{name: name}, nil
+	}
+
+	return part{}, fmt.Errorf("naming: unknown placeholder '{{%s}}'", s)
+}
+
+// has checks if the template includes the placeholder with the given name.
+func (t *Template) has(name string) bool {
+	for _, p := range t.parts {
+		if p.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compile builds the regular expression used to match names made from the template.
+func (t *Template) compile() {
+	expr := "^"
+
+	for i, p := range t.parts {
+		if p.name == "" {
+			expr += regexp.QuoteMeta(p.literal)
+			continue
+		}
+
+		t.groups = append(t.groups, i)
+
+		switch p.name {
+		case "dir", "path":
+			expr += "(.+?)"
+		case "job":
+			expr += "([^/]*?)"
+		case "unix":
+			expr += "([0-9]+)"
+		case "ext":
+			expr += "([A-Za-z0-9]+(?:\\.[A-Za-z0-9]+)*)"
+		case "date":
+			expr += "(" + datePattern(p.layout) + ")"
+		default:
+			expr += "([^/]+?)"
+		}
+	}
+
+	if !t.hasExt {
+		t.groups = append(t.groups, -1)
+		expr += "(?:\\.([A-Za-z0-9]+(?:\\.[A-Za-z0-9]+)*))?"
+	}
+
+	t.re = regexp.MustCompile(expr + "$")
+}
+
+// datePattern returns a regular expression matching dates formatted with the given layout. Dates
+// are always formatted in UTC, so a sample date formatted with the layout has the same shape as
+// any other, apart from the widths of numbers and names, which are allowed to vary.
+func datePattern(layout string) string {
+	sample := time.Date(2017, 12, 24, 22, 40, 50, 0, time.UTC).Format(layout)
+
+	expr := ""
+	last := ""
+
+	for _, r := range sample {
+		var next string
+
+		switch {
+		case r >= '0' && r <= '9':
+			next = "[0-9]+"
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+			next = "[A-Za-z]+"
+		case r == ' ':
+			next = " *"
+		default:
+			next = regexp.QuoteMeta(string(r))
+		}
+
+		// Runs of digits, or letters, are matched as a whole.
+		if next != last || (next != "[0-9]+" && next != "[A-Za-z]+") {
+			expr += next
+		}
+
+		last = next
+	}
+
+	return expr
+}
+
+// String returns the template's text.
+func (t *Template) String() string {
+	return t.text
+}
+
+// Execute names an archive, using the given values.
+func (t *Template) Execute(v Vars) string {
+	return t.execute(v, len(t.parts), true)
+}
+
+// Prefix returns the part of the names of all archives of the folder described by the given values
+// that's the same for each of them. That's everything up to the first placeholder that changes
+// from one archive to the next; the time, the run ID, or the extension.
+func (t *Template) Prefix(v Vars) string {
+	for i, p := range t.parts {
+		switch p.name {
+		case "unix", "date", "run", "ext":
+			return t.execute(v, i, false)
+		}
+	}
+
+	return t.execute(v, len(t.parts), false)
+}
+
+// execute renders the first n parts of the template, adding the extension if asked to.
+func (t *Template) execute(v Vars, n int, ext bool) string {
+	buf := &strings.Builder{}
+
+	for _, p := range t.parts[:n] {
+		buf.WriteString(value(p, v))
+	}
+
+	name := buf.String()
+	if ext && !t.hasExt && v.Ext != "" {
+		name += "." + v.Ext
+	}
+
+	// An archive made in the working directory has no directory in its name.
+	return strings.TrimPrefix(name, "./")
+}
+
+// value returns the text that the given part of a template is replaced with, given the values.
+func value(p part, v Vars) string {
+	var s string
+
+	switch p.name {
+	case "":
+		return p.literal
+	case "dir":
+		return v.Dir
+	case "path":
+		s = v.Path
+	case "host":
+		s = safe(v.Host)
+	case "job":
+		s = safe(v.Job)
+	case "folder":
+		s = safe(v.Folder)
+	case "date":
+		s = v.Time.UTC().Format(p.layout)
+	case "unix":
+		s = strconv.FormatInt(v.Time.Unix(), 10)
+	case "ext":
+		s = v.Ext
+	case "run":
+		s = safe(v.RunID)
+	}
+
+	return strings.Replace(s, " ", "_", -1)
+}
+
+// safe makes the given value safe to use as a single part of a path.
+func safe(s string) string {
+	return strings.Replace(s, "/", "_", -1)
+}
+
+// Match recovers the values used to make the given archive name from the template. The Time is
+// recovered from {{unix}} if it's in the template, otherwise from each {{date:LAYOUT}}, so it's
+// only as precise as the layouts are. If the name wasn't made from the template, false is returned.
+func (t *Template) Match(name string) (Vars, bool) {
+	v, ok := t.match(name)
+	if !ok && t.parts[0].name == "dir" {
+		// Archives made in the working directory have "./" trimmed from their names.
+		v, ok = t.match("./" + name)
+	}
+
+	return v, ok
+}
+
+// match recovers the values used to make the given archive name, exactly as given.
+func (t *Template) match(name string) (Vars, bool) {
+	matches := t.re.FindStringSubmatch(name)
+	if matches == nil {
+		return Vars{}, false
+	}
+
+	v := Vars{}
+	seen := make(map[string]string)
+
+	dateLayouts := []string{}
+	dateValues := []string{}
+
+	for i, index := range t.groups {
+		s := matches[i+1]
+
+		name := "ext"
+		if index >= 0 {
+			name = t.parts[index].name
+		}
+
+		// The same placeholder must have the same value everywhere it appears.
+		if name != "date" {
+			if prev, ok := seen[name]; ok && prev != s {
+				return Vars{}, false
+			}
+
+			seen[name] = s
+		}
+
+		switch name {
+		case "dir":
+			v.Dir = s
+		case "host":
+			v.Host = s
+		case "job":
+			v.Job = s
+		case "folder":
+			v.Folder = s
+		case "path":
+			v.Path = s
+		case "ext":
+			v.Ext = s
+		case "run":
+			v.RunID = s
+		case "unix":
+			unix, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return Vars{}, false
+			}
+
+			v.Time = time.Unix(unix, 0)
+		case "date":
+			dateLayouts = append(dateLayouts, t.parts[index].layout)
+			dateValues = append(dateValues, s)
+		}
+	}
+
+	// Every date must parse, even if the time comes from {{unix}}, or the name isn't ours. Parsing
+	// them all together combines their parts into a single time.
+	if len(dateLayouts) > 0 {
+		date, err := time.Parse(strings.Join(dateLayouts, "\x00"), strings.Join(dateValues, "\x00"))
+		if err != nil {
+			return Vars{}, false
+		}
+
+		if !t.has("unix") {
+			v.Time = date
+		}
+	}
+
+	return v, true
+}
+
+// Of checks if the archive with the given name is an archive of the folder described by the given
+// values, made from the template; i.e. it was made the same way, but maybe at a different time.
+func (t *Template) Of(name string, v Vars) bool {
+	matched, ok := t.Match(name)
+	if !ok {
+		return false
+	}
+
+	v.Time = matched.Time
+	v.RunID = matched.RunID
+	v.Ext = matched.Ext
+
+	return t.Execute(v) == name
+}
@@ -0,0 +1,169 @@
+package naming
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("should parse the default template if none is given", func(t *testing.T) {
+		tmpl, err := Parse("")
+		assert.OK(t, err)
+		assert.Equal(t, DefaultTemplate, tmpl.String())
+	})
+
+	t.Run("should error if a placeholder is unknown", func(t *testing.T) {
+		_, err := Parse("{{folder}}-{{unix}}-{{nope}}")
+		assert.NotOK(t, err)
+		assert.Equal(t, "naming: unknown placeholder '{{nope}}'", err.Error())
+	})
+
+	t.Run("should error if a placeholder isn't closed", func(t *testing.T) {
+		_, err := Parse("{{folder}}-{{unix")
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if a date has no layout", func(t *testing.T) {
+		_, err := Parse("{{folder}}-{{date:}}")
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if the folder can't be recovered from names", func(t *testing.T) {
+		_, err := Parse("{{host}}-{{unix}}")
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if the time can't be recovered from names", func(t *testing.T) {
+		_, err := Parse("{{host}}/{{folder}}")
+		assert.NotOK(t, err)
+	})
+}
+
+func TestTemplate_Execute(t *testing.T) {
+	vars := Vars{
+		Dir:    "/backup",
+		Host:   "nas",
+		Job:    "nightly",
+		Folder: "my photos",
+		Path:   "media/my photos",
+		Time:   time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC),
+		Ext:    "tar.gz",
+		RunID:  "abc123",
+	}
+
+	t.Run("should name archives the way foldup always has by default", func(t *testing.T) {
+		assert.Equal(t, "/backup/backup-my_photos-1500000000.tar.gz", Default.Execute(vars))
+	})
+
+	t.Run("should leave the working directory out of names", func(t *testing.T) {
+		v := vars
+		v.Dir = "."
+
+		assert.Equal(t, "backup-my_photos-1500000000.tar.gz", Default.Execute(v))
+	})
+
+	t.Run("should replace each placeholder", func(t *testing.T) {
+		tmpl := MustParse("{{host}}/{{job}}/{{path}}/{{date:2006/01/02}}/{{folder}}-{{run}}.{{ext}}")
+		assert.Equal(t, "nas/nightly/media/my_photos/2017/07/14/my_photos-abc123.tar.gz", tmpl.Execute(vars))
+	})
+
+	t.Run("should format dates in UTC", func(t *testing.T) {
+		v := vars
+		v.Time = vars.Time.In(time.FixedZone("test", 10*60*60))
+
+		tmpl := MustParse("{{folder}}-{{date:2006-01-02T15}}")
+		assert.Equal(t, "my_photos-2017-07-14T02.tar.gz", tmpl.Execute(v))
+	})
+
+	t.Run("should not let values other than the path add directories", func(t *testing.T) {
+		v := vars
+		v.Host = "a/b"
+
+		tmpl := MustParse("{{host}}/{{folder}}-{{unix}}")
+		assert.Equal(t, "a_b/my_photos-1500000000.tar.gz", tmpl.Execute(v))
+	})
+}
+
+func TestTemplate_Match(t *testing.T) {
+	t.Run("should recover the folder and time from default names", func(t *testing.T) {
+		v, ok := Default.Match("/backup/backup-my_photos-1500000000.tar.gz")
+		assert.True(t, ok, "expected name to match")
+		assert.Equal(t, "/backup", v.Dir)
+		assert.Equal(t, "my_photos", v.Folder)
+		assert.Equal(t, int64(1500000000), v.Time.Unix())
+		assert.Equal(t, "tar.gz", v.Ext)
+	})
+
+	t.Run("should match default names made in the working directory", func(t *testing.T) {
+		v, ok := Default.Match("backup-photos-1500000000.zip")
+		assert.True(t, ok, "expected name to match")
+		assert.Equal(t, ".", v.Dir)
+		assert.Equal(t, "photos", v.Folder)
+		assert.Equal(t, "zip", v.Ext)
+	})
+
+	t.Run("should recover the time from dates", func(t *testing.T) {
+		tmpl := MustParse("{{host}}/{{folder}}/{{date:2006/01/02}}/{{folder}}-{{date:150405}}")
+
+		v, ok := tmpl.Match("nas/photos/2017/07/14/photos-024000.tar.gz")
+		assert.True(t, ok, "expected name to match")
+		assert.Equal(t, "nas", v.Host)
+		assert.Equal(t, "photos", v.Folder)
+		assert.Equal(t, time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC), v.Time)
+	})
+
+	t.Run("should match dates followed by separators that also appear in them", func(t *testing.T) {
+		tmpl := MustParse("{{folder}}/{{date:2006-01-02}}-{{run}}")
+
+		v, ok := tmpl.Match("photos/2017-07-14-abc.tar.gz")
+		assert.True(t, ok, "expected name to match")
+		assert.Equal(t, "abc", v.RunID)
+		assert.Equal(t, time.Date(2017, 7, 14, 0, 0, 0, 0, time.UTC), v.Time)
+	})
+
+	t.Run("should not match names where a repeated placeholder differs", func(t *testing.T) {
+		tmpl := MustParse("{{folder}}/{{folder}}-{{unix}}")
+
+		_, ok := tmpl.Match("photos/music-1500000000.tar.gz")
+		assert.False(t, ok, "expected name not to match")
+	})
+
+	t.Run("should not match names with invalid dates", func(t *testing.T) {
+		tmpl := MustParse("{{folder}}/{{date:2006-01-02}}")
+
+		_, ok := tmpl.Match("photos/yesterday.tar.gz")
+		assert.False(t, ok, "expected name not to match")
+	})
+
+	t.Run("should not match names made some other way", func(t *testing.T) {
+		_, ok := Default.Match("/backup/notes.txt")
+		assert.False(t, ok, "expected name not to match")
+	})
+}
+
+func TestTemplate_Prefix(t *testing.T) {
+	t.Run("should render everything up to the first part that changes between archives", func(t *testing.T) {
+		tmpl := MustParse("{{host}}/{{folder}}/{{date:2006}}/{{folder}}-{{unix}}")
+		assert.Equal(t, "nas/photos/", tmpl.Prefix(Vars{Host: "nas", Folder: "photos"}))
+	})
+
+	t.Run("should match the default prefix", func(t *testing.T) {
+		assert.Equal(t, "/backup/backup-photos-", Default.Prefix(Vars{Dir: "/backup", Folder: "photos"}))
+	})
+}
+
+func TestTemplate_Of(t *testing.T) {
+	vars := Vars{Dir: "/backup", Folder: "photos"}
+
+	t.Run("should check if a name is of the given folder", func(t *testing.T) {
+		assert.True(t, Default.Of("/backup/backup-photos-1500000000.tar.gz", vars), "expected name to be of photos")
+		assert.True(t, Default.Of("/backup/backup-photos-1500000001.zip", vars), "expected name to be of photos")
+	})
+
+	t.Run("should not confuse folders that share a prefix", func(t *testing.T) {
+		assert.False(t, Default.Of("/backup/backup-photos-old-1500000000.tar.gz", vars), "expected name not to be of photos")
+		assert.False(t, Default.Of("/backup/backup-music-1500000000.tar.gz", vars), "expected name not to be of photos")
+	})
+}
@@ -0,0 +1,269 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/foldup"
+)
+
+// DigestInterval is how often digest emails are sent.
+const DigestInterval = 24 * time.Hour
+
+// SMTPConfig describes how to connect to an SMTP server to send email.
+type SMTPConfig struct {
+	// Addr is the address of the SMTP server, in the form 'host:port'.
+	Addr string
+	// StartTLS requires the connection to be upgraded with STARTTLS before sending anything.
+	StartTLS bool
+	// Username is used to authenticate with the server, if it's not empty.
+	Username string
+	// Password is used to authenticate with the server.
+	Password string
+}
+
+// EmailNotifier emails a report once each run has finished. In digest mode, reports are collected
+// up, and only sent together in a single email when the notifier is flushed.
+type EmailNotifier struct {
+	sync.Mutex
+
+	config  SMTPConfig
+	from    string
+	to      []string
+	digest  bool
+	pending []Notification
+}
+
+// NewEmailNotifier creates a new EmailNotifier, sending email from the `from` address to each of
+// the `to` addresses.
+func NewEmailNotifier(config SMTPConfig, from string, to []string, digest bool) (Notifier, error) {
+	if _, _, err := net.SplitHostPort(config.Addr); err != nil {
+		return nil, fmt.Errorf("notify: invalid SMTP address '%s': %v", config.Addr, err)
+	}
+
+	if from == "" || len(to) == 0 {
+		return nil, fmt.Errorf("notify: email needs a sender and at least one recipient")
+	}
+
+	return &EmailNotifier{
+		config: config,
+		from:   from,
+		to:     to,
+		digest: digest,
+	}, nil
+}
+
+// Notify emails a report for the notification, unless it's only the start of a run. In digest
+// mode, the report is held on to until the notifier is flushed.
+func (n *EmailNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.Event == EventStart {
+		return nil
+	}
+
+	if !n.digest {
+		return n.send(ctx, EmailSubject(notification), EmailBody(notification))
+	}
+
+	n.Lock()
+	defer n.Unlock()
+
+	n.pending = append(n.pending, notification)
+
+	return nil
+}
+
+// Flush sends a digest of the reports held on to since the last flush, if there are any. If the
+// digest can't be sent, the reports are kept, to be sent with the next one.
+func (n *EmailNotifier) Flush(ctx context.Context) error {
+	n.Lock()
+	defer n.Unlock()
+
+	if len(n.pending) == 0 {
+		return nil
+	}
+
+	err := n.send(ctx, DigestSubject(n.pending), DigestBody(n.pending))
+	if err != nil {
+		return err
+	}
+
+	n.pending = nil
+
+	return nil
+}
+
+// send sends an email with the given subject and body to each recipient.
+func (n *EmailNotifier) send(ctx context.Context, subject, body string) error {
+	host, _, _ := net.SplitHostPort(n.config.Addr)
+
+	dialer := &net.Dialer{Timeout: Timeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", n.config.Addr)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(Timeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	if n.config.StartTLS {
+		err = client.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return fmt.Errorf("notify: STARTTLS failed: %v", err)
+		}
+	}
+
+	if n.config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, host))
+		if err != nil {
+			return fmt.Errorf("notify: SMTP authentication failed: %v", err)
+		}
+	}
+
+	err = client.Mail(n.from)
+	if err != nil {
+		return err
+	}
+
+	for _, to := range n.to {
+		err = client.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(n.message(subject, body))
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// message builds the full email message, with headers.
+func (n *EmailNotifier) message(subject, body string) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "From: %s\r\n", n.from)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(buf, "\r\n")
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	return buf.Bytes()
+}
+
+// EmailSubject formats the subject of an email about a single run.
+func EmailSubject(n Notification) string {
+	status := "succeeded"
+	if !n.Report.OK() {
+		status = "FAILED"
+	}
+
+	what := n.Report.Dirname
+	if n.Report.Job != "" {
+		what = "job " + n.Report.Job
+	}
+
+	return fmt.Sprintf("[foldup] Backup of %s on %s %s", what, n.Host, status)
+}
+
+// EmailBody formats the body of an email about a single run.
+func EmailBody(n Notification) string {
+	buf := &bytes.Buffer{}
+	writeReport(buf, n.Report)
+
+	return buf.String()
+}
+
+// DigestSubject formats the subject of a digest email about many runs.
+func DigestSubject(ns []Notification) string {
+	failed := 0
+	for _, n := range ns {
+		if !n.Report.OK() {
+			failed++
+		}
+	}
+
+	host := ""
+	if len(ns) > 0 {
+		host = ns[0].Host
+	}
+
+	return fmt.Sprintf("[foldup] Backup digest for %s: %d runs, %d failed", host, len(ns), failed)
+}
+
+// DigestBody formats the body of a digest email about many runs.
+func DigestBody(ns []Notification) string {
+	buf := &bytes.Buffer{}
+
+	for i, n := range ns {
+		if i > 0 {
+			fmt.Fprintf(buf, "\n")
+		}
+
+		writeReport(buf, n.Report)
+	}
+
+	return buf.String()
+}
+
+// writeReport writes a plain text description of a run, with a table of the folders backed up.
+func writeReport(buf *bytes.Buffer, r *foldup.Report) {
+	status := "succeeded"
+	if !r.OK() {
+		status = "failed"
+	}
+
+	fmt.Fprintf(buf, "Run %s of %s %s.\n", r.RunID, r.Dirname, status)
+	fmt.Fprintf(buf, "Started:  %s\n", r.Started.Format(time.RFC1123))
+	fmt.Fprintf(buf, "Finished: %s (took %s)\n", r.Finished.Format(time.RFC1123), r.Duration())
+
+	if !r.OK() {
+		fmt.Fprintf(buf, "Error:    %v (at %s stage)\n", r.Err, r.Stage)
+	}
+
+	if len(r.Folders) == 0 {
+		return
+	}
+
+	fmt.Fprintf(buf, "\n")
+
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FOLDER\tOBJECT\tFILES\tSIZE\tDURATION\tUPLOADED")
+
+	for _, f := range r.Folders {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%t\n", f.Name, f.Object, f.Files, f.BytesArchived, f.Duration, f.Uploaded)
+	}
+
+	w.Flush()
+}
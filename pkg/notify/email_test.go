@@ -0,0 +1,235 @@
+package notify_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/notify"
+)
+
+// testMail is a message received by a testSMTPSink.
+type testMail struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// testSMTPSink is a minimal SMTP server that accepts any mail sent to it.
+type testSMTPSink struct {
+	listener net.Listener
+	mails    chan testMail
+}
+
+func newTestSMTPSink(t *testing.T) *testSMTPSink {
+	return newTestSMTPSinkOn(t, "127.0.0.1:0")
+}
+
+func newTestSMTPSinkOn(t *testing.T, addr string) *testSMTPSink {
+	listener, err := net.Listen("tcp", addr)
+	assert.OK(t, err)
+
+	sink := &testSMTPSink{
+		listener: listener,
+		mails:    make(chan testMail, 10),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go sink.serve(conn)
+		}
+	}()
+
+	return sink
+}
+
+func (s *testSMTPSink) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *testSMTPSink) Close() {
+	s.listener.Close()
+}
+
+func (s *testSMTPSink) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	mail := testMail{}
+	reply("220 localhost ESMTP test")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			mail.auth = line
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			mail.from = line
+			reply("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, line)
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+
+			data := []string{}
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				if l == ".\r\n" {
+					break
+				}
+
+				data = append(data, l)
+			}
+
+			mail.data = strings.Join(data, "")
+			s.mails <- mail
+			mail = testMail{}
+
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestNewEmailNotifier(t *testing.T) {
+	t.Run("should error if the SMTP address is invalid", func(t *testing.T) {
+		_, err := notify.NewEmailNotifier(notify.SMTPConfig{Addr: "localhost"}, "a@example.com", []string{"b@example.com"}, false)
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should error if there are no recipients", func(t *testing.T) {
+		_, err := notify.NewEmailNotifier(notify.SMTPConfig{Addr: "localhost:25"}, "a@example.com", nil, false)
+		assert.NotOK(t, err)
+	})
+}
+
+func TestEmailNotifier(t *testing.T) {
+	t.Run("should email a report of each run", func(t *testing.T) {
+		sink := newTestSMTPSink(t)
+		defer sink.Close()
+
+		config := notify.SMTPConfig{
+			Addr:     sink.Addr(),
+			Username: "user",
+			Password: "pass",
+		}
+
+		notifier, err := notify.NewEmailNotifier(config, "foldup@example.com", []string{"a@example.com", "b@example.com"}, false)
+		assert.OK(t, err)
+
+		err = notifier.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(errors.New("oops"))))
+		assert.OK(t, err)
+
+		mail := <-sink.mails
+		assert.True(t, strings.HasPrefix(mail.auth, "AUTH PLAIN"), "Expected client to authenticate")
+		assert.Equal(t, "MAIL FROM:<foldup@example.com>", mail.from)
+		assert.Equal(t, 2, len(mail.to))
+		assert.True(t, strings.Contains(mail.data, "Subject: [foldup] Backup of /srv/data on host FAILED"), "Expected subject to say the backup failed")
+		assert.True(t, strings.Contains(mail.data, "backup-photos-1.tar.gz"), "Expected stored archive names to be listed")
+		assert.False(t, strings.Contains(mail.data, "foldup-1234.tar.gz"), "Expected local archive names not to be listed")
+		assert.True(t, strings.Contains(mail.data, "oops"), "Expected the error to be included")
+	})
+
+	t.Run("should not email about the start of a run", func(t *testing.T) {
+		notifier, err := notify.NewEmailNotifier(notify.SMTPConfig{Addr: "127.0.0.1:1"}, "a@example.com", []string{"b@example.com"}, false)
+		assert.OK(t, err)
+
+		err = notifier.Notify(context.Background(), notify.NewNotification("host", foldup.NewReport("a")))
+		assert.OK(t, err)
+	})
+
+	t.Run("should error if the SMTP server can't be reached", func(t *testing.T) {
+		notifier, err := notify.NewEmailNotifier(notify.SMTPConfig{Addr: "127.0.0.1:1"}, "a@example.com", []string{"b@example.com"}, false)
+		assert.OK(t, err)
+
+		err = notifier.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(nil)))
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should hold on to reports for a digest until flushed", func(t *testing.T) {
+		sink := newTestSMTPSink(t)
+		defer sink.Close()
+
+		notifier, err := notify.NewEmailNotifier(notify.SMTPConfig{Addr: sink.Addr()}, "foldup@example.com", []string{"a@example.com"}, true)
+		assert.OK(t, err)
+
+		first := newFinishedReport(nil)
+
+		second := newFinishedReport(errors.New("oops"))
+		second.Started = first.Started.Add(12 * time.Hour)
+		second.Finished = second.Started.Add(time.Minute)
+
+		assert.OK(t, notifier.Notify(context.Background(), notify.NewNotification("host", first)))
+		assert.OK(t, notifier.Notify(context.Background(), notify.NewNotification("host", second)))
+		assert.Equal(t, 0, len(sink.mails))
+
+		assert.OK(t, notifier.(notify.Flusher).Flush(context.Background()))
+
+		mail := <-sink.mails
+		assert.True(t, strings.Contains(mail.data, "Subject: [foldup] Backup digest for host: 2 runs, 1 failed"), "Expected digest subject")
+		assert.True(t, strings.Contains(mail.data, first.RunID), "Expected first run in digest")
+		assert.True(t, strings.Contains(mail.data, second.RunID), "Expected last run in digest")
+
+		// Nothing is left to send.
+		assert.OK(t, notifier.(notify.Flusher).Flush(context.Background()))
+		assert.Equal(t, 0, len(sink.mails))
+	})
+
+	t.Run("should keep reports for the next digest if one can't be sent", func(t *testing.T) {
+		sink := newTestSMTPSink(t)
+		addr := sink.Addr()
+		sink.Close()
+
+		notifier, err := notify.NewEmailNotifier(notify.SMTPConfig{Addr: addr}, "foldup@example.com", []string{"a@example.com"}, true)
+		assert.OK(t, err)
+
+		report := newFinishedReport(nil)
+
+		assert.OK(t, notifier.Notify(context.Background(), notify.NewNotification("host", report)))
+		assert.NotOK(t, notifier.(notify.Flusher).Flush(context.Background()))
+
+		sink = newTestSMTPSinkOn(t, addr)
+		defer sink.Close()
+
+		assert.OK(t, notifier.(notify.Flusher).Flush(context.Background()))
+
+		mail := <-sink.mails
+		assert.True(t, strings.Contains(mail.data, report.RunID), "Expected the held run in the digest")
+	})
+}
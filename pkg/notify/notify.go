@@ -0,0 +1,143 @@
+// Package notify sends notifications about backup runs to external services, so that failures
+// are noticed without anyone having to watch the logs.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/foldup"
+)
+
+// Event identifies the point in a backup run that a notification is about.
+type Event string
+
+// The events notifications are sent for.
+const (
+	EventStart   Event = "start"
+	EventSuccess Event = "success"
+	EventFailure Event = "failure"
+)
+
+// Timeout is how long a notification request is allowed to take.
+const Timeout = 30 * time.Second
+
+// Notification is sent to a Notifier at the start and end of each backup run.
+type Notification struct {
+	// Event is the point in the run the notification is about.
+	Event Event
+	// Host is the name of the host running the backup.
+	Host string
+	// Report describes the run. At the start of the run, it will be mostly empty.
+	Report *foldup.Report
+}
+
+// NewNotification creates a Notification for the given report. The event is worked out from the
+// state of the report.
+func NewNotification(host string, report *foldup.Report) Notification {
+	event := EventSuccess
+
+	switch {
+	case report.Finished.IsZero():
+		event = EventStart
+	case !report.OK():
+		event = EventFailure
+	}
+
+	return Notification{
+		Event:  event,
+		Host:   host,
+		Report: report,
+	}
+}
+
+// Notifier sends notifications somewhere.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Flusher is implemented by Notifiers that hold on to notifications to send them together later.
+// Flushing sends any notifications held on to straight away.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Notifiers is a Notifier that sends notifications to many Notifiers. Every Notifier is tried,
+// even if some fail.
+type Notifiers []Notifier
+
+// Notify sends the notification to each Notifier, returning an error describing any failures.
+func (ns Notifiers) Notify(ctx context.Context, n Notification) error {
+	errs := []string{}
+
+	for _, notifier := range ns {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("notify: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Flush flushes each Notifier that is a Flusher, returning an error describing any failures.
+func (ns Notifiers) Flush(ctx context.Context) error {
+	errs := []string{}
+
+	for _, notifier := range ns {
+		flusher, ok := notifier.(Flusher)
+		if !ok {
+			continue
+		}
+
+		if err := flusher.Flush(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("notify: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// send makes an HTTP request, treating any non-2xx response as an error.
+func send(ctx context.Context, client *http.Client, method, url string, header http.Header, body io.Reader) error {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	ioutil.ReadAll(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("notify: %s %s responded with '%s'", method, url, res.Status)
+	}
+
+	return nil
+}
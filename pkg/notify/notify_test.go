@@ -0,0 +1,205 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/foldup"
+	"github.com/SeerUK/foldup/pkg/notify"
+)
+
+// testRequest is a request received by a testServer.
+type testRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+// testServer records the requests made to it, responding with the given status.
+type testServer struct {
+	sync.Mutex
+	*httptest.Server
+
+	status   int
+	requests []testRequest
+}
+
+func newTestServer(status int) *testServer {
+	ts := &testServer{status: status}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		ts.Lock()
+		ts.requests = append(ts.requests, testRequest{
+			method: r.Method,
+			path:   r.URL.Path,
+			header: r.Header,
+			body:   string(body),
+		})
+		ts.Unlock()
+
+		w.WriteHeader(ts.status)
+	}))
+
+	return ts
+}
+
+func newFinishedReport(err error) *foldup.Report {
+	report := foldup.NewReport("/srv/data")
+	report.Folders = []foldup.FolderReport{
+		{Name: "photos", Archive: "/tmp/foldup-1234.tar.gz", Object: "backup-photos-1.tar.gz", Files: 3, BytesRead: 100, BytesArchived: 50, Uploaded: true},
+	}
+
+	if err != nil {
+		report.Fail(foldup.StageUpload, err)
+	}
+
+	report.Finish()
+
+	return report
+}
+
+func TestNewNotification(t *testing.T) {
+	t.Run("should work out the event from the report", func(t *testing.T) {
+		assert.Equal(t, notify.EventStart, notify.NewNotification("host", foldup.NewReport("a")).Event)
+		assert.Equal(t, notify.EventSuccess, notify.NewNotification("host", newFinishedReport(nil)).Event)
+		assert.Equal(t, notify.EventFailure, notify.NewNotification("host", newFinishedReport(errors.New("oops"))).Event)
+	})
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	t.Run("should post a JSON payload by default", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		header := http.Header{}
+		header.Set("Authorization", "Bearer secret")
+
+		notifier, err := notify.NewWebhookNotifier(http.DefaultClient, server.URL+"/hook", header, "")
+		assert.OK(t, err)
+
+		err = notifier.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(errors.New("oops"))))
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(server.requests))
+
+		req := server.requests[0]
+		assert.Equal(t, "POST", req.method)
+		assert.Equal(t, "/hook", req.path)
+		assert.Equal(t, "Bearer secret", req.header.Get("Authorization"))
+		assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+
+		var payload notify.Payload
+		assert.OK(t, json.Unmarshal([]byte(req.body), &payload))
+		assert.Equal(t, notify.EventFailure, payload.Event)
+		assert.Equal(t, "oops", payload.Error)
+		assert.Equal(t, "upload", payload.Stage)
+		assert.Equal(t, 1, len(payload.Folders))
+		assert.Equal(t, 0.5, payload.Folders[0].Ratio)
+	})
+
+	t.Run("should render the body from a template if given", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		notifier, err := notify.NewWebhookNotifier(http.DefaultClient, server.URL, nil, `{"msg":{{json .Dirname}},"ok":{{eq .Error ""}}}`)
+		assert.OK(t, err)
+
+		err = notifier.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(nil)))
+		assert.OK(t, err)
+		assert.Equal(t, `{"msg":"/srv/data","ok":true}`, server.requests[0].body)
+	})
+
+	t.Run("should error if the template is invalid", func(t *testing.T) {
+		_, err := notify.NewWebhookNotifier(http.DefaultClient, "http://localhost", nil, "{{")
+		assert.NotOK(t, err)
+	})
+
+	t.Run("should not notify about the start of a run", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		notifier, err := notify.NewWebhookNotifier(http.DefaultClient, server.URL, nil, "")
+		assert.OK(t, err)
+
+		err = notifier.Notify(context.Background(), notify.NewNotification("host", foldup.NewReport("a")))
+		assert.OK(t, err)
+		assert.Equal(t, 0, len(server.requests))
+	})
+
+	t.Run("should error if the server doesn't respond with success", func(t *testing.T) {
+		server := newTestServer(http.StatusInternalServerError)
+		defer server.Close()
+
+		notifier, err := notify.NewWebhookNotifier(http.DefaultClient, server.URL, nil, "")
+		assert.OK(t, err)
+
+		err = notifier.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(nil)))
+		assert.NotOK(t, err)
+	})
+}
+
+func TestSlackNotifier(t *testing.T) {
+	t.Run("should post a Slack-compatible message", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		notifier := notify.NewSlackNotifier(http.DefaultClient, server.URL)
+
+		err := notifier.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(errors.New("oops"))))
+		assert.OK(t, err)
+
+		var message map[string]string
+		assert.OK(t, json.Unmarshal([]byte(server.requests[0].body), &message))
+
+		text := message["text"]
+		assert.True(t, strings.Contains(text, "failed"), "Expected message to say the backup failed")
+		assert.True(t, strings.Contains(text, "oops"), "Expected message to contain the error")
+		assert.True(t, strings.Contains(text, "photos"), "Expected message to list folders")
+	})
+}
+
+func TestPingNotifier(t *testing.T) {
+	t.Run("should ping the URL for each event", func(t *testing.T) {
+		server := newTestServer(http.StatusOK)
+		defer server.Close()
+
+		notifier := notify.NewPingNotifier(http.DefaultClient, server.URL+"/ping/abc/")
+
+		assert.OK(t, notifier.Notify(context.Background(), notify.NewNotification("host", foldup.NewReport("a"))))
+		assert.OK(t, notifier.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(nil))))
+		assert.OK(t, notifier.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(errors.New("oops")))))
+
+		assert.Equal(t, 3, len(server.requests))
+		assert.Equal(t, "/ping/abc/start", server.requests[0].path)
+		assert.Equal(t, "/ping/abc", server.requests[1].path)
+		assert.Equal(t, "/ping/abc/fail", server.requests[2].path)
+	})
+}
+
+func TestNotifiers(t *testing.T) {
+	t.Run("should notify every notifier, even if some fail", func(t *testing.T) {
+		failing := newTestServer(http.StatusBadGateway)
+		defer failing.Close()
+
+		working := newTestServer(http.StatusOK)
+		defer working.Close()
+
+		notifiers := notify.Notifiers{
+			notify.NewPingNotifier(http.DefaultClient, failing.URL),
+			notify.NewPingNotifier(http.DefaultClient, working.URL),
+		}
+
+		err := notifiers.Notify(context.Background(), notify.NewNotification("host", newFinishedReport(nil)))
+		assert.NotOK(t, err)
+		assert.Equal(t, 1, len(working.requests))
+	})
+}
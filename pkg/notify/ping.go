@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// PingNotifier pings a dead man's switch style monitoring service, like healthchecks.io, so that
+// it can raise an alarm if backups stop happening. The base URL is pinged when a run succeeds, with
+// `/start` appended when a run starts, and `/fail` appended when a run fails.
+type PingNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// NewPingNotifier creates a new PingNotifier.
+func NewPingNotifier(client *http.Client, url string) Notifier {
+	return &PingNotifier{
+		client: client,
+		url:    strings.TrimSuffix(url, "/"),
+	}
+}
+
+// Notify pings the URL for the notification's event.
+func (n *PingNotifier) Notify(ctx context.Context, notification Notification) error {
+	url := n.url
+
+	switch notification.Event {
+	case EventStart:
+		url += "/start"
+	case EventFailure:
+		url += "/fail"
+	}
+
+	return send(ctx, n.client, http.MethodGet, url, nil, nil)
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SlackNotifier posts a message to a Slack incoming webhook once each run has finished. Any service
+// that accepts Slack-compatible webhooks, like Mattermost or Rocket.Chat, can be used too.
+type SlackNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// NewSlackNotifier creates a new SlackNotifier.
+func NewSlackNotifier(client *http.Client, url string) Notifier {
+	return &SlackNotifier{
+		client: client,
+		url:    url,
+	}
+}
+
+// Notify sends the notification, unless it's only the start of a run.
+func (n *SlackNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.Event == EventStart {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"text": SlackMessage(notification),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	return send(ctx, n.client, http.MethodPost, n.url, header, bytes.NewReader(body))
+}
+
+// SlackMessage formats the text of a Slack message for the given notification.
+func SlackMessage(n Notification) string {
+	r := n.Report
+	buf := &bytes.Buffer{}
+
+	what := fmt.Sprintf("`%s`", r.Dirname)
+	if r.Job != "" {
+		what = fmt.Sprintf("job `%s`", r.Job)
+	}
+
+	if r.OK() {
+		fmt.Fprintf(buf, ":white_check_mark: Backup of %s on %s succeeded", what, n.Host)
+	} else {
+		fmt.Fprintf(buf, ":x: Backup of %s on %s failed", what, n.Host)
+	}
+
+	fmt.Fprintf(buf, " in %s (run %s)\n", r.Duration().Round(time.Second), r.RunID)
+
+	if !r.OK() {
+		fmt.Fprintf(buf, "Failed at %s stage: %v\n", r.Stage, r.Err)
+	}
+
+	for _, f := range r.Folders {
+		status := "uploaded"
+		if !f.Uploaded {
+			status = "not uploaded"
+		}
+
+		fmt.Fprintf(buf, "• %s: %d files, %d bytes archived, %s\n", f.Name, f.Files, f.BytesArchived, status)
+	}
+
+	return strings.TrimSpace(buf.String())
+}
@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// Payload is the JSON body sent by a WebhookNotifier when no template is given.
+type Payload struct {
+	Event           Event           `json:"event"`
+	Host            string          `json:"host"`
+	Job             string          `json:"job,omitempty"`
+	RunID           string          `json:"run_id"`
+	Dirname         string          `json:"dirname"`
+	Started         time.Time       `json:"started"`
+	Finished        time.Time       `json:"finished"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	BytesRead       int64           `json:"bytes_read"`
+	BytesArchived   int64           `json:"bytes_archived"`
+	BytesUploaded   int64           `json:"bytes_uploaded"`
+	Stage           string          `json:"stage,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	Folders         []FolderPayload `json:"folders"`
+}
+
+// FolderPayload describes a single folder within a Payload.
+type FolderPayload struct {
+	Name          string  `json:"name"`
+	Archive       string  `json:"archive"`
+	Files         int     `json:"files"`
+	BytesRead     int64   `json:"bytes_read"`
+	BytesArchived int64   `json:"bytes_archived"`
+	BytesUploaded int64   `json:"bytes_uploaded"`
+	Uploaded      bool    `json:"uploaded"`
+	Ratio         float64 `json:"compression_ratio"`
+}
+
+// NewPayload creates the Payload for the given notification.
+func NewPayload(n Notification) Payload {
+	r := n.Report
+
+	payload := Payload{
+		Event:           n.Event,
+		Host:            n.Host,
+		Job:             r.Job,
+		RunID:           r.RunID,
+		Dirname:         r.Dirname,
+		Started:         r.Started,
+		Finished:        r.Finished,
+		DurationSeconds: r.Duration().Seconds(),
+		BytesRead:       r.BytesRead(),
+		BytesArchived:   r.BytesArchived(),
+		BytesUploaded:   r.BytesUploaded(),
+		Stage:           string(r.Stage),
+		Folders:         []FolderPayload{},
+	}
+
+	if r.Finished.IsZero() {
+		payload.DurationSeconds = 0
+	}
+
+	if r.Err != nil {
+		payload.Error = r.Err.Error()
+	}
+
+	for _, f := range r.Folders {
+		payload.Folders = append(payload.Folders, FolderPayload{
+			Name:          f.Name,
+			Archive:       f.Archive,
+			Files:         f.Files,
+			BytesRead:     f.BytesRead,
+			BytesArchived: f.BytesArchived,
+			BytesUploaded: f.BytesUploaded,
+			Uploaded:      f.Uploaded,
+			Ratio:         f.CompressionRatio(),
+		})
+	}
+
+	return payload
+}
+
+// WebhookNotifier POSTs a notification to a URL once each run has finished. By default the body is
+// a JSON encoded Payload, but a template can be given to produce any body the receiver expects.
+type WebhookNotifier struct {
+	client *http.Client
+	url    string
+	header http.Header
+	body   *template.Template
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier. The `header` is sent with each request. If
+// `body` is not empty, it's parsed as a text/template, which is executed with a Payload to create
+// the request body. A `json` function is available in templates to encode values.
+func NewWebhookNotifier(client *http.Client, url string, header http.Header, body string) (Notifier, error) {
+	notifier := &WebhookNotifier{
+		client: client,
+		url:    url,
+		header: http.Header{},
+	}
+
+	for name, values := range header {
+		notifier.header[name] = values
+	}
+
+	if notifier.header.Get("Content-Type") == "" {
+		notifier.header.Set("Content-Type", "application/json")
+	}
+
+	if body != "" {
+		tmpl, err := template.New("webhook").Funcs(templateFuncs).Parse(body)
+		if err != nil {
+			return nil, err
+		}
+
+		notifier.body = tmpl
+	}
+
+	return notifier, nil
+}
+
+// Notify sends the notification, unless it's only the start of a run.
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	if notification.Event == EventStart {
+		return nil
+	}
+
+	payload := NewPayload(notification)
+	body := &bytes.Buffer{}
+
+	var err error
+	if n.body != nil {
+		err = n.body.Execute(body, payload)
+	} else {
+		err = json.NewEncoder(body).Encode(payload)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return send(ctx, n.client, http.MethodPost, n.url, n.header, body)
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		bs, err := json.Marshal(v)
+		return string(bs), err
+	},
+}
@@ -1,6 +1,9 @@
 package scheduling
 
-import "time"
+import (
+	"math/rand"
+	"time"
+)
 
 var (
 	parseExprTestExpr expression
@@ -25,6 +28,20 @@ func timeNowTest() time.Time {
 }
 
 func revertStubs() {
-	parseExpr = parseCronExpr
+	parseExpr = parseExpression
 	timeNow = time.Now
+	randInt63n = rand.Int63n
+}
+
+// testSequence is an expression that runs at each of the given times, in order.
+type testSequence []time.Time
+
+func (e testSequence) Next(prev time.Time) time.Time {
+	for _, t := range e {
+		if t.After(prev) {
+			return t
+		}
+	}
+
+	return time.Time{}
 }
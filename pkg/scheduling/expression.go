@@ -0,0 +1,165 @@
+package scheduling
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// day is the length of a day on the wall clock.
+const day = 24 * time.Hour
+
+// parseExpression parses a schedule expression. As well as cron-like expressions, and the
+// shorthands cronexpr understands (like "@hourly" and "@daily"), it accepts intervals like
+// "@every 6h". Any of these may be followed by an offset, like "@daily offset 2h30m", to shift every
+// run later by that long.
+func parseExpression(expr string) (expression, error) {
+	fields := strings.Fields(expr)
+
+	var offset time.Duration
+
+	if n := len(fields); n >= 2 && fields[n-2] == "offset" {
+		var err error
+
+		offset, err = time.ParseDuration(fields[n-1])
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("scheduling: invalid offset '%s' in '%s'", fields[n-1], expr)
+		}
+
+		fields = fields[:n-2]
+	}
+
+	if len(fields) > 0 && fields[0] == "@every" {
+		return parseInterval(expr, fields, offset)
+	}
+
+	cexpr, err := parseCronExpr(strings.Join(fields, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	if offset == 0 {
+		return cexpr, nil
+	}
+
+	return &offsetExpression{expr: cexpr, offset: offset}, nil
+}
+
+// parseInterval parses the fields of an "@every" expression.
+func parseInterval(expr string, fields []string, offset time.Duration) (expression, error) {
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("scheduling: expected '@every DURATION' in '%s'", expr)
+	}
+
+	every, err := time.ParseDuration(fields[1])
+	if err != nil || every < time.Second {
+		return nil, fmt.Errorf("scheduling: invalid interval '%s' in '%s', it must be at least 1s", fields[1], expr)
+	}
+
+	if offset >= every {
+		return nil, fmt.Errorf("scheduling: offset in '%s' must be shorter than the interval", expr)
+	}
+
+	return &intervalExpression{every: every, offset: offset}, nil
+}
+
+// intervalExpression runs at a fixed interval. Intervals shorter than a day start again at each
+// midnight, on the wall clock of the time zone of the times given to it, plus the offset, rather
+// than from when foldup started; so "@every 6h" runs at 00:00, 06:00, 12:00 and 18:00, and
+// "@every 7h" at 00:00, 07:00, 14:00 and 21:00, every day, and neither drifts when foldup restarts.
+// Longer intervals are aligned to multiples of the interval since the zero time, on the wall clock.
+type intervalExpression struct {
+	every  time.Duration
+	offset time.Duration
+}
+
+// Next returns the first run strictly after the given time.
+func (e *intervalExpression) Next(t time.Time) time.Time {
+	if e.every >= day {
+		_, zoneOffset := t.Zone()
+
+		// Truncate aligns to multiples of the interval since the zero time, in UTC, so shift the
+		// time to line it up with the wall clock instead.
+		shift := time.Duration(zoneOffset)*time.Second - e.offset
+
+		return t.Add(shift).Truncate(e.every).Add(e.every).Add(-shift)
+	}
+
+	year, month, date := t.Date()
+	hour, min, sec := t.Clock()
+
+	// Work on the wall clock, so that runs happen at the same times every day, even on days that
+	// daylight saving time makes shorter or longer.
+	wall := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(t.Nanosecond())
+
+	// Until the offset has passed, the runs started the previous day carry on.
+	if wall < e.offset {
+		date--
+		wall += day
+	}
+
+	next := e.offset + ((wall-e.offset)/e.every+1)*e.every
+
+	// The last run of each day may come round sooner than the interval, so the next day's runs
+	// start at midnight again.
+	if next > day+e.offset {
+		next = day + e.offset
+	}
+
+	// time.Date normalises the overflowing nanoseconds into the wall clock time of that day.
+	run := time.Date(year, month, date, 0, 0, 0, int(next), t.Location())
+
+	// When clocks go back, a wall clock time can happen twice, and the earlier one may be chosen.
+	for !run.After(t) {
+		run = run.Add(e.every)
+	}
+
+	return run
+}
+
+// offsetExpression shifts every run of another expression later, by the offset.
+type offsetExpression struct {
+	expr   expression
+	offset time.Duration
+}
+
+// Next returns the first run strictly after the given time.
+func (e *offsetExpression) Next(t time.Time) time.Time {
+	next := e.expr.Next(t.Add(-e.offset))
+	if next.IsZero() {
+		return next
+	}
+
+	return next.Add(e.offset)
+}
+
+// Validate returns an error if the given schedule expression is invalid.
+func Validate(expr string) error {
+	_, err := parseExpr(expr)
+
+	return err
+}
+
+// NextRuns returns the next n times the given schedule expression would run, after the given
+// time. The expression is evaluated in the time zone of the given time.
+func NextRuns(expr string, from time.Time, n int) ([]time.Time, error) {
+	cexpr, err := parseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []time.Time{}
+
+	for prev := from; len(runs) < n; {
+		next := cexpr.Next(prev)
+		if next.IsZero() {
+			break
+		}
+
+		runs = append(runs, next)
+		prev = next
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,139 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestParseExpression(t *testing.T) {
+	from := time.Date(2017, time.June, 10, 10, 15, 0, 0, time.UTC)
+
+	t.Run("should parse cron-like expressions, and shorthands", func(t *testing.T) {
+		for expr, expected := range map[string]time.Time{
+			"0 3 * * *": time.Date(2017, time.June, 11, 3, 0, 0, 0, time.UTC),
+			"@hourly":   time.Date(2017, time.June, 10, 11, 0, 0, 0, time.UTC),
+			"@daily":    time.Date(2017, time.June, 11, 0, 0, 0, 0, time.UTC),
+		} {
+			cexpr, err := parseExpression(expr)
+			assert.OK(t, err)
+			assert.Equal(t, expected, cexpr.Next(from))
+		}
+	})
+
+	t.Run("should parse intervals, aligned to midnight", func(t *testing.T) {
+		cexpr, err := parseExpression("@every 6h")
+		assert.OK(t, err)
+
+		assert.Equal(t, time.Date(2017, time.June, 10, 12, 0, 0, 0, time.UTC), cexpr.Next(from))
+	})
+
+	t.Run("should align intervals to midnight in the time zone of the given time", func(t *testing.T) {
+		loc := time.FixedZone("UTC+5", 5*60*60)
+
+		cexpr, err := parseExpression("@every 6h")
+		assert.OK(t, err)
+
+		assert.Equal(t, time.Date(2017, time.June, 10, 18, 0, 0, 0, loc), cexpr.Next(from.In(loc)))
+	})
+
+	t.Run("should start intervals again at each midnight, so they don't drift", func(t *testing.T) {
+		cexpr, err := parseExpression("@every 7h")
+		assert.OK(t, err)
+
+		runs := []time.Time{}
+		for next := from; len(runs) < 5; {
+			next = cexpr.Next(next)
+			runs = append(runs, next)
+		}
+
+		assert.Equal(t, []time.Time{
+			time.Date(2017, time.June, 10, 14, 0, 0, 0, time.UTC),
+			time.Date(2017, time.June, 10, 21, 0, 0, 0, time.UTC),
+			time.Date(2017, time.June, 11, 0, 0, 0, 0, time.UTC),
+			time.Date(2017, time.June, 11, 7, 0, 0, 0, time.UTC),
+			time.Date(2017, time.June, 11, 14, 0, 0, 0, time.UTC),
+		}, runs)
+
+		cexpr, err = parseExpression("@every 7h offset 1h")
+		assert.OK(t, err)
+
+		assert.Equal(t, time.Date(2017, time.June, 11, 1, 0, 0, 0, time.UTC), cexpr.Next(time.Date(2017, time.June, 10, 22, 30, 0, 0, time.UTC)))
+		assert.Equal(t, time.Date(2017, time.June, 11, 1, 0, 0, 0, time.UTC), cexpr.Next(time.Date(2017, time.June, 11, 0, 30, 0, 0, time.UTC)))
+	})
+
+	t.Run("should keep intervals on the wall clock when daylight saving time changes", func(t *testing.T) {
+		loc, err := time.LoadLocation("Europe/London")
+		assert.OK(t, err)
+
+		cexpr, err := parseExpression("@every 6h")
+		assert.OK(t, err)
+
+		// Clocks went forward an hour at 01:00 on the 26th of March 2017.
+		next := cexpr.Next(time.Date(2017, time.March, 26, 0, 0, 0, 0, loc))
+		assert.Equal(t, time.Date(2017, time.March, 26, 6, 0, 0, 0, loc), next)
+	})
+
+	t.Run("should align intervals of a day or more to multiples of the interval", func(t *testing.T) {
+		cexpr, err := parseExpression("@every 48h")
+		assert.OK(t, err)
+
+		next := cexpr.Next(from)
+		assert.Equal(t, 0, next.Hour())
+		assert.Equal(t, 48*time.Hour, cexpr.Next(next).Sub(next))
+	})
+
+	t.Run("should shift runs later by an offset", func(t *testing.T) {
+		for expr, expected := range map[string]time.Time{
+			"@every 6h offset 30m":   time.Date(2017, time.June, 10, 12, 30, 0, 0, time.UTC),
+			"@every 15m offset 5m":   time.Date(2017, time.June, 10, 10, 20, 0, 0, time.UTC),
+			"@daily offset 2h30m":    time.Date(2017, time.June, 11, 2, 30, 0, 0, time.UTC),
+			"0 10 * * * offset 20m":  time.Date(2017, time.June, 10, 10, 20, 0, 0, time.UTC),
+			"@hourly offset 10m":     time.Date(2017, time.June, 10, 11, 10, 0, 0, time.UTC),
+			"  @hourly   offset 20m": time.Date(2017, time.June, 10, 10, 20, 0, 0, time.UTC),
+		} {
+			cexpr, err := parseExpression(expr)
+			assert.OK(t, err)
+			assert.Equal(t, expected, cexpr.Next(from))
+		}
+	})
+
+	t.Run("should error if given an invalid expression", func(t *testing.T) {
+		for _, expr := range []string{
+			"",
+			"Hello, World!",
+			"@every",
+			"@every soon",
+			"@every 0s",
+			"@every 6h 12h",
+			"@every 1h offset 1h",
+			"@daily offset -1h",
+			"@daily offset later",
+		} {
+			_, err := parseExpression(expr)
+			assert.NotOK(t, err)
+		}
+	})
+}
+
+func TestNextRuns(t *testing.T) {
+	t.Run("should return the next runs of an expression", func(t *testing.T) {
+		from := time.Date(2017, time.June, 10, 10, 15, 0, 0, time.UTC)
+
+		runs, err := NextRuns("@every 6h offset 1h", from, 3)
+
+		assert.OK(t, err)
+		assert.Equal(t, []time.Time{
+			time.Date(2017, time.June, 10, 13, 0, 0, 0, time.UTC),
+			time.Date(2017, time.June, 10, 19, 0, 0, 0, time.UTC),
+			time.Date(2017, time.June, 11, 1, 0, 0, 0, time.UTC),
+		}, runs)
+	})
+
+	t.Run("should error if given an invalid expression", func(t *testing.T) {
+		_, err := NextRuns("@every", time.Now(), 3)
+
+		assert.NotOK(t, err)
+	})
+}
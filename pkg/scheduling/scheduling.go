@@ -1,6 +1,8 @@
 package scheduling
 
 import (
+	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/gorhill/cronexpr"
@@ -11,53 +13,297 @@ type expression interface {
 }
 
 // For testing
-var parseExpr = parseCronExpr
+var parseExpr = parseExpression
 var timeNow = time.Now
+var randInt63n = rand.Int63n
 
 func parseCronExpr(expr string) (expression, error) {
 	return cronexpr.Parse(expr)
 }
 
+// Interval estimates the time between runs of the given cron-like expression, by looking at the
+// longest gap between the times it would run over the next day, or at least the next two runs.
+// Schedules like "@every 7h" have a shorter gap before each midnight, which shouldn't be mistaken
+// for the interval. For other irregular schedules this is only a rough guide.
+func Interval(expr string) (time.Duration, error) {
+	cexpr, err := parseExpr(expr)
+	if err != nil {
+		return 0, err
+	}
+
+	return interval(cexpr, timeNow()), nil
+}
+
+// interval estimates the time between runs of the given expression after the given time, as
+// Interval does.
+func interval(cexpr expression, from time.Time) time.Duration {
+	prev := cexpr.Next(from)
+	until := prev.Add(day)
+
+	var longest time.Duration
+
+	for i := 0; i < maxIntervalRuns; i++ {
+		next := cexpr.Next(prev)
+		if !next.After(prev) {
+			break
+		}
+
+		if gap := next.Sub(prev); gap > longest {
+			longest = gap
+		}
+
+		if next.After(until) {
+			break
+		}
+
+		prev = next
+	}
+
+	return longest
+}
+
+// maxIntervalRuns limits how many runs Interval looks at, for schedules that run very often.
+const maxIntervalRuns = 1000
+
+// Misfire is a policy for what to do about scheduled runs that were missed because the previous
+// run was still going when they came due.
+type Misfire string
+
+// The available misfire policies.
+const (
+	// MisfireSkip skips any missed runs, waiting for the next one that's due. This is the default.
+	MisfireSkip Misfire = "skip"
+	// MisfireOnce runs once straight away to catch up, no matter how many runs were missed.
+	MisfireOnce Misfire = "once"
+	// MisfireQueue runs every missed run, one after another.
+	MisfireQueue Misfire = "queue"
+)
+
+// ParseMisfire returns the misfire policy with the given name. An empty name gives MisfireSkip.
+func ParseMisfire(name string) (Misfire, error) {
+	switch Misfire(name) {
+	case "", MisfireSkip:
+		return MisfireSkip, nil
+	case MisfireOnce, MisfireQueue:
+		return Misfire(name), nil
+	}
+
+	return "", fmt.Errorf("scheduling: unknown misfire policy '%s', expected one of: skip, once, queue", name)
+}
+
+// Options configures optional behaviour of Schedule.
+type Options struct {
+	// OnNext is called with the time of the next run, each time a run is scheduled.
+	OnNext func(next time.Time)
+	// OnSkip is called with the number of runs skipped, each time missed runs are skipped.
+	OnSkip func(missed int)
+	// RunOnStart makes the function run once straight away, before waiting for the first run.
+	RunOnStart bool
+	// Trigger runs the function out of schedule each time a value is received on it. The next
+	// scheduled run still happens when it was due to.
+	Trigger <-chan struct{}
+	// Misfire decides what happens to runs that were missed because a run was still going when
+	// they came due. Defaults to MisfireSkip.
+	Misfire Misfire
+	// Location is the time zone the expression is evaluated in. Defaults to the local time zone.
+	Location *time.Location
+	// Jitter delays each scheduled run by a random amount of time, up to this long, so that many
+	// hosts sharing a schedule don't all run at once.
+	Jitter time.Duration
+}
+
 // ScheduleFunc takes a cron-like expression, and a callback function to execute on a schedule. It
 // will run indefinitely, or until there is an error. If there is an error, it will be returned.
 // This function is synchronous, and will block.
 //
-// The `expr` parameter is the cron-like expression (we're using github.com/gorhill/cronexpr).
+// The `expr` parameter is the cron-like expression (we're using github.com/gorhill/cronexpr), or
+// an interval like "@every 6h". Either may be followed by an offset, like "@daily offset 2h".
 // The `quit` parameter is a channel that can be sent any int that will break the loop.
 // The `fn` parameter is a callback function that will be called each scheduled interval.
 func ScheduleFunc(done <-chan int, expr string, fn func() error) error {
-	prev := timeNow()
+	return Schedule(done, expr, fn, Options{})
+}
 
+// Schedule works like ScheduleFunc, but takes some Options to customise it's behaviour.
+func Schedule(done <-chan int, expr string, fn func() error, opts Options) error {
 	cexpr, err := parseExpr(expr)
 	if err != nil {
 		return err
 	}
-	errs := make(chan error, 1)
 
-	go func() {
-		for {
-			next := cexpr.Next(prev)
-			dur := next.Sub(prev)
+	// Jitter as long as the interval could delay a run past the next one.
+	if opts.Jitter > 0 {
+		if every := interval(cexpr, timeNow()); opts.Jitter >= every {
+			return fmt.Errorf("scheduling: jitter of %s must be shorter than the interval between runs, %s", opts.Jitter, every)
+		}
+	}
+
+	if opts.RunOnStart {
+		err = fn()
+		if err != nil {
+			return err
+		}
+	}
+
+	s := &scheduler{
+		expr: cexpr,
+		fn:   fn,
+		opts: opts,
+	}
+
+	start := timeNow()
+	if opts.Location != nil {
+		// Expressions are evaluated in the time zone of the times they're given.
+		start = start.In(opts.Location)
+	}
+
+	return s.run(done, start)
+}
+
+// waitResult describes how waiting for a scheduled run ended.
+type waitResult int
+
+const (
+	// runDue means the scheduled run is due.
+	runDue waitResult = iota
+	// runMissed means the scheduled run came due while a triggered run was still going.
+	runMissed
+	// stopped means the schedule was stopped.
+	stopped
+)
+
+// scheduler runs a function on a schedule.
+type scheduler struct {
+	expr expression
+	fn   func() error
+	opts Options
+}
+
+// run runs the function each time it's due after `prev`, until the schedule is stopped, or the
+// function returns an error.
+func (s *scheduler) run(done <-chan int, prev time.Time) error {
+	for {
+		next := s.expr.Next(prev)
+		due := next.Add(s.jitter())
+
+		if s.opts.OnNext != nil {
+			s.opts.OnNext(due)
+		}
+
+		result, err := s.wait(done, due)
+		if err != nil || result == stopped {
+			return err
+		}
+
+		if result == runDue {
+			// Call the function, if we error, bail and return it.
+			err = s.fn()
+			if err != nil {
+				return err
+			}
 
 			// Keep the last time, we'll use it in the next loop for better accuracy.
 			prev = next
+		}
 
-			timer := time.NewTimer(dur)
-
-			select {
-			case <-timer.C:
-				// Call the function, if we error, bail and return it.
-				err = fn()
-				if err != nil {
-					errs <- err
-					return
-				}
-			case <-done:
-				errs <- nil
-				return
+		prev, err = s.catchUp(prev)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// wait waits for the run at `due` to come due, running the function each time it's triggered in
+// the meantime.
+func (s *scheduler) wait(done <-chan int, due time.Time) (waitResult, error) {
+	timer := time.NewTimer(due.Sub(timeNow()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return runDue, nil
+		case <-s.opts.Trigger:
+			// Triggered runs don't affect the schedule, so carry on waiting afterwards, unless the
+			// scheduled run came due while the triggered one was going.
+			err := s.fn()
+			if err != nil {
+				return stopped, err
 			}
+
+			if !due.After(timeNow()) {
+				return runMissed, nil
+			}
+		case <-done:
+			return stopped, nil
+		}
+	}
+}
+
+// catchUp deals with any runs that came due after `prev` while the function was running, according
+// to the misfire policy. It returns the time the next run should be scheduled after.
+func (s *scheduler) catchUp(prev time.Time) (time.Time, error) {
+	missed, last := missedRuns(s.expr, prev, timeNow())
+	if missed == 0 {
+		return prev, nil
+	}
+
+	switch s.opts.Misfire {
+	case MisfireQueue:
+		// Scheduling from the last run that happened makes the missed runs due straight away.
+		return prev, nil
+	case MisfireOnce:
+		s.skipped(missed - 1)
+
+		err := s.fn()
+		if err != nil {
+			return last, err
 		}
-	}()
 
-	return <-errs
+		// Runs missed while catching up are skipped, otherwise a backup that always overruns would
+		// never stop catching up.
+		missed, last = missedRuns(s.expr, last, timeNow())
+		s.skipped(missed)
+
+		return last, nil
+	default:
+		s.skipped(missed)
+
+		return last, nil
+	}
+}
+
+// jitter returns a random delay for the next run, if jitter is enabled.
+func (s *scheduler) jitter() time.Duration {
+	if s.opts.Jitter <= 0 {
+		return 0
+	}
+
+	return time.Duration(randInt63n(int64(s.opts.Jitter)))
+}
+
+// skipped reports that the given number of runs were skipped, if any were.
+func (s *scheduler) skipped(missed int) {
+	if missed > 0 && s.opts.OnSkip != nil {
+		s.opts.OnSkip(missed)
+	}
+}
+
+// missedRuns counts the runs that came due after `prev`, up to and including `now`. The time of the
+// last of them is also returned.
+func missedRuns(expr expression, prev time.Time, now time.Time) (int, time.Time) {
+	missed := 0
+	last := prev
+
+	for {
+		next := expr.Next(last)
+
+		// Expressions that have no more runs return the zero time, so also make sure we're moving.
+		if next.After(now) || !next.After(last) {
+			return missed, last
+		}
+
+		missed++
+		last = next
+	}
 }
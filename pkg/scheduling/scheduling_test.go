@@ -51,8 +51,13 @@ func TestScheduleFunc(t *testing.T) {
 		done := make(chan int, 1)
 
 		err := ScheduleFunc(done, "* * * * * * *", func() error {
-			call <- true
-			done <- 1
+			// The test expression keeps returning the same time, so we may be called again before
+			// the done signal is noticed.
+			select {
+			case call <- true:
+				done <- 1
+			default:
+			}
 
 			return nil
 		})
@@ -94,3 +99,331 @@ func TestScheduleFunc(t *testing.T) {
 		assert.NotOK(t, err)
 	})
 }
+
+func TestSchedule(t *testing.T) {
+	t.Run("should report the time of the next run", func(t *testing.T) {
+		defer revertStubs()
+
+		now := time.Now()
+		next := now.Add(1 * time.Millisecond)
+
+		timeNow = timeNowTest
+		timeNowTestTime = now
+
+		parseExpr = parseExprTest
+		parseExprTestExpr = &testExpression{
+			next: next,
+		}
+
+		done := make(chan int, 1)
+
+		var reported time.Time
+
+		err := Schedule(done, "* * * * * * *", func() error {
+			// The test expression keeps returning the same time, so we may be called again before
+			// the done signal is noticed.
+			select {
+			case done <- 1:
+			default:
+			}
+
+			return nil
+		}, Options{
+			OnNext: func(t time.Time) {
+				reported = t
+			},
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, next, reported)
+	})
+}
+
+func TestInterval(t *testing.T) {
+	t.Run("should return the time between runs", func(t *testing.T) {
+		interval, err := Interval("0 * * * *")
+
+		assert.OK(t, err)
+		assert.Equal(t, time.Hour, interval)
+	})
+
+	t.Run("should not mistake the shorter gap before midnight for the interval", func(t *testing.T) {
+		defer revertStubs()
+
+		timeNow = func() time.Time {
+			return time.Date(2017, time.June, 10, 20, 0, 0, 0, time.UTC)
+		}
+
+		interval, err := Interval("@every 7h")
+
+		assert.OK(t, err)
+		assert.Equal(t, 7*time.Hour, interval)
+	})
+
+	t.Run("should error if given an invalid expression", func(t *testing.T) {
+		_, err := Interval("Hello, World!")
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestSchedule_RunOnStart(t *testing.T) {
+	t.Run("should run the function before the first scheduled run", func(t *testing.T) {
+		defer revertStubs()
+
+		parseExpr = parseExprTest
+		parseExprTestExpr = &testExpression{
+			next: time.Now().Add(time.Hour),
+		}
+
+		done := make(chan int, 1)
+		calls := 0
+
+		err := Schedule(done, "0 3 * * *", func() error {
+			calls++
+			done <- 1
+
+			return nil
+		}, Options{
+			RunOnStart: true,
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should error if the first run fails", func(t *testing.T) {
+		done := make(chan int, 1)
+
+		err := Schedule(done, "0 3 * * *", func() error {
+			return errors.New("This is an error")
+		}, Options{
+			RunOnStart: true,
+		})
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestSchedule_Trigger(t *testing.T) {
+	t.Run("should run the function each time it's triggered", func(t *testing.T) {
+		defer revertStubs()
+
+		parseExpr = parseExprTest
+		parseExprTestExpr = &testExpression{
+			next: time.Now().Add(time.Hour),
+		}
+
+		done := make(chan int, 1)
+		trigger := make(chan struct{}, 1)
+		calls := 0
+
+		trigger <- struct{}{}
+
+		err := Schedule(done, "0 3 * * *", func() error {
+			calls++
+
+			if calls == 2 {
+				done <- 1
+			} else {
+				trigger <- struct{}{}
+			}
+
+			return nil
+		}, Options{
+			Trigger: trigger,
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should error if a triggered run fails", func(t *testing.T) {
+		defer revertStubs()
+
+		parseExpr = parseExprTest
+		parseExprTestExpr = &testExpression{
+			next: time.Now().Add(time.Hour),
+		}
+
+		done := make(chan int, 1)
+		trigger := make(chan struct{}, 1)
+
+		trigger <- struct{}{}
+
+		err := Schedule(done, "0 3 * * *", func() error {
+			return errors.New("This is an error")
+		}, Options{
+			Trigger: trigger,
+		})
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestSchedule_Misfire(t *testing.T) {
+	base := time.Now()
+	ms := time.Millisecond
+
+	ticks := []time.Time{base.Add(ms), base.Add(2 * ms), base.Add(3 * ms), base.Add(4 * ms), base.Add(time.Hour)}
+
+	// The first run overruns, so the second and third runs are missed. The schedule is stopped
+	// after the given number of runs.
+	schedule := func(misfire Misfire, runs int) (nexts []time.Time, skipped int) {
+		defer revertStubs()
+
+		clock := base
+
+		timeNow = func() time.Time {
+			return clock
+		}
+
+		parseExpr = func(expr string) (expression, error) {
+			return testSequence(ticks), nil
+		}
+
+		done := make(chan int, 1)
+		calls := 0
+
+		err := Schedule(done, "* * * * *", func() error {
+			calls++
+
+			if calls == 1 {
+				clock = base.Add(3 * ms)
+			}
+
+			if calls == runs {
+				done <- 1
+			}
+
+			return nil
+		}, Options{
+			Misfire: misfire,
+			OnNext: func(next time.Time) {
+				nexts = append(nexts, next)
+			},
+			OnSkip: func(missed int) {
+				skipped += missed
+			},
+		})
+
+		assert.OK(t, err)
+
+		return nexts, skipped
+	}
+
+	t.Run("should skip missed runs by default", func(t *testing.T) {
+		nexts, skipped := schedule("", 2)
+
+		assert.Equal(t, []time.Time{ticks[0], ticks[3], ticks[4]}, nexts)
+		assert.Equal(t, 2, skipped)
+	})
+
+	t.Run("should run once to catch up on missed runs", func(t *testing.T) {
+		nexts, skipped := schedule(MisfireOnce, 3)
+
+		assert.Equal(t, []time.Time{ticks[0], ticks[3], ticks[4]}, nexts)
+		assert.Equal(t, 1, skipped)
+	})
+
+	t.Run("should run every missed run if they're queued", func(t *testing.T) {
+		nexts, skipped := schedule(MisfireQueue, 4)
+
+		assert.Equal(t, ticks, nexts)
+		assert.Equal(t, 0, skipped)
+	})
+}
+
+func TestParseMisfire(t *testing.T) {
+	t.Run("should parse misfire policies", func(t *testing.T) {
+		for name, expected := range map[string]Misfire{"": MisfireSkip, "skip": MisfireSkip, "once": MisfireOnce, "queue": MisfireQueue} {
+			misfire, err := ParseMisfire(name)
+
+			assert.OK(t, err)
+			assert.Equal(t, expected, misfire)
+		}
+	})
+
+	t.Run("should error if given an unknown policy", func(t *testing.T) {
+		_, err := ParseMisfire("sometimes")
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestSchedule_Location(t *testing.T) {
+	t.Run("should evaluate the expression in the given time zone", func(t *testing.T) {
+		loc, err := time.LoadLocation("America/New_York")
+		assert.OK(t, err)
+
+		done := make(chan int, 1)
+
+		var reported time.Time
+
+		err = Schedule(done, "0 2 * * *", func() error {
+			return nil
+		}, Options{
+			Location: loc,
+			OnNext: func(next time.Time) {
+				reported = next
+				done <- 1
+			},
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, loc, reported.Location())
+		assert.Equal(t, 2, reported.Hour())
+		assert.Equal(t, 0, reported.Minute())
+	})
+}
+
+func TestSchedule_Jitter(t *testing.T) {
+	t.Run("should delay each run by a random amount of time", func(t *testing.T) {
+		defer revertStubs()
+
+		next := time.Now().Add(time.Hour)
+
+		parseExpr = parseExprTest
+		parseExprTestExpr = testSequence{next, next.Add(time.Hour)}
+
+		var max int64
+
+		randInt63n = func(n int64) int64 {
+			max = n
+			return int64(30 * time.Second)
+		}
+
+		done := make(chan int, 1)
+
+		var reported time.Time
+
+		err := Schedule(done, "0 * * * *", func() error {
+			return nil
+		}, Options{
+			Jitter: time.Minute,
+			OnNext: func(next time.Time) {
+				reported = next
+				done <- 1
+			},
+		})
+
+		assert.OK(t, err)
+		assert.Equal(t, int64(time.Minute), max)
+		assert.Equal(t, next.Add(30*time.Second), reported)
+	})
+
+	t.Run("should error if the jitter isn't shorter than the interval between runs", func(t *testing.T) {
+		called := false
+
+		err := Schedule(make(chan int), "@every 1h", func() error {
+			called = true
+			return nil
+		}, Options{
+			Jitter:     time.Hour,
+			RunOnStart: true,
+		})
+
+		assert.NotOK(t, err)
+		assert.False(t, called, "Expected nothing to run")
+	})
+}
@@ -0,0 +1,135 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JobState records when a scheduled job last ran, so that runs missed while the scheduler wasn't
+// running can be noticed when it starts again.
+type JobState struct {
+	// LastRun is when the job last started running.
+	LastRun time.Time `json:"last_run"`
+	// LastSuccess is when the job last started a run that succeeded.
+	LastSuccess time.Time `json:"last_success,omitempty"`
+}
+
+// StateStore keeps track of the state of scheduled jobs, between restarts.
+type StateStore interface {
+	// Get finds the state of the job with the given name, if there is any.
+	Get(job string) (JobState, bool, error)
+	// Put stores the state of the job with the given name, replacing any existing state.
+	Put(job string, state JobState) error
+}
+
+// FileStateStore is a StateStore that persists state to a JSON file on the local disk.
+type FileStateStore struct {
+	sync.Mutex
+
+	path string
+}
+
+// NewFileStateStore creates a new StateStore instance, using FileStateStore. The file at the given
+// path doesn't need to exist yet.
+func NewFileStateStore(path string) StateStore {
+	return &FileStateStore{
+		path: path,
+	}
+}
+
+// Get finds the state of the given job in the state file.
+func (s *FileStateStore) Get(job string) (JobState, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	states, err := s.read()
+	if err != nil {
+		return JobState{}, false, err
+	}
+
+	state, ok := states[job]
+
+	return state, ok, nil
+}
+
+// Put writes the state of the given job to the state file.
+func (s *FileStateStore) Put(job string, state JobState) error {
+	s.Lock()
+	defer s.Unlock()
+
+	states, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	states[job] = state
+
+	return s.write(states)
+}
+
+// read loads the states from the state file. A missing file is treated as being empty.
+func (s *FileStateStore) read() (map[string]JobState, error) {
+	states := make(map[string]JobState)
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
+
+// write saves the given states to the state file. The file is written to a temporary location
+// first, then renamed, so that an interrupted write can't corrupt it.
+func (s *FileStateStore) write(states map[string]JobState) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".foldup-state")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Missed returns true if the given schedule expression was due to run at least once after the
+// given time of the last run, up to now. If there was no last run, nothing can have been missed.
+// The expression is evaluated in the time zone of `now`.
+func Missed(expr string, lastRun time.Time, now time.Time) (bool, error) {
+	if lastRun.IsZero() {
+		return false, nil
+	}
+
+	runs, err := NextRuns(expr, lastRun.In(now.Location()), 1)
+	if err != nil {
+		return false, err
+	}
+
+	return len(runs) > 0 && !runs[0].After(now), nil
+}
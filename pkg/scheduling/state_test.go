@@ -0,0 +1,101 @@
+package scheduling
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestFileStateStore(t *testing.T) {
+	t.Run("should store and retrieve job state", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-state")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		filename := path.Join(dir, "state.json")
+		lastRun := time.Date(2017, time.June, 10, 3, 0, 0, 0, time.UTC)
+
+		store := NewFileStateStore(filename)
+
+		_, ok, err := store.Get("photos")
+		assert.OK(t, err)
+		assert.False(t, ok, "Expected no state yet")
+
+		err = store.Put("photos", JobState{LastRun: lastRun, LastSuccess: lastRun})
+		assert.OK(t, err)
+
+		err = store.Put("documents", JobState{LastRun: lastRun})
+		assert.OK(t, err)
+
+		// A new store should read the same file.
+		state, ok, err := NewFileStateStore(filename).Get("photos")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected state to be found")
+		assert.True(t, lastRun.Equal(state.LastRun), "Expected the last run to be stored")
+		assert.True(t, lastRun.Equal(state.LastSuccess), "Expected the last success to be stored")
+
+		state, ok, err = store.Get("documents")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected state to be found")
+		assert.True(t, state.LastSuccess.IsZero(), "Expected no last success")
+	})
+
+	t.Run("should error if the state file is invalid", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "foldup-state")
+		assert.OK(t, err)
+
+		defer os.Remove(file.Name())
+
+		file.WriteString("{oops")
+		file.Close()
+
+		_, _, err = NewFileStateStore(file.Name()).Get("photos")
+		assert.NotOK(t, err)
+	})
+}
+
+func TestMissed(t *testing.T) {
+	lastRun := time.Date(2017, time.June, 10, 3, 0, 0, 0, time.UTC)
+
+	t.Run("should return true if a run was due since the last run", func(t *testing.T) {
+		missed, err := Missed("0 3 * * *", lastRun, lastRun.Add(25*time.Hour))
+
+		assert.OK(t, err)
+		assert.True(t, missed, "Expected a missed run")
+	})
+
+	t.Run("should return false if no run was due since the last run", func(t *testing.T) {
+		missed, err := Missed("0 3 * * *", lastRun, lastRun.Add(23*time.Hour))
+
+		assert.OK(t, err)
+		assert.False(t, missed, "Expected no missed run")
+	})
+
+	t.Run("should return false if there was no last run", func(t *testing.T) {
+		missed, err := Missed("0 3 * * *", time.Time{}, lastRun)
+
+		assert.OK(t, err)
+		assert.False(t, missed, "Expected no missed run")
+	})
+
+	t.Run("should evaluate the expression in the time zone of now", func(t *testing.T) {
+		loc := time.FixedZone("UTC+5", 5*60*60)
+
+		// 03:00 in UTC+5 is 22:00 UTC, so is due before 23:00 UTC.
+		missed, err := Missed("0 3 * * *", lastRun, time.Date(2017, time.June, 10, 23, 0, 0, 0, time.UTC).In(loc))
+
+		assert.OK(t, err)
+		assert.True(t, missed, "Expected a missed run")
+	})
+
+	t.Run("should error if given an invalid expression", func(t *testing.T) {
+		_, err := Missed("whenever", lastRun, lastRun)
+
+		assert.NotOK(t, err)
+	})
+}
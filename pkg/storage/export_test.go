@@ -0,0 +1,12 @@
+package storage
+
+import (
+	"math/rand"
+	"time"
+)
+
+func revertStubs() {
+	randFloat64 = rand.Float64
+	timeAfter = time.After
+	timeNow = time.Now
+}
@@ -2,11 +2,66 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
+// ErrNotFound is returned when fetching an object that doesn't exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ErrPreconditionFailed is returned when storing an object conditionally, if the object has been
+// replaced since the generation that was given.
+var ErrPreconditionFailed = errors.New("storage: object has changed since it was fetched")
+
+// ErrUnsupported is returned by gateways that wrap another gateway, if the wrapped gateway can't do
+// what's asked of it.
+var ErrUnsupported = errors.New("storage: gateway doesn't support the operation")
+
 // Gateway provides an interface for interacting with some kind of storage system. This could be
 // filesystem-based, in-memory, in some remote storage bucket, etc.
 type Gateway interface {
 	Store(ctx context.Context, filename string, in io.Reader) error
 }
+
+// Checker is implemented by gateways that can check whether their storage system is reachable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// ObjectInfo describes an object that has been stored.
+type ObjectInfo struct {
+	// Name is the name the object was stored with.
+	Name string
+	// Size is the size of the object, in bytes.
+	Size int64
+	// Created is the time the object was stored.
+	Created time.Time
+}
+
+// Lister is implemented by gateways that can list the objects they've stored.
+type Lister interface {
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+// Fetcher is implemented by gateways that can read back the objects they've stored. If the object
+// doesn't exist, ErrNotFound is returned. The returned reader must be closed.
+type Fetcher interface {
+	Fetch(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// Deleter is implemented by gateways that can delete objects they've stored.
+type Deleter interface {
+	Delete(ctx context.Context, name string) error
+}
+
+// Generational is implemented by gateways that keep track of the generation of each object, so
+// that an object can be replaced only if nobody else has replaced it since it was fetched.
+type Generational interface {
+	// FetchGeneration works like Fetch, but also returns the generation of the fetched object.
+	FetchGeneration(ctx context.Context, name string) (io.ReadCloser, int64, error)
+	// StoreGeneration works like Store, but only stores the object if the object stored under the
+	// same name is still at the given generation, or if the generation is 0, if there isn't one.
+	// Otherwise, ErrPreconditionFailed is returned.
+	StoreGeneration(ctx context.Context, name string, in io.Reader, generation int64) error
+}
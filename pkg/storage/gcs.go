@@ -3,38 +3,177 @@ package storage
 import (
 	"context"
 	"io"
-	"log"
+	"net/http"
+	"time"
 
+	gstorage "cloud.google.com/go/storage"
+	"github.com/SeerUK/foldup/pkg/logging"
 	"github.com/SeerUK/foldup/pkg/storage/gcs"
+	"google.golang.org/api/googleapi"
 )
 
 // GCSGateway implements the Gateway interface for interacting with Google Cloud Storage.
 type GCSGateway struct {
 	bucket string
 	client gcs.Client
+	logger logging.Logger
 }
 
 // NewGCSGateway creates a new Gateway instance, using GCSGateway.
-func NewGCSGateway(client gcs.Client, bucket string) Gateway {
+func NewGCSGateway(client gcs.Client, bucket string, logger logging.Logger) Gateway {
 	return &GCSGateway{
 		bucket: bucket,
 		client: client,
+		logger: logger,
 	}
 }
 
 // Store attempts to write a file via the Gateway.
 func (g *GCSGateway) Store(ctx context.Context, filename string, reader io.Reader) error {
-	log.Printf("Started uploading archive '%s'...", filename)
+	logger := logging.FromContext(ctx, g.logger).With(logging.Archive(filename))
+	logger.Info("Started uploading archive")
+
+	started := time.Now()
+
+	// Cancelling the writer's context aborts the upload, rather than committing a partial object.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	writer := g.client.Bucket(g.bucket).Object(filename).NewWriteCloser(ctx)
-	_, err := io.Copy(writer, reader)
 
-	cerr := writer.Close()
-	if cerr != nil {
-		return cerr
+	n, err := io.Copy(writer, reader)
+	if err != nil {
+		cancel()
+		writer.Close()
+
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Finished uploading archive", logging.Bytes(n), logging.Duration(time.Since(started)))
+
+	return nil
+}
+
+// Check makes sure the bucket can be reached. Being denied access to the bucket's metadata still
+// counts as reachable, because accounts that can only write objects aren't allowed to read it.
+func (g *GCSGateway) Check(ctx context.Context) error {
+	_, err := g.client.Bucket(g.bucket).Attrs(ctx)
+
+	if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusForbidden {
+		return nil
+	}
+
+	return err
+}
+
+// List lists the objects in the bucket whose names start with the given prefix.
+func (g *GCSGateway) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects, err := g.client.Bucket(g.bucket).Objects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []ObjectInfo{}
+	for _, o := range objects {
+		infos = append(infos, ObjectInfo{
+			Name:    o.Name,
+			Size:    o.Size,
+			Created: o.Created,
+		})
+	}
+
+	return infos, nil
+}
+
+// Fetch opens the object in the bucket with the given name for reading.
+func (g *GCSGateway) Fetch(ctx context.Context, name string) (io.ReadCloser, error) {
+	reader, err := g.client.Bucket(g.bucket).Object(name).NewReader(ctx)
+	if err == gstorage.ErrObjectNotExist {
+		return nil, ErrNotFound
+	}
+
+	return reader, err
+}
+
+// FetchGeneration opens the object in the bucket with the given name for reading, along with its
+// generation. If the object is replaced between finding its generation and opening it,
+// ErrPreconditionFailed is returned.
+func (g *GCSGateway) FetchGeneration(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	object := g.client.Bucket(g.bucket).Object(name)
+
+	attrs, err := object.Attrs(ctx)
+	if err == gstorage.ErrObjectNotExist {
+		return nil, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reader, err := object.If(gstorage.Conditions{GenerationMatch: attrs.Generation}).NewReader(ctx)
+	if err == gstorage.ErrObjectNotExist || isPreconditionFailed(err) {
+		return nil, 0, ErrPreconditionFailed
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return reader, attrs.Generation, nil
+}
+
+// StoreGeneration writes the object in the bucket with the given name, if it's still at the given
+// generation, or if the generation is 0, if it doesn't exist yet.
+func (g *GCSGateway) StoreGeneration(ctx context.Context, name string, in io.Reader, generation int64) error {
+	conds := gstorage.Conditions{GenerationMatch: generation}
+	if generation == 0 {
+		conds = gstorage.Conditions{DoesNotExist: true}
+	}
+
+	// Cancelling the writer's context aborts the write, rather than committing a partial object.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writer := g.client.Bucket(g.bucket).Object(name).If(conds).NewWriteCloser(ctx)
+
+	_, err := io.Copy(writer, in)
+	if err != nil {
+		cancel()
+		writer.Close()
+
+		return err
 	}
 
-	log.Printf("Finished uploading archive '%s'...", filename)
+	err = writer.Close()
+	if isPreconditionFailed(err) {
+		return ErrPreconditionFailed
+	}
 
 	return err
 }
+
+// Delete deletes the object in the bucket with the given name. If there's no such object,
+// ErrNotFound is returned.
+func (g *GCSGateway) Delete(ctx context.Context, name string) error {
+	g.logger.Info("Deleting archive", logging.Archive(name))
+
+	err := g.client.Bucket(g.bucket).Object(name).Delete(ctx)
+	if err == gstorage.ErrObjectNotExist {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// isPreconditionFailed checks if the given error is GCS refusing a request because one of its
+// preconditions didn't hold.
+func isPreconditionFailed(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+
+	return ok && apiErr.Code == http.StatusPreconditionFailed
+}
@@ -1,16 +1,26 @@
 package gcs
 
-import "cloud.google.com/go/storage"
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+	xcontext "golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+)
 
 // StorageBucket is the interface that lets us mock a *storage.BucketHandle instance. We can
 // construct a Bucket with a StorageBucket.
 type StorageBucket interface {
+	Attrs(ctx xcontext.Context) (*storage.BucketAttrs, error)
 	Object(name string) *storage.ObjectHandle
+	Objects(ctx xcontext.Context, q *storage.Query) *storage.ObjectIterator
 }
 
 // Bucket is used by our Client interface for interacting with buckets in GCS.
 type Bucket interface {
+	Attrs(ctx context.Context) (*storage.BucketAttrs, error)
 	Object(name string) Object
+	Objects(ctx context.Context, prefix string) ([]*storage.ObjectAttrs, error)
 }
 
 // GoogleBucket is an implementation of Bucket that can use the real Google Cloud Storage client
@@ -26,6 +36,11 @@ func NewGoogleBucket(bucket StorageBucket) Bucket {
 	}
 }
 
+// Attrs wraps a call to the underlying StorageBucket, fetching the bucket's metadata.
+func (b *GoogleBucket) Attrs(ctx context.Context) (*storage.BucketAttrs, error) {
+	return b.bucket.Attrs(ctx)
+}
+
 // Object wraps a call to the underlying StorageBucket, creating an Object, which is like a
 // *storage.ObjectHandle. This should be idempotent.
 func (b *GoogleBucket) Object(name string) Object {
@@ -33,3 +48,23 @@ func (b *GoogleBucket) Object(name string) Object {
 
 	return NewGoogleObject(obj)
 }
+
+// Objects wraps a call to the underlying StorageBucket, listing all of the objects in the bucket
+// whose names start with the given prefix.
+func (b *GoogleBucket) Objects(ctx context.Context, prefix string) ([]*storage.ObjectAttrs, error) {
+	it := b.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	objects := []*storage.ObjectAttrs{}
+
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, attrs)
+	}
+}
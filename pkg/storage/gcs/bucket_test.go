@@ -1,14 +1,27 @@
 package gcs
 
 import (
+	"context"
 	"testing"
 
 	"cloud.google.com/go/storage"
 	"github.com/SeerUK/assert"
+	xcontext "golang.org/x/net/context"
 )
 
 type TestStorageBucket struct {
 	object string
+	attrs  bool
+}
+
+func (b *TestStorageBucket) Attrs(ctx xcontext.Context) (*storage.BucketAttrs, error) {
+	b.attrs = true
+
+	return &storage.BucketAttrs{}, nil
+}
+
+func (b *TestStorageBucket) Objects(ctx xcontext.Context, q *storage.Query) *storage.ObjectIterator {
+	return nil
 }
 
 func (b *TestStorageBucket) Object(name string) *storage.ObjectHandle {
@@ -29,3 +42,15 @@ func TestGoogleBucket_Object(t *testing.T) {
 		assert.Equal(t, sb.object, name)
 	})
 }
+
+func TestGoogleBucket_Attrs(t *testing.T) {
+	t.Run("should fetch the bucket's attributes", func(t *testing.T) {
+		sb := &TestStorageBucket{}
+		gb := NewGoogleBucket(sb)
+
+		_, err := gb.Attrs(context.Background())
+
+		assert.OK(t, err)
+		assert.True(t, sb.attrs, "Expected attrs to have been called")
+	})
+}
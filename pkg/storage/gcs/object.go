@@ -12,11 +12,19 @@ import (
 // construct on Object with a StorageObject.
 type StorageObject interface {
 	NewWriter(ctx xcontext.Context) *storage.Writer
+	NewReader(ctx xcontext.Context) (*storage.Reader, error)
+	Attrs(ctx xcontext.Context) (*storage.ObjectAttrs, error)
+	Delete(ctx xcontext.Context) error
+	If(conds storage.Conditions) *storage.ObjectHandle
 }
 
 // Object is used by our Bucket interface for interacting with objects in GCS.
 type Object interface {
 	NewWriteCloser(ctx context.Context) io.WriteCloser
+	NewReader(ctx context.Context) (io.ReadCloser, error)
+	Attrs(ctx context.Context) (*storage.ObjectAttrs, error)
+	Delete(ctx context.Context) error
+	If(conds storage.Conditions) Object
 }
 
 // GoogleObject is an implementation of Object that can use the real Google Cloud Storage client
@@ -37,3 +45,30 @@ func NewGoogleObject(object StorageObject) Object {
 func (o *GoogleObject) NewWriteCloser(ctx context.Context) io.WriteCloser {
 	return o.object.NewWriter(ctx)
 }
+
+// Delete wraps a call to the underlying StorageObject, deleting the object.
+func (o *GoogleObject) Delete(ctx context.Context) error {
+	return o.object.Delete(ctx)
+}
+
+// NewReader wraps a call to the underlying StorageObject, creating an io.ReadCloser that reads the
+// object's content.
+func (o *GoogleObject) NewReader(ctx context.Context) (io.ReadCloser, error) {
+	reader, err := o.object.NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// Attrs wraps a call to the underlying StorageObject, fetching the object's metadata.
+func (o *GoogleObject) Attrs(ctx context.Context) (*storage.ObjectAttrs, error) {
+	return o.object.Attrs(ctx)
+}
+
+// If wraps a call to the underlying StorageObject, creating an Object whose operations only happen
+// if the given conditions are met, e.g. if the object's generation hasn't changed.
+func (o *GoogleObject) If(conds storage.Conditions) Object {
+	return NewGoogleObject(o.object.If(conds))
+}
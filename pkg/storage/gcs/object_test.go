@@ -11,6 +11,30 @@ import (
 
 type TestStorageObject struct {
 	newWriter bool
+	deleted   bool
+	conds     storage.Conditions
+	readerErr error
+	attrs     *storage.ObjectAttrs
+}
+
+func (o *TestStorageObject) NewReader(ctx xcontext.Context) (*storage.Reader, error) {
+	return &storage.Reader{}, o.readerErr
+}
+
+func (o *TestStorageObject) Attrs(ctx xcontext.Context) (*storage.ObjectAttrs, error) {
+	return o.attrs, nil
+}
+
+func (o *TestStorageObject) If(conds storage.Conditions) *storage.ObjectHandle {
+	o.conds = conds
+
+	return &storage.ObjectHandle{}
+}
+
+func (o *TestStorageObject) Delete(ctx xcontext.Context) error {
+	o.deleted = true
+
+	return nil
 }
 
 func (o *TestStorageObject) NewWriter(ctx xcontext.Context) *storage.Writer {
@@ -29,3 +53,63 @@ func TestGoogleObject_NewWriteCloser(t *testing.T) {
 		assert.True(t, sob.newWriter, "Expected newWriter to have been called")
 	})
 }
+
+func TestGoogleObject_Delete(t *testing.T) {
+	t.Run("should delete the object", func(t *testing.T) {
+		sob := &TestStorageObject{}
+		gob := NewGoogleObject(sob)
+
+		err := gob.Delete(context.Background())
+
+		assert.OK(t, err)
+		assert.True(t, sob.deleted, "Expected delete to have been called")
+	})
+}
+
+func TestGoogleObject_NewReader(t *testing.T) {
+	t.Run("should create an io.ReadCloser", func(t *testing.T) {
+		sob := &TestStorageObject{}
+		gob := NewGoogleObject(sob)
+
+		reader, err := gob.NewReader(context.Background())
+
+		assert.OK(t, err)
+		assert.NotEqual(t, nil, reader)
+	})
+
+	t.Run("should return a nil reader if there's an error", func(t *testing.T) {
+		sob := &TestStorageObject{readerErr: storage.ErrObjectNotExist}
+		gob := NewGoogleObject(sob)
+
+		reader, err := gob.NewReader(context.Background())
+
+		assert.Equal(t, storage.ErrObjectNotExist, err)
+		assert.True(t, reader == nil, "Expected a nil reader")
+	})
+}
+
+func TestGoogleObject_Attrs(t *testing.T) {
+	t.Run("should fetch the object's metadata", func(t *testing.T) {
+		attrs := &storage.ObjectAttrs{Generation: 3}
+
+		sob := &TestStorageObject{attrs: attrs}
+		gob := NewGoogleObject(sob)
+
+		result, err := gob.Attrs(context.Background())
+
+		assert.OK(t, err)
+		assert.Equal(t, attrs, result)
+	})
+}
+
+func TestGoogleObject_If(t *testing.T) {
+	t.Run("should create an object with the given conditions", func(t *testing.T) {
+		sob := &TestStorageObject{}
+		gob := NewGoogleObject(sob)
+
+		conditional := gob.If(storage.Conditions{GenerationMatch: 3})
+
+		assert.NotEqual(t, nil, conditional)
+		assert.Equal(t, int64(3), sob.conds.GenerationMatch)
+	})
+}
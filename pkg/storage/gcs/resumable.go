@@ -0,0 +1,168 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// ResumableEndpoint is the base URL of the GCS JSON API used for uploading media.
+const ResumableEndpoint = "https://www.googleapis.com/upload/storage/v1"
+
+// statusResumeIncomplete is the status code GCS responds with when part of a resumable upload has
+// been received, but the upload is not yet complete.
+const statusResumeIncomplete = 308
+
+// ErrSessionExpired is returned when a resumable upload session no longer exists, meaning the
+// upload will have to be started again from the beginning.
+var ErrSessionExpired = errors.New("gcs: resumable upload session has expired")
+
+// ResumableClient is used to upload objects to GCS in chunks, using resumable upload sessions.
+// Sessions are identified by a URI, which remains valid for about a week, so an upload can be
+// resumed by an entirely different process than the one that started it.
+type ResumableClient interface {
+	// StartSession begins a new resumable upload of the named object, returning the session URI.
+	StartSession(ctx context.Context, bucket, name string) (string, error)
+	// QueryOffset asks GCS how many bytes of the upload it has persisted, and whether the upload
+	// has been completed.
+	QueryOffset(ctx context.Context, uri string) (int64, bool, error)
+	// UploadChunk sends the given chunk, starting at the given offset. If the total size of the
+	// object is known, it should be given, otherwise it should be -1. The offset GCS expects the
+	// next chunk to start at is returned, along with whether the upload has been completed.
+	UploadChunk(ctx context.Context, uri string, offset int64, chunk []byte, total int64) (int64, bool, error)
+}
+
+// HTTPResumableClient is an implementation of ResumableClient that talks to the GCS JSON API using
+// the given HTTP client, which is expected to handle authentication.
+type HTTPResumableClient struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewHTTPResumableClient produces a new ResumableClient instance, using HTTPResumableClient.
+func NewHTTPResumableClient(client *http.Client, endpoint string) ResumableClient {
+	return &HTTPResumableClient{
+		client:   client,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+	}
+}
+
+// StartSession begins a new resumable upload session for the given object.
+func (c *HTTPResumableClient) StartSession(ctx context.Context, bucket, name string) (string, error) {
+	query := url.Values{}
+	query.Set("uploadType", "resumable")
+	query.Set("name", name)
+
+	target := fmt.Sprintf("%s/b/%s/o?%s", c.endpoint, url.PathEscape(bucket), query.Encode())
+
+	req, err := http.NewRequest(http.MethodPost, target, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("X-Upload-Content-Type", "application/octet-stream")
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+
+	defer drainAndClose(res)
+
+	if err := googleapi.CheckResponse(res); err != nil {
+		return "", err
+	}
+
+	uri := res.Header.Get("Location")
+	if uri == "" {
+		return "", errors.New("gcs: resumable upload session URI missing from response")
+	}
+
+	return uri, nil
+}
+
+// QueryOffset finds out how much of the upload in the given session GCS has persisted.
+func (c *HTTPResumableClient) QueryOffset(ctx context.Context, uri string) (int64, bool, error) {
+	return c.put(ctx, uri, nil, "bytes */*")
+}
+
+// UploadChunk uploads a chunk of data to the given session.
+func (c *HTTPResumableClient) UploadChunk(ctx context.Context, uri string, offset int64, chunk []byte, total int64) (int64, bool, error) {
+	size := "*"
+	if total >= 0 {
+		size = strconv.FormatInt(total, 10)
+	}
+
+	contentRange := fmt.Sprintf("bytes */%s", size)
+	if len(chunk) > 0 {
+		contentRange = fmt.Sprintf("bytes %d-%d/%s", offset, offset+int64(len(chunk))-1, size)
+	}
+
+	return c.put(ctx, uri, chunk, contentRange)
+}
+
+// put sends a PUT request to the given session URI, and interprets the response in terms of the
+// resumable upload protocol.
+func (c *HTTPResumableClient) put(ctx context.Context, uri string, body []byte, contentRange string) (int64, bool, error) {
+	req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	req.Header.Set("Content-Range", contentRange)
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, false, err
+	}
+
+	defer drainAndClose(res)
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return 0, true, nil
+	case statusResumeIncomplete:
+		offset, err := parseRangeHeader(res.Header.Get("Range"))
+		return offset, false, err
+	case http.StatusNotFound, http.StatusGone:
+		return 0, false, ErrSessionExpired
+	}
+
+	return 0, false, googleapi.CheckResponse(res)
+}
+
+// parseRangeHeader reads the Range header of an incomplete upload response, which looks like
+// "bytes=0-1234", and returns the offset the next chunk should start from. If there is no header,
+// then no bytes have been persisted yet.
+func parseRangeHeader(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+
+	dash := strings.LastIndex(header, "-")
+	if !strings.HasPrefix(header, "bytes=") || dash == -1 {
+		return 0, fmt.Errorf("gcs: unexpected range header '%s'", header)
+	}
+
+	last, err := strconv.ParseInt(header[dash+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("gcs: unexpected range header '%s'", header)
+	}
+
+	return last + 1, nil
+}
+
+// drainAndClose reads the rest of a response body before closing it, so the underlying connection
+// can be re-used.
+func drainAndClose(res *http.Response) {
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+}
@@ -0,0 +1,136 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SeerUK/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// testResumableServer is a minimal fake of the GCS resumable upload API.
+type testResumableServer struct {
+	data     []byte
+	complete bool
+	gone     bool
+	status   int
+}
+
+func (s *testResumableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		w.Header().Set("Location", fmt.Sprintf("http://%s/session/1", r.Host))
+		return
+	}
+
+	if s.gone {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	s.data = append(s.data, body...)
+
+	if !strings.HasSuffix(r.Header.Get("Content-Range"), "/*") {
+		s.complete = true
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if len(s.data) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.data)-1))
+	}
+
+	w.WriteHeader(statusResumeIncomplete)
+}
+
+func TestHTTPResumableClient(t *testing.T) {
+	t.Run("should start a session, and upload chunks to it", func(t *testing.T) {
+		fake := &testResumableServer{}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		client := NewHTTPResumableClient(http.DefaultClient, server.URL)
+
+		uri, err := client.StartSession(context.Background(), "test-bucket", "test-object")
+		assert.OK(t, err)
+		assert.Equal(t, server.URL+"/session/1", uri)
+
+		offset, complete, err := client.QueryOffset(context.Background(), uri)
+		assert.OK(t, err)
+		assert.Equal(t, int64(0), offset)
+		assert.False(t, complete, "Expected upload not to be complete")
+
+		offset, complete, err = client.UploadChunk(context.Background(), uri, 0, []byte("test-"), -1)
+		assert.OK(t, err)
+		assert.Equal(t, int64(5), offset)
+		assert.False(t, complete, "Expected upload not to be complete")
+
+		offset, complete, err = client.QueryOffset(context.Background(), uri)
+		assert.OK(t, err)
+		assert.Equal(t, int64(5), offset)
+
+		_, complete, err = client.UploadChunk(context.Background(), uri, 5, []byte("data"), 9)
+		assert.OK(t, err)
+		assert.True(t, complete, "Expected upload to be complete")
+		assert.Equal(t, "test-data", string(fake.data))
+	})
+
+	t.Run("should return ErrSessionExpired if the session is gone", func(t *testing.T) {
+		server := httptest.NewServer(&testResumableServer{gone: true})
+		defer server.Close()
+
+		client := NewHTTPResumableClient(http.DefaultClient, server.URL)
+
+		_, _, err := client.QueryOffset(context.Background(), server.URL+"/session/1")
+
+		assert.Equal(t, ErrSessionExpired, err)
+	})
+
+	t.Run("should return API errors", func(t *testing.T) {
+		server := httptest.NewServer(&testResumableServer{status: http.StatusServiceUnavailable})
+		defer server.Close()
+
+		client := NewHTTPResumableClient(http.DefaultClient, server.URL)
+
+		_, err := client.StartSession(context.Background(), "test-bucket", "test-object")
+		assert.NotOK(t, err)
+
+		_, _, err = client.UploadChunk(context.Background(), server.URL+"/session/1", 0, []byte("x"), 1)
+
+		apiErr, ok := err.(*googleapi.Error)
+		assert.True(t, ok, "Expected a *googleapi.Error")
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.Code)
+	})
+}
+
+func TestParseRangeHeader(t *testing.T) {
+	t.Run("should return the next offset", func(t *testing.T) {
+		offset, err := parseRangeHeader("bytes=0-1023")
+
+		assert.OK(t, err)
+		assert.Equal(t, int64(1024), offset)
+	})
+
+	t.Run("should return zero if there is no header", func(t *testing.T) {
+		offset, err := parseRangeHeader("")
+
+		assert.OK(t, err)
+		assert.Equal(t, int64(0), offset)
+	})
+
+	t.Run("should error if the header is malformed", func(t *testing.T) {
+		_, err := parseRangeHeader("potatoes")
+
+		assert.NotOK(t, err)
+	})
+}
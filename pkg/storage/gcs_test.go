@@ -7,9 +7,13 @@ import (
 	"io"
 	"io/ioutil"
 	"testing"
+	"time"
 
+	gstorage "cloud.google.com/go/storage"
 	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/logging"
 	"github.com/SeerUK/foldup/pkg/storage/gcs"
+	"google.golang.org/api/googleapi"
 )
 
 type discardWriteCloser struct {
@@ -49,8 +53,22 @@ func (c *testGCSClient) Bucket(name string) gcs.Bucket {
 }
 
 type testGCSBucket struct {
-	object     gcs.Object
-	objectName string
+	object       gcs.Object
+	objectName   string
+	attrsError   error
+	objects      []*gstorage.ObjectAttrs
+	objectsError error
+	prefix       string
+}
+
+func (b *testGCSBucket) Objects(ctx context.Context, prefix string) ([]*gstorage.ObjectAttrs, error) {
+	b.prefix = prefix
+
+	return b.objects, b.objectsError
+}
+
+func (b *testGCSBucket) Attrs(ctx context.Context) (*gstorage.BucketAttrs, error) {
+	return &gstorage.BucketAttrs{}, b.attrsError
 }
 
 func (b *testGCSBucket) Object(name string) gcs.Object {
@@ -61,12 +79,81 @@ func (b *testGCSBucket) Object(name string) gcs.Object {
 
 type testGCSObject struct {
 	writeCloser io.WriteCloser
+	deleted     bool
+	deleteError error
+	content     []byte
+	generation  int64
+	readError   error
+	conds       []gstorage.Conditions
+}
+
+func (o *testGCSObject) Delete(ctx context.Context) error {
+	o.deleted = true
+
+	return o.deleteError
+}
+
+func (o *testGCSObject) NewReader(ctx context.Context) (io.ReadCloser, error) {
+	if o.readError != nil {
+		return nil, o.readError
+	}
+
+	if o.content == nil {
+		return nil, gstorage.ErrObjectNotExist
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(o.content)), nil
+}
+
+func (o *testGCSObject) Attrs(ctx context.Context) (*gstorage.ObjectAttrs, error) {
+	if o.generation == 0 {
+		return nil, gstorage.ErrObjectNotExist
+	}
+
+	return &gstorage.ObjectAttrs{Generation: o.generation}, nil
+}
+
+func (o *testGCSObject) If(conds gstorage.Conditions) gcs.Object {
+	o.conds = append(o.conds, conds)
+
+	return o
 }
 
 func (o *testGCSObject) NewWriteCloser(ctx context.Context) io.WriteCloser {
+	if w, ok := o.writeCloser.(*abortableWriteCloser); ok {
+		w.ctx = ctx
+	}
+
 	return o.writeCloser
 }
 
+// abortableWriteCloser imitates a *storage.Writer, which only commits the object on Close if its
+// context hasn't been cancelled.
+type abortableWriteCloser struct {
+	ctx       context.Context
+	committed bool
+}
+
+func (w *abortableWriteCloser) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+func (w *abortableWriteCloser) Close() error {
+	if w.ctx.Err() != nil {
+		return w.ctx.Err()
+	}
+
+	w.committed = true
+
+	return nil
+}
+
+type failingReader struct{}
+
+func (r failingReader) Read(p []byte) (n int, err error) {
+	return 0, errors.New("read error")
+}
+
 func newGCSClient(writeCloser io.WriteCloser) gcs.Client {
 	object := &testGCSObject{}
 	object.writeCloser = writeCloser
@@ -87,7 +174,7 @@ func TestGCSGateway_Store(t *testing.T) {
 		reader := bytes.NewBuffer([]byte("test-data"))
 
 		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
-		gateway := NewGCSGateway(client, bucketName)
+		gateway := NewGCSGateway(client, bucketName, logging.NewNopLogger())
 
 		err := gateway.Store(context.Background(), fileName, reader)
 
@@ -105,10 +192,235 @@ func TestGCSGateway_Store(t *testing.T) {
 		assert.OK(t, err)
 
 		client := newGCSClient(writeCloser)
-		gateway := NewGCSGateway(client, bucketName)
+		gateway := NewGCSGateway(client, bucketName, logging.NewNopLogger())
 
 		err = gateway.Store(context.Background(), fileName, reader)
 
 		assert.NotOK(t, err)
 	})
+
+	t.Run("should abort the upload, rather than commit it, if reading fails", func(t *testing.T) {
+		writeCloser := &abortableWriteCloser{}
+
+		client := newGCSClient(writeCloser)
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger())
+
+		err := gateway.Store(context.Background(), "test-file", failingReader{})
+
+		assert.NotOK(t, err)
+		assert.Equal(t, "read error", err.Error())
+		assert.False(t, writeCloser.committed, "Expected upload not to be committed")
+	})
+}
+
+func TestGCSGateway_Check(t *testing.T) {
+	t.Run("should not error if the bucket is reachable", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Checker)
+
+		assert.OK(t, gateway.Check(context.Background()))
+	})
+
+	t.Run("should not error if access to the bucket's metadata is denied", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		client.(*testGCSClient).bucket.(*testGCSBucket).attrsError = &googleapi.Error{Code: 403}
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Checker)
+
+		assert.OK(t, gateway.Check(context.Background()))
+	})
+
+	t.Run("should error if the bucket can't be reached", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		client.(*testGCSClient).bucket.(*testGCSBucket).attrsError = &googleapi.Error{Code: 404}
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Checker)
+
+		assert.NotOK(t, gateway.Check(context.Background()))
+	})
+}
+
+func TestGCSGateway_List(t *testing.T) {
+	t.Run("should list objects with the given prefix", func(t *testing.T) {
+		created := time.Now()
+
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		bucket := client.(*testGCSClient).bucket.(*testGCSBucket)
+		bucket.objects = []*gstorage.ObjectAttrs{
+			{Name: "backup-photos-1.tar.gz", Size: 10, Created: created},
+		}
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Lister)
+
+		objects, err := gateway.List(context.Background(), "backup-")
+
+		assert.OK(t, err)
+		assert.Equal(t, "backup-", bucket.prefix)
+		assert.Equal(t, []ObjectInfo{{Name: "backup-photos-1.tar.gz", Size: 10, Created: created}}, objects)
+	})
+
+	t.Run("should return errors listing objects", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		client.(*testGCSClient).bucket.(*testGCSBucket).objectsError = errors.New("oops")
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Lister)
+
+		_, err := gateway.List(context.Background(), "")
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestGCSGateway_Fetch(t *testing.T) {
+	t.Run("should read the named object", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		bucket := client.(*testGCSClient).bucket.(*testGCSBucket)
+		bucket.object.(*testGCSObject).content = []byte("data")
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Fetcher)
+
+		reader, err := gateway.Fetch(context.Background(), "catalog.json")
+		assert.OK(t, err)
+
+		defer reader.Close()
+
+		data, err := ioutil.ReadAll(reader)
+		assert.OK(t, err)
+		assert.Equal(t, "data", string(data))
+		assert.Equal(t, "catalog.json", bucket.objectName)
+	})
+
+	t.Run("should return ErrNotFound if the object doesn't exist", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Fetcher)
+
+		_, err := gateway.Fetch(context.Background(), "catalog.json")
+		assert.Equal(t, ErrNotFound, err)
+	})
+}
+
+func TestGCSGateway_Delete(t *testing.T) {
+	t.Run("should delete the named object", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		bucket := client.(*testGCSClient).bucket.(*testGCSBucket)
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Deleter)
+
+		err := gateway.Delete(context.Background(), "backup-photos-1.tar.gz")
+
+		assert.OK(t, err)
+		assert.Equal(t, "backup-photos-1.tar.gz", bucket.objectName)
+		assert.True(t, bucket.object.(*testGCSObject).deleted, "Expected object to be deleted")
+	})
+
+	t.Run("should return ErrNotFound if the object doesn't exist", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		client.(*testGCSClient).bucket.(*testGCSBucket).object.(*testGCSObject).deleteError = gstorage.ErrObjectNotExist
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Deleter)
+
+		err := gateway.Delete(context.Background(), "backup-photos-1.tar.gz")
+		assert.Equal(t, ErrNotFound, err)
+	})
+}
+
+func TestGCSGateway_FetchGeneration(t *testing.T) {
+	t.Run("should read the named object at its current generation", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		object := client.(*testGCSClient).bucket.(*testGCSBucket).object.(*testGCSObject)
+		object.content = []byte("data")
+		object.generation = 3
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Generational)
+
+		reader, generation, err := gateway.FetchGeneration(context.Background(), "catalog.json")
+		assert.OK(t, err)
+
+		defer reader.Close()
+
+		data, err := ioutil.ReadAll(reader)
+		assert.OK(t, err)
+		assert.Equal(t, "data", string(data))
+		assert.Equal(t, int64(3), generation)
+		assert.Equal(t, []gstorage.Conditions{{GenerationMatch: 3}}, object.conds)
+	})
+
+	t.Run("should return ErrNotFound if the object doesn't exist", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Generational)
+
+		_, _, err := gateway.FetchGeneration(context.Background(), "catalog.json")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("should return ErrPreconditionFailed if the object is replaced before it's read", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		object := client.(*testGCSClient).bucket.(*testGCSBucket).object.(*testGCSObject)
+		object.generation = 3
+		object.readError = &googleapi.Error{Code: 412}
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Generational)
+
+		_, _, err := gateway.FetchGeneration(context.Background(), "catalog.json")
+		assert.Equal(t, ErrPreconditionFailed, err)
+	})
+}
+
+func TestGCSGateway_StoreGeneration(t *testing.T) {
+	t.Run("should only store the object if it's still at the given generation", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		object := client.(*testGCSClient).bucket.(*testGCSBucket).object.(*testGCSObject)
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Generational)
+
+		err := gateway.StoreGeneration(context.Background(), "catalog.json", bytes.NewBufferString("data"), 3)
+		assert.OK(t, err)
+		assert.Equal(t, []gstorage.Conditions{{GenerationMatch: 3}}, object.conds)
+	})
+
+	t.Run("should only store the object if it doesn't exist, given generation 0", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		object := client.(*testGCSClient).bucket.(*testGCSBucket).object.(*testGCSObject)
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Generational)
+
+		err := gateway.StoreGeneration(context.Background(), "catalog.json", bytes.NewBufferString("data"), 0)
+		assert.OK(t, err)
+		assert.Equal(t, []gstorage.Conditions{{DoesNotExist: true}}, object.conds)
+	})
+
+	t.Run("should return ErrPreconditionFailed if the object has been replaced", func(t *testing.T) {
+		client := newGCSClient(&testFailingWriteCloser{err: &googleapi.Error{Code: 412}})
+
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Generational)
+
+		err := gateway.StoreGeneration(context.Background(), "catalog.json", bytes.NewBufferString("data"), 3)
+		assert.Equal(t, ErrPreconditionFailed, err)
+	})
+
+	t.Run("should abort the upload, rather than commit it, if reading fails", func(t *testing.T) {
+		writeCloser := &abortableWriteCloser{}
+
+		client := newGCSClient(writeCloser)
+		gateway := NewGCSGateway(client, "test-bucket", logging.NewNopLogger()).(Generational)
+
+		err := gateway.StoreGeneration(context.Background(), "catalog.json", failingReader{}, 3)
+		assert.NotOK(t, err)
+		assert.False(t, writeCloser.committed, "Expected upload not to be committed")
+	})
+}
+
+// testFailingWriteCloser discards what's written to it, and fails to close with the given error.
+type testFailingWriteCloser struct {
+	err error
+}
+
+func (w *testFailingWriteCloser) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+func (w *testFailingWriteCloser) Close() error {
+	return w.err
 }
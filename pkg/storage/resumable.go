@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/logging"
+	"github.com/SeerUK/foldup/pkg/storage/gcs"
+)
+
+// ResumableChunkSizeMultiple is the size that resumable upload chunks must be a multiple of.
+const ResumableChunkSizeMultiple = 256 * 1024
+
+// ResumableGateway implements the Gateway interface for Google Cloud Storage, uploading files in
+// chunks using resumable upload sessions. Sessions are kept in a SessionStore, so that an
+// interrupted upload can be resumed later, even by another process.
+type ResumableGateway struct {
+	bucket    string
+	client    gcs.ResumableClient
+	sessions  SessionStore
+	chunkSize int
+	logger    logging.Logger
+}
+
+// NewResumableGateway creates a new Gateway instance, using ResumableGateway. The `chunkSize` must
+// be a positive multiple of ResumableChunkSizeMultiple.
+func NewResumableGateway(client gcs.ResumableClient, bucket string, sessions SessionStore, chunkSize int, logger logging.Logger) (Gateway, error) {
+	if chunkSize <= 0 || chunkSize%ResumableChunkSizeMultiple != 0 {
+		return nil, fmt.Errorf("storage: chunk size must be a positive multiple of %d bytes", ResumableChunkSizeMultiple)
+	}
+
+	return &ResumableGateway{
+		bucket:    bucket,
+		client:    client,
+		sessions:  sessions,
+		chunkSize: chunkSize,
+		logger:    logger,
+	}, nil
+}
+
+// Store attempts to write a file via the Gateway, using a resumable upload session. If a session for
+// the file already exists, the upload continues from wherever that session got up to.
+func (g *ResumableGateway) Store(ctx context.Context, filename string, reader io.Reader) error {
+	logger := logging.FromContext(ctx, g.logger).With(logging.Archive(filename))
+	started := time.Now()
+
+	session, offset, complete, err := g.findSession(ctx, logger, filename)
+	if err != nil || complete {
+		return err
+	}
+
+	if session.URI == "" {
+		logger.Info("Started uploading archive")
+
+		session, err = g.startSession(ctx, filename, reader)
+		if err != nil {
+			return err
+		}
+	} else {
+		logger.Info("Resuming upload of archive", logging.F("offset", offset))
+
+		if err := skip(reader, offset); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, g.chunkSize)
+	filled := 0
+	eof := false
+
+	for {
+		if !eof {
+			n, err := io.ReadFull(reader, buf[filled:])
+			filled += n
+
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+
+		total := int64(-1)
+		if eof {
+			total = offset + int64(filled)
+		}
+
+		next, complete, err := g.client.UploadChunk(ctx, session.URI, offset, buf[:filled], total)
+		if err != nil {
+			return err
+		}
+
+		if complete {
+			break
+		}
+
+		if next <= offset && filled > 0 || next > offset+int64(filled) {
+			return fmt.Errorf("storage: unexpected resumable upload offset %d, after sending from %d", next, offset)
+		}
+
+		if eof && next == offset+int64(filled) {
+			return errors.New("storage: resumable upload incomplete after sending all data")
+		}
+
+		// Keep hold of anything the server didn't persist, it'll be sent again with the next chunk.
+		filled = copy(buf, buf[next-offset:filled])
+		offset = next
+	}
+
+	if err := g.sessions.Delete(g.bucket, filename); err != nil {
+		return err
+	}
+
+	logger.Info("Finished uploading archive", logging.Bytes(offset+int64(filled)), logging.Duration(time.Since(started)))
+
+	return nil
+}
+
+// findSession looks for an existing upload session for the given file. If one exists, and is
+// still usable, it will be returned along with the offset to continue uploading from. Otherwise an
+// empty session is returned. If the session's upload had already been completed, then complete
+// will be true, and there is nothing left to upload.
+func (g *ResumableGateway) findSession(ctx context.Context, logger logging.Logger, filename string) (UploadSession, int64, bool, error) {
+	session, ok, err := g.sessions.Get(g.bucket, filename)
+	if err != nil || !ok {
+		return UploadSession{}, 0, false, err
+	}
+
+	offset, complete, err := g.client.QueryOffset(ctx, session.URI)
+	if complete {
+		logger.Info("Archive was already uploaded by a previous session")
+
+		return session, 0, true, g.sessions.Delete(g.bucket, filename)
+	}
+
+	if err == gcs.ErrSessionExpired {
+		logger.Warn("Previous upload session for archive has expired, starting again")
+
+		return UploadSession{}, 0, false, g.sessions.Delete(g.bucket, filename)
+	}
+
+	if err != nil {
+		return UploadSession{}, 0, false, err
+	}
+
+	return session, offset, false, nil
+}
+
+// startSession starts a new upload session for the given file, and persists it.
+func (g *ResumableGateway) startSession(ctx context.Context, filename string, reader io.Reader) (UploadSession, error) {
+	uri, err := g.client.StartSession(ctx, g.bucket, filename)
+	if err != nil {
+		return UploadSession{}, err
+	}
+
+	session := UploadSession{
+		URI:     uri,
+		Bucket:  g.bucket,
+		Object:  filename,
+		Started: timeNow(),
+	}
+
+	// If we're uploading a file, remember where it is so it can be found again to resume, even if
+	// we're later run from a different working directory.
+	if named, ok := reader.(interface {
+		Name() string
+	}); ok {
+		session.Source, err = filepath.Abs(named.Name())
+		if err != nil {
+			return UploadSession{}, err
+		}
+	}
+
+	return session, g.sessions.Put(session)
+}
+
+// skip moves the given reader forward by the given number of bytes, seeking if possible.
+func skip(reader io.Reader, offset int64) error {
+	if seeker, ok := reader.(io.Seeker); ok {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}
+
+	_, err := io.CopyN(ioutil.Discard, reader, offset)
+
+	return err
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/logging"
+)
+
+// testResumableClient is an in-memory fake of a gcs.ResumableClient. If interruptAfter is set, it
+// will fail once that many bytes have been received, imitating a dropped connection.
+type testResumableClient struct {
+	data           []byte
+	complete       bool
+	sessions       int
+	interruptAfter int
+	uploadErr      error
+}
+
+func (c *testResumableClient) StartSession(ctx context.Context, bucket, name string) (string, error) {
+	c.sessions++
+	c.data = nil
+
+	return "test-session", nil
+}
+
+func (c *testResumableClient) QueryOffset(ctx context.Context, uri string) (int64, bool, error) {
+	return int64(len(c.data)), c.complete, nil
+}
+
+func (c *testResumableClient) UploadChunk(ctx context.Context, uri string, offset int64, chunk []byte, total int64) (int64, bool, error) {
+	if c.uploadErr != nil {
+		return 0, false, c.uploadErr
+	}
+
+	if c.interruptAfter > 0 && len(c.data) >= c.interruptAfter {
+		c.interruptAfter = 0
+		return 0, false, io.ErrUnexpectedEOF
+	}
+
+	c.data = append(c.data[:offset], chunk...)
+	c.complete = total >= 0 && int64(len(c.data)) == total
+
+	return int64(len(c.data)), c.complete, nil
+}
+
+func TestNewResumableGateway(t *testing.T) {
+	t.Run("should error if the chunk size isn't a multiple of 256KiB", func(t *testing.T) {
+		_, err := NewResumableGateway(&testResumableClient{}, "test-bucket", newMemorySessionStore(), 1000, logging.NewNopLogger())
+
+		assert.NotOK(t, err)
+	})
+}
+
+func TestResumableGateway_Store(t *testing.T) {
+	data := bytes.Repeat([]byte("foldup"), ResumableChunkSizeMultiple)
+
+	t.Run("should upload the file in chunks", func(t *testing.T) {
+		client := &testResumableClient{}
+		sessions := newMemorySessionStore()
+
+		gateway, err := NewResumableGateway(client, "test-bucket", sessions, ResumableChunkSizeMultiple, logging.NewNopLogger())
+		assert.OK(t, err)
+
+		err = gateway.Store(context.Background(), "test-file", bytes.NewReader(data))
+
+		assert.OK(t, err)
+		assert.True(t, client.complete, "Expected upload to be complete")
+		assert.True(t, bytes.Equal(data, client.data), "Expected uploaded data to match")
+
+		all, err := sessions.All()
+		assert.OK(t, err)
+		assert.Equal(t, 0, len(all))
+	})
+
+	t.Run("should resume an interrupted upload", func(t *testing.T) {
+		client := &testResumableClient{interruptAfter: 2 * ResumableChunkSizeMultiple}
+		sessions := newMemorySessionStore()
+
+		gateway, err := NewResumableGateway(client, "test-bucket", sessions, ResumableChunkSizeMultiple, logging.NewNopLogger())
+		assert.OK(t, err)
+
+		err = gateway.Store(context.Background(), "test-file", bytes.NewReader(data))
+		assert.NotOK(t, err)
+
+		_, ok, err := sessions.Get("test-bucket", "test-file")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected session to be kept")
+
+		// Pretend we're a new process, reading the file again from the start.
+		err = gateway.Store(context.Background(), "test-file", bytes.NewBuffer(data))
+
+		assert.OK(t, err)
+		assert.Equal(t, 1, client.sessions)
+		assert.True(t, bytes.Equal(data, client.data), "Expected uploaded data to match")
+	})
+
+	t.Run("should remember the absolute path of the file being uploaded", func(t *testing.T) {
+		file, err := os.Open("gcs.go")
+		assert.OK(t, err)
+
+		defer file.Close()
+
+		client := &testResumableClient{uploadErr: io.ErrUnexpectedEOF}
+		sessions := newMemorySessionStore()
+
+		gateway, err := NewResumableGateway(client, "test-bucket", sessions, ResumableChunkSizeMultiple, logging.NewNopLogger())
+		assert.OK(t, err)
+
+		err = gateway.Store(context.Background(), "test-file", file)
+		assert.NotOK(t, err)
+
+		expected, err := filepath.Abs("gcs.go")
+		assert.OK(t, err)
+
+		session, _, err := sessions.Get("test-bucket", "test-file")
+		assert.OK(t, err)
+		assert.Equal(t, expected, session.Source)
+	})
+
+	t.Run("should not upload again if a previous session completed", func(t *testing.T) {
+		client := &testResumableClient{complete: true}
+		sessions := newMemorySessionStore()
+		sessions.Put(UploadSession{URI: "test-session", Bucket: "test-bucket", Object: "test-file"})
+
+		gateway, err := NewResumableGateway(client, "test-bucket", sessions, ResumableChunkSizeMultiple, logging.NewNopLogger())
+		assert.OK(t, err)
+
+		err = gateway.Store(context.Background(), "test-file", bytes.NewReader(data))
+
+		assert.OK(t, err)
+		assert.Equal(t, 0, client.sessions)
+	})
+}
+
+// memorySessionStore is a SessionStore that only keeps sessions in memory.
+type memorySessionStore struct {
+	sessions map[string]UploadSession
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{
+		sessions: make(map[string]UploadSession),
+	}
+}
+
+func (s *memorySessionStore) Get(bucket, object string) (UploadSession, bool, error) {
+	session, ok := s.sessions[sessionKey(bucket, object)]
+	return session, ok, nil
+}
+
+func (s *memorySessionStore) Put(session UploadSession) error {
+	s.sessions[sessionKey(session.Bucket, session.Object)] = session
+	return nil
+}
+
+func (s *memorySessionStore) Delete(bucket, object string) error {
+	delete(s.sessions, sessionKey(bucket, object))
+	return nil
+}
+
+func (s *memorySessionStore) All() ([]UploadSession, error) {
+	all := []UploadSession{}
+	for _, session := range s.sessions {
+		all = append(all, session)
+	}
+
+	return all, nil
+}
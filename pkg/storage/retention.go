@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"sort"
+	"time"
+)
+
+// RetentionPolicy decides which stored archives of a folder are kept, and which are deleted.
+type RetentionPolicy struct {
+	// KeepLast is the number of most recent archives to keep. If it's 0, there's no limit.
+	KeepLast int
+	// MaxAge is how long archives are kept for. If it's 0, there's no limit.
+	MaxAge time.Duration
+}
+
+// Enabled returns true if the policy would ever delete anything.
+func (p RetentionPolicy) Enabled() bool {
+	return p.KeepLast > 0 || p.MaxAge > 0
+}
+
+// Expired returns the objects that should be deleted under the policy, given all of the archives
+// stored for a single folder. The most recent archive is always kept, however old it is, so that
+// there's something to restore from if backups stop for a while.
+func (p RetentionPolicy) Expired(objects []ObjectInfo, now time.Time) []ObjectInfo {
+	sorted := append([]ObjectInfo{}, objects...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+
+	expired := []ObjectInfo{}
+
+	for i, o := range sorted {
+		if i == 0 {
+			continue
+		}
+
+		tooMany := p.KeepLast > 0 && i >= p.KeepLast
+		tooOld := p.MaxAge > 0 && now.Sub(o.Created) > p.MaxAge
+
+		if tooMany || tooOld {
+			expired = append(expired, o)
+		}
+	}
+
+	return expired
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestRetentionPolicy_Expired(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	objects := []ObjectInfo{
+		{Name: "c", Created: now.Add(-3 * day)},
+		{Name: "a", Created: now.Add(-1 * day)},
+		{Name: "d", Created: now.Add(-4 * day)},
+		{Name: "b", Created: now.Add(-2 * day)},
+	}
+
+	names := func(objects []ObjectInfo) []string {
+		result := []string{}
+		for _, o := range objects {
+			result = append(result, o.Name)
+		}
+
+		return result
+	}
+
+	t.Run("should keep the most recent archives", func(t *testing.T) {
+		policy := RetentionPolicy{KeepLast: 2}
+
+		assert.Equal(t, []string{"c", "d"}, names(policy.Expired(objects, now)))
+	})
+
+	t.Run("should expire archives older than the maximum age", func(t *testing.T) {
+		policy := RetentionPolicy{MaxAge: 2*day + time.Hour}
+
+		assert.Equal(t, []string{"c", "d"}, names(policy.Expired(objects, now)))
+	})
+
+	t.Run("should always keep the most recent archive", func(t *testing.T) {
+		policy := RetentionPolicy{MaxAge: time.Hour}
+
+		assert.Equal(t, []string{"b", "c", "d"}, names(policy.Expired(objects, now)))
+	})
+
+	t.Run("should keep everything if disabled", func(t *testing.T) {
+		policy := RetentionPolicy{}
+
+		assert.False(t, policy.Enabled(), "Expected policy to be disabled")
+		assert.Equal(t, []string{}, names(policy.Expired(objects, now)))
+	})
+}
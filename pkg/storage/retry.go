@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/SeerUK/foldup/pkg/logging"
+	"google.golang.org/api/googleapi"
+)
+
+// For testing
+var (
+	randFloat64 = rand.Float64
+	timeAfter   = time.After
+	timeNow     = time.Now
+)
+
+// RetryPolicy describes how many times, and how often, a RetryGateway should retry operations
+// that fail with a transient error.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times an operation will be attempted, including the
+	// first attempt. A value less than 1 is treated as 1.
+	MaxAttempts int
+	// MaxElapsed is the maximum total time to spend retrying an operation, from when it first
+	// fails, including time spent waiting between attempts. It never cuts an attempt short, so long
+	// uploads that are going fine aren't affected. A zero value means there is no limit.
+	MaxElapsed time.Duration
+	// InitialInterval is the delay before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between any two attempts.
+	MaxInterval time.Duration
+	// Multiplier is applied to the delay after each failed attempt.
+	Multiplier float64
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with sensible defaults for uploading archives.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     5,
+		MaxElapsed:      15 * time.Minute,
+		InitialInterval: 1 * time.Second,
+		MaxInterval:     1 * time.Minute,
+		Multiplier:      2,
+	}
+}
+
+// backoff returns the delay to wait after the given (1-indexed) failed attempt. The delay grows
+// exponentially, and has "equal jitter" applied, so it will be somewhere between half of, and the
+// full exponential interval.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	interval := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+
+	return time.Duration(interval/2 + randFloat64()*interval/2)
+}
+
+// RetryGateway is a Gateway that wraps another Gateway, retrying operations that fail with
+// transient errors using exponential backoff.
+type RetryGateway struct {
+	gateway Gateway
+	policy  RetryPolicy
+	logger  logging.Logger
+}
+
+// NewRetryGateway creates a new Gateway instance, using RetryGateway.
+func NewRetryGateway(gateway Gateway, policy RetryPolicy, logger logging.Logger) Gateway {
+	return &RetryGateway{
+		gateway: gateway,
+		policy:  policy,
+		logger:  logger,
+	}
+}
+
+// Store attempts to write a file via the wrapped Gateway, retrying if a transient error occurs. To
+// be able to retry, the given reader must also be an io.Seeker, so that it can be read again from
+// the start on each attempt. If it isn't, only a single attempt will be made.
+func (g *RetryGateway) Store(ctx context.Context, filename string, reader io.Reader) error {
+	seeker, canSeek := reader.(io.Seeker)
+
+	// The time spent retrying is counted from the first failure, however long that attempt took.
+	var failed time.Time
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+		err := g.gateway.Store(ctx, filename, reader)
+		if err == nil {
+			return nil
+		}
+
+		if !canSeek || !IsTransient(err) || attempt >= g.policy.MaxAttempts {
+			return err
+		}
+
+		if failed.IsZero() {
+			failed = timeNow()
+		}
+
+		delay := g.policy.backoff(attempt)
+		if g.policy.MaxElapsed > 0 && timeNow().Sub(failed)+delay > g.policy.MaxElapsed {
+			return err
+		}
+
+		logging.FromContext(ctx, g.logger).Warn(
+			"Retrying upload of archive",
+			logging.Archive(filename),
+			logging.F("delay", delay),
+			logging.F("attempt", attempt),
+			logging.F("max_attempts", g.policy.MaxAttempts),
+			logging.Err(err),
+		)
+
+		select {
+		case <-timeAfter(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Check checks the wrapped Gateway's storage is reachable, if it is able to.
+func (g *RetryGateway) Check(ctx context.Context) error {
+	if checker, ok := g.gateway.(Checker); ok {
+		return checker.Check(ctx)
+	}
+
+	return nil
+}
+
+// IsTransient reports whether the given error is likely to be temporary, meaning that retrying the
+// operation that caused it may succeed. Server errors, rate limiting, timeouts, and connection
+// resets are all considered transient. Errors caused by a context being cancelled, or reaching its
+// deadline, aren't, as retrying with the same context would fail in the same way.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500 || apiErr.Code == 429
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno == syscall.ECONNRESET || errno == syscall.ECONNABORTED || errno == syscall.EPIPE
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// List lists objects using the wrapped Gateway, if it is able to.
+func (g *RetryGateway) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	if lister, ok := g.gateway.(Lister); ok {
+		return lister.List(ctx, prefix)
+	}
+
+	return nil, errors.New("storage: gateway can't list objects")
+}
+
+// Fetch fetches an object using the wrapped Gateway, if it is able to.
+func (g *RetryGateway) Fetch(ctx context.Context, name string) (io.ReadCloser, error) {
+	if fetcher, ok := g.gateway.(Fetcher); ok {
+		return fetcher.Fetch(ctx, name)
+	}
+
+	return nil, errors.New("storage: gateway can't fetch objects")
+}
+
+// Delete deletes an object using the wrapped Gateway, if it is able to.
+func (g *RetryGateway) Delete(ctx context.Context, name string) error {
+	if deleter, ok := g.gateway.(Deleter); ok {
+		return deleter.Delete(ctx, name)
+	}
+
+	return errors.New("storage: gateway can't delete objects")
+}
+
+// FetchGeneration fetches an object, along with its generation, using the wrapped Gateway, if it is
+// able to. If it isn't, ErrUnsupported is returned.
+func (g *RetryGateway) FetchGeneration(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	if generational, ok := g.gateway.(Generational); ok {
+		return generational.FetchGeneration(ctx, name)
+	}
+
+	return nil, 0, ErrUnsupported
+}
+
+// StoreGeneration stores an object if it's still at the given generation, using the wrapped
+// Gateway, if it is able to. If it isn't, ErrUnsupported is returned.
+func (g *RetryGateway) StoreGeneration(ctx context.Context, name string, in io.Reader, generation int64) error {
+	if generational, ok := g.gateway.(Generational); ok {
+		return generational.StoreGeneration(ctx, name, in, generation)
+	}
+
+	return ErrUnsupported
+}
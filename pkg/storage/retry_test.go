@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/SeerUK/assert"
+	"github.com/SeerUK/foldup/pkg/logging"
+	"google.golang.org/api/googleapi"
+)
+
+// testFlakyGateway is a Gateway that fails with the given errors, in order, before succeeding.
+type testFlakyGateway struct {
+	errs  []error
+	calls int
+	reads []string
+}
+
+func (g *testFlakyGateway) Store(ctx context.Context, filename string, in io.Reader) error {
+	data, _ := ioutil.ReadAll(in)
+
+	g.reads = append(g.reads, string(data))
+	g.calls++
+
+	if len(g.errs) >= g.calls {
+		return g.errs[g.calls-1]
+	}
+
+	return nil
+}
+
+// testSlowGateway is a Gateway that takes the given time to store files, unless its context is
+// done first.
+type testSlowGateway struct {
+	delay time.Duration
+}
+
+func (g *testSlowGateway) Store(ctx context.Context, filename string, in io.Reader) error {
+	select {
+	case <-time.After(g.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func stubRetryTiming() {
+	randFloat64 = func() float64 {
+		return 1
+	}
+
+	timeAfter = func(d time.Duration) <-chan time.Time {
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+
+		return ch
+	}
+}
+
+func TestRetryGateway_Store(t *testing.T) {
+	transient := &googleapi.Error{Code: 503}
+
+	t.Run("should retry transient errors, reading from the start each time", func(t *testing.T) {
+		defer revertStubs()
+		stubRetryTiming()
+
+		inner := &testFlakyGateway{errs: []error{transient, transient}}
+		gateway := NewRetryGateway(inner, DefaultRetryPolicy(), logging.NewNopLogger())
+
+		err := gateway.Store(context.Background(), "test-file", bytes.NewReader([]byte("test-data")))
+
+		assert.OK(t, err)
+		assert.Equal(t, 3, inner.calls)
+		assert.Equal(t, []string{"test-data", "test-data", "test-data"}, inner.reads)
+	})
+
+	t.Run("should not retry errors that aren't transient", func(t *testing.T) {
+		defer revertStubs()
+		stubRetryTiming()
+
+		inner := &testFlakyGateway{errs: []error{errors.New("oops")}}
+		gateway := NewRetryGateway(inner, DefaultRetryPolicy(), logging.NewNopLogger())
+
+		err := gateway.Store(context.Background(), "test-file", bytes.NewReader([]byte("test-data")))
+
+		assert.NotOK(t, err)
+		assert.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("should not retry if the reader can't be re-read", func(t *testing.T) {
+		defer revertStubs()
+		stubRetryTiming()
+
+		inner := &testFlakyGateway{errs: []error{transient}}
+		gateway := NewRetryGateway(inner, DefaultRetryPolicy(), logging.NewNopLogger())
+
+		err := gateway.Store(context.Background(), "test-file", bytes.NewBufferString("test-data"))
+
+		assert.NotOK(t, err)
+		assert.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("should give up after the maximum number of attempts", func(t *testing.T) {
+		defer revertStubs()
+		stubRetryTiming()
+
+		policy := DefaultRetryPolicy()
+		policy.MaxAttempts = 3
+
+		inner := &testFlakyGateway{errs: []error{transient, transient, transient, transient}}
+		gateway := NewRetryGateway(inner, policy, logging.NewNopLogger())
+
+		err := gateway.Store(context.Background(), "test-file", bytes.NewReader([]byte("test-data")))
+
+		assert.NotOK(t, err)
+		assert.Equal(t, 3, inner.calls)
+	})
+
+	t.Run("should give up if the next attempt would exceed the maximum time", func(t *testing.T) {
+		defer revertStubs()
+		stubRetryTiming()
+
+		policy := DefaultRetryPolicy()
+		policy.MaxElapsed = 500 * time.Millisecond
+
+		inner := &testFlakyGateway{errs: []error{transient, transient}}
+		gateway := NewRetryGateway(inner, policy, logging.NewNopLogger())
+
+		err := gateway.Store(context.Background(), "test-file", bytes.NewReader([]byte("test-data")))
+
+		assert.NotOK(t, err)
+		assert.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("should not cut short attempts that take longer than the maximum time", func(t *testing.T) {
+		policy := DefaultRetryPolicy()
+		policy.MaxElapsed = 10 * time.Millisecond
+
+		inner := &testSlowGateway{delay: 50 * time.Millisecond}
+		gateway := NewRetryGateway(inner, policy, logging.NewNopLogger())
+
+		err := gateway.Store(context.Background(), "test-file", bytes.NewReader([]byte("test-data")))
+
+		assert.OK(t, err)
+	})
+
+	t.Run("should not retry attempts whose context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		inner := &testSlowGateway{delay: time.Minute}
+		gateway := NewRetryGateway(inner, DefaultRetryPolicy(), logging.NewNopLogger())
+
+		err := gateway.Store(ctx, "test-file", bytes.NewReader([]byte("test-data")))
+
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("should stop waiting if the context is cancelled", func(t *testing.T) {
+		defer revertStubs()
+
+		timeAfter = func(d time.Duration) <-chan time.Time {
+			return make(chan time.Time)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		inner := &testFlakyGateway{errs: []error{transient}}
+		gateway := NewRetryGateway(inner, DefaultRetryPolicy(), logging.NewNopLogger())
+
+		err := gateway.Store(ctx, "test-file", bytes.NewReader([]byte("test-data")))
+
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 1, inner.calls)
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	t.Run("should grow exponentially up to the maximum interval", func(t *testing.T) {
+		defer revertStubs()
+		stubRetryTiming()
+
+		policy := DefaultRetryPolicy()
+
+		assert.Equal(t, 1*time.Second, policy.backoff(1))
+		assert.Equal(t, 2*time.Second, policy.backoff(2))
+		assert.Equal(t, 4*time.Second, policy.backoff(3))
+		assert.Equal(t, 1*time.Minute, policy.backoff(10))
+	})
+
+	t.Run("should apply jitter", func(t *testing.T) {
+		defer revertStubs()
+
+		randFloat64 = func() float64 {
+			return 0
+		}
+
+		policy := DefaultRetryPolicy()
+
+		assert.Equal(t, 1*time.Second, policy.backoff(2))
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	t.Run("should identify transient errors", func(t *testing.T) {
+		reset := &net.OpError{Op: "write", Err: &os.SyscallError{Syscall: "write", Err: syscall.ECONNRESET}}
+
+		assert.True(t, IsTransient(&googleapi.Error{Code: 500}), "Expected 500 to be transient")
+		assert.True(t, IsTransient(&googleapi.Error{Code: 429}), "Expected 429 to be transient")
+		assert.True(t, IsTransient(reset), "Expected connection reset to be transient")
+		assert.True(t, IsTransient(io.ErrUnexpectedEOF), "Expected unexpected EOF to be transient")
+
+		wrapped := fmt.Errorf("uploading: %w", &googleapi.Error{Code: 503})
+		assert.True(t, IsTransient(wrapped), "Expected wrapped 503 to be transient")
+	})
+
+	t.Run("should not identify other errors as transient", func(t *testing.T) {
+		assert.False(t, IsTransient(&googleapi.Error{Code: 403}), "Expected 403 not to be transient")
+		assert.False(t, IsTransient(errors.New("oops")), "Expected generic error not to be transient")
+		assert.False(t, IsTransient(context.Canceled), "Expected cancellation not to be transient")
+		assert.False(t, IsTransient(context.DeadlineExceeded), "Expected deadline not to be transient")
+		assert.False(t, IsTransient(fmt.Errorf("uploading: %w", context.DeadlineExceeded)), "Expected wrapped deadline not to be transient")
+	})
+}
+
+func TestRetryGateway_Check(t *testing.T) {
+	t.Run("should check the wrapped gateway, if it can be checked", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		client.(*testGCSClient).bucket.(*testGCSBucket).attrsError = errors.New("oops")
+
+		gateway := NewRetryGateway(NewGCSGateway(client, "test-bucket", logging.NewNopLogger()), DefaultRetryPolicy(), logging.NewNopLogger())
+
+		assert.NotOK(t, gateway.(Checker).Check(context.Background()))
+	})
+
+	t.Run("should not error if the wrapped gateway can't be checked", func(t *testing.T) {
+		gateway := NewRetryGateway(&testFlakyGateway{}, DefaultRetryPolicy(), logging.NewNopLogger())
+
+		assert.OK(t, gateway.(Checker).Check(context.Background()))
+	})
+}
+
+func TestRetryGateway_List(t *testing.T) {
+	t.Run("should list using the wrapped gateway, if it can list", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		gateway := NewRetryGateway(NewGCSGateway(client, "test-bucket", logging.NewNopLogger()), DefaultRetryPolicy(), logging.NewNopLogger())
+
+		_, err := gateway.(Lister).List(context.Background(), "")
+		assert.OK(t, err)
+
+		err = gateway.(Deleter).Delete(context.Background(), "test")
+		assert.OK(t, err)
+
+		_, err = gateway.(Fetcher).Fetch(context.Background(), "test")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("should error if the wrapped gateway can't list", func(t *testing.T) {
+		gateway := NewRetryGateway(&testFlakyGateway{}, DefaultRetryPolicy(), logging.NewNopLogger())
+
+		_, err := gateway.(Lister).List(context.Background(), "")
+		assert.NotOK(t, err)
+
+		err = gateway.(Deleter).Delete(context.Background(), "test")
+		assert.NotOK(t, err)
+
+		_, err = gateway.(Fetcher).Fetch(context.Background(), "test")
+		assert.NotOK(t, err)
+	})
+}
+
+func TestRetryGateway_Generational(t *testing.T) {
+	t.Run("should use generations of the wrapped gateway, if it has them", func(t *testing.T) {
+		client := newGCSClient(newDiscardWriteCloser(ioutil.Discard))
+		gateway := NewRetryGateway(NewGCSGateway(client, "test-bucket", logging.NewNopLogger()), DefaultRetryPolicy(), logging.NewNopLogger())
+
+		_, _, err := gateway.(Generational).FetchGeneration(context.Background(), "test")
+		assert.Equal(t, ErrNotFound, err)
+
+		err = gateway.(Generational).StoreGeneration(context.Background(), "test", bytes.NewBufferString("data"), 0)
+		assert.OK(t, err)
+	})
+
+	t.Run("should return ErrUnsupported if the wrapped gateway has no generations", func(t *testing.T) {
+		gateway := NewRetryGateway(&testFlakyGateway{}, DefaultRetryPolicy(), logging.NewNopLogger())
+
+		_, _, err := gateway.(Generational).FetchGeneration(context.Background(), "test")
+		assert.Equal(t, ErrUnsupported, err)
+
+		err = gateway.(Generational).StoreGeneration(context.Background(), "test", bytes.NewBufferString("data"), 0)
+		assert.Equal(t, ErrUnsupported, err)
+	})
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UploadSession describes a resumable upload that has been started, but may not have finished.
+type UploadSession struct {
+	// URI identifies the session with the storage provider.
+	URI string `json:"uri"`
+	// Bucket is the name of the bucket the object is being uploaded to.
+	Bucket string `json:"bucket"`
+	// Object is the name of the object being uploaded.
+	Object string `json:"object"`
+	// Source is the local file being uploaded, if known.
+	Source string `json:"source,omitempty"`
+	// Started is the time the session was started.
+	Started time.Time `json:"started"`
+	// Job is the name of the job that started the session, if it was started through a
+	// JobSessionStore.
+	Job string `json:"job,omitempty"`
+}
+
+// SessionStore keeps track of resumable upload sessions, so that they can be resumed later, even
+// by a different process.
+type SessionStore interface {
+	// Get finds the session for the given object, if there is one.
+	Get(bucket, object string) (UploadSession, bool, error)
+	// Put stores a session, replacing any existing session for the same object.
+	Put(session UploadSession) error
+	// Delete removes the session for the given object, if there is one.
+	Delete(bucket, object string) error
+	// All returns every stored session, sorted by bucket and object name.
+	All() ([]UploadSession, error)
+}
+
+// FileSessionStore is a SessionStore that persists sessions to a JSON file on the local disk.
+type FileSessionStore struct {
+	sync.Mutex
+
+	path string
+}
+
+// NewFileSessionStore creates a new SessionStore instance, using FileSessionStore. The file at the
+// given path doesn't need to exist yet.
+func NewFileSessionStore(path string) SessionStore {
+	return &FileSessionStore{
+		path: path,
+	}
+}
+
+// Get finds the session for the given object in the session file.
+func (s *FileSessionStore) Get(bucket, object string) (UploadSession, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	sessions, err := s.read()
+	if err != nil {
+		return UploadSession{}, false, err
+	}
+
+	session, ok := sessions[sessionKey(bucket, object)]
+
+	return session, ok, nil
+}
+
+// Put writes the given session to the session file.
+func (s *FileSessionStore) Put(session UploadSession) error {
+	s.Lock()
+	defer s.Unlock()
+
+	sessions, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	sessions[sessionKey(session.Bucket, session.Object)] = session
+
+	return s.write(sessions)
+}
+
+// Delete removes the session for the given object from the session file.
+func (s *FileSessionStore) Delete(bucket, object string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	sessions, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	key := sessionKey(bucket, object)
+	if _, ok := sessions[key]; !ok {
+		return nil
+	}
+
+	delete(sessions, key)
+
+	return s.write(sessions)
+}
+
+// All returns all of the sessions in the session file.
+func (s *FileSessionStore) All() ([]UploadSession, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	sessions, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for key := range sessions {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	result := []UploadSession{}
+	for _, key := range keys {
+		result = append(result, sessions[key])
+	}
+
+	return result, nil
+}
+
+// read loads the sessions from the session file. A missing file is treated as being empty.
+func (s *FileSessionStore) read() (map[string]UploadSession, error) {
+	sessions := make(map[string]UploadSession)
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return sessions, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// write saves the given sessions to the session file. The file is written to a temporary location
+// first, then renamed, so that an interrupted write can't corrupt it.
+func (s *FileSessionStore) write(sessions map[string]UploadSession) error {
+	if len(sessions) == 0 {
+		err := os.Remove(s.path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".foldup-sessions")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// JobSessionStore is a SessionStore that only sees the sessions started by a single job, so that
+// jobs can share a session file without resuming, or discarding, each other's uploads.
+type JobSessionStore struct {
+	store SessionStore
+	job   string
+}
+
+// NewJobSessionStore creates a new SessionStore instance, using JobSessionStore. Sessions for the
+// job with the given name are kept in the given store.
+func NewJobSessionStore(store SessionStore, job string) SessionStore {
+	return &JobSessionStore{
+		store: store,
+		job:   job,
+	}
+}
+
+// Get finds the session for the given object, if the job started it.
+func (s *JobSessionStore) Get(bucket, object string) (UploadSession, bool, error) {
+	session, ok, err := s.store.Get(bucket, object)
+	if err != nil || !ok || session.Job != s.job {
+		return UploadSession{}, false, err
+	}
+
+	return session, true, nil
+}
+
+// Put stores the given session as one started by the job.
+func (s *JobSessionStore) Put(session UploadSession) error {
+	session.Job = s.job
+
+	return s.store.Put(session)
+}
+
+// Delete removes the session for the given object, if the job started it.
+func (s *JobSessionStore) Delete(bucket, object string) error {
+	_, ok, err := s.Get(bucket, object)
+	if err != nil || !ok {
+		return err
+	}
+
+	return s.store.Delete(bucket, object)
+}
+
+// All returns every session started by the job.
+func (s *JobSessionStore) All() ([]UploadSession, error) {
+	sessions, err := s.store.All()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []UploadSession{}
+	for _, session := range sessions {
+		if session.Job == s.job {
+			result = append(result, session)
+		}
+	}
+
+	return result, nil
+}
+
+// sessionKey produces the key used to identify a session for the given object.
+func sessionKey(bucket, object string) string {
+	return bucket + "/" + object
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SeerUK/assert"
+)
+
+func TestFileSessionStore(t *testing.T) {
+	t.Run("should persist sessions between instances", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-sessions")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "sessions.json")
+
+		err = NewFileSessionStore(path).Put(UploadSession{
+			URI:    "https://example.com/session",
+			Bucket: "test-bucket",
+			Object: "test-object",
+		})
+
+		assert.OK(t, err)
+
+		session, ok, err := NewFileSessionStore(path).Get("test-bucket", "test-object")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected session to be found")
+		assert.Equal(t, "https://example.com/session", session.URI)
+
+		sessions, err := NewFileSessionStore(path).All()
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(sessions))
+	})
+
+	t.Run("should remove the file when the last session is deleted", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-sessions")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "sessions.json")
+		store := NewFileSessionStore(path)
+
+		assert.OK(t, store.Put(UploadSession{Bucket: "test-bucket", Object: "test-object"}))
+		assert.OK(t, store.Delete("test-bucket", "test-object"))
+
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err), "Expected session file to be removed")
+
+		_, ok, err := store.Get("test-bucket", "test-object")
+		assert.OK(t, err)
+		assert.False(t, ok, "Expected session not to be found")
+	})
+
+	t.Run("should error if the session file is corrupt", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "foldup-sessions")
+		assert.OK(t, err)
+
+		defer os.Remove(file.Name())
+
+		file.WriteString("not json")
+		file.Close()
+
+		_, _, err = NewFileSessionStore(file.Name()).Get("test-bucket", "test-object")
+		assert.NotOK(t, err)
+	})
+}
+
+func TestJobSessionStore(t *testing.T) {
+	t.Run("should only see the sessions started by its own job", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "foldup-sessions")
+		assert.OK(t, err)
+
+		defer os.RemoveAll(dir)
+
+		shared := NewFileSessionStore(filepath.Join(dir, "sessions.json"))
+
+		first := NewJobSessionStore(shared, "first")
+		second := NewJobSessionStore(shared, "second")
+
+		assert.OK(t, first.Put(UploadSession{Bucket: "test-bucket", Object: "first-object"}))
+		assert.OK(t, second.Put(UploadSession{Bucket: "test-bucket", Object: "second-object"}))
+
+		sessions, err := first.All()
+		assert.OK(t, err)
+		assert.Equal(t, 1, len(sessions))
+		assert.Equal(t, "first-object", sessions[0].Object)
+		assert.Equal(t, "first", sessions[0].Job)
+
+		_, ok, err := first.Get("test-bucket", "second-object")
+		assert.OK(t, err)
+		assert.False(t, ok, "Expected another job's session not to be found")
+
+		// Deleting another job's session does nothing.
+		assert.OK(t, first.Delete("test-bucket", "second-object"))
+
+		_, ok, err = second.Get("test-bucket", "second-object")
+		assert.OK(t, err)
+		assert.True(t, ok, "Expected session to be kept")
+
+		all, err := shared.All()
+		assert.OK(t, err)
+		assert.Equal(t, 2, len(all))
+	})
+}